@@ -0,0 +1,358 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// NOTE: aggregate.go groups the objects of a frame by one or more
+// dotpaths and summarizes each group, the result is a new in memory
+// DataFrame with one object per group.
+//
+
+const (
+	// AggCount counts the objects in a group, with a dotpath it counts the non-null values
+	AggCount = "count"
+	// AggSum adds up the numeric values
+	AggSum = "sum"
+	// AggMin is the smallest value, values compare the way keys sort
+	AggMin = "min"
+	// AggMax is the largest value, values compare the way keys sort
+	AggMax = "max"
+	// AggMean is the average of the numeric values
+	AggMean = "mean"
+	// AggDistinctCount counts the distinct non-null values
+	AggDistinctCount = "distinct-count"
+	// AggCollect gathers the non-null values into an array
+	AggCollect = "collect"
+)
+
+// Aggregation describes a summary calculated for each group
+type Aggregation struct {
+	// Func is the aggregation, e.g. AggCount, AggSum
+	Func string `json:"func"`
+	// DotPath is the source of the values in each object, it is
+	// optional for AggCount
+	DotPath string `json:"dot_path,omitempty"`
+	// Label is the attribute name of the result, it defaults to
+	// the aggregation's expression (e.g. "sum(.x)")
+	Label string `json:"label,omitempty"`
+}
+
+// String returns the aggregation's expression, e.g. "sum(.x)"
+func (a *Aggregation) String() string {
+	if a.DotPath == "" {
+		return a.Func
+	}
+	return fmt.Sprintf("%s(%s)", a.Func, a.DotPath)
+}
+
+// label returns the attribute name of the aggregation's result
+func (a *Aggregation) label() string {
+	if a.Label != "" {
+		return a.Label
+	}
+	return a.String()
+}
+
+// validate checks the aggregation's name and dotpath
+func (a *Aggregation) validate() error {
+	switch a.Func {
+	case AggCount:
+	case AggSum, AggMin, AggMax, AggMean, AggDistinctCount, AggCollect:
+		if a.DotPath == "" {
+			return fmt.Errorf("%s requires a dotpath", a.Func)
+		}
+	default:
+		return fmt.Errorf("unknown aggregation %q", a.Func)
+	}
+	if a.DotPath != "" {
+		return checkPath(a.DotPath)
+	}
+	return nil
+}
+
+// ParseGroupBy splits a comma separated list of dotpaths to group by,
+// e.g. ".year,.type"
+func ParseGroupBy(src string) []string {
+	return splitList(src)
+}
+
+// ParseAggregations parses a comma separated list of aggregations,
+// e.g. "count,sum(.amount)=total,collect(.title)". A label may
+// follow an equal sign.
+func ParseAggregations(src string) ([]*Aggregation, error) {
+	aggregations := []*Aggregation{}
+	for _, expr := range splitList(src) {
+		a := new(Aggregation)
+		spec := expr
+		if i := strings.LastIndex(spec, ")="); i >= 0 {
+			spec, a.Label = spec[0:i+1], strings.TrimSpace(spec[i+2:])
+		} else if strings.Contains(spec, "(") == false && strings.Contains(spec, "=") {
+			parts := strings.SplitN(spec, "=", 2)
+			spec, a.Label = parts[0], strings.TrimSpace(parts[1])
+		}
+		spec = strings.TrimSpace(spec)
+		if i := strings.Index(spec, "("); i >= 0 {
+			if strings.HasSuffix(spec, ")") == false {
+				return nil, fmt.Errorf("missing closing parenthesis in %q", expr)
+			}
+			a.Func, a.DotPath = strings.TrimSpace(spec[0:i]), strings.TrimSpace(spec[i+1:len(spec)-1])
+		} else {
+			a.Func = spec
+		}
+		a.Func = strings.ToLower(a.Func)
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+		aggregations = append(aggregations, a)
+	}
+	return aggregations, nil
+}
+
+// groupPath returns the dotpath and label of a group. A frame label
+// (e.g. "year") is treated as the dotpath ".year".
+func groupPath(p string) (string, string) {
+	switch {
+	case strings.HasPrefix(p, JMESPrefix):
+		return p, strings.TrimPrefix(p, JMESPrefix)
+	case strings.HasPrefix(p, "."):
+		return p, strings.TrimPrefix(p, ".")
+	}
+	return "." + p, p
+}
+
+// aggregateNumber returns a numeric value as an exact rational,
+// json.Number is parsed from its source text so no precision is lost.
+// Floats are parsed from their shortest decimal form so 0.1 is 1/10.
+func aggregateNumber(value interface{}) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(v.String())
+	case float64:
+		return new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	case float32:
+		return new(big.Rat).SetString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	}
+	return nil, false
+}
+
+// ratToNumber renders a rational as a json.Number, integers are exact
+func ratToNumber(r *big.Rat) json.Number {
+	if r.IsInt() {
+		return json.Number(r.Num().String())
+	}
+	f, _ := r.Float64()
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// aggregateValue calculates an aggregation over a group's objects
+func aggregateValue(a *Aggregation, objects []map[string]interface{}) (interface{}, error) {
+	if a.Func == AggCount && a.DotPath == "" {
+		return len(objects), nil
+	}
+	values := []interface{}{}
+	for _, obj := range objects {
+		value, err := evalPath(a.DotPath, obj)
+		if err != nil || value == nil {
+			continue
+		}
+		values = append(values, value)
+	}
+	switch a.Func {
+	case AggCount:
+		return len(values), nil
+	case AggCollect:
+		return values, nil
+	case AggDistinctCount:
+		seen := map[string]bool{}
+		for _, value := range values {
+			src, err := json.Marshal(normalizeQueryValue(value))
+			if err != nil {
+				return nil, err
+			}
+			seen[string(src)] = true
+		}
+		return len(seen), nil
+	case AggMin, AggMax:
+		var (
+			result interface{}
+			best   sortValue
+		)
+		for i, value := range values {
+			sv := newSortValue(value)
+			cmp := compareSortValues(sv, best, nil)
+			if i == 0 || (a.Func == AggMin && cmp < 0) || (a.Func == AggMax && cmp > 0) {
+				result, best = value, sv
+			}
+		}
+		return result, nil
+	case AggSum, AggMean:
+		sum, cnt := new(big.Rat), 0
+		for _, value := range values {
+			if n, ok := aggregateNumber(value); ok {
+				sum.Add(sum, n)
+				cnt++
+			}
+		}
+		if a.Func == AggSum {
+			return ratToNumber(sum), nil
+		}
+		if cnt == 0 {
+			return nil, nil
+		}
+		return ratToNumber(sum.Quo(sum, new(big.Rat).SetInt64(int64(cnt)))), nil
+	}
+	return nil, fmt.Errorf("unknown aggregation %q", a.Func)
+}
+
+// GroupBy groups the frame's objects by the values found at the
+// dotpaths (or frame labels) in groupBy and calculates the aggregations
+// for each group. The result is a new DataFrame, it isn't saved with
+// the collection. Its objects hold the group values followed by the
+// aggregations and are ordered by the group values. Without groupBy
+// the whole frame is a single group.
+func (f *DataFrame) GroupBy(groupBy []string, aggregations []*Aggregation) (*DataFrame, error) {
+	dotPaths, labels := []string{}, []string{}
+	for _, p := range groupBy {
+		dotPath, label := groupPath(p)
+		if err := checkPath(dotPath); err != nil {
+			return nil, err
+		}
+		dotPaths = append(dotPaths, dotPath)
+		labels = append(labels, label)
+	}
+	for _, a := range aggregations {
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+		dotPaths = append(dotPaths, a.String())
+		labels = append(labels, a.label())
+	}
+
+	type group struct {
+		values  []interface{}
+		objects []map[string]interface{}
+	}
+	groups := map[string]*group{}
+	for _, obj := range f.Objects() {
+		values := make([]interface{}, len(groupBy))
+		for i := range groupBy {
+			if value, err := evalPath(dotPaths[i], obj); err == nil {
+				values[i] = value
+			}
+		}
+		src, err := json.Marshal(normalizeQueryValue(values))
+		if err != nil {
+			return nil, err
+		}
+		key := string(src)
+		g, ok := groups[key]
+		if ok == false {
+			g = &group{values: values}
+			groups[key] = g
+		}
+		g.objects = append(g.objects, obj)
+	}
+
+	keys := []string{}
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := groups[keys[i]].values, groups[keys[j]].values
+		for k := range a {
+			if cmp := compareSortValues(newSortValue(a[k]), newSortValue(b[k]), nil); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return keys[i] < keys[j]
+	})
+
+	now := time.Now()
+	result := &DataFrame{
+		Name:           f.Name,
+		CollectionName: f.CollectionName,
+		DotPaths:       dotPaths,
+		Labels:         labels,
+		Keys:           keys,
+		ObjectMap:      map[string]interface{}{},
+		Created:        now,
+		Updated:        now,
+	}
+	for _, key := range keys {
+		g := groups[key]
+		obj := map[string]interface{}{}
+		for i, value := range g.values {
+			obj[labels[i]] = value
+		}
+		for i, a := range aggregations {
+			value, err := aggregateValue(a, g.objects)
+			if err != nil {
+				return nil, err
+			}
+			obj[labels[len(groupBy)+i]] = value
+		}
+		result.ObjectMap[key] = obj
+	}
+	return result, nil
+}
+
+// FrameGroupBy reads a frame and groups its objects, see DataFrame.GroupBy
+func (c *Collection) FrameGroupBy(name string, groupBy []string, aggregations []*Aggregation) (*DataFrame, error) {
+	f, err := c.FrameRead(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.GroupBy(groupBy, aggregations)
+}
+
+// WriteCSV writes the frame's objects as CSV rows in the order of
+// its labels. Strings and numbers are written as is, null as an
+// empty cell and other values as JSON.
+func (f *DataFrame) WriteCSV(out io.Writer, includeHeaderRow bool) error {
+	w := csv.NewWriter(out)
+	for _, row := range f.Grid(includeHeaderRow) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if cell != nil {
+				cells[i] = colToString(cell)
+			}
+		}
+		if err := w.Write(cells); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
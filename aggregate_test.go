@@ -0,0 +1,131 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseAggregations(t *testing.T) {
+	aggregations, err := ParseAggregations("count, sum(.amount)=total,collect(jmes:tags[?starts_with(@, 'a')]),distinct-count(.type)")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	expected := []Aggregation{
+		{Func: AggCount},
+		{Func: AggSum, DotPath: ".amount", Label: "total"},
+		{Func: AggCollect, DotPath: "jmes:tags[?starts_with(@, 'a')]"},
+		{Func: AggDistinctCount, DotPath: ".type"},
+	}
+	if len(aggregations) != len(expected) {
+		t.Fatalf("expected %d aggregations, got %d", len(expected), len(aggregations))
+	}
+	for i, a := range aggregations {
+		if *a != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], a)
+		}
+	}
+	for _, src := range []string{"median(.x)", "sum", "sum(.x", "min(jmes:[?)"} {
+		if _, err := ParseAggregations(src); err == nil {
+			t.Errorf("expected an error for %q", src)
+		}
+	}
+	if groupBy := ParseGroupBy(".year, jmes:join(',', tags)"); len(groupBy) != 2 || groupBy[1] != "jmes:join(',', tags)" {
+		t.Errorf("unexpected group by %q", groupBy)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	cName := path.Join("testdata", "aggregate_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	records := map[string]string{
+		"r1": `{"year": 2019, "type": "article", "amount": 9007199254740993, "title": "A"}`,
+		"r2": `{"year": 2019, "type": "book", "amount": 1, "title": "B"}`,
+		"r3": `{"year": 2020, "type": "article", "amount": 0.1, "title": "C"}`,
+		"r4": `{"year": 2020, "type": "article", "amount": 0.2, "title": "D"}`,
+		"r5": `{"year": 2018, "type": "article", "title": "E"}`,
+	}
+	keys := []string{"r1", "r2", "r3", "r4", "r5"}
+	for _, key := range keys {
+		if err := c.CreateJSON(key, []byte(records[key])); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	if _, err := c.FrameCreate("pubs", keys, []string{".year", ".type", ".amount", ".title"}, []string{"year", "type", "amount", "title"}, false); err != nil {
+		t.Fatalf("%s", err)
+	}
+	aggregations, err := ParseAggregations("count,sum(.amount)=total,mean(.amount),min(.title),max(.title),distinct-count(.type)=types,collect(.title)=titles,count(.amount)")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	f, err := c.FrameGroupBy("pubs", []string{"year"}, aggregations)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	src, err := json.Marshal(f.Objects())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	// Groups are ordered by year, sums are exact beyond float64's
+	// precision and missing values are skipped.
+	expected := `[{"count":1,"count(.amount)":0,"max(.title)":"E","mean(.amount)":null,"min(.title)":"E","titles":["E"],"total":0,"types":1,"year":2018},` +
+		`{"count":2,"count(.amount)":2,"max(.title)":"B","mean(.amount)":4503599627370497,"min(.title)":"A","titles":["A","B"],"total":9007199254740994,"types":2,"year":2019},` +
+		`{"count":2,"count(.amount)":2,"max(.title)":"D","mean(.amount)":0.15,"min(.title)":"C","titles":["C","D"],"total":0.3,"types":1,"year":2020}]`
+	if string(src) != expected {
+		t.Errorf("expected %s\ngot %s", expected, src)
+	}
+	if len(f.Labels) != 9 || f.Labels[0] != "year" || f.Labels[2] != "total" {
+		t.Errorf("unexpected labels %q", f.Labels)
+	}
+
+	// Several groups, a single group and CSV output
+	f, err = c.FrameGroupBy("pubs", []string{".year", ".type"}, []*Aggregation{{Func: AggCount}})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := f.WriteCSV(buf, true); err != nil {
+		t.Fatalf("%s", err)
+	}
+	expectedCSV := "year,type,count\n2018,article,1\n2019,article,1\n2019,book,1\n2020,article,2\n"
+	if buf.String() != expectedCSV {
+		t.Errorf("expected %q, got %q", expectedCSV, buf.String())
+	}
+	f, err = c.FrameGroupBy("pubs", nil, []*Aggregation{{Func: AggCount}})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if objects := f.Objects(); len(objects) != 1 || objects[0]["count"] != 5 {
+		t.Errorf("expected a single group of 5, got %+v", objects)
+	}
+	if _, err := c.FrameGroupBy("missing", nil, nil); err == nil {
+		t.Errorf("expected an error for a missing frame")
+	}
+}
@@ -81,7 +81,7 @@ func (c *Collection) attachmentNames(keyName, semver, fName string) (string, str
 		attachmentMetadata string
 	)
 	if c.KeyExists(keyName) == false {
-		return "", "", fmt.Errorf("No key found for %q", keyName)
+		return "", "", c.errKeyNotFound(keyName)
 	}
 	return attachmentFile, attachmentMetadata, nil
 }
@@ -172,7 +172,7 @@ func updateAttachmentList(attachmentList []*Attachment, newObj *Attachment) []*A
 // AttachStream is for attaching open a non-JSON file buffer (via an io.Reader).
 func (c *Collection) AttachStream(keyName, semver, fullName string, buf io.Reader) error {
 	if c.KeyExists(keyName) == false {
-		return fmt.Errorf("No key found for %q", keyName)
+		return c.errKeyNotFound(keyName)
 	}
 	if semver == "" {
 		// We use version v0.0.0 for "unversioned" attachments.
@@ -263,7 +263,7 @@ func (c *Collection) AttachStream(keyName, semver, fullName string, buf io.Reade
 // ANY existing attached content with the same semver and basename.
 func (c *Collection) AttachFile(keyName, semver string, fullName string) error {
 	if c.KeyExists(keyName) == false {
-		return fmt.Errorf("No key found for %q", keyName)
+		return c.errKeyNotFound(keyName)
 	}
 	if semver == "" {
 		// We use version v0.0.0 for "unversioned" attachments.
@@ -399,7 +399,7 @@ func filterNameFound(a []string, target string) bool {
 // An error value is always returned.
 func (c *Collection) GetAttachedFiles(keyName string, semver string, filterNames ...string) error {
 	if c.KeyExists(keyName) == false {
-		return fmt.Errorf("No key found for %q", keyName)
+		return c.errKeyNotFound(keyName)
 	}
 	jsonObject := map[string]interface{}{}
 	if err := c.Read(keyName, jsonObject, false); err != nil {
@@ -435,7 +435,7 @@ func (c *Collection) GetAttachedFiles(keyName string, semver string, filterNames
 // Prune a non-JSON document from a JSON document in the collection.
 func (c *Collection) Prune(keyName string, semver string, filterNames ...string) error {
 	if c.KeyExists(keyName) == false {
-		return fmt.Errorf("No key found for %q", keyName)
+		return c.errKeyNotFound(keyName)
 	}
 	jsonObject := map[string]interface{}{}
 	if err := c.Read(keyName, jsonObject, false); err != nil {
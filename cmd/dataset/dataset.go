@@ -20,8 +20,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -29,6 +31,7 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"time"
@@ -163,9 +166,24 @@ THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
 	syncOverwrite     bool
 	batchSize         int
 	sampleSize        int
+	workers           int
 	keyFName          string
 	filterExpr        string
 	sortExpr          string
+	templateFilter    bool
+	sortLocale        string
+	sortFoldCase      bool
+	sortNulls         string
+	lockTimeout       int
+	expectedRevision  string
+	revisionFName     string
+	removeValue       bool
+	joinConflict      string
+	joinArrays        string
+	joinUnionKey      string
+
+	// appCtx is cancelled by Ctrl-C so long running verbs stop cleanly
+	appCtx = context.Background()
 
 	// Search specific options, application Options
 	showHighlight  bool
@@ -179,8 +197,26 @@ THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
 	size           int
 	from           int
 	explain        bool // Note: will be force results to be in JSON format
+	facets         string
+	facetSize      int
+	storeFields    string
+	fieldBoosts    string
 	setValue       bool // Note: set a collection level metadata value
 
+	// Frame paging options
+	pageOffset int
+	pageLimit  int
+
+	// Live frame options
+	liveMode string
+
+	// Frame column type options
+	frameTypes string
+
+	// Aggregate specific options
+	groupByPaths    string
+	aggregationExpr string
+
 	// Application Verbs
 	vInit         *cli.Verb // init
 	vStatus       *cli.Verb // status
@@ -211,6 +247,9 @@ THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
 	vFrames       *cli.Verb // frames
 	vRefresh      *cli.Verb // refresh
 	vReframe      *cli.Verb // reframe
+	vRegenerate   *cli.Verb // regenerate
+	vFrameLive    *cli.Verb // frame-live
+	vFrameTypes   *cli.Verb // frame-types
 	vFrameDelete  *cli.Verb // delete-frame
 	vSyncSend     *cli.Verb // sync-send
 	vSyncRecieve  *cli.Verb // sync-recieve
@@ -220,9 +259,51 @@ THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
 	vWhere        *cli.Verb // where
 	vVersion      *cli.Verb // version of collection (semvar)
 	vContact      *cli.Verb // contact info for collection
+	vKeepRevs     *cli.Verb // keep-revisions
+	vSchema       *cli.Verb // schema
+	vValidate     *cli.Verb // validate
+	vHistory      *cli.Verb // history
+	vRestore      *cli.Verb // restore
+	vUndelete     *cli.Verb // undelete
+	vRevToken     *cli.Verb // revision-token
+	vPatch        *cli.Verb // patch
+	vTrash        *cli.Verb // trash
+	vEmptyTrash   *cli.Verb // empty-trash
+	vIndexCreate  *cli.Verb // index-create
+	vIndexDrop    *cli.Verb // index-drop
+	vIndexRebuild *cli.Verb // index-rebuild
+	vIndexFrame   *cli.Verb // index
+	vSearch       *cli.Verb // search
+	vLunrIndex    *cli.Verb // lunr-index
+	vAggregate    *cli.Verb // aggregate
 
 )
 
+// splitPathLabel splits a "DOTPATH=LABEL" pair, without a label the
+// dotpath is used. A JMESPath expression compares with "==" and a
+// computed column may hold "=" in a string so their label follows the
+// last lone "=".
+func splitPathLabel(item string) (string, string) {
+	item = strings.TrimSpace(item)
+	if strings.HasPrefix(item, dataset.JMESPrefix) || strings.Contains(item, "(") || strings.Contains(item, "{{") {
+		for i := len(item) - 1; i > 0; i-- {
+			if item[i] != '=' {
+				continue
+			}
+			if (i+1 < len(item) && item[i+1] == '=') || strings.ContainsRune("=!<>", rune(item[i-1])) {
+				continue
+			}
+			return strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		return item, strings.TrimPrefix(item, dataset.JMESPrefix)
+	}
+	if strings.Contains(item, "=") == true {
+		kp := strings.SplitN(item, "=", 2)
+		return strings.TrimSpace(kp[0]), strings.TrimSpace(kp[1])
+	}
+	return item, strings.TrimPrefix(item, ".")
+}
+
 // keysFromSrc takes a byte splice, splits them on "\n" and converts any
 // non-empty line string appended to the keys slice
 func keysFromSrc(src []byte) []string {
@@ -502,6 +583,158 @@ func fnContact(in io.Reader, out io.Writer, eout io.Writer, args []string, flagS
 	return 0
 }
 
+// fnKeepRevisions - given a collection path, turn on (or off) keeping object revisions
+func fnKeepRevisions(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		err error
+	)
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(eout, "expected a collection name and/or true or false\n")
+		return 1
+	}
+	cName := args[0]
+	if setValue {
+		keep := true
+		if len(args) > 1 {
+			keep, err = strconv.ParseBool(args[1])
+			if err != nil {
+				fmt.Fprintf(eout, "expected true or false, %s\n", err)
+				return 1
+			}
+		}
+		err = dataset.SetKeepRevisions(cName, keep)
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+	} else {
+		fmt.Fprintf(out, "%t", dataset.GetKeepRevisions(cName))
+	}
+	return 0
+}
+
+// fnSchema - show, set or remove the JSON Schema for a collection
+func fnSchema(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		src []byte
+		err error
+	)
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(eout, "expected a collection name and/or JSON Schema filename\n")
+		return 1
+	}
+	c, err := dataset.GetCollection(args[0])
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+	switch {
+	case removeValue:
+		err = c.RemoveSchema()
+	case setValue:
+		if len(args) > 1 {
+			src, err = ioutil.ReadFile(args[1])
+		} else {
+			src, err = ioutil.ReadAll(in)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "failed to read JSON Schema, %s\n", err)
+			return 1
+		}
+		err = c.SetSchema(src)
+	default:
+		src, err = c.Schema()
+		if err == nil {
+			fmt.Fprintf(out, "%s", bytes.TrimSpace(src))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// fnValidate - report the objects in a collection that fail its JSON Schema
+func fnValidate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		keys []string
+		src  []byte
+		err  error
+	)
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(eout, "Missing collection name\n")
+		return 1
+	}
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = keysFromSrc(src)
+	}
+	keys = append(keys, args[1:]...)
+	c, err := dataset.GetCollection(args[0])
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+	failed, err := c.Validate(keys)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if jsonFormat {
+		if prettyPrint {
+			src, err = json.MarshalIndent(failed, "", "    ")
+		} else {
+			src, err = json.Marshal(failed)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "%s", src)
+	} else {
+		lines := []string{}
+		for _, vErr := range failed {
+			for _, fErr := range vErr.Errors {
+				lines = append(lines, fmt.Sprintf("%s: %s", vErr.Key, fErr))
+			}
+		}
+		fmt.Fprintf(out, "%s", strings.Join(lines, "\n"))
+	}
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
 // fnStatus - given a path see if it is a collection by attempting to "open" it
 func fnStatus(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
@@ -604,18 +837,13 @@ func fnCreate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 		fmt.Fprintf(eout, "%s must be a valid JSON Object, %s", key, err)
 		return 1
 	}
-	if dataset.KeyExists(cName, key) == true && overwrite == true {
+	err = dataset.CreateJSON(cName, key, src)
+	if errors.Is(err, dataset.ErrKeyExists) && overwrite == true {
 		if err := dataset.UpdateJSON(cName, key, src); err != nil {
 			fmt.Fprintf(eout, "failed to update %q in %s, %s\n", key, cName, err)
 			return 1
 		}
-		if quiet == false {
-			fmt.Fprintf(out, "OK")
-		}
-		return 0
-	}
-
-	if err := dataset.CreateJSON(cName, key, src); err != nil {
+	} else if err != nil {
 		fmt.Fprintf(eout, "failed to create %q in %s, %s\n", key, cName, err)
 		return 1
 	}
@@ -673,12 +901,23 @@ func fnRead(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 		return 1
 	}
 	defer c.Close()
+	if revisionFName != "" && len(keys) != 1 {
+		fmt.Fprintf(eout, "-revision-file requires a single key\n")
+		return 1
+	}
 	if len(keys) == 1 {
 		m := map[string]interface{}{}
-		if err := c.Read(keys[0], m, cleanObject); err != nil {
+		token, err := c.ReadWithRevision(keys[0], m, cleanObject)
+		if err != nil {
 			fmt.Fprintf(eout, "%s, %s\n", keys[0], err)
 			return 1
 		}
+		if revisionFName != "" {
+			if err := ioutil.WriteFile(revisionFName, []byte(token), 0664); err != nil {
+				fmt.Fprintf(eout, "%s\n", err)
+				return 1
+			}
+		}
 		if prettyPrint {
 			src, err = json.MarshalIndent(m, "", "    ")
 		} else {
@@ -783,7 +1022,7 @@ func fnUpdate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 		fmt.Fprintf(eout, "%s must be a valid JSON Object, %s", key, err)
 		return 1
 	}
-	if err := c.Update(key, m); err != nil {
+	if err := c.UpdateIfRevision(key, m, expectedRevision); err != nil {
 		fmt.Fprintf(eout, "failed to update %s in %s, %s\n", key, cName, err)
 		return 1
 	}
@@ -793,73 +1032,36 @@ func fnUpdate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 	return 0
 }
 
-// fnDelete - remove a JSON document from a collection
-func fnDelete(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
-	var (
-		cName string
-		keys  []string
-		src   []byte
-		err   error
-	)
-
-	err = flagSet.Parse(args)
+// fnRevisionToken - return the revision token of a JSON document
+func fnRevisionToken(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		keys = keysFromSrc(src)
-	}
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
-		return 1
-	case len(args) == 1:
-		if len(keys) == 0 {
-			fmt.Fprintf(eout, "Missing key(s)\n")
-			return 1
-		}
-		cName = args[0]
-	case len(args) >= 2:
-		cName, keys = args[0], args[1:]
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+	if len(args) != 2 {
+		fmt.Fprintf(eout, "Expected collection name and key\n")
 		return 1
 	}
+	cName, key := args[0], args[1]
 	c, err := dataset.GetCollection(cName)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	for _, key := range keys {
-		err := c.Delete(key)
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-	}
-	if quiet == false {
-		fmt.Fprintf(out, "OK")
+	token, err := c.RevisionToken(key)
+	if err != nil {
+		fmt.Fprintf(eout, "%s, %s\n", key, err)
+		return 1
 	}
+	fmt.Fprintf(out, "%s", token)
 	return 0
 }
 
-// fnJoin - joins a JSON object in the collection with a new JSON object appending
-// new attributes and optionally overwriting existing attribute in common.
-func fnJoin(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnPatch - apply a JSON Patch or JSON Merge Patch to a JSON document
+func fnPatch(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
 		cName string
 		key   string
@@ -876,15 +1078,15 @@ func fnJoin(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 
 	switch len(args) {
 	case 0:
-		fmt.Fprintf(eout, "Missing collection name, key and JSON source\n")
+		fmt.Fprintf(eout, "Missing collection name, key and patch source\n")
 		return 1
 	case 1:
-		fmt.Fprintf(eout, "Missing key and JSON source\n")
+		fmt.Fprintf(eout, "Missing key and patch source\n")
 		return 1
 	case 2:
 		cName, key = args[0], args[1]
 		if inputFName == "" {
-			fmt.Fprintf(eout, "Missing JSON source\n")
+			fmt.Fprintf(eout, "Missing patch source\n")
 			return 1
 		}
 		if inputFName == "-" {
@@ -897,13 +1099,13 @@ func fnJoin(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 			return 1
 		}
 	case 3:
-		if strings.HasPrefix(args[2], "{") && strings.HasSuffix(args[2], "}") {
-			cName, key, src = args[0], args[1], []byte(args[2])
+		cName, key = args[0], args[1]
+		if strings.HasPrefix(args[2], "{") || strings.HasPrefix(args[2], "[") {
+			src = []byte(args[2])
 		} else {
-			cName, key = args[0], args[1]
 			src, err = ioutil.ReadFile(args[2])
 			if err != nil {
-				fmt.Fprintf(eout, "%s", err)
+				fmt.Fprintf(eout, "%s\n", err)
 				return 1
 			}
 		}
@@ -920,38 +1122,23 @@ func fnJoin(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 		return 1
 	}
 	defer c.Close()
-	// unmarshal new object
-	newObj := map[string]interface{}{}
-	if err := json.Unmarshal(src, &newObj); err != nil {
-		fmt.Fprintf(eout, "%s must be a valid JSON Object, %s", key, err)
-		return 1
-	}
-	// Join the object
-	err = c.Join(key, newObj, overwrite)
-	if err != nil {
+	if err := c.Patch(key, src); err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-
 	if quiet == false {
 		fmt.Fprint(out, "OK")
 	}
 	return 0
 }
 
-// fnKeys returns the keys in a collection
-// If a 'filter expression' is provided it will return a filtered list of keys.
-// Filters with like Go's text/template if statement where the 'filter expression' is
-// the condititional expression in a if/else statement. If the expression evaluates to "true"
-// then the key is included in the list of keys If the expression evaluates to "false" then
-// it is excluded for the list of keys.
-// If a 'sort expression' is provided then the resulting keys are ordered by that expression.
-func fnKeys(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnDelete - remove a JSON document from a collection
+func fnDelete(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
 		cName string
 		keys  []string
-		err   error
 		src   []byte
+		err   error
 	)
 
 	err = flagSet.Parse(args)
@@ -961,23 +1148,34 @@ func fnKeys(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 	}
 	args = flagSet.Args()
 
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = keysFromSrc(src)
+	}
 	switch {
 	case len(args) == 0:
 		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
 		return 1
 	case len(args) == 1:
+		if len(keys) == 0 {
+			fmt.Fprintf(eout, "Missing key(s)\n")
+			return 1
+		}
 		cName = args[0]
-	case len(args) == 2:
-		cName, filterExpr = args[0], args[1]
-	case len(args) == 3:
-		cName, filterExpr, sortExpr = args[0], args[1], args[2]
-	case len(args) > 3:
-		cName, filterExpr, sortExpr, keys = args[0], args[1], args[2], args[3:]
+	case len(args) >= 2:
+		cName, keys = args[0], args[1:]
 	default:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-
 	c, err := dataset.GetCollection(cName)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
@@ -985,64 +1183,26 @@ func fnKeys(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 	}
 	defer c.Close()
 
-	// If we don't have a sub selection of keys, get a complete list of keys
-	if len(keys) == 0 {
-		keys = c.Keys()
-	}
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
+	for _, key := range keys {
+		err := c.Delete(key)
 		if err != nil {
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		keys = keysFromSrc(src)
-	}
-
-	// Apply Filter Expression
-	if len(filterExpr) > 0 && filterExpr != "true" {
-		keys, err = c.KeyFilter(keys[:], filterExpr)
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-	}
-
-	// Apply Sample Size
-	if sampleSize > 0 {
-		random := rand.New(rand.NewSource(time.Now().UnixNano()))
-		shuffle.Strings(keys, random)
-		if sampleSize <= len(keys) {
-			keys = keys[0:sampleSize]
-		}
-	}
-
-	// If now sort we're done
-	if len(sortExpr) == 0 {
-		fmt.Fprintf(out, "%s", strings.Join(keys, "\n"))
-		return 0
 	}
-
-	// We still have sorting to do.
-	keys, err = c.KeySortByExpression(keys, sortExpr)
-	if err != nil {
-		fmt.Fprintf(eout, "%s\n", err)
-		return 1
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
 	}
-	fmt.Fprintf(out, strings.Join(keys, "\n"))
 	return 0
 }
 
-// fnHasKey - check if a key to an object exists in a collection optionally matching keys and a filter expression
-func fnHasKey(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnUndelete - bring JSON document(s) back from a collection's trash
+func fnUndelete(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
 		cName string
 		keys  []string
-		err   error
 		src   []byte
+		err   error
 	)
 
 	err = flagSet.Parse(args)
@@ -1052,25 +1212,6 @@ func fnHasKey(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 	}
 	args = flagSet.Args()
 
-	// Process positional parameters
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
-		return 1
-	case len(args) == 1:
-		cName = args[0]
-		if len(keys) == 0 {
-			fmt.Fprintf(eout, "Missing key(s)\n")
-			return 1
-		}
-	case len(args) >= 2:
-		cName, keys = args[0], args[1:]
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
-		return 1
-	}
-
-	// Read in any key list from a file.
 	if len(inputFName) > 0 {
 		if inputFName == "-" {
 			src, err = ioutil.ReadAll(in)
@@ -1081,9 +1222,21 @@ func fnHasKey(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		keys = append(keys, keysFromSrc(src)...)
+		keys = keysFromSrc(src)
+	}
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
+		return 1
+	case len(args) == 1:
+		if len(keys) == 0 {
+			fmt.Fprintf(eout, "Missing key(s)\n")
+			return 1
+		}
+		cName = args[0]
+	default:
+		cName, keys = args[0], args[1:]
 	}
-
 	c, err := dataset.GetCollection(cName)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
@@ -1091,167 +1244,110 @@ func fnHasKey(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 	}
 	defer c.Close()
 
-	for i, key := range keys {
-		if i > 0 {
-			fmt.Fprintf(out, "\n")
-		}
-		if c.KeyExists(key) {
-			fmt.Fprintf(out, "true")
-		} else {
-			fmt.Fprintf(out, "false")
+	for _, key := range keys {
+		if err := c.Undelete(key); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
 		}
 	}
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
+	}
 	return 0
 }
 
-// fnCount - count objects in a collection, optionally matching keys and a filter expression
-func fnCount(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnTrash - list the JSON documents in a collection's trash
+func fnTrash(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName string
-		keys  []string
-		err   error
-		src   []byte
+		src []byte
+		err error
 	)
-
 	err = flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
-		return 1
-	case len(args) == 1:
-		cName = args[0]
-	case len(args) == 2:
-		cName, filterExpr = args[0], args[1]
-	case len(args) > 2:
-		cName, filterExpr, keys = args[0], args[1], args[2:]
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+	if len(args) != 1 {
+		fmt.Fprintf(eout, "Expected a collection name\n")
 		return 1
 	}
-
-	// Read keys from inputFName
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		keys = append(keys, keysFromSrc(src)...)
-	}
-
-	c, err := dataset.GetCollection(cName)
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	// If we don't have a sub selection of keys, get a list of keys
-	if len(keys) == 0 {
-		keys = c.Keys()
+	entries, err := c.Trash()
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
 	}
-
-	// Process the filter against the keys if necessary
-	if len(filterExpr) > 0 && filterExpr != "true" {
-		keys, err = c.KeyFilter(keys[:], filterExpr)
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
+	if prettyPrint {
+		src, err = json.MarshalIndent(entries, "", "    ")
+	} else {
+		src, err = json.Marshal(entries)
 	}
-	fmt.Fprintf(out, "%d", len(keys))
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s", src)
 	return 0
 }
 
-// fnPath - return a path(s) to an object(s) given a key(s)
-func fnPath(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnEmptyTrash - permanently remove JSON documents from a collection's
+// trash, optionally only those deleted longer ago than a duration
+func fnEmptyTrash(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName   string
-		keys    []string
-		src     []byte
-		docPath string
-		err     error
+		olderThan time.Duration
+		err       error
 	)
-
 	err = flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(eout, "Missing collection name\n")
 		return 1
-	case len(args) == 1:
-		if len(keys) == 0 {
-			fmt.Fprintf(eout, "Missing key(s)\n")
+	case 1:
+	case 2:
+		olderThan, err = time.ParseDuration(args[1])
+		if err != nil {
+			fmt.Fprintf(eout, "Expected a duration (e.g. 720h), %s\n", err)
 			return 1
 		}
-		cName = args[0]
-	case len(args) >= 2:
-		cName, keys = args[0], args[1:]
 	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		fmt.Fprintf(eout, "Too many parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-
-	// Read keys from inputFName
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		keys = append(keys, keysFromSrc(src)...)
-	}
-
-	c, err := dataset.GetCollection(cName)
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	errCnt := 0
-	for i, key := range keys {
-		if i > 0 {
-			fmt.Fprintf(out, "\n")
-		}
-		docPath, err = c.DocPath(key)
-		if err != nil {
-			fmt.Fprintf(eout, "key %q, %s\n", key, err)
-			errCnt++
-		} else {
-			fmt.Fprintf(out, "%s", docPath)
-		}
+	keys, err := c.EmptyTrash(olderThan)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
 	}
-	return errCnt
+	fmt.Fprintf(out, "%s", strings.Join(keys, "\n"))
+	return 0
 }
 
-// fnAttach - attach a file(s) to an object
-func fnAttach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnJoin - recursively joins a JSON object in the collection with a new JSON
+// object appending new attributes and optionally overwriting existing
+// attribute in common.
+func fnJoin(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName  string
-		key    string
-		src    []byte
-		fNames []string
-		err    error
+		cName string
+		key   string
+		src   []byte
+		err   error
 	)
 
 	err = flagSet.Parse(args)
@@ -1261,37 +1357,19 @@ func fnAttach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 	}
 	args = flagSet.Args()
 
-	semver := "v0.0.0"
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key, semver and attachment name(s)\n")
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(eout, "Missing collection name, key and JSON source\n")
 		return 1
-	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing key, semver and attachment name(s)\n")
+	case 1:
+		fmt.Fprintf(eout, "Missing key and JSON source\n")
 		return 1
-	case len(args) == 2:
-		if len(fNames) == 0 {
-			fmt.Fprintf(eout, "Missing attachment name(s)\n")
-			return 1
-		}
+	case 2:
 		cName, key = args[0], args[1]
-	case len(args) == 3:
-		cName, key, fNames = args[0], args[1], args[2:]
-	case len(args) > 3:
-		//Is args[2] a semver or a filename?
-		if val, err := dataset.ParseSemver([]byte(args[2])); err == nil {
-			semver = val.String()
-			cName, key, fNames = args[0], args[1], args[3:]
-		} else {
-			cName, key, fNames = args[0], args[1], args[2:]
+		if inputFName == "" {
+			fmt.Fprintf(eout, "Missing JSON source\n")
+			return 1
 		}
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
-		return 1
-	}
-
-	// Read filenames from inputFName
-	if len(inputFName) > 0 {
 		if inputFName == "-" {
 			src, err = ioutil.ReadAll(in)
 		} else {
@@ -1301,113 +1379,173 @@ func fnAttach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		fNames = append(fNames, keysFromSrc(src)...)
+	case 3:
+		if strings.HasPrefix(args[2], "{") && strings.HasSuffix(args[2], "}") {
+			cName, key, src = args[0], args[1], []byte(args[2])
+		} else {
+			cName, key = args[0], args[1]
+			src, err = ioutil.ReadFile(args[2])
+			if err != nil {
+				fmt.Fprintf(eout, "%s", err)
+				return 1
+			}
+		}
+	default:
+		fmt.Fprintf(eout, "Too many parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+	if strings.HasSuffix(key, ".json") {
+		key = strings.TrimSuffix(key, ".json")
 	}
-
 	c, err := dataset.GetCollection(cName)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	if c.KeyExists(key) == false {
-		fmt.Fprintf(eout, "%q is not in %s\n", key, cName)
+	// unmarshal new object
+	newObj := map[string]interface{}{}
+	if err := json.Unmarshal(src, &newObj); err != nil {
+		fmt.Fprintf(eout, "%s must be a valid JSON Object, %s", key, err)
 		return 1
 	}
-	for _, fname := range fNames {
-		if _, err := os.Stat(fname); os.IsNotExist(err) {
-			fmt.Fprintf(eout, "%s does not exist\n", fname)
-			return 1
+	// Join the object
+	opts := &dataset.JoinOptions{
+		Conflict: joinConflict,
+		Arrays:   joinArrays,
+		UnionKey: joinUnionKey,
+	}
+	if opts.Conflict == "" {
+		opts.Conflict = dataset.JoinKeep
+		if overwrite {
+			opts.Conflict = dataset.JoinOverwrite
 		}
 	}
-	err = c.AttachFiles(key, semver, fNames...)
+	err = c.JoinWithOptions(key, newObj, opts)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+
+	if quiet == false {
+		fmt.Fprint(out, "OK")
+	}
 	return 0
 }
 
-// fnAttachments - list the attachments of an object(s) given a key(s)
-func fnAttachments(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnHistory - list the revisions of an object or return the
+// JSON source of a revision
+func fnHistory(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName       string
-		keys        []string
-		src         []byte
-		attachments []string
-		err         error
+		src []byte
+		rev int
+		err error
 	)
-
 	err = flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(eout, "Missing collection name and key\n")
 		return 1
-	case len(args) == 1:
-		if len(keys) == 0 {
-			fmt.Fprintf(eout, "Missing key(s)\n")
+	case 1:
+		fmt.Fprintf(eout, "Missing key\n")
+		return 1
+	case 2:
+	case 3:
+		rev, err = strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Fprintf(eout, "Revision must be an integer, %s\n", err)
 			return 1
 		}
-		cName = args[0]
-	case len(args) >= 2:
-		cName, keys = args[0], args[1:]
 	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		fmt.Fprintf(eout, "Too many parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-
-	// Read keys from inputFName
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
+	cName, key := args[0], args[1]
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+	if rev > 0 {
+		src, err = c.ReadRevision(key, rev)
 		if err != nil {
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		keys = append(keys, keysFromSrc(src)...)
+		fmt.Fprintf(out, "%s", src)
+		return 0
+	}
+	revisions, err := c.History(key)
+	if err != nil {
+		fmt.Fprintf(eout, "%s, %s\n", key, err)
+		return 1
+	}
+	if prettyPrint {
+		src, err = json.MarshalIndent(revisions, "", "    ")
+	} else {
+		src, err = json.Marshal(revisions)
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
 	}
+	fmt.Fprintf(out, "%s", src)
+	return 0
+}
 
+// fnRestore - make a prior revision the current version of an object
+func fnRestore(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+	if len(args) != 3 {
+		fmt.Fprintf(eout, "Expected collection name, key and revision\n")
+		return 1
+	}
+	cName, key := args[0], args[1]
+	rev, err := strconv.Atoi(args[2])
+	if err != nil {
+		fmt.Fprintf(eout, "Revision must be an integer, %s\n", err)
+		return 1
+	}
 	c, err := dataset.GetCollection(cName)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	errCnt := 0
-	for i, key := range keys {
-		if i > 0 {
-			fmt.Fprintf(out, "\n")
-		}
-		attachments, err = c.Attachments(key)
-		if err != nil {
-			fmt.Fprintf(eout, "key %q, %s\n", key, err)
-			errCnt++
-		} else {
-			fmt.Fprintf(out, "%s", strings.Join(attachments, "\n"))
-		}
+	if err := c.Restore(key, rev); err != nil {
+		fmt.Fprintf(eout, "failed to restore %s in %s, %s\n", key, cName, err)
+		return 1
 	}
-	return errCnt
+	if quiet == false {
+		fmt.Fprint(out, "OK")
+	}
+	return 0
 }
 
-// fnDetach - return a file(s) attached to an object(s) for a given key
-func fnDetach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnKeys returns the keys in a collection
+// If a 'filter expression' is provided it will return a filtered list of keys.
+// Filters with like Go's text/template if statement where the 'filter expression' is
+// the condititional expression in a if/else statement. If the expression evaluates to "true"
+// then the key is included in the list of keys If the expression evaluates to "false" then
+// it is excluded for the list of keys.
+// If a 'sort expression' is provided then the resulting keys are ordered by that expression.
+func fnKeys(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName  string
-		key    string
-		src    []byte
-		fNames []string
-		err    error
+		cName string
+		keys  []string
+		err   error
+		src   []byte
 	)
 
 	err = flagSet.Parse(args)
@@ -1415,34 +1553,40 @@ func fnDetach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+	if workers > 0 {
+		dataset.Workers = workers
+	}
+	dataset.TemplateFilters = templateFilter
 	args = flagSet.Args()
 
-	semver := ""
 	switch {
 	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name and key\n")
+		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
 		return 1
 	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing key\n")
-		return 1
+		cName = args[0]
 	case len(args) == 2:
-		cName, key = args[0], args[1]
+		cName, filterExpr = args[0], args[1]
 	case len(args) == 3:
-		cName, key, fNames = args[0], args[1], args[2:]
+		cName, filterExpr, sortExpr = args[0], args[1], args[2]
 	case len(args) > 3:
-		//Is args[2] a semver or a filename?
-		if val, err := dataset.ParseSemver([]byte(args[2])); err == nil {
-			semver = val.String()
-			cName, key, fNames = args[0], args[1], args[3:]
-		} else {
-			cName, key, fNames = args[0], args[1], args[2:]
-		}
+		cName, filterExpr, sortExpr, keys = args[0], args[1], args[2], args[3:]
 	default:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
 
-	// Read filenames from inputFName
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	// If we don't have a sub selection of keys, get a complete list of keys
+	if len(keys) == 0 {
+		keys = c.Keys()
+	}
 	if len(inputFName) > 0 {
 		if inputFName == "-" {
 			src, err = ioutil.ReadAll(in)
@@ -1453,39 +1597,62 @@ func fnDetach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		fNames = append(fNames, keysFromSrc(src)...)
+		keys = keysFromSrc(src)
 	}
 
-	c, err := dataset.GetCollection(cName)
-	if err != nil {
-		fmt.Fprintf(eout, "%s\n", err)
-		return 1
+	// Apply Filter Expression
+	if len(filterExpr) > 0 && filterExpr != "true" {
+		keys, err = c.KeyFilter(keys[:], filterExpr)
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
 	}
-	defer c.Close()
 
-	if c.KeyExists(key) == false {
-		fmt.Fprintf(eout, "%q is not in %s", key, cName)
+	// Apply Sample Size
+	if sampleSize > 0 {
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		shuffle.Strings(keys, random)
+		if sampleSize <= len(keys) {
+			keys = keys[0:sampleSize]
+		}
+	}
+
+	// If now sort we're done
+	if len(sortExpr) == 0 {
+		fmt.Fprintf(out, "%s", strings.Join(keys, "\n"))
+		return 0
+	}
+
+	// We still have sorting to do.
+	sortOptions := &dataset.SortOptions{
+		Locale:   sortLocale,
+		FoldCase: sortFoldCase,
+	}
+	switch strings.ToLower(sortNulls) {
+	case "first":
+		sortOptions.NullsFirst = true
+	case "", "last":
+	default:
+		fmt.Fprintf(eout, "-nulls must be first or last, got %q\n", sortNulls)
 		return 1
 	}
-	err = c.GetAttachedFiles(key, semver, fNames...)
+	keys, err = c.KeySortByExpressionWithOptions(keys, sortExpr, sortOptions)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-	if quiet == false {
-		fmt.Fprint(out, "OK")
-	}
+	fmt.Fprintf(out, strings.Join(keys, "\n"))
 	return 0
 }
 
-// fnPrune - remove a file(s) attached to an object for a given key
-func fnPrune(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnHasKey - check if a key to an object exists in a collection optionally matching keys and a filter expression
+func fnHasKey(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName  string
-		key    string
-		src    []byte
-		fNames []string
-		err    error
+		cName string
+		keys  []string
+		err   error
+		src   []byte
 	)
 
 	err = flagSet.Parse(args)
@@ -1495,32 +1662,25 @@ func fnPrune(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 	}
 	args = flagSet.Args()
 
-	semver := "v0.0.0"
+	// Process positional parameters
 	switch {
 	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name and key\n")
+		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
 		return 1
 	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing key\n")
-		return 1
-	case len(args) == 2:
-		cName, key = args[0], args[1]
-	case len(args) == 3:
-		cName, key, fNames = args[0], args[1], args[2:]
-	case len(args) >= 3:
-		//Is args[2] a semver or a filename?
-		if val, err := dataset.ParseSemver([]byte(args[2])); err == nil {
-			semver = val.String()
-			cName, key, fNames = args[0], args[1], args[3:]
-		} else {
-			cName, key, fNames = args[0], args[1], args[2:]
+		cName = args[0]
+		if len(keys) == 0 {
+			fmt.Fprintf(eout, "Missing key(s)\n")
+			return 1
 		}
+	case len(args) >= 2:
+		cName, keys = args[0], args[1:]
 	default:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
 
-	// Read filenames from inputFName
+	// Read in any key list from a file.
 	if len(inputFName) > 0 {
 		if inputFName == "-" {
 			src, err = ioutil.ReadAll(in)
@@ -1531,7 +1691,7 @@ func fnPrune(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		fNames = append(fNames, keysFromSrc(src)...)
+		keys = append(keys, keysFromSrc(src)...)
 	}
 
 	c, err := dataset.GetCollection(cName)
@@ -1541,271 +1701,1181 @@ func fnPrune(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 	}
 	defer c.Close()
 
-	if c.KeyExists(key) == false {
-		fmt.Fprintf(eout, "%q is not in %s", key, cName)
-		return 1
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Fprintf(out, "\n")
+		}
+		if c.KeyExists(key) {
+			fmt.Fprintf(out, "true")
+		} else {
+			fmt.Fprintf(out, "false")
+		}
+	}
+	return 0
+}
+
+// fnCount - count objects in a collection, optionally matching keys and a filter expression
+func fnCount(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName string
+		keys  []string
+		err   error
+		src   []byte
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	dataset.TemplateFilters = templateFilter
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
+		return 1
+	case len(args) == 1:
+		cName = args[0]
+	case len(args) == 2:
+		cName, filterExpr = args[0], args[1]
+	case len(args) > 2:
+		cName, filterExpr, keys = args[0], args[1], args[2:]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	// Read keys from inputFName
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = append(keys, keysFromSrc(src)...)
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	// If we don't have a sub selection of keys, get a list of keys
+	if len(keys) == 0 {
+		keys = c.Keys()
+	}
+
+	// Process the filter against the keys if necessary
+	if len(filterExpr) > 0 && filterExpr != "true" {
+		keys, err = c.KeyFilter(keys[:], filterExpr)
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+	}
+	fmt.Fprintf(out, "%d", len(keys))
+	return 0
+}
+
+// fnPath - return a path(s) to an object(s) given a key(s)
+func fnPath(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName   string
+		keys    []string
+		src     []byte
+		docPath string
+		err     error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
+		return 1
+	case len(args) == 1:
+		if len(keys) == 0 {
+			fmt.Fprintf(eout, "Missing key(s)\n")
+			return 1
+		}
+		cName = args[0]
+	case len(args) >= 2:
+		cName, keys = args[0], args[1:]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	// Read keys from inputFName
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = append(keys, keysFromSrc(src)...)
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	errCnt := 0
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Fprintf(out, "\n")
+		}
+		docPath, err = c.DocPath(key)
+		if err != nil {
+			fmt.Fprintf(eout, "key %q, %s\n", key, err)
+			errCnt++
+		} else {
+			fmt.Fprintf(out, "%s", docPath)
+		}
+	}
+	return errCnt
+}
+
+// fnAttach - attach a file(s) to an object
+func fnAttach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName  string
+		key    string
+		src    []byte
+		fNames []string
+		err    error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	semver := "v0.0.0"
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name, key, semver and attachment name(s)\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing key, semver and attachment name(s)\n")
+		return 1
+	case len(args) == 2:
+		if len(fNames) == 0 {
+			fmt.Fprintf(eout, "Missing attachment name(s)\n")
+			return 1
+		}
+		cName, key = args[0], args[1]
+	case len(args) == 3:
+		cName, key, fNames = args[0], args[1], args[2:]
+	case len(args) > 3:
+		//Is args[2] a semver or a filename?
+		if val, err := dataset.ParseSemver([]byte(args[2])); err == nil {
+			semver = val.String()
+			cName, key, fNames = args[0], args[1], args[3:]
+		} else {
+			cName, key, fNames = args[0], args[1], args[2:]
+		}
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	// Read filenames from inputFName
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		fNames = append(fNames, keysFromSrc(src)...)
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	if c.KeyExists(key) == false {
+		fmt.Fprintf(eout, "%q is not in %s\n", key, cName)
+		return 1
+	}
+	for _, fname := range fNames {
+		if _, err := os.Stat(fname); os.IsNotExist(err) {
+			fmt.Fprintf(eout, "%s does not exist\n", fname)
+			return 1
+		}
+	}
+	err = c.AttachFiles(key, semver, fNames...)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// fnAttachments - list the attachments of an object(s) given a key(s)
+func fnAttachments(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName       string
+		keys        []string
+		src         []byte
+		attachments []string
+		err         error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name, key(s)\n")
+		return 1
+	case len(args) == 1:
+		if len(keys) == 0 {
+			fmt.Fprintf(eout, "Missing key(s)\n")
+			return 1
+		}
+		cName = args[0]
+	case len(args) >= 2:
+		cName, keys = args[0], args[1:]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	// Read keys from inputFName
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = append(keys, keysFromSrc(src)...)
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	errCnt := 0
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Fprintf(out, "\n")
+		}
+		attachments, err = c.Attachments(key)
+		if err != nil {
+			fmt.Fprintf(eout, "key %q, %s\n", key, err)
+			errCnt++
+		} else {
+			fmt.Fprintf(out, "%s", strings.Join(attachments, "\n"))
+		}
+	}
+	return errCnt
+}
+
+// fnDetach - return a file(s) attached to an object(s) for a given key
+func fnDetach(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName  string
+		key    string
+		src    []byte
+		fNames []string
+		err    error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	semver := ""
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and key\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing key\n")
+		return 1
+	case len(args) == 2:
+		cName, key = args[0], args[1]
+	case len(args) == 3:
+		cName, key, fNames = args[0], args[1], args[2:]
+	case len(args) > 3:
+		//Is args[2] a semver or a filename?
+		if val, err := dataset.ParseSemver([]byte(args[2])); err == nil {
+			semver = val.String()
+			cName, key, fNames = args[0], args[1], args[3:]
+		} else {
+			cName, key, fNames = args[0], args[1], args[2:]
+		}
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	// Read filenames from inputFName
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		fNames = append(fNames, keysFromSrc(src)...)
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	if c.KeyExists(key) == false {
+		fmt.Fprintf(eout, "%q is not in %s", key, cName)
+		return 1
+	}
+	err = c.GetAttachedFiles(key, semver, fNames...)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if quiet == false {
+		fmt.Fprint(out, "OK")
+	}
+	return 0
+}
+
+// fnPrune - remove a file(s) attached to an object for a given key
+func fnPrune(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName  string
+		key    string
+		src    []byte
+		fNames []string
+		err    error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	semver := "v0.0.0"
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and key\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing key\n")
+		return 1
+	case len(args) == 2:
+		cName, key = args[0], args[1]
+	case len(args) == 3:
+		cName, key, fNames = args[0], args[1], args[2:]
+	case len(args) >= 3:
+		//Is args[2] a semver or a filename?
+		if val, err := dataset.ParseSemver([]byte(args[2])); err == nil {
+			semver = val.String()
+			cName, key, fNames = args[0], args[1], args[3:]
+		} else {
+			cName, key, fNames = args[0], args[1], args[2:]
+		}
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	// Read filenames from inputFName
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		fNames = append(fNames, keysFromSrc(src)...)
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	if c.KeyExists(key) == false {
+		fmt.Fprintf(eout, "%q is not in %s", key, cName)
+		return 1
+	}
+	err = c.Prune(key, semver, fNames...)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if quiet == false {
+		fmt.Fprint(out, "OK")
+	}
+	return 0
+}
+
+// fnGrid - generate a grid (2D array) based on a list of key(s) and dotpath(s).
+// Keys map to rows, dotpaths map to columns
+//
+// Command Syntax: [VERB_OPTIONS] COLLECTION_NAME DOTPATH [DOTPATH ...]
+// Verb Options: filter-expression (-filter) , key list filename (-i,-input), sample size (-sample), verbose (-v, verbose)
+func fnGrid(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName    string
+		keys     []string
+		dotPaths []string
+		src      []byte
+		err      error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if workers > 0 {
+		dataset.Workers = workers
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name, key list filename, and dot path(s)\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing dot paths\n")
+		return 1
+	case len(args) >= 2:
+		cName, dotPaths = args[0], args[1:]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	// Get all keys or read from inputFName
+	keys = c.Keys()
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = append(keys, keysFromSrc(src)...)
+	}
+
+	// Apply Filter Expression
+	if len(filterExpr) > 0 && filterExpr != "true" {
+		keys, err = c.KeyFilter(keys[:], filterExpr)
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+	}
+
+	// Apply Sample Size
+	if sampleSize > 0 {
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		shuffle.Strings(keys, random)
+		if sampleSize <= len(keys) {
+			keys = keys[0:sampleSize]
+		}
+	}
+
+	g, err := c.Grid(keys, dotPaths, showVerbose)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if prettyPrint {
+		src, err = json.MarshalIndent(g, "", "    ")
+	} else {
+		src, err = json.Marshal(g)
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s", src)
+	return 0
+}
+
+// fnFrame - define a data frame and populate it with a list of keys,
+// dotpaths and label pairs
+//
+//     dataset keys collection.ds |\
+//        dataset frame collection.ds my-frame \
+//             ".creator.given=given_name" \
+// 			   ".creator.family=family_name" \
+//             ".popular_color[0]=favorite_color"
+//
+// Verb Options: filter-expression (e.g. -filter),
+// key list filename (e.g. -i), sample size (e.g. -sample)
+// labels (e.g. -labels)
+func fnFrame(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName        string
+		frameName    string
+		keyPathPairs []string
+		dotPaths     []string
+		labels       []string
+		src          []byte
+		err          error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if workers > 0 {
+		dataset.Workers = workers
+	}
+	dataset.TemplateFilters = templateFilter
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing frame name\n")
+		return 1
+	case len(args) == 2:
+		cName, frameName = args[0], args[1]
+	case len(args) >= 3:
+		cName, frameName, keyPathPairs = args[0], args[1], args[2:]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	if len(keyPathPairs) > 0 {
+		for _, item := range keyPathPairs {
+			dotPath, label := splitPathLabel(item)
+			dotPaths = append(dotPaths, dotPath)
+			labels = append(labels, label)
+		}
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	// Check to see if frame exists...
+	if c.FrameExists(frameName) {
+		if len(labels) > 0 || len(dotPaths) > 0 || len(filterExpr) > 0 || len(sortExpr) > 0 || len(liveMode) > 0 || len(frameTypes) > 0 {
+			fmt.Fprintf(eout, "frame %q already exists\n", frameName)
+			return 1
+		}
+		f, err := c.FrameRead(frameName)
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		// Handle pretty printing
+		if prettyPrint {
+			src, err = json.MarshalIndent(f, "", "    ")
+		} else {
+			src, err = json.Marshal(f)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "%s", src)
+		return 0
+	}
+
+	// NOTE: The key selection is saved with the frame so the
+	// regenerate verb can apply it again.
+	def := &dataset.FrameDefinition{
+		AllKeys:        allKeys || len(inputFName) == 0,
+		Filter:         filterExpr,
+		TemplateFilter: templateFilter,
+		Sort:           sortExpr,
+	}
+	if sampleSize > 0 {
+		def.SampleSize = sampleSize
+	}
+	if frameTypes != "" {
+		def.Types, err = dataset.ParseColumnTypes(frameTypes)
+		if err != nil {
+			fmt.Fprintf(eout, "%s, frame creation aborted\n", err)
+			return 1
+		}
+	}
+	// Get all keys or read from inputFName
+	if def.AllKeys == false {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		def.Keys = keysFromSrc(src)
+	}
+
+	// Run a sanity check before we create a new frame...
+	if len(dotPaths) == 0 {
+		fmt.Fprintf(eout, "No dotpaths, frame creation aborted\n")
+		return 1
+	}
+	if len(labels) == 0 {
+		fmt.Fprintf(eout, "No labels, frame creation aborted\n")
+		return 1
+	}
+	switch liveMode {
+	case "", dataset.LiveImmediate, dataset.LiveDeferred:
+	default:
+		fmt.Fprintf(eout, "Unknown live frame mode %q, frame creation aborted\n", liveMode)
+		return 1
+	}
+
+	// NOTE: We defining a new frame now, keys are filtered, sampled
+	// and sorted as described by def.
+	f, err := c.FrameDefineContext(appCtx, frameName, def, dotPaths, labels, showVerbose, nil)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if liveMode != "" {
+		if err := c.FrameLive(frameName, liveMode); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+	}
+
+	// Handle pretty printing
+	if prettyPrint {
+		src, err = json.MarshalIndent(f, "", "    ")
+	} else {
+		src, err = json.Marshal(f)
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s", src)
+	return 0
+}
+
+// fnFrameObjects - list the frames object list .
+func fnFrameObjects(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName     string
+		frameName string
+		err       error
+		src       []byte
+	)
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing frame name for %s\n", args[0])
+		return 1
+	case len(args) == 2:
+		cName = args[0]
+		frameName = args[1]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	var objects []map[string]interface{}
+	if pageOffset > 0 || pageLimit > 0 {
+		// Only read the rows of the page requested
+		objects, err = c.FrameObjectsPage(frameName, pageOffset, pageLimit)
+	} else {
+		var f *dataset.DataFrame
+		f, err = c.FrameRead(frameName)
+		if err == nil {
+			objects = f.Objects()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+
+	// Handle pretty printing
+	if prettyPrint {
+		src, err = json.MarshalIndent(objects, "", "    ")
+	} else {
+		src, err = json.Marshal(objects)
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s", src)
+	return 0
+}
+
+// fnFrameGrid - get a 2D JSON array of a frame's object list.
+func fnFrameGrid(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName     string
+		frameName string
+		err       error
+		src       []byte
+	)
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing frame name for %s\n", args[0])
+		return 1
+	case len(args) == 2:
+		cName = args[0]
+		frameName = args[1]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	f, err := c.FrameRead(frameName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+
+	// Handle pretty printing
+	if prettyPrint {
+		src, err = json.MarshalIndent(f.Grid(useHeaderRow), "", "    ")
+	} else {
+		src, err = json.Marshal(f.Grid(useHeaderRow))
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s", src)
+	return 0
+}
+
+// fnFrames - list the frames defined in a collection.
+func fnFrames(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName      string
+		frameNames []string
+		err        error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		cName = args[0]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+
+	c, err := dataset.GetCollection(cName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	frameNames = c.Frames()
+	if len(frameNames) > 0 {
+		fmt.Fprintf(out, "%s", strings.Join(frameNames, "\n"))
+	}
+	return 0
+}
+
+// fnFrameExists - check if a frame has been defined in collection
+func fnFrameExists(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName     string
+		frameName string
+		err       error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing frame name\n")
+		return 1
+	case len(args) == 2:
+		cName, frameName = args[0], args[1]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+	if dataset.FrameExists(cName, frameName) {
+		fmt.Fprintf(out, "true")
+	} else {
+		fmt.Fprintf(out, "false")
+	}
+	return 0
+}
+
+// fnFrameDelete - remove a frame from a collection
+func fnFrameDelete(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		cName     string
+		frameName string
+		err       error
+	)
+
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing frame name\n")
+		return 1
+	case len(args) == 2:
+		cName, frameName = args[0], args[1]
+	default:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+	err = dataset.FrameDelete(cName, frameName)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
+	}
+	return 0
+}
+
+// fnIndexCreate declares secondary indexes on dotpaths
+//
+//    dataset index-create publications.ds .publication_date .creators[:].orcid
+//
+func fnIndexCreate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	args = flagSet.Args()
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and dotpath\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing dotpath\n")
+		return 1
 	}
-	err = c.Prune(key, semver, fNames...)
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+	defer c.Close()
+	for _, dotPath := range args[1:] {
+		if showVerbose {
+			fmt.Fprintf(eout, "indexing %s\n", dotPath)
+		}
+		if err := c.IndexCreate(dotPath); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+	}
 	if quiet == false {
-		fmt.Fprint(out, "OK")
+		fmt.Fprintf(out, "OK")
 	}
 	return 0
 }
 
-// fnGrid - generate a grid (2D array) based on a list of key(s) and dotpath(s).
-// Keys map to rows, dotpaths map to columns
+// fnIndexDrop removes secondary indexes from a collection
 //
-// Command Syntax: [VERB_OPTIONS] COLLECTION_NAME DOTPATH [DOTPATH ...]
-// Verb Options: filter-expression (-filter) , key list filename (-i,-input), sample size (-sample), verbose (-v, verbose)
-func fnGrid(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
-	var (
-		cName    string
-		keys     []string
-		dotPaths []string
-		src      []byte
-		err      error
-	)
-
-	err = flagSet.Parse(args)
+//    dataset index-drop publications.ds .publication_date
+//
+func fnIndexDrop(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
 	switch {
 	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name, key list filename, and dot path(s)\n")
+		fmt.Fprintf(eout, "Missing collection name and dotpath\n")
 		return 1
 	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing dot paths\n")
-		return 1
-	case len(args) >= 2:
-		cName, dotPaths = args[0], args[1:]
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		fmt.Fprintf(eout, "Missing dotpath\n")
 		return 1
 	}
-
-	c, err := dataset.GetCollection(cName)
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	// Get all keys or read from inputFName
-	keys = c.Keys()
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		keys = append(keys, keysFromSrc(src)...)
-	}
-
-	// Apply Filter Expression
-	if len(filterExpr) > 0 && filterExpr != "true" {
-		keys, err = c.KeyFilter(keys[:], filterExpr)
-		if err != nil {
+	for _, dotPath := range args[1:] {
+		if err := c.IndexDrop(dotPath); err != nil {
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
 	}
-
-	// Apply Sample Size
-	if sampleSize > 0 {
-		random := rand.New(rand.NewSource(time.Now().UnixNano()))
-		shuffle.Strings(keys, random)
-		if sampleSize <= len(keys) {
-			keys = keys[0:sampleSize]
-		}
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
 	}
+	return 0
+}
 
-	g, err := c.Grid(keys, dotPaths, showVerbose)
+// fnIndexRebuild regenerates secondary indexes, all of them if
+// no dotpaths are given.
+//
+//    dataset index-rebuild publications.ds
+//
+func fnIndexRebuild(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-	if prettyPrint {
-		src, err = json.MarshalIndent(g, "", "    ")
-	} else {
-		src, err = json.Marshal(g)
+	args = flagSet.Args()
+	if len(args) == 0 {
+		fmt.Fprintf(eout, "Missing collection name\n")
+		return 1
 	}
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-	fmt.Fprintf(out, "%s", src)
+	defer c.Close()
+	dotPaths := args[1:]
+	if len(dotPaths) == 0 {
+		dotPaths = c.Indexes()
+	}
+	for _, dotPath := range dotPaths {
+		if showVerbose {
+			fmt.Fprintf(eout, "rebuilding %s\n", dotPath)
+		}
+		if err := c.IndexRebuild(dotPath); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+	}
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
+	}
 	return 0
 }
 
-// fnFrame - define a data frame and populate it with a list of keys,
-// dotpaths and label pairs
+// fnIndexFrame builds a full text index of a frame
 //
-//     dataset keys collection.ds |\
-//        dataset frame collection.ds my-frame \
-//             ".creator.given=given_name" \
-// 			   ".creator.family=family_name" \
-//             ".popular_color[0]=favorite_color"
+//    dataset index publications.ds titles titles.idx
 //
-// Verb Options: filter-expression (e.g. -filter),
-// key list filename (e.g. -i), sample size (e.g. -sample)
-// labels (e.g. -labels)
-func fnFrame(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
-	var (
-		cName        string
-		frameName    string
-		keys         []string
-		keyPathPairs []string
-		dotPaths     []string
-		labels       []string
-		src          []byte
-		err          error
-	)
-
-	err = flagSet.Parse(args)
+func fnIndexFrame(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
 	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name and frame name\n")
-		return 1
-	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing frame name\n")
+	case len(args) < 3:
+		fmt.Fprintf(eout, "Expected collection name, frame name and index path\n")
 		return 1
-	case len(args) == 2:
-		cName, frameName = args[0], args[1]
-	case len(args) >= 3:
-		cName, frameName, keyPathPairs = args[0], args[1], args[2:]
-	default:
+	case len(args) > 3:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-
-	if len(keyPathPairs) > 0 {
-		for _, item := range keyPathPairs {
-			if strings.Contains(item, "=") == true {
-				kp := strings.SplitN(item, "=", 2)
-				dotPaths = append(dotPaths, strings.TrimSpace(kp[0]))
-				labels = append(labels, strings.TrimSpace(kp[1]))
-			} else {
-				item = strings.TrimSpace(item)
-				dotPaths = append(dotPaths, item)
-				labels = append(labels, strings.TrimPrefix(item, "."))
-			}
-		}
-	}
-
-	c, err := dataset.GetCollection(cName)
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	// Check to see if frame exists...
-	if c.FrameExists(frameName) {
-		if len(labels) > 0 || len(dotPaths) > 0 || len(filterExpr) > 0 {
-			fmt.Fprintf(eout, "frame %q already exists\n", frameName)
-			return 1
-		}
-		f, err := c.FrameRead(frameName)
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		// Handle pretty printing
-		if prettyPrint {
-			src, err = json.MarshalIndent(f, "", "    ")
-		} else {
-			src, err = json.Marshal(f)
-		}
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		fmt.Fprintf(out, "%s", src)
-		return 0
-	}
-
-	// Get all keys or read from inputFName
-	keys = c.Keys()
-	if allKeys == false && len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
-		} else {
-			src, err = ioutil.ReadFile(inputFName)
-		}
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
-		keys = keysFromSrc(src)
-	}
-
-	// Apply Filter Expression
-	if len(filterExpr) > 0 {
-		keys, err = c.KeyFilter(keys[:], filterExpr)
-		if err != nil {
-			fmt.Fprintf(eout, "%s\n", err)
-			return 1
-		}
+	if err := c.IndexFrame(args[1], args[2]); err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
 	}
-
-	// Apply Sample Size
-	if sampleSize > 0 {
-		random := rand.New(rand.NewSource(time.Now().UnixNano()))
-		shuffle.Strings(keys, random)
-		if sampleSize <= len(keys) {
-			keys = keys[0:sampleSize]
-		}
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
 	}
+	return 0
+}
 
-	// Run a sanity check before we create a new frame...
-	if len(dotPaths) == 0 {
-		fmt.Fprintf(eout, "No dotpaths, frame creation aborted\n")
+// fnSearch runs a query against a full text index
+//
+//    dataset search -highlight publications.ds titles.idx '+title:climate -author:smith'
+//
+func fnSearch(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	var (
+		src []byte
+	)
+	err := flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-	if len(labels) == 0 {
-		fmt.Fprintf(eout, "No labels, frame creation aborted\n")
+	args = flagSet.Args()
+	if len(args) < 3 {
+		fmt.Fprintf(eout, "Expected collection name, index path and query\n")
 		return 1
 	}
-	//NOTE: We need to be able to frame an empty collection so we
-	// can bring mapped content in from a spreadsheet or CSV file easily.
-	if len(keys) == 0 && len(c.KeyMap) > 0 {
-		fmt.Fprintf(eout, "No keys, frame creation aborted\n")
+	c, err := dataset.GetCollection(args[0])
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-
-	// NOTE: We defining a new frame now.
-	f, err := c.FrameCreate(frameName, keys, dotPaths, labels, showVerbose)
+	defer c.Close()
+	opts := &dataset.SearchOptions{
+		From:      from,
+		Size:      size,
+		Highlight: showHighlight,
+		FacetSize: facetSize,
+	}
+	for _, field := range strings.Split(resultFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			opts.Fields = append(opts.Fields, field)
+		}
+	}
+	for _, facet := range strings.Split(facets, ",") {
+		if facet = strings.TrimSpace(facet); facet != "" {
+			opts.Facets = append(opts.Facets, facet)
+		}
+	}
+	result, err := c.Search(args[1], strings.Join(args[2:], " "), opts)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-
-	// NOTE: Make need to make sure we save our additional
-	// settings - sampleSize
-
-	// Handle pretty printing
+	if idsOnly {
+		for _, hit := range result.Hits {
+			fmt.Fprintln(out, hit.Key)
+		}
+		return 0
+	}
 	if prettyPrint {
-		src, err = json.MarshalIndent(f, "", "    ")
+		src, err = json.MarshalIndent(result, "", "    ")
 	} else {
-		src, err = json.Marshal(f)
+		src, err = json.Marshal(result)
 	}
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
@@ -1815,54 +2885,72 @@ func fnFrame(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 	return 0
 }
 
-// fnFrameObjects - list the frames object list .
-func fnFrameObjects(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnLunrIndex writes a Lunr.js index and document store of a frame
+//
+//    dataset -o lunr.json lunr-index -fields title,abstract -boost title=10 publications.ds pubs
+//
+func fnLunrIndex(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName     string
-		frameName string
-		err       error
-		src       []byte
+		src []byte
 	)
-	err = flagSet.Parse(args)
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
 	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name and frame name\n")
-		return 1
-	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing frame name for %s\n", args[0])
+	case len(args) < 2:
+		fmt.Fprintf(eout, "Expected collection name and frame name\n")
 		return 1
-	case len(args) == 2:
-		cName = args[0]
-		frameName = args[1]
-	default:
+	case len(args) > 2:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-
-	c, err := dataset.GetCollection(cName)
+	opts := &dataset.LunrOptions{
+		Boosts: map[string]float64{},
+	}
+	for _, field := range strings.Split(resultFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			opts.Fields = append(opts.Fields, field)
+		}
+	}
+	for _, field := range strings.Split(storeFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			opts.Store = append(opts.Store, field)
+		}
+	}
+	for _, boost := range strings.Split(fieldBoosts, ",") {
+		if boost = strings.TrimSpace(boost); boost == "" {
+			continue
+		}
+		parts := strings.SplitN(boost, "=", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(eout, "Expected LABEL=NUMBER, got %q\n", boost)
+			return 1
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			fmt.Fprintf(eout, "Expected LABEL=NUMBER, got %q\n", boost)
+			return 1
+		}
+		opts.Boosts[strings.TrimSpace(parts[0])] = n
+	}
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	f, err := c.FrameRead(frameName)
+	idx, err := c.LunrIndex(args[1], opts)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-
-	// Handle pretty printing
 	if prettyPrint {
-		src, err = json.MarshalIndent(f.Objects(), "", "    ")
+		src, err = json.MarshalIndent(idx, "", "    ")
 	} else {
-		src, err = json.Marshal(f.Objects())
+		src, err = json.Marshal(idx)
 	}
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
@@ -1872,54 +2960,55 @@ func fnFrameObjects(in io.Reader, out io.Writer, eout io.Writer, args []string,
 	return 0
 }
 
-// fnFrameGrid - get a 2D JSON array of a frame's object list.
-func fnFrameGrid(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnAggregate groups a frame's objects and summarizes each group
+//
+//    dataset aggregate -group .year -agg count,sum(.amount) collections.ds my-frame
+//
+func fnAggregate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName     string
-		frameName string
-		err       error
-		src       []byte
+		src []byte
 	)
-	err = flagSet.Parse(args)
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
 	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name and frame name\n")
-		return 1
-	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing frame name for %s\n", args[0])
+	case len(args) < 2:
+		fmt.Fprintf(eout, "Expected collection name and frame name\n")
 		return 1
-	case len(args) == 2:
-		cName = args[0]
-		frameName = args[1]
-	default:
+	case len(args) > 2:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-
-	c, err := dataset.GetCollection(cName)
+	aggregations, err := dataset.ParseAggregations(aggregationExpr)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	defer c.Close()
-
-	f, err := c.FrameRead(frameName)
+	f, err := c.FrameGroupBy(args[1], dataset.ParseGroupBy(groupByPaths), aggregations)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-
-	// Handle pretty printing
+	if csvFormat {
+		if err := f.WriteCSV(out, csvSkipHeader == false); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		return 0
+	}
 	if prettyPrint {
-		src, err = json.MarshalIndent(f.Grid(useHeaderRow), "", "    ")
+		src, err = json.MarshalIndent(f.Objects(), "", "    ")
 	} else {
-		src, err = json.Marshal(f.Grid(useHeaderRow))
+		src, err = json.Marshal(f.Objects())
 	}
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
@@ -1929,12 +3018,18 @@ func fnFrameGrid(in io.Reader, out io.Writer, eout io.Writer, args []string, fla
 	return 0
 }
 
-// fnFrames - list the frames defined in a collection.
-func fnFrames(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+// fnReframe updates a Frame's object list from the current state
+// of collection using the existing keys or the keys supplied.
+//
+//    dataset reframe -i keys.txt collections.ds my-frame
+//
+func fnReframe(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
 	var (
-		cName      string
-		frameNames []string
-		err        error
+		cName     string
+		frameName string
+		keys      []string
+		src       []byte
+		err       error
 	)
 
 	err = flagSet.Parse(args)
@@ -1942,6 +3037,9 @@ func fnFrames(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+	if workers > 0 {
+		dataset.Workers = workers
+	}
 	args = flagSet.Args()
 
 	switch {
@@ -1949,77 +3047,73 @@ func fnFrames(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 		fmt.Fprintf(eout, "Missing collection name and frame name\n")
 		return 1
 	case len(args) == 1:
-		cName = args[0]
+		fmt.Fprintf(eout, "Missing frame name\n")
+		return 1
+	case len(args) == 2:
+		cName, frameName = args[0], args[1]
 	default:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
 
-	c, err := dataset.GetCollection(cName)
-	if err != nil {
-		fmt.Fprintf(eout, "%s\n", err)
+	// Check to see if frame exists...
+	if dataset.FrameExists(cName, frameName) == false {
+		fmt.Fprintf(eout, "Frame %q not defined in %s\n", frameName, cName)
 		return 1
 	}
-	defer c.Close()
 
-	frameNames = c.Frames()
-	if len(frameNames) > 0 {
-		fmt.Fprintf(out, "%s", strings.Join(frameNames, "\n"))
+	keys = dataset.FrameKeys(cName, frameName)
+
+	// Read from inputFName, update frame's keys
+	if len(inputFName) > 0 {
+		if inputFName == "-" {
+			src, err = ioutil.ReadAll(in)
+		} else {
+			src, err = ioutil.ReadFile(inputFName)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		keys = keysFromSrc(src)
 	}
-	return 0
-}
 
-// fnFrameExists - check if a frame has been defined in collection
-func fnFrameExists(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
-	var (
-		cName     string
-		frameName string
-		err       error
-	)
+	// Apply Sample Size
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shuffle.Strings(keys, random)
+	if sampleSize <= len(keys) && sampleSize > 0 {
+		keys = keys[0:sampleSize]
+	}
 
-	err = flagSet.Parse(args)
-	if err != nil {
-		fmt.Fprintf(eout, "%s\n", err)
+	if len(keys) == 0 {
+		fmt.Fprintf(eout, "No keys available to update frame\n")
 		return 1
 	}
-	args = flagSet.Args()
 
-	switch {
-	case len(args) == 0:
-		fmt.Fprintf(eout, "Missing collection name and frame name\n")
-		return 1
-	case len(args) == 1:
-		fmt.Fprintf(eout, "Missing frame name\n")
-		return 1
-	case len(args) == 2:
-		cName, frameName = args[0], args[1]
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+	// Now regenerate the objects in the frame
+	err = dataset.FrameReframe(cName, frameName, keys, showVerbose)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-	if dataset.FrameExists(cName, frameName) {
-		fmt.Fprintf(out, "true")
-	} else {
-		fmt.Fprintf(out, "false")
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
 	}
 	return 0
 }
 
-// fnFrameDelete - remove a frame from a collection
-func fnFrameDelete(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
-	var (
-		cName     string
-		frameName string
-		err       error
-	)
-
-	err = flagSet.Parse(args)
+// fnFrameLive shows or sets how a frame is kept up to date as
+// objects change, "immediate", "deferred" or "off".
+//
+//    dataset frame-live collections.ds my-frame deferred
+//
+func fnFrameLive(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
 	switch {
 	case len(args) == 0:
 		fmt.Fprintf(eout, "Missing collection name and frame name\n")
@@ -2027,44 +3121,55 @@ func fnFrameDelete(in io.Reader, out io.Writer, eout io.Writer, args []string, f
 	case len(args) == 1:
 		fmt.Fprintf(eout, "Missing frame name\n")
 		return 1
-	case len(args) == 2:
-		cName, frameName = args[0], args[1]
-	default:
+	case len(args) > 3:
 		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
 		return 1
 	}
-	err = dataset.FrameDelete(cName, frameName)
+	c, err := dataset.GetCollection(args[0])
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+	defer c.Close()
+	if c.FrameExists(args[1]) == false {
+		fmt.Fprintf(eout, "Frame %q not defined in %s\n", args[1], args[0])
+		return 1
+	}
+	if len(args) == 2 {
+		mode := c.LiveFrames[args[1]]
+		if mode == "" {
+			mode = "off"
+		}
+		fmt.Fprintf(out, "%s", mode)
+		return 0
+	}
+	mode := strings.ToLower(args[2])
+	if mode == "off" {
+		mode = ""
+	}
+	if err := c.FrameLive(args[1], mode); err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
 	if quiet == false {
 		fmt.Fprintf(out, "OK")
 	}
 	return 0
 }
 
-// fnReframe updates a Frame's object list from the current state
-// of collection using the existing keys or the keys supplied.
+// fnFrameTypes shows the types of a frame's columns or declares them,
+// values are coerced to a declared type.
 //
-//    dataset reframe -i keys.txt collections.ds my-frame
+//    dataset frame-types collections.ds my-frame
+//    dataset frame-types collections.ds my-frame year=integer published=date
 //
-func fnReframe(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
-	var (
-		cName     string
-		frameName string
-		keys      []string
-		src       []byte
-		err       error
-	)
-
-	err = flagSet.Parse(args)
+func fnFrameTypes(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
 	args = flagSet.Args()
-
 	switch {
 	case len(args) == 0:
 		fmt.Fprintf(eout, "Missing collection name and frame name\n")
@@ -2072,53 +3177,81 @@ func fnReframe(in io.Reader, out io.Writer, eout io.Writer, args []string, flagS
 	case len(args) == 1:
 		fmt.Fprintf(eout, "Missing frame name\n")
 		return 1
-	case len(args) == 2:
-		cName, frameName = args[0], args[1]
-	default:
-		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+	}
+	c, err := dataset.GetCollection(args[0])
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
-
-	// Check to see if frame exists...
-	if dataset.FrameExists(cName, frameName) == false {
-		fmt.Fprintf(eout, "Frame %q not defined in %s\n", frameName, cName)
+	defer c.Close()
+	if c.FrameExists(args[1]) == false {
+		fmt.Fprintf(eout, "Frame %q not defined in %s\n", args[1], args[0])
 		return 1
 	}
-
-	keys = dataset.FrameKeys(cName, frameName)
-
-	// Read from inputFName, update frame's keys
-	if len(inputFName) > 0 {
-		if inputFName == "-" {
-			src, err = ioutil.ReadAll(in)
+	if len(args) == 2 {
+		types, err := c.FrameTypes(args[1])
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		var src []byte
+		if prettyPrint {
+			src, err = json.MarshalIndent(types, "", "    ")
 		} else {
-			src, err = ioutil.ReadFile(inputFName)
+			src, err = json.Marshal(types)
 		}
 		if err != nil {
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		keys = keysFromSrc(src)
+		fmt.Fprintf(out, "%s", src)
+		return 0
 	}
-
-	// Apply Sample Size
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
-	shuffle.Strings(keys, random)
-	if sampleSize <= len(keys) && sampleSize > 0 {
-		keys = keys[0:sampleSize]
+	types, err := dataset.ParseColumnTypes(strings.Join(args[2:], ","))
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
 	}
-
-	if len(keys) == 0 {
-		fmt.Fprintf(eout, "No keys available to update frame\n")
+	if err := c.FrameSetTypes(args[1], types, showVerbose); err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+	if quiet == false {
+		fmt.Fprintf(out, "OK")
+	}
+	return 0
+}
 
-	// Now regenerate the objects in the frame
-	err = dataset.FrameReframe(cName, frameName, keys, showVerbose)
+// fnRegenerate selects a frame's keys again using the filter, sort
+// and sample saved with its definition and reframes it.
+//
+//    dataset regenerate collections.ds my-frame
+//
+func fnRegenerate(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet *flag.FlagSet) int {
+	err := flagSet.Parse(args)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
 	}
+	if workers > 0 {
+		dataset.Workers = workers
+	}
+	args = flagSet.Args()
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(eout, "Missing collection name and frame name\n")
+		return 1
+	case len(args) == 1:
+		fmt.Fprintf(eout, "Missing frame name\n")
+		return 1
+	case len(args) > 2:
+		fmt.Fprintf(eout, "Don't understand parameters, %s\n", strings.Join(args, " "))
+		return 1
+	}
+	if err := dataset.FrameRegenerate(args[0], args[1], showVerbose); err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
 	if quiet == false {
 		fmt.Fprintf(out, "OK")
 	}
@@ -2167,7 +3300,7 @@ func fnRefresh(in io.Reader, out io.Writer, eout io.Writer, args []string, flagS
 
 	if len(keyPathPairs) > 0 {
 		for _, item := range keyPathPairs {
-			if strings.Contains(item, "=") {
+			if strings.Contains(item, "=") && strings.HasPrefix(strings.TrimSpace(item), dataset.JMESPrefix) == false {
 				kp := strings.SplitN(item, "=", 2)
 				labels = append(labels, strings.TrimSpace(kp[0]))
 				dotPaths = append(dotPaths, strings.TrimSpace(kp[1]))
@@ -2207,7 +3340,7 @@ func fnRefresh(in io.Reader, out io.Writer, eout io.Writer, args []string, flagS
 	}
 
 	// Now regenerate grid content with Reframe
-	err = dataset.FrameRefresh(cName, frameName, keys, showVerbose)
+	err = dataset.FrameRefreshContext(appCtx, cName, frameName, keys, showVerbose, nil)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
@@ -2293,7 +3426,7 @@ func fnImport(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
 		}
-		cnt, err := c.ImportCSV(fp, idCol, useHeaderRow, overwrite, showVerbose)
+		cnt, err := c.ImportCSVContext(appCtx, fp, idCol, useHeaderRow, overwrite, showVerbose, nil)
 		if err != nil {
 			fmt.Fprintf(eout, "%s\n", err)
 			return 1
@@ -2729,7 +3862,7 @@ func fnCheck(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 		return 1
 	}
 	for _, cName := range args {
-		err = dataset.Check(cName, showVerbose)
+		err = dataset.CheckContext(appCtx, cName, showVerbose, nil)
 		if err != nil {
 			fmt.Fprintf(eout, "error in %q, %s\n", cName, err)
 			return 1
@@ -2758,7 +3891,7 @@ func fnRepair(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSe
 		return 1
 	}
 	for _, cName := range args {
-		err = dataset.Repair(cName, showVerbose)
+		err = dataset.RepairContext(appCtx, cName, showVerbose, nil)
 		if err != nil {
 			fmt.Fprintf(eout, "error in %q, %s\n", cName, err)
 			return 1
@@ -2825,7 +3958,7 @@ func fnClone(in io.Reader, out io.Writer, eout io.Writer, args []string, flagSet
 		return 1
 	}
 
-	err = c.Clone(destCollectionName, keys, showVerbose)
+	err = c.CloneContext(appCtx, destCollectionName, keys, showVerbose, nil)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
@@ -2899,7 +4032,7 @@ func fnCloneSample(in io.Reader, out io.Writer, eout io.Writer, args []string, f
 		size = int(math.Floor(float64(len(keys)) * 0.10))
 	}
 
-	err = c.CloneSample(trainingCollectionName, testCollectionName, keys, size, showVerbose)
+	err = c.CloneSampleContext(appCtx, trainingCollectionName, testCollectionName, keys, size, showVerbose, nil)
 	if err != nil {
 		fmt.Fprintf(eout, "%s\n", err)
 		return 1
@@ -2952,6 +4085,7 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	app.BoolVar(&generateMarkdown, "generate-markdown", false, "generate Markdown documentation")
 	app.BoolVar(&generateManPage, "generate-manpage", false, "output manpage markup")
 	app.BoolVar(&showVerbose, "V,verbose", false, "output rows processed on importing from CSV")
+	app.IntVar(&lockTimeout, "lock-timeout", 10, "seconds to wait for a collection locked by another process")
 
 	// Application Verbs
 	app.VerbsRequired = true
@@ -2965,6 +4099,15 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vCheck.SetParams("COLLECTION", "[COLLECTION ...]")
 	vRepair = app.NewVerb("repair", "repair a collection", fnRepair)
 	vRepair.SetParams("COLLECTION")
+	vSchema = app.NewVerb("schema", "show, set or remove a collection's JSON Schema", fnSchema)
+	vSchema.SetParams("COLLECTION", "[JSON_SCHEMA_FILENAME]")
+	vSchema.BoolVar(&setValue, "set", false, "set the JSON Schema")
+	vSchema.BoolVar(&removeValue, "remove", false, "remove the JSON Schema")
+	vValidate = app.NewVerb("validate", "report objects failing the collection's JSON Schema", fnValidate)
+	vValidate.SetParams("COLLECTION", "[KEY ...]")
+	vValidate.StringVar(&inputFName, "i,input", "", "read keys, one per line, from a file")
+	vValidate.BoolVar(&jsonFormat, "json", false, "output errors as JSON")
+	vValidate.BoolVar(&prettyPrint, "p,pretty", false, "pretty print JSON output")
 	vClone = app.NewVerb("clone", "clone a collection", fnClone)
 	vClone.SetParams("SRC_COLLECTION", "DEST_COLLECTION")
 	vClone.StringVar(&inputFName, "i,input", "", "read key(s), one per line, from a file")
@@ -2986,24 +4129,59 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vRead.StringVar(&inputFName, "i,input", "", "read key(s), one per line, from a file")
 	vRead.BoolVar(&cleanObject, "c,clean", false, "Remove dataset underscore variables before returning object")
 	vRead.BoolVar(&prettyPrint, "p,pretty", false, "pretty print JSON output")
+	vRead.StringVar(&revisionFName, "revision-file", "", "write the revision token of the object read to a file")
 
 	vUpdate = app.NewVerb("update", "update a JSON object", fnUpdate)
 	vUpdate.SetParams("COLLECTION", "KEY", "[JSON_SRC|JSON_FILENAME]")
 	vUpdate.StringVar(&inputFName, "i,input", "", "input file to read JSON object source from")
+	vUpdate.StringVar(&expectedRevision, "revision", "", "only update if the object's revision token matches")
+
+	vRevToken = app.NewVerb("revision-token", "revision token of a JSON object", fnRevisionToken)
+	vRevToken.SetParams("COLLECTION", "KEY")
+
+	vPatch = app.NewVerb("patch", "apply a JSON Patch or JSON Merge Patch to a JSON object", fnPatch)
+	vPatch.SetParams("COLLECTION", "KEY", "[PATCH_SRC|PATCH_FILENAME]")
+	vPatch.StringVar(&inputFName, "i,input", "", "input file to read the patch from")
 
 	vDelete = app.NewVerb("delete", "delete a JSON object", fnDelete)
 	vDelete.SetParams("COLLECTION", "[KEY]", "[KEY ...]")
 	vDelete.StringVar(&inputFName, "i,input", "", "read keys, one per line, from a file")
 
+	vUndelete = app.NewVerb("undelete", "bring back a deleted JSON object", fnUndelete)
+	vUndelete.SetParams("COLLECTION", "[KEY]", "[KEY ...]")
+	vUndelete.StringVar(&inputFName, "i,input", "", "read keys, one per line, from a file")
+
+	vTrash = app.NewVerb("trash", "list deleted JSON objects", fnTrash)
+	vTrash.SetParams("COLLECTION")
+	vTrash.BoolVar(&prettyPrint, "p,pretty", false, "pretty print JSON output")
+
+	vEmptyTrash = app.NewVerb("empty-trash", "permanently remove deleted JSON objects", fnEmptyTrash)
+	vEmptyTrash.SetParams("COLLECTION", "[OLDER_THAN]")
+
 	vJoin = app.NewVerb("join", "join attributes to a JSON object", fnJoin)
 	vJoin.SetParams("COLLECTION", "KEY", "[JSON_SRC|JSON_FILENAME]")
 	vJoin.StringVar(&inputFName, "i,input", "", "read JSON source from file")
 	vJoin.BoolVar(&overwrite, "overwrite", false, "if true replace attributes otherwise append only new attributes")
+	vJoin.StringVar(&joinConflict, "conflict", "", "strategy for values in common: keep, overwrite or error")
+	vJoin.StringVar(&joinArrays, "arrays", "", "strategy for arrays in common: replace, append or union")
+	vJoin.StringVar(&joinUnionKey, "union-key", "", "dotpath used to match array items with -arrays union")
+
+	vHistory = app.NewVerb("history", "list the revisions of a JSON object", fnHistory)
+	vHistory.SetParams("COLLECTION", "KEY", "[REVISION]")
+	vHistory.BoolVar(&prettyPrint, "p,pretty", false, "pretty print JSON output")
+
+	vRestore = app.NewVerb("restore", "restore a revision of a JSON object", fnRestore)
+	vRestore.SetParams("COLLECTION", "KEY", "REVISION")
 
 	vKeys = app.NewVerb("keys", "list keys in collection", fnKeys)
 	vKeys.SetParams("COLLECTION", "[FILTER_EXPR]", "[SORT_EXPR]", "[KEY ...]")
 	vKeys.IntVar(&sampleSize, "sample", -1, "set a sample size for keys returned")
+	vKeys.IntVar(&workers, "workers", 0, "number of objects to read and evaluate at once")
 	vKeys.StringVar(&inputFName, "i,input", "", "read keys, one per line, from a file")
+	vKeys.BoolVar(&templateFilter, "template-filter", false, "read FILTER_EXPR as a Go template expression")
+	vKeys.StringVar(&sortLocale, "locale", "", "collate strings by a locale (e.g. en, sv) when sorting")
+	vKeys.BoolVar(&sortFoldCase, "fold-case", false, "ignore case when sorting strings")
+	vKeys.StringVar(&sortNulls, "nulls", "last", "place objects missing a sort value first or last")
 
 	vHasKey = app.NewVerb("haskey", "check for key(s) in collection", fnHasKey)
 	vHasKey.SetParams("COLLECTION", "[KEY]", "[KEY ...]")
@@ -3012,6 +4190,7 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vCount = app.NewVerb("count", "count JSON objects", fnCount)
 	vCount.SetParams("COLLECTION", "[FILTER_EXPR]", "[KEY ...]")
 	vCount.StringVar(&inputFName, "i,input", "", "read keys, one per line, from a file")
+	vCount.BoolVar(&templateFilter, "template-filter", false, "read FILTER_EXPR as a Go template expression")
 
 	vPath = app.NewVerb("path", "path to JSON object", fnPath)
 	vPath.SetParams("COLLECTION", "[KEY]", "[KEY ...]")
@@ -3039,6 +4218,7 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vGrid.SetParams("COLLECTION", "DOTPATH", "[DOTPATH ...]")
 	vGrid.StringVar(&inputFName, "i,input", "", "use only the keys, one per line, from a file")
 	vGrid.IntVar(&sampleSize, "s,sample", -1, "make grid based on a key sample of a given size")
+	vGrid.IntVar(&workers, "workers", 0, "number of objects to read and evaluate at once")
 	vGrid.BoolVar(&showVerbose, "v,verbose", showVerbose, "verbose reporting for grid generation")
 	vGrid.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
 
@@ -3046,15 +4226,21 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vFrame.SetParams("COLLECTION", "FRAME_NAME", "DOTPATH", "[DOTPATH ...]")
 	vFrame.StringVar(&inputFName, "i,input", "", "use only the keys, one per line, from a file")
 	vFrame.StringVar(&filterExpr, "filter", "", "apply filter for inclusion in frame")
+	vFrame.BoolVar(&templateFilter, "template-filter", false, "read the -filter expression as a Go template expression")
 	vFrame.StringVar(&sortExpr, "sort", "", "apply sort expression for keys/grid in frame")
 	vFrame.IntVar(&sampleSize, "s,sample", -1, "make frame based on a key sample of a given size")
+	vFrame.IntVar(&workers, "workers", 0, "number of objects to read and evaluate at once")
 	vFrame.BoolVar(&allKeys, "a,all", allKeys, "Use all collection keys for frame")
+	vFrame.StringVar(&liveMode, "live", "", "keep the frame up to date as objects change, immediate or deferred")
+	vFrame.StringVar(&frameTypes, "types", "", "declare column types, e.g. year=integer,published=date")
 	vFrame.BoolVar(&showVerbose, "v,verbose", showVerbose, "verbose reporting for frame generation")
 	vFrame.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
 
 	vFrameObjects = app.NewVerb("frame-objects", "return the object list of a frame", fnFrameObjects)
 	vFrameObjects.SetParams("COLLECTION", "FRAME_NAME")
 	vFrameObjects.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
+	vFrameObjects.IntVar(&pageOffset, "offset", 0, "skip this many objects of the frame")
+	vFrameObjects.IntVar(&pageLimit, "limit", 0, "return at most this many objects, zero returns the rest")
 
 	vFrameGrid = app.NewVerb("frame-grid", "return the object list as a 2D array", fnFrameGrid)
 	vFrameGrid.SetParams("COLLECTION", "FRAME_NAME")
@@ -3065,13 +4251,25 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vReframe.SetParams("COLLECTION", "FRAME_NAME")
 	vReframe.StringVar(&inputFName, "i,input", "", "frame only the keys listed in the file, one key per line")
 	vReframe.IntVar(&sampleSize, "s,sample", -1, "reframe based on a key sample of a given size")
+	vReframe.IntVar(&workers, "workers", 0, "number of objects to read and evaluate at once")
 	vReframe.BoolVar(&showVerbose, "v,verbose", false, "use verbose output")
 	vReframe.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
+	vRegenerate = app.NewVerb("regenerate", "select a frame's keys again with its saved filter, sort and sample then reframe it", fnRegenerate)
+	vRegenerate.SetParams("COLLECTION", "FRAME_NAME")
+	vRegenerate.IntVar(&workers, "workers", 0, "number of objects to read and evaluate at once")
+	vRegenerate.BoolVar(&showVerbose, "v,verbose", false, "use verbose output")
+	vFrameLive = app.NewVerb("frame-live", "show or set how a frame is kept up to date as objects change", fnFrameLive)
+	vFrameLive.SetParams("COLLECTION", "FRAME_NAME", "[immediate|deferred|off]")
+	vFrameTypes = app.NewVerb("frame-types", "show or declare the types of a frame's columns", fnFrameTypes)
+	vFrameTypes.SetParams("COLLECTION", "FRAME_NAME", "[LABEL=TYPE ...]")
+	vFrameTypes.BoolVar(&showVerbose, "v,verbose", false, "report values that can't be coerced")
+	vFrameTypes.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
 
 	vRefresh = app.NewVerb("refresh", "update an existing frame from a list of keys", fnReframe)
 	vRefresh.SetParams("COLLECTION", "FRAME_NAME")
 	vRefresh.StringVar(&inputFName, "i,input", "", "frame only the keys listed in the file, one key per line")
 	vRefresh.IntVar(&sampleSize, "s,sample", -1, "reframe based on a key sample of a given size")
+	vRefresh.IntVar(&workers, "workers", 0, "number of objects to read and evaluate at once")
 	vRefresh.BoolVar(&showVerbose, "v,verbose", false, "use verbose output")
 	vRefresh.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
 
@@ -3084,6 +4282,49 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vFrameDelete = app.NewVerb("delete-frame", "delete a frame from a collection", fnFrameDelete)
 	vFrameDelete.SetParams("COLLECTION", "FRAME_NAME")
 
+	// Secondary indexes on dotpaths
+	vIndexCreate = app.NewVerb("index-create", "index the values of dotpaths for filters and sorts", fnIndexCreate)
+	vIndexCreate.SetParams("COLLECTION", "DOTPATH", "[DOTPATH ...]")
+	vIndexCreate.BoolVar(&showVerbose, "v,verbose", false, "verbose output")
+
+	vIndexDrop = app.NewVerb("index-drop", "remove the indexes on dotpaths", fnIndexDrop)
+	vIndexDrop.SetParams("COLLECTION", "DOTPATH", "[DOTPATH ...]")
+
+	vIndexRebuild = app.NewVerb("index-rebuild", "regenerate the indexes on dotpaths, all if none are given", fnIndexRebuild)
+	vIndexRebuild.SetParams("COLLECTION", "[DOTPATH ...]")
+	vIndexRebuild.BoolVar(&showVerbose, "v,verbose", false, "verbose output")
+
+	// Full text search over frames
+	vIndexFrame = app.NewVerb("index", "build a full text index of a frame", fnIndexFrame)
+	vIndexFrame.SetParams("COLLECTION", "FRAME_NAME", "INDEX_PATH")
+
+	vSearch = app.NewVerb("search", "search a full text index of a frame", fnSearch)
+	vSearch.SetParams("COLLECTION", "INDEX_PATH", "QUERY")
+	vSearch.StringVar(&resultFields, "fields", "", "search only these labels, comma separated")
+	vSearch.IntVar(&size, "size", 10, "the number of hits to return, 0 returns all")
+	vSearch.IntVar(&from, "from", 0, "the offset of the first hit returned")
+	vSearch.BoolVar(&showHighlight, "highlight", false, "include highlighted matches")
+	vSearch.StringVar(&facets, "facets", "", "count the values of these labels, comma separated")
+	vSearch.IntVar(&facetSize, "facet-size", 10, "the number of values per facet, 0 returns all")
+	vSearch.BoolVar(&idsOnly, "ids,ids-only", false, "list only the matching keys")
+	vSearch.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
+
+	vLunrIndex = app.NewVerb("lunr-index", "write a Lunr.js index and document store of a frame", fnLunrIndex)
+	vLunrIndex.SetParams("COLLECTION", "FRAME_NAME")
+	vLunrIndex.StringVar(&resultFields, "fields", "", "index only these labels, comma separated")
+	vLunrIndex.StringVar(&storeFields, "store", "", "store only these labels, comma separated, defaults to the indexed labels")
+	vLunrIndex.StringVar(&fieldBoosts, "boost", "", "boost the scores of labels, e.g. title=10,author=2")
+	vLunrIndex.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
+
+	// Aggregations over frames
+	vAggregate = app.NewVerb("aggregate", "group a frame's objects and summarize each group", fnAggregate)
+	vAggregate.SetParams("COLLECTION", "FRAME_NAME")
+	vAggregate.StringVar(&groupByPaths, "group", "", "group by these dotpaths or labels, comma separated")
+	vAggregate.StringVar(&aggregationExpr, "agg", "count", "aggregations, e.g. count,sum(.amount)=total,mean(.amount)")
+	vAggregate.BoolVar(&csvFormat, "csv", false, "write the groups as CSV")
+	vAggregate.BoolVar(&csvSkipHeader, "csv-skip-header", false, "leave out the CSV header row")
+	vAggregate.BoolVar(&prettyPrint, "p,pretty", prettyPrint, "pretty print JSON output")
+
 	// Import/export collections from/into tables
 	vImport = app.NewVerb("import", "import from a table (CSV, GSheet) into a collection of JSON objects", fnImport)
 	vImport.SetParams("COLLECTION", "(CSV_FILENAME|GSHEET_ID SHEET_NAME)", "ID_COL_NO", "[CELL_RANGE]")
@@ -3133,10 +4374,14 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 	vContact = app.NewVerb("contact", "contact info for questions and support", fnContact)
 	vContact.SetParams("COLLECTION", "[CONTACT_INFO]")
 	vContact.BoolVar(&setValue, "set", false, "set the value(s)")
+	vKeepRevs = app.NewVerb("keep-revisions", "keep prior revisions of JSON objects", fnKeepRevisions)
+	vKeepRevs.SetParams("COLLECTION", "[true|false]")
+	vKeepRevs.BoolVar(&setValue, "set", false, "set the value(s)")
 
 	// We're ready to process args
 	app.Parse()
 	args := app.Args()
+	dataset.LockTimeout = time.Duration(lockTimeout) * time.Second
 
 	// Setup IO
 	var err error
@@ -3176,6 +4421,19 @@ To view a specific example use --help EXAMPLE\_NAME where EXAMPLE\_NAME is one o
 		os.Exit(0)
 	}
 
+	// Ctrl-C cancels appCtx, a second Ctrl-C exits immediately
+	var cancel context.CancelFunc
+	appCtx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		fmt.Fprintf(app.Eout, "\ninterrupted, stopping\n")
+		cancel()
+	}()
+
 	// Application Logic
 	exitCode := app.Run(args)
 	if exitCode != 0 {
@@ -19,6 +19,7 @@
 package dataset
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -77,7 +78,7 @@ func Open(cName string) error {
 	}
 	c, err := openCollection(cName)
 	if err != nil {
-		return fmt.Errorf("%q failed to open, %s", cName, err)
+		return fmt.Errorf("%q failed to open, %w", cName, err)
 	}
 	cMap.collections[cName] = c
 	return nil
@@ -94,7 +95,7 @@ func GetCollection(cName string) (*Collection, error) {
 	if c, found := cMap.collections[cName]; found {
 		return c, nil
 	}
-	return nil, fmt.Errorf("%s not found", cName)
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // Collections returns a list of collections previously
@@ -121,7 +122,7 @@ func Close(cName string) error {
 			return c.Close()
 		}
 	}
-	return fmt.Errorf("%q not found", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // CloseAll goes through the service collection list
@@ -188,7 +189,7 @@ func KeyFilter(cName string, keys []string, fitlerExpr string) ([]string, error)
 	if c, found := cMap.collections[cName]; found {
 		return c.KeyFilter(keys, fitlerExpr)
 	}
-	return nil, fmt.Errorf("%q not found", cName)
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // KeySortByExpression returns a list of sorted keys given a list of keys and expression
@@ -201,7 +202,21 @@ func KeySortByExpression(cName string, keys []string, sortExpr string) ([]string
 	if c, found := cMap.collections[cName]; found {
 		return c.KeySortByExpression(keys, sortExpr)
 	}
-	return nil, fmt.Errorf("%q not found", cName)
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// KeySortByExpressionWithOptions returns a list of sorted keys given a
+// list of keys, expression and sort options
+func KeySortByExpressionWithOptions(cName string, keys []string, sortExpr string, opts *SortOptions) ([]string, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		return c.KeySortByExpressionWithOptions(keys, sortExpr, opts)
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // CreateJSON takes a collection name, key and JSON object
@@ -219,7 +234,7 @@ func CreateJSON(cName string, key string, src []byte) error {
 		c.objectMutex.Unlock()
 		return err
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // ReadJSON takes a collection name, key and returns a JSON object
@@ -233,7 +248,7 @@ func ReadJSON(cName string, key string) ([]byte, error) {
 	if c, found := cMap.collections[cName]; found {
 		return c.ReadJSON(key)
 	}
-	return nil, fmt.Errorf("%q not available", cName)
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // UpdateJSON takes a collection name, key and JSON object
@@ -250,7 +265,100 @@ func UpdateJSON(cName string, key string, src []byte) error {
 		c.objectMutex.Unlock()
 		return err
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// UpdateJSONIfRevision takes a collection name, key, JSON object
+// document and revision token. It updates the collection only if the
+// object's revision token matches, otherwise a *ConflictError is
+// returned. An empty revision skips the check.
+func UpdateJSONIfRevision(cName string, key string, src []byte, revision string) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		err := c.UpdateJSONIfRevision(key, src, revision)
+		c.objectMutex.Unlock()
+		return err
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// JoinJSON takes a collection name, key, JSON object document and
+// *JoinOptions and recursively merges the document with the stored
+// object. If the object doesn't exist it is created.
+func JoinJSON(cName string, key string, src []byte, opts *JoinOptions) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		obj := map[string]interface{}{}
+		if err := DecodeJSON(src, &obj); err != nil {
+			return err
+		}
+		c.objectMutex.Lock()
+		err := c.JoinWithOptions(key, obj, opts)
+		c.objectMutex.Unlock()
+		return err
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// PatchJSON takes a collection name, key and a JSON Patch (RFC 6902)
+// or JSON Merge Patch (RFC 7396) document and applies it to the
+// stored object.
+func PatchJSON(cName string, key string, patchSrc []byte) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		err := c.Patch(key, patchSrc)
+		c.objectMutex.Unlock()
+		return err
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// ReadJSONWithRevision takes a collection name and key and returns
+// the object's JSON source and its revision token.
+func ReadJSONWithRevision(cName string, key string) ([]byte, string, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, "", err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		src, token, err := c.ReadJSONWithRevision(key)
+		c.objectMutex.Unlock()
+		return src, token, err
+	}
+	return nil, "", fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// RevisionToken takes a collection name and key and returns
+// the object's current revision token.
+func RevisionToken(cName string, key string) (string, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return "", err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		token, err := c.RevisionToken(key)
+		c.objectMutex.Unlock()
+		return token, err
+	}
+	return "", fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // DeleteJSON takes a collection name and key and removes
@@ -267,7 +375,7 @@ func DeleteJSON(cName string, key string) error {
 		c.objectMutex.Unlock()
 		return err
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // FrameExists returns true if frame found in service collection,
@@ -295,7 +403,7 @@ func FrameKeys(cName string, fName string) []string {
 		}
 	}
 	if c, found := cMap.collections[cName]; found {
-		f, err := c.FrameRead(fName)
+		f, err := c.getFrameWithoutRows(fName)
 		if err != nil {
 			return nil
 		}
@@ -317,7 +425,24 @@ func FrameCreate(cName string, fName string, keys []string, dotPaths []string, l
 		c.objectMutex.Unlock()
 		return f, err
 	}
-	return nil, fmt.Errorf("%q not available", cName)
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameDefine creates a frame in a service collection from the keys
+// selected by a definition
+func FrameDefine(cName string, fName string, def *FrameDefinition, dotPaths []string, labels []string, verbose bool) (*DataFrame, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		f, err := c.FrameDefine(fName, def, dotPaths, labels, verbose)
+		c.objectMutex.Unlock()
+		return f, err
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // FrameObjects returns a JSON document of a copy of the objects in a frame for
@@ -332,12 +457,31 @@ func FrameObjects(cName string, fName string) ([]map[string]interface{}, error)
 	if c, found := cMap.collections[cName]; found {
 		return c.FrameObjects(fName)
 	}
-	return nil, fmt.Errorf("%q not available", cName)
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameObjectsPage returns limit objects of a frame starting at offset,
+// a limit of zero or less returns the objects to the end of the frame
+func FrameObjectsPage(cName string, fName string, offset int, limit int) ([]map[string]interface{}, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		return c.FrameObjectsPage(fName, offset, limit)
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // FrameRefresh updates the frame object list's for the keys provided. Any new keys
 //  cause a new object to be appended to the end of the list.
 func FrameRefresh(cName string, fName string, keys []string, verbose bool) error {
+	return FrameRefreshContext(context.Background(), cName, fName, keys, verbose, nil)
+}
+
+// FrameRefreshContext is FrameRefresh with a context and progress callback
+func FrameRefreshContext(ctx context.Context, cName string, fName string, keys []string, verbose bool, progress ProgressFunc) error {
 	if cMap == nil || IsOpen(cName) == false {
 		if err := Open(cName); err != nil {
 			return err
@@ -347,9 +491,9 @@ func FrameRefresh(cName string, fName string, keys []string, verbose bool) error
 		c.collectionMutex = new(sync.Mutex)
 		c.objectMutex = new(sync.Mutex)
 		c.frameMutex = new(sync.Mutex)
-		return c.FrameRefresh(fName, keys, verbose)
+		return c.FrameRefreshContext(ctx, fName, keys, verbose, progress)
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // FrameReframe updates the frame object list. If a list of keys is provided then
@@ -365,7 +509,67 @@ func FrameReframe(cName string, fName string, keys []string, verbose bool) error
 		defer c.frameMutex.Unlock()
 		return c.FrameReframe(fName, keys, verbose)
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameRegenerate selects the frame's keys again using its definition
+// and reframes it
+func FrameRegenerate(cName string, fName string, verbose bool) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.frameMutex.Lock()
+		defer c.frameMutex.Unlock()
+		return c.FrameRegenerate(fName, verbose)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameLive registers a frame as a live view of the collection,
+// mode is LiveImmediate, LiveDeferred or empty to stop
+func FrameLive(cName string, fName string, mode string) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.frameMutex.Lock()
+		defer c.frameMutex.Unlock()
+		return c.FrameLive(fName, mode)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameTypes returns the types of a frame's columns
+func FrameTypes(cName string, fName string) ([]*ColumnType, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		return c.FrameTypes(fName)
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameSetTypes declares the types of a frame's columns by label
+func FrameSetTypes(cName string, fName string, types map[string]string, verbose bool) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.frameMutex.Lock()
+		defer c.frameMutex.Unlock()
+		return c.FrameSetTypes(fName, types, verbose)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // FrameClear clears the object and key list from a frame
@@ -380,7 +584,7 @@ func FrameClear(cName string, fName string) error {
 		defer c.frameMutex.Unlock()
 		return c.FrameClear(fName)
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // FrameDelete deletes a frame from a service collection
@@ -395,7 +599,7 @@ func FrameDelete(cName string, fName string) error {
 		defer c.frameMutex.Unlock()
 		return c.FrameDelete(fName)
 	}
-	return fmt.Errorf("%q not available", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // Frames returns a list of frame names in a service collection
@@ -408,9 +612,128 @@ func Frames(cName string) []string {
 	return []string{}
 }
 
+// IndexCreate declares a secondary index on a dotpath in a collection
+func IndexCreate(cName string, dotPath string) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		defer c.objectMutex.Unlock()
+		return c.IndexCreate(dotPath)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// IndexDrop removes a secondary index from a collection
+func IndexDrop(cName string, dotPath string) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		defer c.objectMutex.Unlock()
+		return c.IndexDrop(dotPath)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// IndexRebuild regenerates a collection's index on a dotpath
+func IndexRebuild(cName string, dotPath string) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.objectMutex.Lock()
+		defer c.objectMutex.Unlock()
+		return c.IndexRebuild(dotPath)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// Indexes returns a list of indexed dotpaths in a collection
+func Indexes(cName string) []string {
+	if IsOpen(cName) == true {
+		if c, found := cMap.collections[cName]; found {
+			return c.Indexes()
+		}
+	}
+	return []string{}
+}
+
+// IndexFrame builds a full text index of a frame in indexPath
+func IndexFrame(cName string, fName string, indexPath string) error {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.frameMutex.Lock()
+		defer c.frameMutex.Unlock()
+		return c.IndexFrame(fName, indexPath)
+	}
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// Search runs a query against a collection's full text index
+func Search(cName string, indexPath string, query string, opts *SearchOptions) (*SearchResult, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		return c.Search(indexPath, query, opts)
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// LunrIndex builds a Lunr.js index and document store from a frame
+func LunrIndex(cName string, fName string, opts *LunrOptions) (*LunrBundle, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.frameMutex.Lock()
+		defer c.frameMutex.Unlock()
+		return c.LunrIndex(fName, opts)
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
+// FrameGroupBy groups a frame's objects and calculates aggregations
+// for each group
+func FrameGroupBy(cName string, fName string, groupBy []string, aggregations []*Aggregation) (*DataFrame, error) {
+	if cMap == nil || IsOpen(cName) == false {
+		if err := Open(cName); err != nil {
+			return nil, err
+		}
+	}
+	if c, found := cMap.collections[cName]; found {
+		c.frameMutex.Lock()
+		defer c.frameMutex.Unlock()
+		return c.FrameGroupBy(fName, groupBy, aggregations)
+	}
+	return nil, fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
+}
+
 // Check checks a dataset collection and reports error to console.
 // NOTE: Collection objects are locked during check!
 func Check(cName string, verbose bool) error {
+	return CheckContext(context.Background(), cName, verbose, nil)
+}
+
+// CheckContext is Check with a context and progress callback
+func CheckContext(ctx context.Context, cName string, verbose bool, progress ProgressFunc) error {
 	if cMap == nil || IsOpen(cName) == false {
 		if err := Open(cName); err != nil {
 			return err
@@ -418,16 +741,23 @@ func Check(cName string, verbose bool) error {
 	}
 	if c, found := cMap.collections[cName]; found {
 		c.objectMutex.Lock()
-		err := analyzer(cName, verbose)
+		err := analyzerContext(ctx, cName, verbose, progress)
 		c.objectMutex.Unlock()
 		return err
 	}
-	return fmt.Errorf("%q not found", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // Repair repairs a collection
 // NOTE: Collection objects are locked during repair!
 func Repair(cName string, verbose bool) error {
+	return RepairContext(context.Background(), cName, verbose, nil)
+}
+
+// RepairContext is Repair with a context and progress callback. If
+// ctx is done before the repair finishes the collection's metadata
+// is left unchanged.
+func RepairContext(ctx context.Context, cName string, verbose bool, progress ProgressFunc) error {
 	if cMap == nil || IsOpen(cName) == false {
 		// Check to see if we have a collection.json or pairtree.
 		//FIXME: this needs to also work with uri to S3 like object stores.
@@ -453,11 +783,11 @@ func Repair(cName string, verbose bool) error {
 	}
 	if c, found := cMap.collections[cName]; found {
 		c.objectMutex.Lock()
-		err := repair(cName, verbose)
+		err := repairContext(ctx, cName, verbose, progress)
 		c.objectMutex.Unlock()
 		return err
 	}
-	return fmt.Errorf("%q not found", cName)
+	return fmt.Errorf("%w, %q", ErrCollectionNotFound, cName)
 }
 
 // SetWho sets the collection's Who metadata value for a collection
@@ -467,7 +797,7 @@ func SetWho(cName string, names []string) error {
 		return err
 	}
 	c.Who = names
-	if err = c.saveMetadata(); err != nil {
+	if err = c.withLock(c.saveMetadata); err != nil {
 		return err
 	}
 	return c.addNamaste()
@@ -489,7 +819,7 @@ func SetWhat(cName string, what string) error {
 		return err
 	}
 	c.What = what
-	if err = c.saveMetadata(); err != nil {
+	if err = c.withLock(c.saveMetadata); err != nil {
 		return err
 	}
 	return c.addNamaste()
@@ -511,7 +841,7 @@ func SetWhen(cName string, when string) error {
 		return err
 	}
 	c.When = when
-	if err = c.saveMetadata(); err != nil {
+	if err = c.withLock(c.saveMetadata); err != nil {
 		return err
 	}
 	return c.addNamaste()
@@ -533,7 +863,7 @@ func SetWhere(cName string, where string) error {
 		return err
 	}
 	c.Where = where
-	if err = c.saveMetadata(); err != nil {
+	if err = c.withLock(c.saveMetadata); err != nil {
 		return err
 	}
 	return c.addNamaste()
@@ -555,7 +885,7 @@ func SetVersion(cName string, version string) error {
 		return err
 	}
 	c.Version = version
-	return c.saveMetadata()
+	return c.withLock(c.saveMetadata)
 }
 
 // GetVersion gets the version info for the collection.
@@ -574,7 +904,7 @@ func SetContact(cName string, contact string) error {
 		return err
 	}
 	c.Contact = contact
-	return c.saveMetadata()
+	return c.withLock(c.saveMetadata)
 }
 
 // GetContact gets the contact info for the collection.
@@ -585,3 +915,22 @@ func GetContact(cName string) string {
 	}
 	return c.Contact
 }
+
+// SetKeepRevisions turns on (or off) keeping prior versions of objects
+func SetKeepRevisions(cName string, keep bool) error {
+	c, err := GetCollection(cName)
+	if err != nil {
+		return err
+	}
+	c.KeepRevisions = keep
+	return c.withLock(c.saveMetadata)
+}
+
+// GetKeepRevisions returns true if the collection keeps prior versions of objects
+func GetKeepRevisions(cName string) bool {
+	c, err := GetCollection(cName)
+	if err != nil {
+		return false
+	}
+	return c.KeepRevisions
+}
@@ -0,0 +1,501 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+)
+
+//
+// NOTE: columns.go evaluates computed frame columns. Where a frame
+// takes a dotpath for a column it also takes a function expression
+// or a Go template evaluated against the source object, e.g.
+//
+//     concat(.family, ", ", .given)
+//     year(.date)
+//     count(.creators)
+//     {{ .family }}, {{ .given }}
+//
+// Function arguments are dotpaths, strings, numbers, true, false, null
+// or other function expressions. Templates can call the same
+// functions (e.g. `{{ year .date }}`). The expressions are saved with
+// the frame in place of its dotpaths and evaluated again when the
+// frame is refreshed.
+//
+
+// columnFunc is a function that can be used in a computed column
+type columnFunc struct {
+	// minArgs and maxArgs bound the number of arguments, maxArgs
+	// of -1 takes any number
+	minArgs int
+	maxArgs int
+	fn      func(args []interface{}) (interface{}, error)
+}
+
+var (
+	// columnFuncs are the functions available to computed columns
+	columnFuncs map[string]*columnFunc
+
+	// columnTemplateFuncs exposes the column functions to templates
+	columnTemplateFuncs = template.FuncMap{}
+)
+
+func init() {
+	columnFuncs = map[string]*columnFunc{
+		"concat":   {1, -1, columnConcat},
+		"join":     {1, 2, columnJoin},
+		"coalesce": {1, -1, columnCoalesce},
+		"count":    {1, 1, columnCount},
+		"first":    {1, 1, columnFirst},
+		"last":     {1, 1, columnLast},
+		"lower":    {1, 1, columnStringFunc(strings.ToLower)},
+		"upper":    {1, 1, columnStringFunc(strings.ToUpper)},
+		"trim":     {1, 1, columnStringFunc(strings.TrimSpace)},
+		"year":     {1, 1, columnDateFunc(func(t time.Time) int { return t.Year() })},
+		"month":    {1, 1, columnDateFunc(func(t time.Time) int { return int(t.Month()) })},
+		"day":      {1, 1, columnDateFunc(func(t time.Time) int { return t.Day() })},
+	}
+	// NOTE: templates call the same functions
+	for name, fn := range columnFuncs {
+		f := fn
+		columnTemplateFuncs[name] = func(args ...interface{}) (interface{}, error) {
+			if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+				return nil, fmt.Errorf("wrong number of arguments")
+			}
+			return f.fn(args)
+		}
+	}
+}
+
+// columnString renders a value as a string, null is an empty string
+func columnString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return colToString(value)
+}
+
+// columnConcat joins its arguments as strings, nulls are skipped
+func columnConcat(args []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(columnString(arg))
+	}
+	return sb.String(), nil
+}
+
+// columnJoin joins the elements of an array with a separator (by
+// default ", ")
+func columnJoin(args []interface{}) (interface{}, error) {
+	sep := ", "
+	if len(args) > 1 {
+		sep = columnString(args[1])
+	}
+	a, ok := args[0].([]interface{})
+	if ok == false {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return columnString(args[0]), nil
+	}
+	parts := []string{}
+	for _, item := range a {
+		if item != nil {
+			parts = append(parts, columnString(item))
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// columnCoalesce returns its first argument that isn't null or an
+// empty string
+func columnCoalesce(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if isNull(arg) == false {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+// columnCount counts the elements of an array, the attributes of an
+// object or the characters of a string
+func columnCount(args []interface{}) (interface{}, error) {
+	n := 0
+	switch v := args[0].(type) {
+	case nil:
+	case []interface{}:
+		n = len(v)
+	case map[string]interface{}:
+		n = len(v)
+	case string:
+		n = utf8.RuneCountInString(v)
+	default:
+		n = 1
+	}
+	return json.Number(strconv.Itoa(n)), nil
+}
+
+// columnFirst returns the first element of an array
+func columnFirst(args []interface{}) (interface{}, error) {
+	if a, ok := args[0].([]interface{}); ok {
+		if len(a) == 0 {
+			return nil, nil
+		}
+		return a[0], nil
+	}
+	return args[0], nil
+}
+
+// columnLast returns the last element of an array
+func columnLast(args []interface{}) (interface{}, error) {
+	if a, ok := args[0].([]interface{}); ok {
+		if len(a) == 0 {
+			return nil, nil
+		}
+		return a[len(a)-1], nil
+	}
+	return args[0], nil
+}
+
+// columnStringFunc applies fn to a string argument
+func columnStringFunc(fn func(string) string) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(columnString(args[0])), nil
+	}
+}
+
+// columnDateFunc applies fn to a date argument, a year on its own
+// (e.g. "2019") is accepted as a date
+func columnDateFunc(fn func(time.Time) int) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if isNull(args[0]) {
+			return nil, nil
+		}
+		s := strings.TrimSpace(columnString(args[0]))
+		t, _, ok := parseDate(s)
+		if ok == false {
+			var err error
+			if t, err = time.Parse("2006", s); err != nil {
+				return nil, fmt.Errorf("%q is not a date", s)
+			}
+		}
+		return json.Number(strconv.Itoa(fn(t))), nil
+	}
+}
+
+// columnExpr is a compiled function expression or one of its arguments
+type columnExpr struct {
+	dotPath string
+	literal interface{}
+	fn      *columnFunc
+	args    []*columnExpr
+}
+
+// eval evaluates an expression against an object, a dotpath that
+// isn't found is null
+func (e *columnExpr) eval(obj interface{}) (interface{}, error) {
+	switch {
+	case e.fn != nil:
+		args := make([]interface{}, len(e.args))
+		for i, arg := range e.args {
+			value, err := arg.eval(obj)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return e.fn.fn(args)
+	case e.dotPath != "":
+		value, err := evalPath(e.dotPath, obj)
+		if err != nil {
+			return nil, nil
+		}
+		return value, nil
+	}
+	return e.literal, nil
+}
+
+// columnParser holds the state of parsing a function expression, it
+// shares the query language's tokens
+type columnParser struct {
+	src    string
+	tokens []queryToken
+	i      int
+}
+
+// errorf returns an error at the position of a token
+func (p *columnParser) errorf(tok queryToken, format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d in column %q", fmt.Sprintf(format, args...), tok.pos+1, p.src)
+}
+
+func (p *columnParser) next() queryToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *columnParser) parseExpr() (*columnExpr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokDotpath:
+		return &columnExpr{dotPath: tok.text}, nil
+	case tokString:
+		return &columnExpr{literal: tok.value}, nil
+	case tokNumber:
+		return &columnExpr{literal: json.Number(tok.text)}, nil
+	case tokWord:
+		switch tok.text {
+		case "true":
+			return &columnExpr{literal: true}, nil
+		case "false":
+			return &columnExpr{literal: false}, nil
+		case "null":
+			return &columnExpr{}, nil
+		}
+		return p.parseCall(tok)
+	}
+	return nil, p.errorf(tok, "expected a dotpath, value or function")
+}
+
+// parseCall parses the arguments of a function call
+func (p *columnParser) parseCall(name queryToken) (*columnExpr, error) {
+	fn, ok := columnFuncs[name.text]
+	if ok == false {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	if tok := p.next(); tok.kind != tokPunct || tok.text != "(" {
+		return nil, p.errorf(tok, "expected \"(\"")
+	}
+	e := &columnExpr{fn: fn}
+	for {
+		if tok := p.tokens[p.i]; tok.kind == tokPunct && tok.text == ")" && len(e.args) == 0 {
+			p.next()
+			break
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		e.args = append(e.args, arg)
+		tok := p.next()
+		if tok.kind == tokPunct && tok.text == ")" {
+			break
+		}
+		if tok.kind != tokPunct || tok.text != "," {
+			return nil, p.errorf(tok, "expected \",\" or \")\"")
+		}
+	}
+	if len(e.args) < fn.minArgs || (fn.maxArgs >= 0 && len(e.args) > fn.maxArgs) {
+		return nil, p.errorf(name, "wrong number of arguments to %s", name.text)
+	}
+	return e, nil
+}
+
+// parseColumnExpr compiles a function expression
+func parseColumnExpr(src string) (*columnExpr, error) {
+	tokens, err := tokenizeQuery(src)
+	if err != nil {
+		if qe, ok := err.(*QueryError); ok {
+			return nil, fmt.Errorf("%s at position %d in column %q", qe.Msg, qe.Pos+1, src)
+		}
+		return nil, err
+	}
+	p := &columnParser{src: src, tokens: tokens}
+	name := p.next()
+	if name.kind != tokWord {
+		return nil, p.errorf(name, "expected a function")
+	}
+	e, err := p.parseCall(name)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return e, nil
+}
+
+// columnCacheSize bounds the number of compiled computed columns kept
+const columnCacheSize = 256
+
+// columnCache holds compiled computed columns by source
+var columnCache = struct {
+	sync.Mutex
+	columns map[string]interface{}
+}{columns: map[string]interface{}{}}
+
+// columnValueFunc is appended to each printed pipeline of a column
+// template so a missing or null value renders as an empty string
+const columnValueFunc = "columnValue"
+
+// columnValue returns a template pipeline's value, null is an
+// empty string rather than "<no value>"
+func columnValue(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
+// columnValueNodes appends columnValue to the pipelines that print
+// in a template's parse tree
+func columnValueNodes(t *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				columnValueNodes(t, child)
+			}
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(columnValueFunc).SetTree(t).SetPos(n.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		columnValueNodes(t, n.List)
+		columnValueNodes(t, n.ElseList)
+	case *parse.RangeNode:
+		columnValueNodes(t, n.List)
+		columnValueNodes(t, n.ElseList)
+	case *parse.WithNode:
+		columnValueNodes(t, n.List)
+		columnValueNodes(t, n.ElseList)
+	}
+}
+
+// compileColumnTemplate parses a column template
+func compileColumnTemplate(p string) (*template.Template, error) {
+	tmpl, err := template.New("column").Funcs(columnTemplateFuncs).Funcs(template.FuncMap{
+		columnValueFunc: columnValue,
+	}).Parse(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			columnValueNodes(t.Tree, t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+// isComputedColumn returns true if a column's source is a function
+// expression or a template rather than a dotpath or JMESPath
+// expression
+func isComputedColumn(p string) bool {
+	if strings.Contains(p, "{{") {
+		return true
+	}
+	return isPathExpression(p) == false && strings.Contains(p, "(")
+}
+
+// compileColumn returns the compiled form of a computed column, a
+// *template.Template or a *columnExpr
+func compileColumn(p string) (interface{}, error) {
+	columnCache.Lock()
+	defer columnCache.Unlock()
+	if c, ok := columnCache.columns[p]; ok {
+		return c, nil
+	}
+	var (
+		c   interface{}
+		err error
+	)
+	if strings.Contains(p, "{{") {
+		if c, err = compileColumnTemplate(p); err != nil {
+			return nil, fmt.Errorf("%q is not a valid column template, %s", p, err)
+		}
+	} else if c, err = parseColumnExpr(p); err != nil {
+		return nil, err
+	}
+	// NOTE: when the cache is full an arbitrary column is evicted
+	if len(columnCache.columns) >= columnCacheSize {
+		for k := range columnCache.columns {
+			delete(columnCache.columns, k)
+			break
+		}
+	}
+	columnCache.columns[p] = c
+	return c, nil
+}
+
+// checkColumn returns an error if a column's source doesn't compile
+func checkColumn(p string) error {
+	if isComputedColumn(p) {
+		_, err := compileColumn(p)
+		return err
+	}
+	return checkPath(p)
+}
+
+// evalColumn returns the value of a frame column's source applied to
+// an object. Like a dotpath that isn't found a computed column that
+// results in null is an error.
+func evalColumn(p string, obj interface{}) (interface{}, error) {
+	if isComputedColumn(p) == false {
+		return evalPath(p, obj)
+	}
+	c, err := compileColumn(p)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch e := c.(type) {
+	case *template.Template:
+		buf := new(bytes.Buffer)
+		if err := e.Execute(buf, obj); err != nil {
+			return nil, fmt.Errorf("%q, %s", p, err)
+		}
+		value = buf.String()
+	case *columnExpr:
+		if value, err = e.eval(obj); err != nil {
+			return nil, fmt.Errorf("%q, %s", p, err)
+		}
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%q has no value", p)
+	}
+	return value, nil
+}
@@ -0,0 +1,196 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEvalColumn(t *testing.T) {
+	obj := map[string]interface{}{}
+	src := []byte(`{
+		"family": "Doe",
+		"given": "Jane",
+		"date": "2019-05-01",
+		"year": "2008",
+		"creators": [ {"name": "A"}, {"name": "B"}, {"name": "C"} ],
+		"tags": [ "x", "y" ],
+		"blank": "",
+		"text": "a <no value> b",
+		"none": null
+	}`)
+	if err := json.Unmarshal(src, &obj); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	columns := []struct {
+		expr     string
+		expected string
+	}{
+		{`concat(.family, ", ", .given)`, `"Doe, Jane"`},
+		{`concat(.family, .missing, "!")`, `"Doe!"`},
+		{`year(.date)`, `2019`},
+		{`month(.date)`, `5`},
+		{`year(.year)`, `2008`},
+		{`count(.creators)`, `3`},
+		{`count(.missing)`, `0`},
+		{`join(.tags)`, `"x, y"`},
+		{`join(.tags, ";")`, `"x;y"`},
+		{`upper(first(.tags))`, `"X"`},
+		{`last(.creators)`, `{"name":"C"}`},
+		{`coalesce(.blank, .missing, .given)`, `"Jane"`},
+		{`{{ .family }}, {{ .given }}`, `"Doe, Jane"`},
+		{`{{ .family }}{{ .missing }}`, `"Doe"`},
+		{`{{ .family }}{{ .none }}`, `"Doe"`},
+		{`{{ with .missing }}x{{ else }}{{ .none }}-{{ end }}`, `"-"`},
+		{`{{ year .date }}-{{ count .tags }}`, `"2019-2"`},
+		{`.family`, `"Doe"`},
+	}
+	for _, c := range columns {
+		if err := checkColumn(c.expr); err != nil {
+			t.Errorf("expected %s to compile, got %s", c.expr, err)
+			continue
+		}
+		value, err := evalColumn(c.expr, obj)
+		if err != nil {
+			t.Errorf("expected %s to evaluate, got %s", c.expr, err)
+			continue
+		}
+		src, _ := json.Marshal(value)
+		if string(src) != c.expected {
+			t.Errorf("expected %s to be %s, got %s", c.expr, c.expected, src)
+		}
+	}
+
+	// Text that happens to read "<no value>" is kept
+	if value, err := evalColumn(`{{ .text }}`, obj); err != nil || value != "a <no value> b" {
+		t.Errorf("expected {{ .text }} to be %q, got %v, %v", "a <no value> b", value, err)
+	}
+
+	// A computed column without a value is missing like a dotpath
+	for _, expr := range []string{`first(.missing)`, `coalesce(.blank)`} {
+		if _, err := evalColumn(expr, obj); err == nil {
+			t.Errorf("expected %s to have no value", expr)
+		}
+	}
+	if _, err := evalColumn(`year(.family)`, obj); err == nil {
+		t.Errorf("expected year(.family) to fail")
+	}
+	for _, expr := range []string{`nope(.a)`, `count(.a, .b)`, `concat(.a`, `concat(.a) .b`, `{{ .a `} {
+		if err := checkColumn(expr); err == nil {
+			t.Errorf("expected %s not to compile", expr)
+		}
+	}
+
+	// The compiled columns are bounded
+	for i := 0; i < columnCacheSize+10; i++ {
+		if err := checkColumn(fmt.Sprintf(`{{ .family }}-%d`, i)); err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+	columnCache.Lock()
+	if len(columnCache.columns) > columnCacheSize {
+		t.Errorf("expected at most %d cached columns, got %d", columnCacheSize, len(columnCache.columns))
+	}
+	columnCache.Unlock()
+}
+
+func TestComputedFrameColumns(t *testing.T) {
+	cName := path.Join("testdata", "frame_columns.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("expected to create %q, got %s", cName, err)
+		t.FailNow()
+	}
+	defer c.Close()
+	objects := map[string]string{
+		"k1": `{"family": "Doe", "given": "Jane", "date": "2019-05-01", "creators": ["a", "b"]}`,
+		"k2": `{"family": "Roe", "given": "Rick", "date": "2020-01-02", "creators": ["c"]}`,
+	}
+	keys := []string{"k1", "k2"}
+	for _, key := range keys {
+		if err := c.CreateJSON(key, []byte(objects[key])); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	dotPaths := []string{"._Key", `concat(.family, ", ", .given)`, "year(.date)", "count(.creators)", "{{ .given }} {{ .family }}"}
+	labels := []string{"id", "name", "year", "creators", "display"}
+	if _, err := c.FrameCreate("bad", keys, []string{"nope(.a)"}, []string{"a"}, false); err == nil {
+		t.Errorf("expected an unknown function to fail frame creation")
+	}
+	f, err := c.FrameCreate("f1", keys, dotPaths, labels, false)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	row := f.ObjectMap["k1"].(map[string]interface{})
+	if row["name"] != "Doe, Jane" || row["display"] != "Jane Doe" || row["year"] != json.Number("2019") || row["creators"] != json.Number("2") {
+		t.Errorf("unexpected computed row %+v", row)
+	}
+	if typ := f.columnType("year"); typ == nil || typ.Type != TypeInteger {
+		t.Errorf("expected year to be an integer column, got %+v", typ)
+	}
+
+	// The expressions are saved with the frame and evaluated again on refresh
+	if err := c.UpdateJSON("k1", []byte(`{"family": "Doe", "given": "Janet", "date": "2021-05-01", "creators": ["a", "b", "c"]}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameRefresh("f1", []string{"k1"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	f, err = c.FrameRead("f1")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if strings.Join(f.DotPaths, "|") != strings.Join(dotPaths, "|") {
+		t.Errorf("expected saved columns %q, got %q", dotPaths, f.DotPaths)
+	}
+	row = f.ObjectMap["k1"].(map[string]interface{})
+	if row["name"] != "Doe, Janet" || row["year"] != json.Number("2021") || row["creators"] != json.Number("3") {
+		t.Errorf("unexpected refreshed row %+v", row)
+	}
+
+	// Merging a table leaves computed columns out of the objects
+	table := [][]interface{}{
+		{"id", "name", "year", "creators", "display"},
+		{"k3", "Poe, Edgar", "1845", "1", "Edgar Poe"},
+	}
+	if err := c.MergeFromTable("f1", table, true, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	obj := map[string]interface{}{}
+	if err := c.Read("k3", obj, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(obj) != 1 || obj["_Key"] != "k3" {
+		t.Errorf("expected only _Key in merged object, got %+v", obj)
+	}
+}
@@ -0,0 +1,152 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+)
+
+//
+// NOTE: conflict.go provides optimistic concurrency for updates.
+// An object's revision token is a checksum of its stored JSON source.
+// A caller reads the object and its token, makes changes then updates
+// passing the token back. If another writer changed the object in the
+// meantime the update fails with a *ConflictError.
+//
+
+// ConflictError is returned when an object's revision token doesn't
+// match the one expected by an update.
+type ConflictError struct {
+	// Key of the object being updated
+	Key string
+	// Expected is the revision token the caller expected
+	Expected string
+	// Actual is the object's current revision token, empty if
+	// the object doesn't exist.
+	Actual string
+}
+
+// Error implements the error interface
+func (e *ConflictError) Error() string {
+	if e.Actual == "" {
+		return fmt.Sprintf("conflict updating %q, expected revision %s, object not found", e.Key, e.Expected)
+	}
+	return fmt.Sprintf("conflict updating %q, expected revision %s, found %s", e.Key, e.Expected, e.Actual)
+}
+
+// Unwrap returns ErrRevisionConflict
+func (e *ConflictError) Unwrap() error {
+	return ErrRevisionConflict
+}
+
+// revisionToken returns the revision token for JSON source
+func revisionToken(src []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(src))
+}
+
+// RevisionToken returns the current revision token of an object.
+// To update an object you've read use ReadJSONWithRevision or
+// ReadWithRevision instead, the object may change between calls.
+func (c *Collection) RevisionToken(key string) (string, error) {
+	_, token, err := c.ReadJSONWithRevision(key)
+	return token, err
+}
+
+// ReadJSONWithRevision returns an object's JSON source and the
+// revision token of that source
+func (c *Collection) ReadJSONWithRevision(key string) ([]byte, string, error) {
+	src, err := c.ReadJSON(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return src, revisionToken(src), nil
+}
+
+// ReadWithRevision is Read returning the revision token of the
+// object read
+func (c *Collection) ReadWithRevision(name string, data map[string]interface{}, cleanObject bool) (string, error) {
+	src, token, err := c.ReadJSONWithRevision(name)
+	if err != nil {
+		return "", err
+	}
+	if err := decodeObject(src, data, cleanObject); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkRevision returns a *ConflictError if the object's revision
+// token isn't the expected one. An empty expected revision always
+// passes.
+func (c *Collection) checkRevision(key string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	actual := ""
+	if c.KeyExists(normalizeKeyName(key)) {
+		src, err := c.ReadJSON(key)
+		if err != nil {
+			return err
+		}
+		actual = revisionToken(src)
+	}
+	if actual != expected {
+		return &ConflictError{Key: key, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// UpdateJSONIfRevision updates a JSON doc only if its revision token
+// matches revision. An empty revision skips the check.
+func (c *Collection) UpdateJSONIfRevision(name string, src []byte, revision string) error {
+	// Hold the lock so no other process writes between check and update
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if err := c.checkRevision(name, revision); err != nil {
+		return err
+	}
+	return c.updateJSON(name, src, "update")
+}
+
+// UpdateIfRevision updates a JSON doc from data only if its revision
+// token matches revision. An empty revision skips the check.
+func (c *Collection) UpdateIfRevision(name string, data map[string]interface{}, revision string) error {
+	src, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Update can't marshal into JSON %s, %s", name, err)
+	}
+	return c.UpdateJSONIfRevision(name, src, revision)
+}
+
+// JoinIfRevision joins obj to an object only if its revision token
+// matches revision. An empty revision skips the check.
+func (c *Collection) JoinIfRevision(key string, obj map[string]interface{}, overwrite bool, revision string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if err := c.checkRevision(key, revision); err != nil {
+		return err
+	}
+	return c.join(key, obj, joinOptions(overwrite))
+}
@@ -0,0 +1,88 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestConflict(t *testing.T) {
+	cName := path.Join("testdata", "conflict_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	if err := c.Create("one", map[string]interface{}{"count": 1}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	rev1, err := c.RevisionToken("one")
+	if err != nil || rev1 == "" {
+		t.Errorf("expected a revision token, %v", err)
+		t.FailNow()
+	}
+	if err := c.UpdateIfRevision("one", map[string]interface{}{"count": 2}, rev1); err != nil {
+		t.Errorf("expected update with current revision, %s", err)
+	}
+	rev2, _ := c.RevisionToken("one")
+	if rev1 == rev2 {
+		t.Errorf("expected revision to change after update")
+	}
+	obj := map[string]interface{}{}
+	if rev, err := c.ReadWithRevision("one", obj, true); err != nil || rev != rev2 {
+		t.Errorf("expected revision %s with the object read, got %s, %v", rev2, rev, err)
+	} else if obj["count"].(json.Number).String() != "2" || obj["_Key"] != nil {
+		t.Errorf("expected clean object with count 2, got %+v", obj)
+	}
+
+	// A stale revision is a conflict
+	err = c.UpdateIfRevision("one", map[string]interface{}{"count": 3}, rev1)
+	if err == nil {
+		t.Errorf("expected a conflict updating with a stale revision")
+	} else if conflict, ok := err.(*ConflictError); ok == false {
+		t.Errorf("expected *ConflictError, got %T %s", err, err)
+	} else if conflict.Expected != rev1 || conflict.Actual != rev2 {
+		t.Errorf("unexpected conflict %+v", conflict)
+	}
+	obj = map[string]interface{}{}
+	c.Read("one", obj, true)
+	if obj["count"].(json.Number).String() != "2" {
+		t.Errorf("expected object unchanged after conflict, got %+v", obj)
+	}
+
+	if err := c.JoinIfRevision("one", map[string]interface{}{"name": "one"}, false, rev1); err == nil {
+		t.Errorf("expected a conflict joining with a stale revision")
+	}
+	if err := c.JoinIfRevision("one", map[string]interface{}{"name": "one"}, false, rev2); err != nil {
+		t.Errorf("expected join with current revision, %s", err)
+	}
+	if err := c.UpdateJSONIfRevision("one", []byte(`{"count":4}`), ""); err != nil {
+		t.Errorf("expected an empty revision to skip the check, %s", err)
+	}
+	if err := c.UpdateJSONIfRevision("missing", []byte(`{}`), rev1); err == nil {
+		t.Errorf("expected a conflict for a missing object")
+	}
+}
@@ -20,8 +20,10 @@ package dataset
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -37,7 +39,6 @@ import (
 
 	// Caltech Library packages
 	"github.com/caltechlibrary/dataset/tbl"
-	"github.com/caltechlibrary/dotpath"
 	"github.com/caltechlibrary/namaste"
 	"github.com/caltechlibrary/pairtree"
 	"github.com/caltechlibrary/shuffle"
@@ -87,8 +88,9 @@ type Collection struct {
 	// workPath holds the path (i.e. non-protocol and hostname, in URI)
 	workPath string // `json:"-"`
 
-	// KeyMap holds the document key to path in the collection
-	KeyMap map[string]string `json:"keymap"`
+	// keyIndex holds the document key to path in the collection,
+	// it is stored in _keys.jsonl rather than collection.json
+	keyIndex *keyIndex
 
 	// Store holds the storage system information (e.g. local disc, S3, GS)
 	// and related methods for interacting with it
@@ -97,6 +99,13 @@ type Collection struct {
 	// FrameMap is a list of frame names and with rel path to the frame defined in the collection
 	FrameMap map[string]string `json:"frames"`
 
+	// IndexMap holds the indexed dotpaths with the rel path to their index
+	IndexMap map[string]string `json:"indexes,omitempty"`
+
+	// LiveFrames holds the names of the frames kept up to date as
+	// objects change with their mode, LiveImmediate or LiveDeferred
+	LiveFrames map[string]string `json:"live_frames,omitempty"`
+
 	//
 	// Metadata for collection.
 	//
@@ -111,6 +120,11 @@ type Collection struct {
 	// Contact info
 	Contact string `json:"contact,omitempty"`
 
+	// KeepRevisions when true saves prior versions of objects
+	// so they can be listed with History() and brought back
+	// with Restore().
+	KeepRevisions bool `json:"keep_revisions,omitempty"`
+
 	// CodeMeta is a relative path or URL to a Code Meta
 	// JSON document for the collection.  Often it'll be
 	// in the collection's root and have the value "codemeta.json"
@@ -152,6 +166,24 @@ type Collection struct {
 
 	// frameMutex is used to sync on frame writing (e.g. writes involving _frame path)
 	frameMutex *sync.Mutex
+
+	// fileLock holds the exclusive lock on the collection between processes
+	fileLock *collectionLock
+
+	// schema holds the collection's JSON Schema once loaded
+	schema       *jsonSchema
+	schemaLoaded bool
+
+	// indexes holds the dotpath indexes once used
+	indexes map[string]*dotpathIndex
+
+	// notLive holds the frames stopped being live since the
+	// collection was opened so mergeFrameMap doesn't restore them
+	notLive map[string]bool
+
+	// liveCache holds the immediate live frames between writes,
+	// see live.go
+	liveCache map[string]*liveFrame
 }
 
 //
@@ -182,7 +214,8 @@ func keyAndFName(name string) (string, string) {
 	return name, url.QueryEscape(name) + ".json"
 }
 
-// saveMetadata writes the collection's metadata to  c.Store and c.workPath
+// saveMetadata writes the collection's metadata to  c.Store and c.workPath,
+// the caller holds the collection's lock
 func (c *Collection) saveMetadata() error {
 	if c.unsafeSaveMetadata == true {
 		// NOTE: We're playing fast and loose with the collection metadata, skip saveMetadata().
@@ -196,6 +229,15 @@ func (c *Collection) saveMetadata() error {
 			}
 		}
 	}
+	c.mergeFrameMap()
+
+	// NOTE: Write out a migrated key index before collection.json
+	// drops the legacy keymap.
+	if c.keyIndex != nil && c.keyIndex.migrate {
+		if err := c.keyIndex.save(); err != nil {
+			return fmt.Errorf("Can't store key index, %s", err)
+		}
+	}
 	src, err := json.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("Can't marshal metadata, %s", err)
@@ -247,6 +289,47 @@ func (c *Collection) addNamaste() error {
 	return nil
 }
 
+// mergeFrameMap adds frames, indexes and live frames saved by other processes
+// since the collection was opened so saveMetadata doesn't drop them.
+func (c *Collection) mergeFrameMap() {
+	src, err := c.Store.ReadFile(path.Join(c.workPath, "collection.json"))
+	if err != nil {
+		return
+	}
+	saved := struct {
+		FrameMap   map[string]string `json:"frames"`
+		IndexMap   map[string]string `json:"indexes"`
+		LiveFrames map[string]string `json:"live_frames"`
+	}{}
+	if err := json.Unmarshal(src, &saved); err != nil {
+		return
+	}
+	for name, p := range saved.FrameMap {
+		if _, ok := c.FrameMap[name]; ok == false && c.Store.IsFile(path.Join(c.workPath, p)) {
+			if c.FrameMap == nil {
+				c.FrameMap = make(map[string]string)
+			}
+			c.FrameMap[name] = p
+		}
+	}
+	for dotPath, p := range saved.IndexMap {
+		if _, ok := c.IndexMap[dotPath]; ok == false && c.Store.IsFile(path.Join(c.workPath, p)) {
+			if c.IndexMap == nil {
+				c.IndexMap = make(map[string]string)
+			}
+			c.IndexMap[dotPath] = p
+		}
+	}
+	for name, mode := range saved.LiveFrames {
+		if _, ok := c.LiveFrames[name]; ok == false && c.FrameMap[name] != "" && c.notLive[name] == false {
+			if c.LiveFrames == nil {
+				c.LiveFrames = make(map[string]string)
+			}
+			c.LiveFrames[name] = mode
+		}
+	}
+}
+
 //
 // Public interface for dataset
 //
@@ -299,13 +382,14 @@ func InitCollection(name string) (*Collection, error) {
 		c.What = fmt.Sprintf("A dataset %s collection initilized on %s", Version, dt.Format("Monday, January 2, 2006 at 3:04pm MST.."))
 	}
 	c.workPath = collectionName
-	c.KeyMap = map[string]string{}
 	c.Store = store
+	c.keyIndex = newKeyIndex(store, collectionName)
+	c.fileLock = new(collectionLock)
 
 	c.collectionMutex = new(sync.Mutex)
 	c.objectMutex = new(sync.Mutex)
 	c.frameMutex = new(sync.Mutex)
-	err = c.saveMetadata()
+	err = c.withLock(c.saveMetadata)
 	if err != nil {
 		return nil, err
 	}
@@ -320,7 +404,15 @@ func openCollection(name string) (*Collection, error) {
 		return nil, err
 	}
 	collectionName := collectionNameAsPath(name)
+	l, err := acquireLock(store, collectionName, false)
+	if err != nil {
+		return nil, err
+	}
 	src, err := store.ReadFile(path.Join(collectionName, "collection.json"))
+	l.release()
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w, %s", ErrCollectionNotFound, name)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -328,13 +420,21 @@ func openCollection(name string) (*Collection, error) {
 	if err := json.Unmarshal(src, &c); err != nil {
 		return nil, err
 	}
+	// NOTE: collections created before the key index kept their
+	// keys in collection.json, we use them until the index is written.
+	legacy := struct {
+		KeyMap map[string]string `json:"keymap"`
+	}{}
+	if err := json.Unmarshal(src, &legacy); err != nil {
+		return nil, err
+	}
 	//NOTE: we need to reset collectionName so we're working with a path useable to get to the JSON documents.
 	c.Name = path.Base(collectionName)
 	c.workPath = collectionName
 	c.Store = store
-	if c.KeyMap == nil {
-		c.KeyMap = make(map[string]string)
-	}
+	c.keyIndex = newKeyIndex(store, collectionName)
+	c.keyIndex.useLegacyKeyMap(legacy.KeyMap)
+	c.fileLock = new(collectionLock)
 
 	c.collectionMutex = new(sync.Mutex)
 	c.objectMutex = new(sync.Mutex)
@@ -355,13 +455,27 @@ func deleteCollection(name string) error {
 	return nil
 }
 
+// keyPath returns the pairtree path of a key, an error is returned
+// if the key isn't found or the key index can't be read
+func (c *Collection) keyPath(keyName string) (string, error) {
+	p, ok, err := c.keyIndex.get(keyName)
+	if err != nil {
+		return "", err
+	}
+	if ok == false {
+		return "", c.errKeyNotFound(keyName)
+	}
+	return p, nil
+}
+
 // DocPath returns a full path to a key or an error if not found
 func (c *Collection) DocPath(name string) (string, error) {
 	keyName, name := keyAndFName(name)
-	if p, ok := c.KeyMap[keyName]; ok == true {
-		return path.Join(c.workPath, p, name), nil
+	p, err := c.keyPath(keyName)
+	if err != nil {
+		return "", err
 	}
-	return "", fmt.Errorf("Can't find %q", name)
+	return path.Join(c.workPath, p, name), nil
 }
 
 // Close closes a collection, writing the updated keys to disc
@@ -369,17 +483,32 @@ func (c *Collection) Close() error {
 	// Cleanup c so it can't accidentally get reused
 	c.Name = ""
 	c.workPath = ""
-	c.KeyMap = map[string]string{}
+	c.keyIndex = nil
 	c.Store = nil
 
 	c.collectionMutex = nil
 	c.objectMutex = nil
 	c.frameMutex = nil
+	c.fileLock = nil
+	c.schema = nil
+	c.schemaLoaded = false
+	c.indexes = nil
+	c.liveCache = nil
 	return nil
 }
 
 // CreateJSON adds a JSON doc to a collection, if a problem occurs it returns an error
 func (c *Collection) CreateJSON(key string, src []byte) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.createJSON(key, src)
+}
+
+// createJSON adds a JSON doc to a collection, the caller holds the
+// collection's lock
+func (c *Collection) createJSON(key string, src []byte) error {
 	key = strings.TrimSpace(key)
 	if key == "" || key == ".json" {
 		return fmt.Errorf("must not be empty")
@@ -388,20 +517,26 @@ func (c *Collection) CreateJSON(key string, src []byte) error {
 	// Enforce the _Key attribute is unique and does not exist in collection already
 	key = normalizeKeyName(key)
 	keyName, FName := keyAndFName(key)
-	if _, keyExists := c.KeyMap[keyName]; keyExists == true {
-		return fmt.Errorf("%s already exists in collection %s", key, c.Name)
+	_, keyExists, err := c.keyIndex.get(keyName)
+	if err != nil {
+		return err
+	}
+	if keyExists == true {
+		return c.errKeyExists(key)
 	}
 
 	// Make sure we have an "object" not an array object in JSON notation
 	if bytes.HasPrefix(src, []byte(`{`)) == false {
-		return fmt.Errorf("dataset can only stores JSON objects")
+		return ErrNotAnObject
 	}
 	// Add a _Key value if needed in the JSON source
 	if bytes.Contains(src, []byte(`"_Key"`)) == false {
 		src = bytes.Replace(src, []byte(`{`), []byte(`{"_Key":"`+keyName+`",`), 1)
 	}
+	if err := c.validateJSON(keyName, src); err != nil {
+		return err
+	}
 
-	var err error
 	pair := pairtree.Encode(key)
 	pairPath := path.Join("pairtree", pair)
 	if c.Store.Type == storage.FS {
@@ -416,50 +551,50 @@ func (c *Collection) CreateJSON(key string, src []byte) error {
 	if err != nil {
 		return err
 	}
-	// We now need to update KeyMap
-	c.KeyMap[key] = pairPath
-	return c.saveMetadata()
+	// We now need to update the key index
+	if err := c.keyIndex.set(key, pairPath); err != nil {
+		return err
+	}
+	c.indexObject(keyName, src)
+	if c.KeepRevisions {
+		return c.saveRevision(keyName, pairPath, "create", src, nil, "")
+	}
+	return nil
 }
 
 // CreateObjectsJSON takes a list of keys and creates a default object for each key
 // as quickly as possible. NOTE: if object already exist creation is skipped without
-// reporting an error.
+// reporting an error. The objects are created in a single transaction.
 func (c *Collection) CreateObjectsJSON(keyList []string, src []byte) error {
-	c.unsafeSaveMetadata = true
-	defer func() {
-		c.unsafeSaveMetadata = false
-		c.saveMetadata()
-	}()
+	tx, err := c.Begin()
+	if err != nil {
+		return err
+	}
 	for _, key := range keyList {
-		if c.KeyExists(key) == false {
-			if err := c.CreateJSON(key, src); err != nil {
+		if tx.keyExists(key) == false {
+			if err := tx.CreateJSON(key, src); err != nil {
+				tx.Rollback()
 				return err
 			}
 		}
 	}
-	return nil
+	return tx.Commit()
 }
 
-// IsKeyNotFound checks an error message and returns true if
-// it is a key not found error.
+// IsKeyNotFound returns true if e is a key not found error,
+// it is the same as errors.Is(e, ErrKeyNotFound).
 func (c *Collection) IsKeyNotFound(e error) bool {
-	if strings.Compare(e.Error(), "key not found") == 0 {
-		return true
-	}
-	return false
+	return errors.Is(e, ErrKeyNotFound)
 }
 
 // ReadJSON finds a the record in the collection and returns the JSON source
 func (c *Collection) ReadJSON(name string) ([]byte, error) {
-	if c.KeyExists(name) == false {
-		return nil, fmt.Errorf("key not found")
-	}
 	name = normalizeKeyName(name)
 	// Handle potentially URL encoded names
 	keyName, FName := keyAndFName(name)
-	pairPath, ok := c.KeyMap[keyName]
-	if ok != true {
-		return nil, fmt.Errorf("%q does not exist in %s", keyName, c.Name)
+	pairPath, err := c.keyPath(keyName)
+	if err != nil {
+		return nil, err
 	}
 	// NOTE: c.Name is the path to the collection not the name of JSON document
 	// we need to join c.Name + bucketName + name to get path do JSON document
@@ -472,18 +607,28 @@ func (c *Collection) ReadJSON(name string) ([]byte, error) {
 
 // UpdateJSON a JSON doc in a collection, returns an error if there is a problem
 func (c *Collection) UpdateJSON(name string, src []byte) error {
-	var ()
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.updateJSON(name, src, "update")
+}
+
+// updateJSON writes the JSON doc, action is recorded in the
+// object's history when the collection keeps revisions. The caller
+// holds the collection's lock.
+func (c *Collection) updateJSON(name string, src []byte, action string) error {
 	// Normalize key and filenames
 	name = normalizeKeyName(name)
 	keyName, fName := keyAndFName(name)
 	// Make sure Key exists before proceeding with update
 	if c.KeyExists(name) == false {
-		return fmt.Errorf("key not found")
+		return c.errKeyNotFound(name)
 	}
 
 	// Make sure we have an "object" not an array object in JSON notation
 	if bytes.HasPrefix(src, []byte(`{`)) == false {
-		return fmt.Errorf("dataset can only stores JSON objects")
+		return ErrNotAnObject
 	}
 
 	// Make sure we preserve attachment metadata
@@ -504,11 +649,14 @@ func (c *Collection) UpdateJSON(name string, src []byte) error {
 	if bytes.Contains(src, []byte(`"_Key"`)) == false {
 		src = bytes.Replace(src, []byte(`{`), []byte(`{"_Key":"`+keyName+`",`), 1)
 	}
+	if err := c.validateJSON(keyName, src); err != nil {
+		return err
+	}
 
-	//NOTE: KeyMap should include pairtree path (e.g. pairtree/AA/BB/CC...)
-	pairPath, ok := c.KeyMap[keyName]
-	if ok != true {
-		return fmt.Errorf("%q does not exist in %q", keyName, c.Name)
+	//NOTE: key index should include pairtree path (e.g. pairtree/AA/BB/CC...)
+	pairPath, err := c.keyPath(keyName)
+	if err != nil {
+		return err
 	}
 	if c.Store.Type == storage.FS {
 		err := c.Store.MkdirAll(path.Join(c.workPath, pairPath), 0770)
@@ -516,7 +664,28 @@ func (c *Collection) UpdateJSON(name string, src []byte) error {
 			return fmt.Errorf("Update (mkdir) %q, %s", path.Join(c.workPath, pairPath), err)
 		}
 	}
-	return c.Store.WriteFile(path.Join(c.workPath, pairPath, fName), src, 0664)
+	if c.KeepRevisions == false {
+		if err := c.Store.WriteFile(path.Join(c.workPath, pairPath, fName), src, 0664); err != nil {
+			return err
+		}
+		c.indexObject(keyName, src)
+		return nil
+	}
+	// Keep the current version in case the object predates its history
+	docPath := path.Join(c.workPath, pairPath, fName)
+	prior, err := c.Store.ReadFile(docPath)
+	if err != nil {
+		return err
+	}
+	priorModified := ""
+	if info, err := c.Store.Stat(docPath); err == nil {
+		priorModified = info.ModTime().Format(time.RFC3339)
+	}
+	if err := c.Store.WriteFile(docPath, src, 0664); err != nil {
+		return err
+	}
+	c.indexObject(keyName, src)
+	return c.saveRevision(keyName, pairPath, action, src, prior, priorModified)
 }
 
 // Create a JSON doc from an map[string]interface{} and adds it  to a collection, if problem returns an error
@@ -537,6 +706,12 @@ func (c *Collection) Read(name string, data map[string]interface{}, cleanObject
 	if err != nil {
 		return err
 	}
+	return decodeObject(src, data, cleanObject)
+}
+
+// decodeObject decodes an object's JSON source into data, removing
+// the underscore attributes if cleanObject is true
+func decodeObject(src []byte, data map[string]interface{}, cleanObject bool) error {
 	decoder := json.NewDecoder(bytes.NewReader(src))
 	decoder.UseNumber()
 	if err := decoder.Decode(&data); err != nil {
@@ -558,55 +733,66 @@ func (c *Collection) Update(name string, data map[string]interface{}) error {
 	return c.UpdateJSON(name, src)
 }
 
-// Delete removes a JSON doc from a collection
+// Delete moves a JSON doc and its attachments from a collection
+// into the trash. Use Undelete() to bring it back or EmptyTrash()
+// to remove it for good.
 func (c *Collection) Delete(name string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.deleteObject(name)
+}
+
+// deleteObject moves a JSON doc and its attachments into the trash,
+// the caller holds the collection's lock
+func (c *Collection) deleteObject(name string) error {
 	name = normalizeKeyName(name)
 	keyName, FName := keyAndFName(name)
-
-	pairPath, ok := c.KeyMap[keyName]
-	if ok != true {
-		return fmt.Errorf("%q key not found in %q", keyName, c.Name)
+	pairPath, err := c.keyPath(keyName)
+	if err != nil {
+		return err
 	}
-
-	//NOTE: Need to remove any stale tarball before removing our record!
-	tarball := strings.TrimSuffix(FName, ".json") + ".tar"
-	p := path.Join(c.workPath, pairPath, tarball)
-	if err := c.Store.RemoveAll(p); err != nil {
-		return fmt.Errorf("Can't remove attachment for %q, %s", keyName, err)
+	if err := c.trashObject(keyName, FName, pairPath); err != nil {
+		return fmt.Errorf("Can't delete %q, %s", keyName, err)
 	}
-	p = path.Join(c.workPath, pairPath, FName)
-	if err := c.Store.Remove(p); err != nil {
-		return fmt.Errorf("Error removing %q, %s", p, err)
+	if err := c.keyIndex.remove(keyName); err != nil {
+		return err
 	}
-
-	delete(c.KeyMap, keyName)
-	return c.saveMetadata()
+	c.unindexObject(keyName)
+	return nil
 }
 
 // Keys returns a list of keys in a collection
 func (c *Collection) Keys() []string {
-	keys := []string{}
-	for k := range c.KeyMap {
-		keys = append(keys, k)
-	}
-	return keys
+	return c.keyIndex.list()
 }
 
-// KeyExists returns true if key is in collection's KeyMap, false otherwise
+// KeyExists returns true if key is in collection's key index, false otherwise
 func (c *Collection) KeyExists(key string) bool {
-	_, hasKey := c.KeyMap[key]
+	_, hasKey, err := c.keyIndex.get(key)
+	if err != nil {
+		log.Printf("WARNING %s, %s", c.Name, err)
+	}
 	return hasKey
 }
 
 // Length returns the number of keys in a collection
 func (c *Collection) Length() int {
-	return len(c.KeyMap)
+	return c.keyIndex.length()
 }
 
 // ImportCSV takes a reader and iterates over the rows and imports them as
 // a JSON records into dataset.
 //BUG: returns lines processed should probably return number of rows imported
 func (c *Collection) ImportCSV(buf io.Reader, idCol int, skipHeaderRow bool, overwrite bool, verboseLog bool) (int, error) {
+	return c.ImportCSVContext(context.Background(), buf, idCol, skipHeaderRow, overwrite, verboseLog, nil)
+}
+
+// ImportCSVContext is ImportCSV with a context and progress callback.
+// If ctx is done it stops before the next row, rows already imported
+// are kept, and returns ctx's error.
+func (c *Collection) ImportCSVContext(ctx context.Context, buf io.Reader, idCol int, skipHeaderRow bool, overwrite bool, verboseLog bool, progress ProgressFunc) (int, error) {
 	var (
 		fieldNames []string
 		key        string
@@ -624,6 +810,9 @@ func (c *Collection) ImportCSV(buf io.Reader, idCol int, skipHeaderRow bool, ove
 		}
 	}
 	for {
+		if err := ctx.Err(); err != nil {
+			return lineNo, err
+		}
 		lineNo++
 		row, err := r.Read()
 		if err == io.EOF {
@@ -681,6 +870,7 @@ func (c *Collection) ImportCSV(buf io.Reader, idCol int, skipHeaderRow bool, ove
 		} else if verboseLog {
 			log.Printf("Skipping row %d, key value missing", lineNo)
 		}
+		progress.report("import", lineNo, -1)
 		if verboseLog == true && (lineNo%1000) == 0 {
 			log.Printf("%d rows processed", lineNo)
 		}
@@ -783,12 +973,15 @@ func colToString(cell interface{}) string {
 }
 
 // ExportCSV takes a reader and frame and iterates over the objects
-// generating rows and exports then as a CSV file
+// generating rows and exports then as a CSV file. Cells are formatted
+// by the type of the frame's column, nulls in a typed column are
+// written as empty cells.
 func (c *Collection) ExportCSV(fp io.Writer, eout io.Writer, f *DataFrame, verboseLog bool) (int, error) {
 	//, filterExpr string, dotExpr []string, colNames []string, verboseLog bool) (int, error) {
 	keys := f.Keys[:]
 	dotExpr := f.DotPaths
 	colNames := f.Labels
+	types := f.columnTypes()
 
 	// write out colNames
 	w := csv.NewWriter(fp)
@@ -803,15 +996,17 @@ func (c *Collection) ExportCSV(fp io.Writer, eout io.Writer, f *DataFrame, verbo
 		writeErrors   int
 		dotpathErrors int
 	)
-	for i, key := range keys {
-		data := map[string]interface{}{}
-		if err := c.Read(key, data, false); err == nil {
+	cur := c.NewCursor(context.Background(), keys)
+	defer cur.Close()
+	for cur.Next() {
+		i, key := cur.Position(), cur.Key()
+		if data, err := cur.Object(); err == nil {
 			// write row out.
 			row = []string{}
-			for _, colPath := range dotExpr {
-				col, err := dotpath.Eval(colPath, data)
+			for j, colPath := range dotExpr {
+				col, err := evalColumn(colPath, data)
 				if err == nil {
-					row = append(row, colToString(col))
+					row = append(row, formatCell(col, types[j]))
 				} else {
 					if verboseLog == true {
 						log.Printf("error in dotpath %q for key %q in %s, %s\n", colPath, key, c.workPath, err)
@@ -828,7 +1023,6 @@ func (c *Collection) ExportCSV(fp io.Writer, eout io.Writer, f *DataFrame, verbo
 				}
 				writeErrors++
 			}
-			data = nil
 		} else {
 			log.Printf("error reading %s %q, %s\n", c.workPath, key, err)
 			readErrors++
@@ -845,11 +1039,13 @@ func (c *Collection) ExportCSV(fp io.Writer, eout io.Writer, f *DataFrame, verbo
 }
 
 // ExportTable takes a reader and frame and iterates over the objects
-// generating rows and exports then as a CSV file
+// generating rows and exports then as a table, cells are coerced to
+// the type of the frame's column
 func (c *Collection) ExportTable(eout io.Writer, f *DataFrame, verboseLog bool) (int, [][]interface{}, error) {
 	keys := f.Keys[:]
 	dotExpr := f.DotPaths
 	colNames := f.Labels
+	types := f.columnTypes()
 
 	var (
 		cnt           int
@@ -864,14 +1060,19 @@ func (c *Collection) ExportTable(eout io.Writer, f *DataFrame, verboseLog bool)
 	}
 	table = append(table, row)
 
-	for _, key := range keys {
-		data := map[string]interface{}{}
-		if err := c.Read(key, data, false); err == nil {
+	cur := c.NewCursor(context.Background(), keys)
+	defer cur.Close()
+	for cur.Next() {
+		key := cur.Key()
+		if data, err := cur.Object(); err == nil {
 			// write row out.
 			row = []interface{}{}
-			for _, colPath := range dotExpr {
-				col, err := dotpath.Eval(colPath, data)
+			for j, colPath := range dotExpr {
+				col, err := evalColumn(colPath, data)
 				if err == nil {
+					if v, err := coerceValue(col, types[j]); err == nil {
+						col = v
+					}
 					row = append(row, col)
 				} else {
 					if verboseLog == true {
@@ -883,7 +1084,6 @@ func (c *Collection) ExportTable(eout io.Writer, f *DataFrame, verboseLog bool)
 			}
 			table = append(table, row)
 			cnt++
-			data = nil
 		} else {
 			log.Printf("error reading %s %q, %s\n", c.workPath, key, err)
 			readErrors++
@@ -896,13 +1096,28 @@ func (c *Collection) ExportTable(eout io.Writer, f *DataFrame, verboseLog bool)
 }
 
 // KeyFilter takes a list of keys and  filter expression and returns
-// the list of keys passing through the filter or an error
+// the list of keys passing through the filter or an error. The filter
+// expression is a query (see ParseQuery) or, if TemplateFilters is
+// true, a Go template expression.
 func (c *Collection) KeyFilter(keyList []string, filterExpr string) ([]string, error) {
+	return c.keyFilter(keyList, filterExpr, TemplateFilters)
+}
+
+// keyFilter is KeyFilter, filterExpr is a Go template filter when
+// templateFilter is true and a query otherwise
+func (c *Collection) keyFilter(keyList []string, filterExpr string, templateFilter bool) ([]string, error) {
 	// Handle the trivial case of filter resolving to true
 	// NOTE: empty filter is treated as "true"
 	if filterExpr == "true" || filterExpr == "" {
 		return keyList, nil
 	}
+	if templateFilter == false {
+		q, err := ParseQuery(filterExpr)
+		if err != nil {
+			return nil, err
+		}
+		return c.KeyQuery(keyList, q)
+	}
 
 	// Some sort of filter is involved
 	filter, err := tmplfn.ParseFilter(filterExpr)
@@ -910,17 +1125,34 @@ func (c *Collection) KeyFilter(keyList []string, filterExpr string) ([]string, e
 		return nil, err
 	}
 
-	keys := []string{}
+	candidates := []string{}
 	for _, key := range keyList {
 		key = strings.TrimSpace(key)
 		if len(key) > 0 {
-			m := map[string]interface{}{}
-			if err := c.Read(key, m, false); err == nil {
-				if ok, err := filter.Apply(m); err == nil && ok == true {
-					keys = append(keys, key)
-				}
+			candidates = append(candidates, key)
+		}
+	}
+	// Only read the objects the indexes say might match
+	if matched := c.indexFilter(filterExpr); matched != nil {
+		indexed := []string{}
+		for _, key := range candidates {
+			if matched[key] {
+				indexed = append(indexed, key)
 			}
 		}
+		candidates = indexed
+	}
+	keys := []string{}
+	err = c.parallelObjects(context.Background(), candidates, func(key string, m map[string]interface{}) (interface{}, error) {
+		return filter.Apply(m)
+	}, func(i int, key string, value interface{}, err error) error {
+		if ok, _ := value.(bool); err == nil && ok == true {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return keys, nil
 }
@@ -929,6 +1161,13 @@ func (c *Collection) KeyFilter(keyList []string, filterExpr string) ([]string, e
 // and new collection name. Returns an error value if there is a problem. Clone does NOT copy
 // attachments, only the JSON records.
 func (c *Collection) Clone(cloneName string, keys []string, verbose bool) error {
+	return c.CloneContext(context.Background(), cloneName, keys, verbose, nil)
+}
+
+// CloneContext is Clone with a context and progress callback. If ctx
+// is done before all the objects are copied it returns ctx's error,
+// the new collection keeps the objects copied so far.
+func (c *Collection) CloneContext(ctx context.Context, cloneName string, keys []string, verbose bool, progress ProgressFunc) error {
 	if len(keys) == 0 {
 		return fmt.Errorf("Zero keys clone from %s to %s", c.Name, cloneName)
 	}
@@ -936,8 +1175,12 @@ func (c *Collection) Clone(cloneName string, keys []string, verbose bool) error
 	if err != nil {
 		return err
 	}
+	defer clone.Close()
 	i := 0
 	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		src, err := c.ReadJSON(key)
 		if err != nil {
 			return err
@@ -947,6 +1190,7 @@ func (c *Collection) Clone(cloneName string, keys []string, verbose bool) error
 			return err
 		}
 		i++
+		progress.report("clone", i, len(keys))
 		if verbose && (i%100) == 0 {
 			log.Printf("%d objects processed\n", i)
 		}
@@ -965,6 +1209,12 @@ func (c *Collection) Clone(cloneName string, keys []string, verbose bool) error
 // If the test collection name is not an empty string it will be created and any records not in the training
 // collection will be cloned from the current collection into the test collection.
 func (c *Collection) CloneSample(trainingCollectionName string, testCollectionName string, keys []string, sampleSize int, verbose bool) error {
+	return c.CloneSampleContext(context.Background(), trainingCollectionName, testCollectionName, keys, sampleSize, verbose, nil)
+}
+
+// CloneSampleContext is CloneSample with a context and progress
+// callback, see CloneContext.
+func (c *Collection) CloneSampleContext(ctx context.Context, trainingCollectionName string, testCollectionName string, keys []string, sampleSize int, verbose bool, progress ProgressFunc) error {
 	if sampleSize < 1 {
 		return fmt.Errorf("sample size should be greater than zero")
 	}
@@ -981,12 +1231,12 @@ func (c *Collection) CloneSample(trainingCollectionName string, testCollectionNa
 	random := rand.New(rand.NewSource(time.Now().UnixNano()))
 	shuffle.Strings(keys, random)
 	trainingKeys := keys[0:sampleSize]
-	if err := c.Clone(trainingCollectionName, trainingKeys, verbose); err != nil {
+	if err := c.CloneContext(ctx, trainingCollectionName, trainingKeys, verbose, progress); err != nil {
 		return err
 	}
 	if len(testCollectionName) > 0 {
 		testKeys := keys[sampleSize:]
-		if err := c.Clone(testCollectionName, testKeys, verbose); err != nil {
+		if err := c.CloneContext(ctx, testCollectionName, testKeys, verbose, progress); err != nil {
 			return err
 		}
 	}
@@ -1007,28 +1257,10 @@ func IsCollection(p string) bool {
 }
 
 // Join takes a key, a map[string]interface{}{} and overwrite bool
-// and merges the map with an existing JSON object in the collection.
-// BUG: This is a naive join, it assumes the keys in object are top
-// level properties.
+// and recursively merges the map with an existing JSON object in the
+// collection. If overwrite is true values in common are replaced
+// otherwise only missing attributes are added. See JoinWithOptions
+// for other strategies.
 func (c *Collection) Join(key string, obj map[string]interface{}, overwrite bool) error {
-	if c.KeyExists(key) == false {
-		return c.Create(key, obj)
-	}
-	record := map[string]interface{}{}
-	err := c.Read(key, record, false)
-	if err != nil {
-		return err
-	}
-
-	// Merge object
-	for k, v := range obj {
-		if overwrite == true {
-			record[k] = v
-		} else if _, hasProperty := record[k]; hasProperty == false {
-			record[k] = v
-		}
-	}
-
-	// Update record and return
-	return c.Update(key, record)
+	return c.JoinWithOptions(key, obj, joinOptions(overwrite))
 }
@@ -57,8 +57,8 @@ func TestCollection(t *testing.T) {
 		t.FailNow()
 	}
 
-	if len(c.KeyMap) > 0 {
-		t.Errorf("expected 0 keys, got %d", len(c.KeyMap))
+	if c.Length() > 0 {
+		t.Errorf("expected 0 keys, got %d", c.Length())
 	}
 	testData := []map[string]interface{}{}
 	src := `[
@@ -110,7 +110,7 @@ func TestCollection(t *testing.T) {
 		}
 	}
 
-	if len(c.KeyMap) != 3 {
+	if c.Length() != 3 {
 		t.Errorf("%q: expected 1 key, got %+v", c.Name, c)
 		t.FailNow()
 	}
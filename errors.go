@@ -0,0 +1,179 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"errors"
+	"fmt"
+)
+
+//
+// NOTE: errors.go defines the errors callers can test for with
+// errors.Is and errors.As rather than matching error messages.
+// Errors about a specific key or frame are returned as *KeyError
+// or *FrameError, both wrap one of the sentinel errors below.
+//
+
+var (
+	// ErrKeyNotFound is returned when a key isn't in the collection
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrKeyExists is returned when creating a key already in the collection
+	ErrKeyExists = errors.New("key already exists")
+	// ErrFrameNotFound is returned when a frame isn't defined
+	ErrFrameNotFound = errors.New("frame not found")
+	// ErrFrameExists is returned when creating a frame already defined
+	ErrFrameExists = errors.New("frame already exists")
+	// ErrNotAnObject is returned when JSON source isn't a JSON object
+	ErrNotAnObject = errors.New("dataset can only stores JSON objects")
+	// ErrCollectionNotFound is returned when a collection isn't open
+	// or can't be found
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionLocked is returned when another process holds
+	// the collection's lock past LockTimeout
+	ErrCollectionLocked = errors.New("collection is locked")
+	// ErrRevisionNotFound is returned when an object's revision
+	// isn't in its history
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrRevisionConflict is wrapped by *ConflictError
+	ErrRevisionConflict = errors.New("revision conflict")
+	// ErrJoinConflict is wrapped by *JoinConflictError
+	ErrJoinConflict = errors.New("join conflict")
+	// ErrValidation is wrapped by *ValidationError
+	ErrValidation = errors.New("schema validation failed")
+	// ErrStopIteration is returned by an IterFunc to end Iterate early
+	ErrStopIteration = errors.New("stop iteration")
+	// ErrIndexNotFound is returned when a dotpath isn't indexed
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrIndexExists is returned when creating an index already defined
+	ErrIndexExists = errors.New("index already exists")
+	// ErrIndexOutOfDate is returned when an index missed an update
+	// and needs rebuilding
+	ErrIndexOutOfDate = errors.New("index out of date")
+	// ErrQuerySyntax is wrapped by *QueryError
+	ErrQuerySyntax = errors.New("query syntax error")
+)
+
+// KeyError reports a problem with a key in a collection
+type KeyError struct {
+	// Collection is the collection's name
+	Collection string
+	// Key is the object's key
+	Key string
+	// Err is ErrKeyNotFound or ErrKeyExists
+	Err error
+}
+
+// Error implements the error interface
+func (e *KeyError) Error() string {
+	switch e.Err {
+	case ErrKeyNotFound:
+		return fmt.Sprintf("%q not found in %s", e.Key, e.Collection)
+	case ErrKeyExists:
+		return fmt.Sprintf("%s already exists in collection %s", e.Key, e.Collection)
+	}
+	return fmt.Sprintf("%q in %s, %s", e.Key, e.Collection, e.Err)
+}
+
+// Unwrap returns the sentinel error
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// FrameError reports a problem with a frame in a collection
+type FrameError struct {
+	// Collection is the collection's name
+	Collection string
+	// Frame is the frame's name
+	Frame string
+	// Err is ErrFrameNotFound or ErrFrameExists
+	Err error
+}
+
+// Error implements the error interface
+func (e *FrameError) Error() string {
+	switch e.Err {
+	case ErrFrameNotFound:
+		return fmt.Sprintf("frame %q not found in %s", e.Frame, e.Collection)
+	case ErrFrameExists:
+		return fmt.Sprintf("frame %q exists in %s", e.Frame, e.Collection)
+	}
+	return fmt.Sprintf("frame %q in %s, %s", e.Frame, e.Collection, e.Err)
+}
+
+// Unwrap returns the sentinel error
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// LockError is returned when a collection's lock can't be acquired
+// before LockTimeout
+type LockError struct {
+	// Collection is the collection's name
+	Collection string
+	// PID of the process holding the lock, zero if unknown
+	PID int
+}
+
+// Error implements the error interface
+func (e *LockError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("collection %s is locked by pid %d", e.Collection, e.PID)
+	}
+	return fmt.Sprintf("collection %s is locked", e.Collection)
+}
+
+// Unwrap returns ErrCollectionLocked
+func (e *LockError) Unwrap() error {
+	return ErrCollectionLocked
+}
+
+// QueryError reports a syntax error in a query expression
+type QueryError struct {
+	// Query is the query's source
+	Query string
+	// Pos is the character offset of the error in Query
+	Pos int
+	// Msg describes the error
+	Msg string
+}
+
+// Error implements the error interface
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d in query %q", e.Msg, e.Pos+1, e.Query)
+}
+
+// Unwrap returns ErrQuerySyntax
+func (e *QueryError) Unwrap() error {
+	return ErrQuerySyntax
+}
+
+// errKeyNotFound returns a *KeyError wrapping ErrKeyNotFound
+func (c *Collection) errKeyNotFound(key string) error {
+	return &KeyError{Collection: c.Name, Key: key, Err: ErrKeyNotFound}
+}
+
+// errKeyExists returns a *KeyError wrapping ErrKeyExists
+func (c *Collection) errKeyExists(key string) error {
+	return &KeyError{Collection: c.Name, Key: key, Err: ErrKeyExists}
+}
+
+// errFrameNotFound returns a *FrameError wrapping ErrFrameNotFound
+func (c *Collection) errFrameNotFound(name string) error {
+	return &FrameError{Collection: c.Name, Frame: name, Err: ErrFrameNotFound}
+}
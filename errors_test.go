@@ -0,0 +1,98 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	cName := path.Join("testdata", "errors_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	if err := c.Create("one", map[string]interface{}{"one": 1}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+
+	_, err = c.ReadJSON("two")
+	if errors.Is(err, ErrKeyNotFound) == false || c.IsKeyNotFound(err) == false {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	var keyErr *KeyError
+	if errors.As(err, &keyErr) == false || keyErr.Key != "two" {
+		t.Errorf("expected *KeyError for two, got %T %v", err, err)
+	}
+	for _, err := range []error{
+		c.UpdateJSON("two", []byte(`{}`)),
+		c.Delete("two"),
+		c.AttachFile("two", "", "errors_test.go"),
+	} {
+		if errors.Is(err, ErrKeyNotFound) == false {
+			t.Errorf("expected ErrKeyNotFound, got %v", err)
+		}
+	}
+	if _, err := c.History("two"); errors.Is(err, ErrKeyNotFound) == false {
+		t.Errorf("expected ErrKeyNotFound reading history, got %v", err)
+	}
+	if err := c.Undelete("two"); errors.Is(err, ErrKeyNotFound) == false {
+		t.Errorf("expected ErrKeyNotFound undeleting, got %v", err)
+	}
+
+	if err := c.CreateJSON("one", []byte(`{}`)); errors.Is(err, ErrKeyExists) == false {
+		t.Errorf("expected ErrKeyExists, got %v", err)
+	}
+	if err := c.CreateJSON("three", []byte(`[1,2,3]`)); errors.Is(err, ErrNotAnObject) == false {
+		t.Errorf("expected ErrNotAnObject, got %v", err)
+	}
+
+	var frameErr *FrameError
+	if _, err := c.FrameRead("missing"); errors.As(err, &frameErr) == false || errors.Is(err, ErrFrameNotFound) == false {
+		t.Errorf("expected ErrFrameNotFound, got %v", err)
+	}
+	if _, err := c.FrameCreate("f1", []string{"one"}, []string{".one"}, []string{"one"}, false); err != nil {
+		t.Errorf("%s", err)
+	}
+	if _, err := c.FrameCreate("f1", []string{"one"}, []string{".one"}, []string{"one"}, false); errors.Is(err, ErrFrameExists) == false {
+		t.Errorf("expected ErrFrameExists, got %v", err)
+	}
+
+	err = c.UpdateJSONIfRevision("one", []byte(`{"one":2}`), "stale")
+	var conflict *ConflictError
+	if errors.Is(err, ErrRevisionConflict) == false || errors.As(err, &conflict) == false {
+		t.Errorf("expected ErrRevisionConflict, got %v", err)
+	}
+	err = c.JoinWithOptions("one", map[string]interface{}{"one": 3}, &JoinOptions{Conflict: JoinError})
+	if errors.Is(err, ErrJoinConflict) == false {
+		t.Errorf("expected ErrJoinConflict, got %v", err)
+	}
+
+	if _, err := GetCollection(path.Join("testdata", "no_such_collection.ds")); errors.Is(err, ErrCollectionNotFound) == false {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+}
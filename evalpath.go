@@ -0,0 +1,137 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	// Caltech Library Packages
+	"github.com/caltechlibrary/dotpath"
+
+	// JMESPath
+	"github.com/jmespath/go-jmespath"
+)
+
+//
+// NOTE: Wherever a dotpath is accepted (frames, grids, exports, sync,
+// joins, indexes and sort expressions) an expression starting with
+// "jmes:" is evaluated as a JMESPath expression (https://jmespath.org),
+// e.g. the name of the first creator whose role is author
+//
+//     jmes:creators[?role=='author'].name | [0]
+//
+// Numbers are float64 when a JMESPath expression is evaluated and an
+// expression resulting in null is treated as a missing value, like a
+// dotpath that isn't found.
+//
+
+// JMESPrefix marks a JMESPath expression where a dotpath is accepted
+const JMESPrefix = "jmes:"
+
+// jmesCache holds compiled JMESPath expressions by source
+var jmesCache sync.Map
+
+// compileJMES returns the compiled form of a JMESPath expression
+func compileJMES(expr string) (*jmespath.JMESPath, error) {
+	if jp, ok := jmesCache.Load(expr); ok {
+		return jp.(*jmespath.JMESPath), nil
+	}
+	jp, err := jmespath.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid JMESPath expression, %s", expr, err)
+	}
+	jmesCache.Store(expr, jp)
+	return jp, nil
+}
+
+// isPathExpression returns true if p is a dotpath or a JMESPath
+// expression
+func isPathExpression(p string) bool {
+	return strings.HasPrefix(p, ".") || strings.HasPrefix(p, JMESPrefix)
+}
+
+// checkPath returns an error if p is a JMESPath expression that
+// doesn't compile
+func checkPath(p string) error {
+	if strings.HasPrefix(p, JMESPrefix) {
+		_, err := compileJMES(strings.TrimPrefix(p, JMESPrefix))
+		return err
+	}
+	return nil
+}
+
+// evalPath returns the value of a dotpath or JMESPath expression
+// applied to data
+func evalPath(p string, data interface{}) (interface{}, error) {
+	if strings.HasPrefix(p, JMESPrefix) == false {
+		return dotpath.Eval(p, data)
+	}
+	jp, err := compileJMES(strings.TrimPrefix(p, JMESPrefix))
+	if err != nil {
+		return nil, err
+	}
+	value, err := jp.Search(normalizeQueryValue(data))
+	if err != nil {
+		return nil, fmt.Errorf("%q, %s", p, err)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%q has no value", p)
+	}
+	return value, nil
+}
+
+// splitFields splits src on commas that aren't inside brackets,
+// parentheses, braces or quotes so JMESPath expressions stay whole.
+// The fields are trimmed, empty ones are kept.
+func splitFields(src string) []string {
+	fields := []string{}
+	depth, start := 0, 0
+	var quote rune
+	for i, r := range src {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			fields = append(fields, strings.TrimSpace(src[start:i]))
+			start = i + 1
+		}
+	}
+	return append(fields, strings.TrimSpace(src[start:]))
+}
+
+// splitList is splitFields without the empty fields
+func splitList(src string) []string {
+	list := []string{}
+	for _, field := range splitFields(src) {
+		if field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
@@ -0,0 +1,130 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEvalPath(t *testing.T) {
+	obj := map[string]interface{}{}
+	src := []byte(`{
+		"title": "Climate and Coasts",
+		"year": 2019,
+		"creators": [
+			{"name": "Doe, Jane", "role": "editor"},
+			{"name": "Smith, Sam", "role": "author"},
+			{"name": "Roe, Ray", "role": "author"}
+		]
+	}`)
+	if err := DecodeJSON(src, &obj); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for p, expected := range map[string]string{
+		".title":     "Climate and Coasts",
+		"jmes:title": "Climate and Coasts",
+		"jmes:creators[?role=='author'].name | [0]":       "Smith, Sam",
+		"jmes:length(creators)":                           "3",
+		"jmes:join('; ', creators[?role=='author'].name)": "Smith, Sam; Roe, Ray",
+		"jmes:year > `2000`":                              "true",
+	} {
+		value, err := evalPath(p, obj)
+		if err != nil {
+			t.Errorf("%s, %s", p, err)
+			continue
+		}
+		if s := colToString(value); s != expected {
+			t.Errorf("%s, expected %q, got %q", p, expected, s)
+		}
+	}
+	for _, p := range []string{".missing", "jmes:missing", "jmes:creators[?role=='translator'] | [0]"} {
+		if _, err := evalPath(p, obj); err == nil {
+			t.Errorf("expected %s to have no value", p)
+		}
+	}
+	if _, err := evalPath("jmes:creators[?", obj); err == nil {
+		t.Errorf("expected an error for an invalid expression")
+	}
+	if isPathExpression("title") || isPathExpression(".title") == false || isPathExpression("jmes:title") == false {
+		t.Errorf("isPathExpression failed")
+	}
+}
+
+func TestJMESPathFramesAndGrids(t *testing.T) {
+	cName := path.Join("testdata", "evalpath_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	for key, src := range map[string]string{
+		"p1": `{"title": "Alpha", "creators": [{"name": "Doe", "role": "editor"}, {"name": "Smith", "role": "author"}]}`,
+		"p2": `{"title": "Beta", "creators": [{"name": "Roe", "role": "author"}]}`,
+	} {
+		if err := c.CreateJSON(key, []byte(src)); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	keys := []string{"p1", "p2"}
+	first := "jmes:creators[?role=='author'].name | [0]"
+
+	if _, err := c.FrameCreate("bad", keys, []string{"jmes:creators[?"}, []string{"author"}, false); err == nil {
+		t.Errorf("expected an invalid expression to be rejected")
+	}
+	f, err := c.FrameCreate("authors", keys, []string{".title", first}, []string{"title", "author"}, false)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for key, expected := range map[string]string{"p1": "Smith", "p2": "Roe"} {
+		obj := f.ObjectMap[key].(map[string]interface{})
+		if obj["author"] != expected {
+			t.Errorf("%s, expected author %q, got %v", key, expected, obj["author"])
+		}
+	}
+
+	g, err := c.Grid(keys, []string{".title", "jmes:length(creators)"}, false)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(g) != 2 || colToString(g[0][1]) != "2" || colToString(g[1][1]) != "1" {
+		t.Errorf("unexpected grid %+v", g)
+	}
+
+	// Indexes accept JMESPath expressions too
+	if err := c.IndexCreate(first); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	found, err := c.IndexCompare(first, "eq", "Roe")
+	if err != nil || strings.Join(found, ",") != "p2" {
+		t.Errorf("expected p2, got %v, %v", found, err)
+	}
+	if err := c.IndexCreate("jmes:creators[?"); err == nil {
+		t.Errorf("expected an invalid expression to be rejected")
+	}
+}
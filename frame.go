@@ -19,16 +19,18 @@
 package dataset
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
 	"path"
 	"strings"
 	"time"
 
 	// Caltech Library packages
-	"github.com/caltechlibrary/dotpath"
+	"github.com/caltechlibrary/shuffle"
 )
 
 //
@@ -56,36 +58,129 @@ type DataFrame struct {
 	// first_title from an array of titles might be labeled "title")
 	Labels []string `json:"labels"`
 
+	// Types describes the values of each labeled column, see ColumnType
+	Types []*ColumnType `json:"types,omitempty"`
+
 	// NOTE: Keys is an orded list of object keys in the frame.
 	Keys []string `json:"keys"`
 
 	// NOTE: Object map privides a quick index by key to object index.
 	ObjectMap map[string]interface{} `json:"object_map"`
 
+	// Definition records how the frame's keys were selected so
+	// FrameRegenerate can select them again from the current collection.
+	// Frames created from a plain key list don't have one.
+	Definition *FrameDefinition `json:"definition,omitempty"`
+
+	// SearchIndexes lists the full text indexes built from the frame
+	// with IndexFrame relative to the collection, they are updated
+	// when the frame changes.
+	SearchIndexes []string `json:"search_indexes,omitempty"`
+
 	// Created is the date the frame is originally generated and defined
 	Created time.Time `json:"created"`
 
 	// Updated is the date the frame is updated (e.g. reframed)
 	Updated time.Time `json:"updated"`
+
+	// offsets locate each key's saved row and stale counts the
+	// superseded rows, see framestore.go
+	offsets map[string]frameOffset
+	stale   int
+
+	// position maps a key to its index in Keys, a removed key leaves
+	// an empty string in Keys until compactKeys is called
+	position map[string]int
+	holes    int
 }
 
-// frameObject takes a list of dot paths, labels and object key
-// then generates a new object based on that.
-func (c *Collection) frameObject(key string, dotPaths []string, labels []string) (map[string]interface{}, error) {
-	errors := []string{}
-	src, err := c.ReadJSON(key)
-	if err != nil {
-		return nil, err
+// FrameDefinition describes the selection of a frame's keys. Keys
+// are filtered, then sampled and finally sorted. It can also declare
+// the types of the frame's columns.
+type FrameDefinition struct {
+	// AllKeys selects from all the collection's keys, otherwise
+	// from Keys
+	AllKeys bool `json:"all_keys,omitempty"`
+
+	// Keys is the key list selected from when AllKeys is false
+	Keys []string `json:"keys,omitempty"`
+
+	// Filter is a query (see ParseQuery) the objects must match
+	Filter string `json:"filter,omitempty"`
+
+	// TemplateFilter is true when Filter is a Go template filter
+	TemplateFilter bool `json:"template_filter,omitempty"`
+
+	// SampleSize when greater than zero selects a random sample
+	// of the filtered keys
+	SampleSize int `json:"sample_size,omitempty"`
+
+	// Sort is a sort expression (e.g. "-.year,.title") applied last
+	Sort string `json:"sort,omitempty"`
+
+	// SortOptions control how Sort compares values
+	SortOptions *SortOptions `json:"sort_options,omitempty"`
+
+	// Types declares column types by label (e.g. "year": "integer"),
+	// the frame's values are coerced to them, see FrameSetTypes
+	Types map[string]string `json:"types,omitempty"`
+
+	// keySet holds Keys for lookups by live frames
+	keySet map[string]bool
+}
+
+// hasKey returns true if key is one of the definition's keys
+func (def *FrameDefinition) hasKey(key string) bool {
+	if def.keySet == nil {
+		def.keySet = make(map[string]bool, len(def.Keys))
+		for _, k := range def.Keys {
+			def.keySet[k] = true
+		}
 	}
-	obj := map[string]interface{}{}
-	err = DecodeJSON(src, &obj)
-	if err != nil {
-		return nil, err
+	return def.keySet[key]
+}
+
+// selectKeys returns the keys described by a frame definition
+func (c *Collection) selectKeys(def *FrameDefinition) ([]string, error) {
+	var (
+		keys []string
+		err  error
+	)
+	if def.AllKeys {
+		keys = c.Keys()
+	} else {
+		keys = append([]string{}, def.Keys...)
+	}
+	if def.Filter != "" {
+		keys, err = c.keyFilter(keys, def.Filter, def.TemplateFilter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if def.SampleSize > 0 {
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		shuffle.Strings(keys, random)
+		if def.SampleSize < len(keys) {
+			keys = keys[0:def.SampleSize]
+		}
+	}
+	if def.Sort != "" {
+		keys, err = c.KeySortByExpressionWithOptions(keys, def.Sort, def.SortOptions)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return keys, nil
+}
 
+// frameObject takes an object's key, the object, a list of dot paths
+// (or computed columns, see columns.go) and labels then generates a
+// new object based on that.
+func frameObject(key string, obj map[string]interface{}, dotPaths []string, labels []string) (map[string]interface{}, error) {
+	errors := []string{}
 	o := map[string]interface{}{}
 	for j, dpath := range dotPaths {
-		value, err := dotpath.Eval(dpath, obj)
+		value, err := evalColumn(dpath, obj)
 		if err == nil {
 			key := labels[j]
 			o[key] = value
@@ -99,6 +194,18 @@ func (c *Collection) frameObject(key string, dotPaths []string, labels []string)
 	return o, nil
 }
 
+// frameObjects frames the objects for keys, see Workers, and calls
+// fn with each framed object in the order of keys. obj is nil if the
+// object couldn't be read.
+func (c *Collection) frameObjects(ctx context.Context, keys []string, dotPaths []string, labels []string, fn func(i int, key string, obj map[string]interface{}, err error) error) error {
+	return c.parallelObjects(ctx, keys, func(key string, obj map[string]interface{}) (interface{}, error) {
+		return frameObject(key, obj, dotPaths, labels)
+	}, func(i int, key string, value interface{}, err error) error {
+		obj, _ := value.(map[string]interface{})
+		return fn(i, key, obj, err)
+	})
+}
+
 // ObjectList (on a collection) takes a set of collection keys and builds
 // an ordered array of objects from the array of keys, dot paths and
 // labels provided.
@@ -107,9 +214,8 @@ func (c *Collection) ObjectList(keys []string, dotPaths []string, labels []strin
 		return nil, fmt.Errorf("dot paths and labels do not match")
 	}
 	pid := os.Getpid()
-	objectList := make([]map[string]interface{}, len(keys))
-	for i, key := range keys {
-		obj, err := c.frameObject(key, dotPaths, labels)
+	objectList := make([]map[string]interface{}, 0, len(keys))
+	err := c.frameObjects(context.Background(), keys, dotPaths, labels, func(i int, key string, obj map[string]interface{}, err error) error {
 		if verbose == true {
 			if err != nil {
 				log.Printf("(pid: %d) WARNING: framing error for key %q (%d), %s", pid, key, i, err)
@@ -124,6 +230,10 @@ func (c *Collection) ObjectList(keys []string, dotPaths []string, labels []strin
 		if verbose && (i > 0) && ((i % 1000) == 0) {
 			log.Printf("(pid: %d) %d keys processed", pid, i)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return objectList, nil
 }
@@ -139,30 +249,70 @@ func (c *Collection) hasFrame(key string) bool {
 
 // getFrame retrieves a frame by frame name from a collection.
 func (c *Collection) getFrame(key string) (*DataFrame, error) {
+	return c.openFrame(key, true)
+}
+
+// getFrameWithoutRows retrieves a frame's definition and keys, its
+// ObjectMap holds only the objects changed by pending live updates.
+func (c *Collection) getFrameWithoutRows(key string) (*DataFrame, error) {
+	return c.openFrame(key, false)
+}
+
+// openFrame reads a frame for a caller that doesn't hold the
+// collection's lock. The lock is only taken if reading the frame
+// writes it, see loadFrame.
+func (c *Collection) openFrame(key string, withRows bool) (*DataFrame, error) {
 	if c.FrameMap == nil {
-		return nil, fmt.Errorf("no frames defined")
+		return nil, c.errFrameNotFound(key)
 	}
 	savedPath, ok := c.FrameMap[key]
 	if ok == false {
-		return nil, fmt.Errorf("frame %s not defined", key)
+		return nil, c.errFrameNotFound(key)
 	}
-	// read frame json from storage
-	src, err := c.Store.ReadFile(path.Join(c.workPath, savedPath))
+	f, current, err := c.readFrame(savedPath, withRows)
 	if err != nil {
 		return nil, err
 	}
-	// convert into DataFrame struct
-	f := new(DataFrame)
-	err = json.Unmarshal(src, &f)
-	// Double check if we have a bad object_map?
-	if f.ObjectMap == nil {
-		f.ObjectMap = map[string]interface{}{}
+	if _, live := c.LiveFrames[key]; current && (live == false || c.Store.IsFile(c.pendingPath(key)) == false) {
+		return f, nil
+	}
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	return c.loadFrame(key, withRows)
+}
+
+// loadFrame reads a frame from storage, see readFrame. A frame saved
+// in the old layout is rewritten and the pending changes of a live
+// frame are applied so the caller holds the collection's lock.
+func (c *Collection) loadFrame(key string, withRows bool) (*DataFrame, error) {
+	if c.FrameMap == nil {
+		return nil, c.errFrameNotFound(key)
+	}
+	savedPath, ok := c.FrameMap[key]
+	if ok == false {
+		return nil, c.errFrameNotFound(key)
+	}
+	f, current, err := c.readFrame(savedPath, withRows)
+	if err != nil {
+		return nil, err
+	}
+	if current == false {
+		if err := c.writeFrame(savedPath, f); err != nil {
+			return nil, err
+		}
+	}
+	// Bring a live frame up to date
+	if _, live := c.LiveFrames[key]; live {
+		err = c.applyPending(key, f)
 	}
 	// return frame and error
 	return f, err
 }
 
-// setFrame writes a DataFrame struct to the collection
+// setFrame writes a DataFrame struct to the collection, the caller
+// holds the collection's lock
 func (c *Collection) setFrame(key string, f *DataFrame) error {
 	// Check to see if we have a _frames directory to store our frames in
 	if _, err := c.Store.Stat(path.Join(c.workPath, "_frames")); err != nil {
@@ -174,11 +324,6 @@ func (c *Collection) setFrame(key string, f *DataFrame) error {
 	f.CollectionName = c.Name
 	f.Name = key
 
-	// render DataFrame to JSON for storage
-	src, err := json.Marshal(f)
-	if err != nil {
-		return err
-	}
 	// calculate the path to store the frame
 	fName := key
 	if strings.HasSuffix(fName, ".json") == false {
@@ -190,23 +335,34 @@ func (c *Collection) setFrame(key string, f *DataFrame) error {
 		c.FrameMap = make(map[string]string)
 	}
 	c.FrameMap[key] = savedPath
-	// save metadata and return
-	err = c.Store.WriteFile(path.Join(c.workPath, savedPath), src, 0664)
-	if err != nil {
+	// save frame, see framestore.go, then metadata and return
+	if err := c.writeFrame(savedPath, f); err != nil {
 		return err
 	}
-	err = c.saveMetadata()
-	return err
+	return c.saveMetadata()
 }
 
-// rmFrame removes a frame from storage as well as from frames.json
+// rmFrame removes a frame from storage as well as from frames.json,
+// the caller holds the collection's lock
 func (c *Collection) rmFrame(key string) error {
 	savedPath, ok := c.FrameMap[key]
 	if ok == false {
-		return fmt.Errorf("Frame %s not found", key)
+		return c.errFrameNotFound(key)
 	}
 	delete(c.FrameMap, key)
-	err := c.Store.Remove(path.Join(c.workPath, savedPath))
+	if _, ok := c.LiveFrames[key]; ok {
+		delete(c.LiveFrames, key)
+		if c.Store.IsFile(c.pendingPath(key)) {
+			c.Store.Remove(c.pendingPath(key))
+		}
+	}
+	header, rowsName, offsetsName := c.frameFiles(savedPath)
+	for _, fName := range []string{rowsName, offsetsName} {
+		if c.Store.IsFile(fName) {
+			c.Store.Remove(fName)
+		}
+	}
+	err := c.Store.Remove(header)
 	err = c.saveMetadata()
 	return err
 }
@@ -222,15 +378,53 @@ func (c *Collection) rmFrame(key string) error {
 // easily be refreshed. Frames also serve as the basis for indexing
 // a dataset collection and provide the data paths (expressed
 // as a list of "dot paths"), labels (aka attribute names),
-// and type information needed for indexing and search.
+// and type information needed for indexing and search. The types of
+// the frame's columns are inferred from its objects, see FrameTypes.
 //
 // If you need to update a frame's objects use FrameRefresh(). If
 // you need to change a frames object ordering use FrameReframe().
 //
 func (c *Collection) FrameCreate(name string, keys []string, dotPaths []string, labels []string, verbose bool) (*DataFrame, error) {
+	return c.FrameCreateContext(context.Background(), name, keys, dotPaths, labels, verbose, nil)
+}
+
+// FrameCreateContext is FrameCreate with a context and progress
+// callback. If ctx is done before all the keys are framed the frame
+// isn't saved and ctx's error is returned.
+func (c *Collection) FrameCreateContext(ctx context.Context, name string, keys []string, dotPaths []string, labels []string, verbose bool, progress ProgressFunc) (*DataFrame, error) {
+	return c.frameCreate(ctx, name, keys, nil, dotPaths, labels, verbose, progress)
+}
+
+// FrameDefine creates a frame from the keys selected by a definition,
+// the definition is saved with the frame so FrameRegenerate can
+// apply it again later.
+func (c *Collection) FrameDefine(name string, def *FrameDefinition, dotPaths []string, labels []string, verbose bool) (*DataFrame, error) {
+	return c.FrameDefineContext(context.Background(), name, def, dotPaths, labels, verbose, nil)
+}
+
+// FrameDefineContext is FrameDefine with a context and progress
+// callback, see FrameCreateContext.
+func (c *Collection) FrameDefineContext(ctx context.Context, name string, def *FrameDefinition, dotPaths []string, labels []string, verbose bool, progress ProgressFunc) (*DataFrame, error) {
+	if c.hasFrame(name) {
+		return nil, &FrameError{Collection: c.Name, Frame: name, Err: ErrFrameExists}
+	}
+	keys, err := c.selectKeys(def)
+	if err != nil {
+		return nil, err
+	}
+	//NOTE: We need to be able to frame an empty collection so we
+	// can bring mapped content in from a spreadsheet or CSV file easily.
+	if len(keys) == 0 && c.Length() > 0 {
+		return nil, fmt.Errorf("No keys, frame creation aborted")
+	}
+	return c.frameCreate(ctx, name, keys, def, dotPaths, labels, verbose, progress)
+}
+
+// frameCreate populates and saves a new frame
+func (c *Collection) frameCreate(ctx context.Context, name string, keys []string, def *FrameDefinition, dotPaths []string, labels []string, verbose bool, progress ProgressFunc) (*DataFrame, error) {
 	// If frame exists return the existing frame
 	if c.hasFrame(name) {
-		return nil, fmt.Errorf("frame %q exists in %q", name, c.Name)
+		return nil, &FrameError{Collection: c.Name, Frame: name, Err: ErrFrameExists}
 	}
 
 	// Case of new Frame and with ObjectList
@@ -238,6 +432,11 @@ func (c *Collection) FrameCreate(name string, keys []string, dotPaths []string,
 		len(labels) != len(dotPaths) {
 		return nil, fmt.Errorf("Mismatched dot paths and labels")
 	}
+	for _, dotPath := range dotPaths {
+		if err := checkColumn(dotPath); err != nil {
+			return nil, err
+		}
+	}
 
 	f := new(DataFrame)
 	f.Name = name
@@ -246,13 +445,20 @@ func (c *Collection) FrameCreate(name string, keys []string, dotPaths []string,
 	f.Labels = labels[:]
 	f.Keys = []string{}
 	f.ObjectMap = make(map[string]interface{})
+	f.Definition = def
 	f.Created = time.Now()
 	f.Updated = time.Now()
+	var declared map[string]string
+	if def != nil {
+		declared = def.Types
+	}
+	if err := f.declareTypes(declared); err != nil {
+		return nil, err
+	}
 
 	// Populate our Object List
 	pid := os.Getpid()
-	for i, key := range keys {
-		obj, err := c.frameObject(key, f.DotPaths, f.Labels)
+	err := c.frameObjects(ctx, keys, f.DotPaths, f.Labels, func(i int, key string, obj map[string]interface{}, err error) error {
 		if verbose == true {
 			if err != nil {
 				log.Printf("(pid: %d) WARNING: framing error for key %q (%d), %s", pid, key, i, err)
@@ -262,11 +468,20 @@ func (c *Collection) FrameCreate(name string, keys []string, dotPaths []string,
 			}
 		}
 		if obj != nil {
+			f.coerceRow(key, obj, verbose)
 			f.ObjectMap[key] = obj
 			f.Keys = append(f.Keys, key)
 		}
+		progress.report("frame", i+1, len(keys))
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	err := c.setFrame(name, f)
+	f.inferTypes()
+	err = c.withLock(func() error {
+		return c.setFrame(name, f)
+	})
 	return f, err
 }
 
@@ -298,12 +513,22 @@ func (c *Collection) FrameRead(name string) (*DataFrame, error) {
 // encountered the object is added to the end of the list. Other objects are not touched and
 // the order of the object list is not changed.
 func (c *Collection) FrameRefresh(name string, keys []string, verbose bool) error {
-	f, err := c.getFrame(name)
+	return c.FrameRefreshContext(context.Background(), name, keys, verbose, nil)
+}
+
+// FrameRefreshContext is FrameRefresh with a context and progress
+// callback. If ctx is done before all the keys are refreshed the
+// frame is left unchanged and ctx's error is returned.
+func (c *Collection) FrameRefreshContext(ctx context.Context, name string, keys []string, verbose bool, progress ProgressFunc) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	f, err := c.loadFrame(name, true)
 	if err != nil {
 		return err
 	}
-	for i, key := range keys {
-		obj, err := c.frameObject(key, f.DotPaths, f.Labels)
+	err = c.frameObjects(ctx, keys, f.DotPaths, f.Labels, func(i int, key string, obj map[string]interface{}, err error) error {
 		if verbose == true {
 			if err != nil {
 				log.Printf("key %q (%d) frame error %s", key, i, err)
@@ -312,16 +537,18 @@ func (c *Collection) FrameRefresh(name string, keys []string, verbose bool) erro
 				log.Printf("key %q (%d) frame object is nil", key, i)
 			}
 		}
+		progress.report("refresh", i+1, len(keys))
 		if err != nil {
 			if verbose {
 				log.Printf("WARNING could not read %q from %q", key, c.Name)
 			}
-			continue
+			return nil
 		}
 		if obj != nil {
 			if _, ok := f.ObjectMap[key]; ok == false {
 				f.Keys = append(f.Keys, key)
 			}
+			f.coerceRow(key, obj, verbose)
 			f.ObjectMap[key] = obj
 		} else {
 			// Remove the stale object
@@ -334,21 +561,39 @@ func (c *Collection) FrameRefresh(name string, keys []string, verbose bool) erro
 				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return c.setFrame(name, f)
+	f.inferTypes()
+	// NOTE: Only the rows of the refreshed keys are saved
+	if err := c.setFrameRows(name, f, keys); err != nil {
+		return err
+	}
+	return c.updateSearchIndexes(f, keys)
 }
 
 // FrameReframe updates a DataFrames object list. The order is replaced by the keys provided.
 // Objects not in the key list are pruned and new objects are added.
 func (c *Collection) FrameReframe(name string, keys []string, verbose bool) error {
-	f, err := c.getFrame(name)
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.frameReframe(name, keys, verbose)
+}
+
+// frameReframe replaces a frame's objects with those of keys, see
+// FrameReframe. The caller holds the collection's lock.
+func (c *Collection) frameReframe(name string, keys []string, verbose bool) error {
+	f, err := c.loadFrame(name, true)
 	if err != nil {
 		return err
 	}
 	// New Keys that will replace the values in f.Keys which are stale.
 	nKeys := []string{}
-	for _, key := range keys {
-		obj, err := c.frameObject(key, f.DotPaths, f.Labels)
+	err = c.frameObjects(context.Background(), keys, f.DotPaths, f.Labels, func(i int, key string, obj map[string]interface{}, err error) error {
 		if verbose == true {
 			if err != nil {
 				log.Printf("key %q frame error %s", key, err)
@@ -358,6 +603,7 @@ func (c *Collection) FrameReframe(name string, keys []string, verbose bool) erro
 			}
 		}
 		if obj != nil {
+			f.coerceRow(key, obj, verbose)
 			f.ObjectMap[key] = obj
 			nKeys = append(nKeys, key)
 		} else if _, ok := f.ObjectMap[key]; ok == true {
@@ -370,6 +616,10 @@ func (c *Collection) FrameReframe(name string, keys []string, verbose bool) erro
 				f.Keys = append(f.Keys[:i], f.Keys[i+1:]...)
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	// Now GC the objects in the stale key list
 	for _, key := range f.Keys {
@@ -379,12 +629,43 @@ func (c *Collection) FrameReframe(name string, keys []string, verbose bool) erro
 	}
 	// Now update the Keys list with the new keys
 	f.Keys = nKeys
+	f.inferTypes()
 	f.Updated = time.Now()
-	return c.setFrame(name, f)
+	if err := c.setFrame(name, f); err != nil {
+		return err
+	}
+	return c.updateSearchIndexes(f, nil)
+}
+
+// FrameRegenerate selects the frame's keys again using its definition
+// and reframes it against the current state of the collection. A
+// frame without a definition is reframed with its own keys, dropping
+// the objects that no longer exist.
+func (c *Collection) FrameRegenerate(name string, verbose bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	f, err := c.loadFrame(name, false)
+	if err != nil {
+		return err
+	}
+	keys := f.Keys
+	if f.Definition != nil {
+		keys, err = c.selectKeys(f.Definition)
+		if err != nil {
+			return err
+		}
+	}
+	return c.frameReframe(name, keys, verbose)
 }
 
 // SaveFrame saves a frame in a collection or returns an error
 func (c *Collection) SaveFrame(name string, f *DataFrame) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
 	return c.setFrame(name, f)
 }
 
@@ -392,18 +673,30 @@ func (c *Collection) SaveFrame(name string, f *DataFrame) error {
 // leaves in place the Frame definition. Use Reframe()
 // to re-populate a frame based on a new key list.
 func (c *Collection) FrameClear(name string) error {
-	f, err := c.getFrame(name)
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	f, err := c.loadFrame(name, true)
 	if err != nil {
 		return err
 	}
 	// Emtpy the key and Object list.
 	f.Keys = []string{}
 	f.ObjectMap = make(map[string]interface{})
-	return c.setFrame(name, f)
+	f.inferTypes()
+	if err := c.setFrame(name, f); err != nil {
+		return err
+	}
+	return c.updateSearchIndexes(f, nil)
 }
 
 // FrameDelete removes a frame from a collection, returns an error if frame can't be deleted.
 func (c *Collection) FrameDelete(name string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
 	return c.rmFrame(name)
 }
 
@@ -427,7 +720,9 @@ func (f *DataFrame) String() string {
 	return fmt.Sprintf("%s", src)
 }
 
-// Grid returns a Grid representaiton of a DataFrame's ObjectList
+// Grid returns a Grid representaiton of a DataFrame's ObjectList.
+// Cells are coerced to their column's type, missing cells in a typed
+// column other than a string column are nil.
 func (f *DataFrame) Grid(includeHeaderRow bool) [][]interface{} {
 	rowCnt := len(f.Keys)
 	colCnt := len(f.Labels)
@@ -443,6 +738,7 @@ func (f *DataFrame) Grid(includeHeaderRow bool) [][]interface{} {
 		rows = append(rows, header)
 	}
 	// Now make reset of grid
+	types := f.columnTypes()
 	objectList := f.Objects()
 	for i, obj := range objectList {
 		rowNo := i
@@ -451,9 +747,13 @@ func (f *DataFrame) Grid(includeHeaderRow bool) [][]interface{} {
 		}
 		row := make([]interface{}, colCnt)
 		for colNo, label := range f.Labels {
+			typ := types[colNo]
 			if val, OK := obj[label]; OK == true {
+				if v, err := coerceValue(val, typ); err == nil {
+					val = v
+				}
 				row[colNo] = val
-			} else {
+			} else if typ == "" || typ == TypeString {
 				row[colNo] = ""
 			}
 		}
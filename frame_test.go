@@ -364,3 +364,93 @@ func TestFrameRefresh(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestFrameRegenerate(t *testing.T) {
+	cName := path.Join("testdata", "frame_regenerate.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("expected to create %q, got %s", cName, err)
+		t.FailNow()
+	}
+	defer c.Close()
+	for i, year := range []int{2008, 2015, 2012, 2019} {
+		key := fmt.Sprintf("k%d", i)
+		src := []byte(fmt.Sprintf(`{"title": "Title %d", "year": %d}`, i, year))
+		if err := c.CreateJSON(key, src); err != nil {
+			t.Errorf("expected to create %q, got %s", key, err)
+			t.FailNow()
+		}
+	}
+	def := &FrameDefinition{
+		AllKeys: true,
+		Filter:  ".year >= 2010",
+		Sort:    "-.year",
+	}
+	f, err := c.FrameDefine("recent", def, []string{".title", ".year"}, []string{"title", "year"}, false)
+	if err != nil {
+		t.Errorf("expected to define frame, got %s", err)
+		t.FailNow()
+	}
+	if strings.Join(f.Keys, ",") != "k3,k1,k2" {
+		t.Errorf("expected k3,k1,k2, got %s", strings.Join(f.Keys, ","))
+	}
+
+	// The definition persists with the frame and is applied again
+	if err := c.CreateJSON("k4", []byte(`{"title": "Title 4", "year": 2017}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Delete("k1"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameRegenerate("recent", false); err != nil {
+		t.Errorf("expected to regenerate frame, got %s", err)
+		t.FailNow()
+	}
+	f, err = c.FrameRead("recent")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if f.Definition == nil || f.Definition.Filter != def.Filter || f.Definition.Sort != def.Sort {
+		t.Errorf("expected definition %+v, got %+v", def, f.Definition)
+	}
+	if strings.Join(f.Keys, ",") != "k3,k4,k2" || len(f.ObjectMap) != 3 {
+		t.Errorf("expected k3,k4,k2, got %s", strings.Join(f.Keys, ","))
+	}
+
+	// A sample is drawn from the filtered keys
+	def = &FrameDefinition{Keys: []string{"k0", "k2", "k3", "k4"}, Filter: ".year >= 2010", SampleSize: 2, Sort: ".year"}
+	f, err = c.FrameDefine("sample", def, []string{".year"}, []string{"year"}, false)
+	if err != nil {
+		t.Errorf("expected to define frame, got %s", err)
+		t.FailNow()
+	}
+	if len(f.Keys) != 2 || f.Keys[0] == "k0" || f.Keys[1] == "k0" {
+		t.Errorf("expected a sample of two filtered keys, got %+v", f.Keys)
+	}
+
+	// Frames without a definition are reframed with their own keys
+	if _, err := c.FrameCreate("plain", []string{"k0", "k2"}, []string{".title"}, []string{"title"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Delete("k0"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameRegenerate("plain", false); err != nil {
+		t.Errorf("expected to regenerate frame, got %s", err)
+		t.FailNow()
+	}
+	f, err = c.FrameRead("plain")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if strings.Join(f.Keys, ",") != "k2" {
+		t.Errorf("expected k2, got %+v", f.Keys)
+	}
+}
@@ -0,0 +1,504 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: framestore.go saves a frame as three files in _frames. NAME.json
+// holds the frame's definition, NAME.rows holds the framed objects as
+// line delimited JSON and NAME.offsets holds the key order along with
+// where each key's row is found in NAME.rows. A refresh appends the
+// changed rows and their offsets rather than rewriting the frame,
+// deleted rows get a tombstone offset. When the superseded rows
+// outnumber the frame's keys the files are compacted. Frames saved as
+// a single JSON document by earlier versions are migrated when read.
+//
+
+const (
+	// frameVersion marks a frame saved as header, rows and offsets
+	frameVersion = 2
+
+	// frameRowsExt is the extension of a frame's rows file
+	frameRowsExt = ".rows"
+
+	// frameOffsetsExt is the extension of a frame's offsets file
+	frameOffsetsExt = ".offsets"
+)
+
+// frameRow is a single line in a frame's rows file
+type frameRow struct {
+	Key    string      `json:"key"`
+	Object interface{} `json:"object"`
+}
+
+// frameOffset is a single line in a frame's offsets file
+type frameOffset struct {
+	Key     string `json:"key"`
+	Offset  int64  `json:"offset,omitempty"`
+	Length  int    `json:"length,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// frameFiles returns the paths of a frame's header, rows and offsets
+// files given the frame's path in FrameMap
+func (c *Collection) frameFiles(savedPath string) (string, string, string) {
+	header := path.Join(c.workPath, savedPath)
+	base := strings.TrimSuffix(header, ".json")
+	return header, base + frameRowsExt, base + frameOffsetsExt
+}
+
+// replaceFile writes a file in full, on local disc it writes a temp
+// file and renames it so a crash can't leave it truncated.
+func (c *Collection) replaceFile(fName string, src []byte) error {
+	if c.Store.Type != storage.FS {
+		return c.Store.WriteFile(fName, src, 0664)
+	}
+	tmpName := fName + ".tmp"
+	if err := c.Store.WriteFile(tmpName, src, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fName)
+}
+
+// appendFile adds src to the end of a file on local disc
+func appendFile(fName string, src []byte) error {
+	fp, err := os.OpenFile(fName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = fp.Write(src)
+	return err
+}
+
+// appendToFile adds src to the end of a file, stores that can't
+// append rewrite the file
+func (c *Collection) appendToFile(fName string, src []byte) error {
+	if c.Store.Type == storage.FS {
+		return appendFile(fName, src)
+	}
+	prior, err := c.Store.ReadFile(fName)
+	if err != nil {
+		prior = []byte{}
+	}
+	return c.Store.WriteFile(fName, append(prior, src...), 0664)
+}
+
+// encodeFrameHeader renders a frame without its keys and objects
+func encodeFrameHeader(f *DataFrame) ([]byte, error) {
+	h := *f
+	h.Keys, h.ObjectMap = nil, nil
+	src, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	header := map[string]json.RawMessage{}
+	if err := json.Unmarshal(src, &header); err != nil {
+		return nil, err
+	}
+	delete(header, "keys")
+	delete(header, "object_map")
+	header["frame_version"] = json.RawMessage(fmt.Sprintf("%d", frameVersion))
+	return json.MarshalIndent(header, "", "    ")
+}
+
+// decodeFrame decodes a frame's header, numbers stay json.Number as
+// they are in the collection's objects. It returns false if the frame
+// was saved as a single JSON document and needs migrating.
+func decodeFrame(src []byte) (*DataFrame, bool, error) {
+	version := struct {
+		FrameVersion int `json:"frame_version"`
+	}{}
+	if err := json.Unmarshal(src, &version); err != nil {
+		return nil, false, err
+	}
+	f := new(DataFrame)
+	decoder := json.NewDecoder(bytes.NewReader(src))
+	decoder.UseNumber()
+	if err := decoder.Decode(&f); err != nil {
+		return nil, false, err
+	}
+	if f.ObjectMap == nil {
+		f.ObjectMap = map[string]interface{}{}
+	}
+	return f, version.FrameVersion >= frameVersion, nil
+}
+
+// readFrameOffsets reads a frame's key order and row offsets
+func (c *Collection) readFrameOffsets(f *DataFrame, offsetsName string) error {
+	f.Keys, f.offsets, f.stale = []string{}, map[string]frameOffset{}, 0
+	f.position, f.holes = nil, 0
+	if c.Store.IsFile(offsetsName) == false {
+		return nil
+	}
+	src, err := c.Store.ReadFile(offsetsName)
+	if err != nil {
+		return err
+	}
+	order, position, removed := []string{}, map[string]int{}, map[int]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(make([]byte, 64*1024), len(src)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		o := frameOffset{}
+		if err := json.Unmarshal(line, &o); err != nil {
+			return fmt.Errorf("Can't read offsets of frame %s, %s", f.Name, err)
+		}
+		i, ok := position[o.Key]
+		switch {
+		case o.Deleted:
+			if ok {
+				removed[i] = true
+				delete(position, o.Key)
+				delete(f.offsets, o.Key)
+			}
+			f.stale++
+		case ok:
+			f.offsets[o.Key] = o
+			f.stale++
+		default:
+			position[o.Key] = len(order)
+			order = append(order, o.Key)
+			f.offsets[o.Key] = o
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for i, key := range order {
+		if removed[i] == false {
+			f.Keys = append(f.Keys, key)
+		}
+	}
+	return nil
+}
+
+// keyPosition returns the index of key in the frame's keys or -1
+func (f *DataFrame) keyPosition(key string) int {
+	if f.position == nil {
+		f.position = make(map[string]int, len(f.Keys))
+		for i, k := range f.Keys {
+			if k != "" {
+				f.position[k] = i
+			}
+		}
+	}
+	if i, ok := f.position[key]; ok {
+		return i
+	}
+	return -1
+}
+
+// appendKey adds a key to the end of the frame's keys
+func (f *DataFrame) appendKey(key string) {
+	if f.keyPosition(key) < 0 {
+		f.position[key] = len(f.Keys)
+		f.Keys = append(f.Keys, key)
+	}
+}
+
+// removeKey removes a key from the frame's keys, the keys are
+// compacted once half of them have been removed
+func (f *DataFrame) removeKey(key string) {
+	i := f.keyPosition(key)
+	if i < 0 {
+		return
+	}
+	f.Keys[i] = ""
+	delete(f.position, key)
+	f.holes++
+	if f.holes > len(f.Keys)/2 {
+		f.compactKeys()
+	}
+}
+
+// compactKeys drops the removed keys from the frame's keys
+func (f *DataFrame) compactKeys() {
+	if f.holes > 0 {
+		keys := make([]string, 0, len(f.Keys)-f.holes)
+		for _, key := range f.Keys {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+		f.Keys, f.holes = keys, 0
+	}
+	f.position = nil
+}
+
+// readFrameRows reads the rows of keys into the frame's ObjectMap.
+// On local disc only the rows needed are read.
+func (c *Collection) readFrameRows(f *DataFrame, rowsName string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var (
+		src []byte
+		fp  *os.File
+		err error
+	)
+	if c.Store.Type == storage.FS && len(keys) < len(f.Keys) {
+		fp, err = os.Open(rowsName)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+	} else if src, err = c.Store.ReadFile(rowsName); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		o, ok := f.offsets[key]
+		if ok == false {
+			continue
+		}
+		line := make([]byte, o.Length)
+		if fp != nil {
+			if _, err := fp.ReadAt(line, o.Offset); err != nil {
+				return fmt.Errorf("Can't read row %q of frame %s, %s", key, f.Name, err)
+			}
+		} else if o.Offset+int64(o.Length) <= int64(len(src)) {
+			line = src[o.Offset : o.Offset+int64(o.Length)]
+		} else {
+			return fmt.Errorf("Can't read row %q of frame %s, offset out of range", key, f.Name)
+		}
+		row := frameRow{}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&row); err != nil {
+			return fmt.Errorf("Can't read row %q of frame %s, %s", key, f.Name, err)
+		}
+		f.ObjectMap[key] = row.Object
+	}
+	return nil
+}
+
+// readFrame reads a frame saved at savedPath, without rows only the
+// frame's definition and keys are read. It returns false if the frame
+// was saved as a single JSON document, its rows are always read and
+// it needs writing in the current layout, see loadFrame.
+func (c *Collection) readFrame(savedPath string, withRows bool) (*DataFrame, bool, error) {
+	header, rowsName, offsetsName := c.frameFiles(savedPath)
+	src, err := c.Store.ReadFile(header)
+	if err != nil {
+		return nil, false, err
+	}
+	f, current, err := decodeFrame(src)
+	if err != nil || current == false {
+		return f, current, err
+	}
+	if err := c.readFrameOffsets(f, offsetsName); err != nil {
+		return nil, false, err
+	}
+	if withRows {
+		if err := c.readFrameRows(f, rowsName, f.Keys); err != nil {
+			return nil, false, err
+		}
+	}
+	return f, true, nil
+}
+
+// writeFrame saves a frame in full. Rows of keys missing from the
+// frame's ObjectMap are copied from the saved rows.
+func (c *Collection) writeFrame(savedPath string, f *DataFrame) error {
+	header, rowsName, offsetsName := c.frameFiles(savedPath)
+	f.compactKeys()
+	var saved []byte
+	for _, key := range f.Keys {
+		if _, ok := f.ObjectMap[key]; ok == false && f.offsets != nil {
+			src, err := c.Store.ReadFile(rowsName)
+			if err != nil {
+				return err
+			}
+			saved = src
+			break
+		}
+	}
+	rows, offsets := new(bytes.Buffer), new(bytes.Buffer)
+	newOffsets := make(map[string]frameOffset, len(f.Keys))
+	for _, key := range f.Keys {
+		var (
+			line []byte
+			err  error
+		)
+		if obj, ok := f.ObjectMap[key]; ok {
+			line, err = json.Marshal(frameRow{Key: key, Object: obj})
+		} else if o, ok := f.offsets[key]; ok && o.Offset+int64(o.Length) <= int64(len(saved)) {
+			line = saved[o.Offset : o.Offset+int64(o.Length)]
+		} else {
+			line, err = json.Marshal(frameRow{Key: key})
+		}
+		if err != nil {
+			return err
+		}
+		o := frameOffset{Key: key, Offset: int64(rows.Len()), Length: len(line)}
+		src, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		rows.Write(line)
+		rows.WriteByte('\n')
+		offsets.Write(src)
+		offsets.WriteByte('\n')
+		newOffsets[key] = o
+	}
+	src, err := encodeFrameHeader(f)
+	if err != nil {
+		return err
+	}
+	// NOTE: The header is written last, it marks the frame as migrated
+	if err := c.replaceFile(rowsName, rows.Bytes()); err != nil {
+		return err
+	}
+	if err := c.replaceFile(offsetsName, offsets.Bytes()); err != nil {
+		return err
+	}
+	if err := c.replaceFile(header, src); err != nil {
+		return err
+	}
+	f.offsets, f.stale = newOffsets, 0
+	return nil
+}
+
+// writeFrameRows saves the rows of the changed keys. Keys in the frame
+// have their rows appended, keys no longer in the frame are removed.
+// New keys must have been added to the end of the frame's keys. The
+// frame is saved in full instead when the store can't append or when
+// enough of the saved rows are stale.
+func (c *Collection) writeFrameRows(savedPath string, f *DataFrame, keys []string) error {
+	header, rowsName, offsetsName := c.frameFiles(savedPath)
+	if c.Store.Type != storage.FS || f.offsets == nil ||
+		(f.stale > minCompactSize && f.stale > len(f.Keys)-f.holes) {
+		return c.writeFrame(savedPath, f)
+	}
+	info, err := os.Stat(rowsName)
+	if err != nil {
+		return c.writeFrame(savedPath, f)
+	}
+	rows, offsets, seen := new(bytes.Buffer), new(bytes.Buffer), map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		_, saved := f.offsets[key]
+		o := frameOffset{Key: key}
+		switch {
+		case f.keyPosition(key) >= 0:
+			line, err := json.Marshal(frameRow{Key: key, Object: f.ObjectMap[key]})
+			if err != nil {
+				return err
+			}
+			o.Offset, o.Length = info.Size()+int64(rows.Len()), len(line)
+			rows.Write(line)
+			rows.WriteByte('\n')
+			f.offsets[key] = o
+			if saved {
+				f.stale++
+			}
+		case saved:
+			o.Deleted = true
+			delete(f.offsets, key)
+			f.stale++
+		default:
+			continue
+		}
+		src, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		offsets.Write(src)
+		offsets.WriteByte('\n')
+	}
+	if rows.Len() > 0 {
+		if err := appendFile(rowsName, rows.Bytes()); err != nil {
+			return err
+		}
+	}
+	if offsets.Len() > 0 {
+		if err := appendFile(offsetsName, offsets.Bytes()); err != nil {
+			return err
+		}
+	}
+	src, err := encodeFrameHeader(f)
+	if err != nil {
+		return err
+	}
+	return c.replaceFile(header, src)
+}
+
+// setFrameRows saves the rows of the changed keys of a frame, see
+// writeFrameRows. The caller holds the collection's lock.
+func (c *Collection) setFrameRows(key string, f *DataFrame, keys []string) error {
+	savedPath, ok := c.FrameMap[key]
+	if ok == false {
+		return c.setFrame(key, f)
+	}
+	f.CollectionName = c.Name
+	f.Name = key
+	return c.writeFrameRows(savedPath, f, keys)
+}
+
+// FrameObjectsPage returns limit objects of a frame starting at
+// offset, only the rows needed are read. A limit of zero or less
+// returns the objects to the end of the frame.
+func (c *Collection) FrameObjectsPage(name string, offset int, limit int) ([]map[string]interface{}, error) {
+	f, err := c.getFrameWithoutRows(name)
+	if err != nil {
+		return nil, err
+	}
+	ol := []map[string]interface{}{}
+	if offset < 0 || offset >= len(f.Keys) {
+		return ol, nil
+	}
+	keys := f.Keys[offset:]
+	if limit > 0 && limit < len(keys) {
+		keys = keys[0:limit]
+	}
+	missing := []string{}
+	for _, key := range keys {
+		if _, ok := f.ObjectMap[key]; ok == false {
+			missing = append(missing, key)
+		}
+	}
+	_, rowsName, _ := c.frameFiles(c.FrameMap[name])
+	if err := c.readFrameRows(f, rowsName, missing); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if obj, ok := f.ObjectMap[key].(map[string]interface{}); ok {
+			ol = append(ol, obj)
+		}
+	}
+	return ol, nil
+}
@@ -0,0 +1,160 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFrameStore(t *testing.T) {
+	cName := path.Join("testdata", "frame_store.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("expected to create %q, got %s", cName, err)
+		t.FailNow()
+	}
+	defer c.Close()
+	keys := []string{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		src := []byte(fmt.Sprintf(`{"title": "Title %d", "n": %d}`, i, i))
+		if err := c.CreateJSON(key, src); err != nil {
+			t.Errorf("expected to create %q, got %s", key, err)
+			t.FailNow()
+		}
+		keys = append(keys, key)
+	}
+	f, err := c.FrameCreate("f1", keys, []string{".title", ".n"}, []string{"title", "n"}, false)
+	if err != nil {
+		t.Errorf("expected to create frame, got %s", err)
+		t.FailNow()
+	}
+	header, rowsName, offsetsName := c.frameFiles(c.FrameMap["f1"])
+	for _, fName := range []string{header, rowsName, offsetsName} {
+		if c.Store.IsFile(fName) == false {
+			t.Errorf("expected %q to exist", fName)
+		}
+	}
+
+	// Paging only reads the rows asked for
+	ol, err := c.FrameObjectsPage("f1", 3, 4)
+	if err != nil {
+		t.Errorf("expected a page of objects, got %s", err)
+		t.FailNow()
+	}
+	if len(ol) != 4 || ol[0]["title"] != "Title 3" || ol[3]["title"] != "Title 6" {
+		t.Errorf("expected Title 3 to Title 6, got %+v", ol)
+	}
+	ol, _ = c.FrameObjectsPage("f1", 8, 0)
+	if len(ol) != 2 {
+		t.Errorf("expected the last two objects, got %+v", ol)
+	}
+	ol, _ = c.FrameObjectsPage("f1", 20, 5)
+	if len(ol) != 0 {
+		t.Errorf("expected no objects past the end, got %+v", ol)
+	}
+
+	// Refreshing appends changed rows
+	if err := c.UpdateJSON("k2", []byte(`{"title": "Title Two", "n": 2}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameRefresh("f1", []string{"k2"}, false); err != nil {
+		t.Errorf("expected to refresh frame, got %s", err)
+		t.FailNow()
+	}
+
+	// Live frames tombstone the rows of deleted objects
+	if err := c.FrameLive("f1", LiveImmediate); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Delete("k5"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	f, err = c.FrameRead("f1")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	expected := "k0,k1,k2,k3,k4,k6,k7,k8,k9"
+	if strings.Join(f.Keys, ",") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(f.Keys, ","))
+	}
+	if len(f.ObjectMap) != 9 {
+		t.Errorf("expected 9 objects, got %d", len(f.ObjectMap))
+	}
+	if obj, ok := f.ObjectMap["k2"].(map[string]interface{}); ok == false || obj["title"] != "Title Two" {
+		t.Errorf("expected refreshed row for k2, got %+v", f.ObjectMap["k2"])
+	}
+	if f.stale != 2 {
+		t.Errorf("expected 2 stale rows, got %d", f.stale)
+	}
+
+	// A full save compacts the rows
+	if err := c.setFrame("f1", f); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	f, _ = c.FrameRead("f1")
+	if f.stale != 0 || strings.Join(f.Keys, ",") != expected {
+		t.Errorf("expected compacted frame, got %d stale, keys %s", f.stale, strings.Join(f.Keys, ","))
+	}
+
+	// Frames saved as a single JSON document are migrated when read
+	src, err := json.Marshal(f)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	os.Remove(rowsName)
+	os.Remove(offsetsName)
+	if err := c.Store.WriteFile(header, src, 0664); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	f, err = c.FrameRead("f1")
+	if err != nil {
+		t.Errorf("expected to read legacy frame, got %s", err)
+		t.FailNow()
+	}
+	if strings.Join(f.Keys, ",") != expected || len(f.ObjectMap) != 9 {
+		t.Errorf("expected legacy frame keys %s, got %s", expected, strings.Join(f.Keys, ","))
+	}
+	for _, fName := range []string{rowsName, offsetsName} {
+		if c.Store.IsFile(fName) == false {
+			t.Errorf("expected migration to write %q", fName)
+		}
+	}
+	src, _ = c.Store.ReadFile(header)
+	if strings.Contains(string(src), `"frame_version"`) == false || strings.Contains(string(src), `"object_map"`) {
+		t.Errorf("expected a frame header, got %s", src)
+	}
+	ol, err = c.FrameObjectsPage("f1", 0, 2)
+	if err != nil || len(ol) != 2 {
+		t.Errorf("expected two objects from migrated frame, got %+v, %v", ol, err)
+	}
+}
@@ -0,0 +1,503 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// NOTE: frametypes.go infers, records and coerces the types of a frame's
+// columns. A column's values are described by one of the types below.
+//
+
+const (
+	// TypeString is a column of strings
+	TypeString = "string"
+
+	// TypeInteger is a column of whole numbers
+	TypeInteger = "integer"
+
+	// TypeNumber is a column of numbers
+	TypeNumber = "number"
+
+	// TypeBoolean is a column of true or false values
+	TypeBoolean = "boolean"
+
+	// TypeDate is a column of dates (e.g. "2006-01-02") or timestamps
+	TypeDate = "date"
+
+	// TypeArray is a column of JSON arrays
+	TypeArray = "array"
+
+	// TypeObject is a column of JSON objects
+	TypeObject = "object"
+
+	// TypeMixed is a column holding values of more than one type
+	TypeMixed = "mixed"
+)
+
+// ColumnType describes the values found in a frame's column
+type ColumnType struct {
+	// Label is the column's label in the frame
+	Label string `json:"label"`
+
+	// Type is the column's type, it is empty when all the column's
+	// values are null
+	Type string `json:"type,omitempty"`
+
+	// NullCount counts the rows where the column is missing, null
+	// or an empty string
+	NullCount int `json:"null_count"`
+
+	// Declared is true when the type was declared rather than
+	// inferred, values are coerced to a declared type
+	Declared bool `json:"declared,omitempty"`
+}
+
+// isColumnType checks if typ is a known column type name
+func isColumnType(typ string) bool {
+	switch typ {
+	case TypeString, TypeInteger, TypeNumber, TypeBoolean,
+		TypeDate, TypeArray, TypeObject, TypeMixed:
+		return true
+	}
+	return false
+}
+
+// ParseColumnTypes parses a list of label and type pairs
+// (e.g. "year=integer,published=date") into a map of label to type.
+// An empty type (e.g. "year=") removes a declared type.
+func ParseColumnTypes(expr string) (map[string]string, error) {
+	types := map[string]string{}
+	for _, item := range strings.Split(expr, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("expected LABEL=TYPE, got %q", item)
+		}
+		label, typ := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if typ != "" && isColumnType(typ) == false {
+			return nil, fmt.Errorf("unknown type %q for %q", typ, label)
+		}
+		types[label] = typ
+	}
+	return types, nil
+}
+
+// parseDate parses a string as a date (see dateLayouts in sort.go)
+// returning the layout it matched
+func parseDate(s string) (time.Time, string, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, layout, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// parseNumber checks if a string is a JSON number
+func parseNumber(s string) (json.Number, bool) {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return "", false
+	}
+	n, ok := value.(json.Number)
+	return n, ok
+}
+
+// isNull checks if a value counts as a null in a column
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	return ok && s == ""
+}
+
+// valueType returns the type of a value, null values have no type
+func valueType(value interface{}) string {
+	if isNull(value) {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		if _, _, ok := parseDate(v); ok {
+			return TypeDate
+		}
+		return TypeString
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return TypeNumber
+		}
+		return TypeInteger
+	case float64:
+		if v == math.Trunc(v) && math.IsInf(v, 0) == false {
+			return TypeInteger
+		}
+		return TypeNumber
+	case float32:
+		return valueType(float64(v))
+	case int, int64, int32:
+		return TypeInteger
+	case bool:
+		return TypeBoolean
+	case time.Time:
+		return TypeDate
+	case []interface{}:
+		return TypeArray
+	case map[string]interface{}:
+		return TypeObject
+	}
+	return TypeMixed
+}
+
+// widenType returns a type that describes values of both types
+func widenType(a string, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "" || a == b:
+		return a
+	case (a == TypeInteger && b == TypeNumber) || (a == TypeNumber && b == TypeInteger):
+		return TypeNumber
+	case (a == TypeDate && b == TypeString) || (a == TypeString && b == TypeDate):
+		return TypeString
+	}
+	return TypeMixed
+}
+
+// coerceValue converts a value to a column type. Null values and
+// empty strings in a column that isn't a string column become nil.
+// Numbers are returned as json.Number so they are rendered exactly.
+func coerceValue(value interface{}, typ string) (interface{}, error) {
+	if typ == "" || typ == TypeMixed || value == nil {
+		return value, nil
+	}
+	if s, ok := value.(string); ok && typ != TypeString {
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+	}
+	switch typ {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		case float64, float32, int, int64:
+			r, _ := aggregateNumber(v)
+			return ratToNumber(r).String(), nil
+		}
+		return colToString(value), nil
+	case TypeInteger, TypeNumber:
+		if s, ok := value.(string); ok {
+			n, ok := parseNumber(strings.TrimSpace(s))
+			if ok == false {
+				return value, fmt.Errorf("%q is not a number", s)
+			}
+			value = n
+		}
+		r, ok := aggregateNumber(value)
+		if ok == false {
+			return value, fmt.Errorf("%v is not a number", value)
+		}
+		if typ == TypeInteger {
+			if r.IsInt() == false {
+				return value, fmt.Errorf("%v is not an integer", value)
+			}
+			return json.Number(r.Num().String()), nil
+		}
+		if n, ok := value.(json.Number); ok {
+			return n, nil
+		}
+		return ratToNumber(r), nil
+	case TypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "t", "yes", "y", "1":
+				return true, nil
+			case "false", "f", "no", "n", "0":
+				return false, nil
+			}
+		default:
+			if r, ok := aggregateNumber(v); ok && r.IsInt() {
+				switch r.Num().Int64() {
+				case 1:
+					return true, nil
+				case 0:
+					return false, nil
+				}
+			}
+		}
+		return value, fmt.Errorf("%v is not a boolean", value)
+	case TypeDate:
+		switch v := value.(type) {
+		case time.Time:
+			return v.Format(time.RFC3339Nano), nil
+		case string:
+			// NOTE: a date keeps the text it was written as
+			if s := strings.TrimSpace(v); s != "" {
+				if _, _, ok := parseDate(s); ok {
+					return s, nil
+				}
+			}
+		}
+		return value, fmt.Errorf("%v is not a date", value)
+	case TypeArray:
+		switch v := value.(type) {
+		case []interface{}:
+			return v, nil
+		case string:
+			if s := strings.TrimSpace(v); strings.HasPrefix(s, "[") {
+				a := []interface{}{}
+				decoder := json.NewDecoder(strings.NewReader(s))
+				decoder.UseNumber()
+				if err := decoder.Decode(&a); err != nil {
+					return value, fmt.Errorf("%q is not an array, %s", v, err)
+				}
+				return a, nil
+			}
+		}
+		// NOTE: a single value becomes an array of one
+		return []interface{}{value}, nil
+	case TypeObject:
+		switch v := value.(type) {
+		case map[string]interface{}:
+			return v, nil
+		case string:
+			if s := strings.TrimSpace(v); strings.HasPrefix(s, "{") {
+				m := map[string]interface{}{}
+				decoder := json.NewDecoder(strings.NewReader(s))
+				decoder.UseNumber()
+				if err := decoder.Decode(&m); err != nil {
+					return value, fmt.Errorf("%q is not an object, %s", v, err)
+				}
+				return m, nil
+			}
+		}
+		return value, fmt.Errorf("%v is not an object", value)
+	}
+	return value, fmt.Errorf("unknown type %q", typ)
+}
+
+// formatCell renders a value as a CSV cell of a column type, null
+// values in a typed column are rendered as an empty cell
+func formatCell(value interface{}, typ string) string {
+	if typ == "" {
+		return colToString(value)
+	}
+	if v, err := coerceValue(value, typ); err == nil {
+		value = v
+	}
+	if value == nil {
+		return ""
+	}
+	return colToString(value)
+}
+
+// columnType returns the type recorded for a label, nil if there
+// isn't one
+func (f *DataFrame) columnType(label string) *ColumnType {
+	for _, t := range f.Types {
+		if t.Label == label {
+			return t
+		}
+	}
+	return nil
+}
+
+// columnTypes returns the type name of each of the frame's columns,
+// columns without a type are an empty string
+func (f *DataFrame) columnTypes() []string {
+	return f.typesOfColumns(false)
+}
+
+// declaredColumnTypes is columnTypes leaving out the inferred types
+func (f *DataFrame) declaredColumnTypes() []string {
+	return f.typesOfColumns(true)
+}
+
+// typesOfColumns returns the type name of each of the frame's
+// columns, only declared types are returned if declaredOnly is true
+func (f *DataFrame) typesOfColumns(declaredOnly bool) []string {
+	n := len(f.Labels)
+	if len(f.DotPaths) > n {
+		n = len(f.DotPaths)
+	}
+	types := make([]string, n)
+	for i, label := range f.Labels {
+		if t := f.columnType(label); t != nil && (t.Declared || declaredOnly == false) {
+			types[i] = t.Type
+		}
+	}
+	return types
+}
+
+// declareTypes sets the declared types of a frame's columns, an empty
+// type returns a column to being inferred
+func (f *DataFrame) declareTypes(types map[string]string) error {
+	for label, typ := range types {
+		if _, ok := findLabel(f.Labels, label); ok == false {
+			return fmt.Errorf("%q is not a label in frame %s", label, f.Name)
+		}
+		if typ != "" && isColumnType(typ) == false {
+			return fmt.Errorf("unknown type %q for %q", typ, label)
+		}
+	}
+	columns := make([]*ColumnType, len(f.Labels))
+	for i, label := range f.Labels {
+		t := f.columnType(label)
+		if t == nil {
+			t = &ColumnType{Label: label}
+		}
+		if typ, ok := types[label]; ok {
+			t.Type, t.Declared = typ, typ != ""
+		}
+		columns[i] = t
+	}
+	f.Types = columns
+	return nil
+}
+
+// coerceRow converts a row's values to the declared types of the
+// frame's columns. Values that can't be converted are left as they
+// are.
+func (f *DataFrame) coerceRow(key string, row map[string]interface{}, verbose bool) {
+	for _, t := range f.Types {
+		if t.Declared == false {
+			continue
+		}
+		value, ok := row[t.Label]
+		if ok == false {
+			continue
+		}
+		v, err := coerceValue(value, t.Type)
+		if err != nil {
+			if verbose {
+				log.Printf("WARNING key %q, %s can't be coerced to %s, %s", key, t.Label, t.Type, err)
+			}
+			continue
+		}
+		row[t.Label] = v
+	}
+}
+
+// inferTypes records the types and null counts of the frame's columns
+// from its rows, declared types are kept
+func (f *DataFrame) inferTypes() {
+	if err := f.declareTypes(nil); err != nil {
+		return
+	}
+	for _, t := range f.Types {
+		t.NullCount = 0
+		if t.Declared == false {
+			t.Type = ""
+		}
+	}
+	for _, key := range f.Keys {
+		row, _ := f.ObjectMap[key].(map[string]interface{})
+		for _, t := range f.Types {
+			value := row[t.Label]
+			if isNull(value) {
+				t.NullCount++
+			} else if t.Declared == false {
+				t.Type = widenType(t.Type, valueType(value))
+			}
+		}
+	}
+}
+
+// widenTypes widens the inferred types of a frame's columns to
+// describe a changed row. It is used when a frame's rows haven't been
+// read, null counts are left to the next full update of the frame.
+func (f *DataFrame) widenTypes(row map[string]interface{}) {
+	if f.Types == nil {
+		return
+	}
+	for _, t := range f.Types {
+		if t.Declared == false {
+			t.Type = widenType(t.Type, valueType(row[t.Label]))
+		}
+	}
+}
+
+// FrameTypes returns the types of a frame's columns. The types of a
+// frame created before types were recorded are inferred from its rows.
+func (c *Collection) FrameTypes(name string) ([]*ColumnType, error) {
+	f, err := c.getFrameWithoutRows(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.Types == nil {
+		if f, err = c.getFrame(name); err != nil {
+			return nil, err
+		}
+		f.inferTypes()
+	}
+	return f.Types, nil
+}
+
+// FrameSetTypes declares the types of a frame's columns by label
+// (e.g. "year": "integer"). The frame's values are coerced to the
+// declared types now and whenever the frame is refreshed. An empty
+// type returns a column to having its type inferred.
+func (c *Collection) FrameSetTypes(name string, types map[string]string, verbose bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	f, err := c.loadFrame(name, true)
+	if err != nil {
+		return err
+	}
+	if err := f.declareTypes(types); err != nil {
+		return err
+	}
+	for _, key := range f.Keys {
+		if row, ok := f.ObjectMap[key].(map[string]interface{}); ok {
+			f.coerceRow(key, row, verbose)
+		}
+	}
+	f.inferTypes()
+	f.Updated = time.Now()
+	if err := c.setFrame(name, f); err != nil {
+		return err
+	}
+	return c.updateSearchIndexes(f, nil)
+}
@@ -0,0 +1,249 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestValueTypes(t *testing.T) {
+	values := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"", ""},
+		{"hello", TypeString},
+		{"2021-03-04", TypeDate},
+		{"2021-03-04T10:11:12Z", TypeDate},
+		{json.Number("12"), TypeInteger},
+		{json.Number("1.5"), TypeNumber},
+		{3.0, TypeInteger},
+		{3.25, TypeNumber},
+		{true, TypeBoolean},
+		{[]interface{}{"a"}, TypeArray},
+		{map[string]interface{}{"a": 1}, TypeObject},
+	}
+	for _, v := range values {
+		if typ := valueType(v.value); typ != v.expected {
+			t.Errorf("expected %v to be %q, got %q", v.value, v.expected, typ)
+		}
+	}
+	widened := []struct {
+		a, b, expected string
+	}{
+		{"", TypeInteger, TypeInteger},
+		{TypeInteger, TypeNumber, TypeNumber},
+		{TypeDate, TypeString, TypeString},
+		{TypeInteger, TypeString, TypeMixed},
+	}
+	for _, w := range widened {
+		if typ := widenType(w.a, w.b); typ != w.expected {
+			t.Errorf("expected %q and %q to widen to %q, got %q", w.a, w.b, w.expected, typ)
+		}
+	}
+
+	coerced := []struct {
+		value    interface{}
+		typ      string
+		expected string
+		ok       bool
+	}{
+		{" 42 ", TypeInteger, "42", true},
+		{"4.0", TypeInteger, "4", true},
+		{"4.5", TypeInteger, "", false},
+		{"4.5", TypeNumber, "4.5", true},
+		{"", TypeNumber, "null", true},
+		{json.Number("7"), TypeString, `"7"`, true},
+		{"yes", TypeBoolean, "true", true},
+		{json.Number("0"), TypeBoolean, "false", true},
+		{"maybe", TypeBoolean, "", false},
+		{"2021-03-04", TypeDate, `"2021-03-04"`, true},
+		{"2021-03-04 10:11:12", TypeDate, `"2021-03-04 10:11:12"`, true},
+		{"2019-01-02T10:00:00.123456789", TypeDate, `"2019-01-02T10:00:00.123456789"`, true},
+		{"March", TypeDate, "", false},
+		{`["a", 1]`, TypeArray, `["a",1]`, true},
+		{"a", TypeArray, `["a"]`, true},
+		{`{"a": 1}`, TypeObject, `{"a":1}`, true},
+		{"a", TypeObject, "", false},
+		{"a", TypeMixed, `"a"`, true},
+	}
+	for _, c := range coerced {
+		value, err := coerceValue(c.value, c.typ)
+		if c.ok == false {
+			if err == nil {
+				t.Errorf("expected %v not to coerce to %s, got %v", c.value, c.typ, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected %v to coerce to %s, got %s", c.value, c.typ, err)
+			continue
+		}
+		src, _ := json.Marshal(value)
+		if string(src) != c.expected {
+			t.Errorf("expected %v as %s to be %s, got %s", c.value, c.typ, c.expected, src)
+		}
+	}
+
+	types, err := ParseColumnTypes("year=integer, published=date,title=")
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	if types["year"] != TypeInteger || types["published"] != TypeDate || types["title"] != "" || len(types) != 3 {
+		t.Errorf("unexpected types %+v", types)
+	}
+	if _, err := ParseColumnTypes("year=int"); err == nil {
+		t.Errorf("expected an unknown type error")
+	}
+}
+
+func TestFrameTypes(t *testing.T) {
+	cName := path.Join("testdata", "frame_types.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("expected to create %q, got %s", cName, err)
+		t.FailNow()
+	}
+	defer c.Close()
+	objects := map[string]string{
+		"k1": `{"title": "One", "year": "2019", "score": 1.5, "published": "2019-05-01"}`,
+		"k2": `{"title": "Two", "year": "2020", "score": 2}`,
+		"k3": `{"title": "Three", "year": "", "score": 3, "published": "2021-01-30"}`,
+	}
+	keys := []string{"k1", "k2", "k3"}
+	for _, key := range keys {
+		if err := c.CreateJSON(key, []byte(objects[key])); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	dotPaths := []string{"._Key", ".title", ".year", ".score", ".published"}
+	labels := []string{"id", "title", "year", "score", "published"}
+	f, err := c.FrameCreate("f1", keys, dotPaths, labels, false)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+
+	// Types are inferred when the frame is created
+	expected := map[string]ColumnType{
+		"id":        {Label: "id", Type: TypeString},
+		"title":     {Label: "title", Type: TypeString},
+		"year":      {Label: "year", Type: TypeString, NullCount: 1},
+		"score":     {Label: "score", Type: TypeNumber},
+		"published": {Label: "published", Type: TypeDate, NullCount: 1},
+	}
+	types, err := c.FrameTypes("f1")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(types) != len(labels) {
+		t.Errorf("expected %d types, got %d", len(labels), len(types))
+	}
+	for _, typ := range types {
+		if *typ != expected[typ.Label] {
+			t.Errorf("expected %+v, got %+v", expected[typ.Label], typ)
+		}
+	}
+
+	// Declared types coerce the frame's values
+	if err := c.FrameSetTypes("f1", map[string]string{"year": TypeInteger}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	f, _ = c.FrameRead("f1")
+	row := f.ObjectMap["k1"].(map[string]interface{})
+	if year, ok := row["year"].(json.Number); ok == false || year.String() != "2019" {
+		t.Errorf("expected year to be coerced to 2019, got (%T) %v", row["year"], row["year"])
+	}
+	if typ := f.columnType("year"); typ == nil || typ.Type != TypeInteger || typ.Declared == false || typ.NullCount != 1 {
+		t.Errorf("expected declared integer year, got %+v", typ)
+	}
+	if err := c.FrameSetTypes("f1", map[string]string{"missing": TypeInteger}, false); err == nil {
+		t.Errorf("expected an error declaring the type of a missing label")
+	}
+
+	// and are applied when the frame is refreshed
+	if err := c.CreateJSON("k4", []byte(`{"title": "Four", "year": "2022", "score": "4.25", "published": "2022-12-01"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameRefresh("f1", []string{"k4"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	f, _ = c.FrameRead("f1")
+	row = f.ObjectMap["k4"].(map[string]interface{})
+	if year, ok := row["year"].(json.Number); ok == false || year.String() != "2022" {
+		t.Errorf("expected refreshed year to be coerced, got (%T) %v", row["year"], row["year"])
+	}
+	if typ := f.columnType("score"); typ == nil || typ.Type != TypeMixed {
+		t.Errorf("expected score to be mixed, got %+v", typ)
+	}
+
+	// Grid and exports use the types
+	grid := f.Grid(false)
+	if len(grid) != 4 || grid[1][4] != nil || grid[2][2] != nil {
+		t.Errorf("expected nil for missing published and empty year, got %+v", grid)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := c.ExportCSV(buf, os.Stderr, f, false); err != nil {
+		t.Errorf("%s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[2] != "k2,Two,2020,2," || lines[3] != "k3,Three,,3,2021-01-30" {
+		t.Errorf("unexpected CSV export %q", lines)
+	}
+	_, table, err := c.ExportTable(os.Stderr, f, false)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	if year, ok := table[1][2].(json.Number); ok == false || year.String() != "2019" {
+		t.Errorf("expected table year to be a number, got (%T) %v", table[1][2], table[1][2])
+	}
+
+	// Merged cells are parsed by the frame's types
+	table = [][]interface{}{
+		{"id", "title", "year", "score", "published"},
+		{"k5", "Five", "2023", "5", "2023-02-03"},
+	}
+	if err := c.MergeFromTable("f1", table, true, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	obj := map[string]interface{}{}
+	if err := c.Read("k5", obj, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if year, ok := obj["year"].(json.Number); ok == false || year.String() != "2023" {
+		t.Errorf("expected merged year to be a number, got (%T) %v", obj["year"], obj["year"])
+	}
+	if obj["published"] != "2023-02-03" {
+		t.Errorf("expected merged published date, got %v", obj["published"])
+	}
+}
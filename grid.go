@@ -19,37 +19,56 @@
 package dataset
 
 import (
+	"context"
 	"log"
 	"os"
-
-	// Caltech Library Packages
-	"github.com/caltechlibrary/dotpath"
 )
 
 // Grid takes a set of collection keys and builds a grid (a 2D array of cells)
 // from the array of keys and dot paths provided
 func (c *Collection) Grid(keys []string, dotPaths []string, verbose bool) ([][]interface{}, error) {
+	for _, dotPath := range dotPaths {
+		if err := checkPath(dotPath); err != nil {
+			return nil, err
+		}
+	}
 	pid := os.Getpid()
-	rows := make([][]interface{}, len(keys))
+	rows := make([][]interface{}, 0, len(keys))
 	colCnt := len(dotPaths)
-	for i, key := range keys {
-		rec := map[string]interface{}{}
-		err := c.Read(key, rec, false)
+	err := c.parallelObjects(context.Background(), keys, func(key string, rec map[string]interface{}) (interface{}, error) {
+		row := make([]interface{}, colCnt)
+		errs := make([]error, colCnt)
+		for j, dpath := range dotPaths {
+			row[j], errs[j] = evalPath(dpath, rec)
+		}
+		return gridRow{row, errs}, nil
+	}, func(i int, key string, value interface{}, err error) error {
 		if err != nil {
-			return nil, err
+			return err
 		}
-		rows[i] = make([]interface{}, colCnt)
-		for j, dpath := range dotPaths {
-			value, err := dotpath.Eval(dpath, rec)
-			if err == nil {
-				rows[i][j] = value
-			} else if verbose == true {
-				log.Printf("(pid: %d) WARNING: skipped key %s, path %s for row %d and column %d, %s", pid, key, dpath, i, j, err)
+		r := value.(gridRow)
+		for j, err := range r.errs {
+			if err != nil {
+				r.cells[j] = nil
+				if verbose == true {
+					log.Printf("(pid: %d) WARNING: skipped key %s, path %s for row %d and column %d, %s", pid, key, dotPaths[j], i, j, err)
+				}
 			}
 		}
+		rows = append(rows, r.cells)
 		if verbose && (i > 0) && ((i % 1000) == 0) {
 			log.Printf("(pid: %d) %d keys processed", pid, i)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return rows, nil
 }
+
+// gridRow holds a row's cells and the errors evaluating them
+type gridRow struct {
+	cells []interface{}
+	errs  []error
+}
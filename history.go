@@ -0,0 +1,217 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+)
+
+//
+// NOTE: history.go keeps prior revisions of objects when a collection
+// has KeepRevisions set. Revisions are stored outside the pairtree
+// in _history, mirroring the pairtree path of the object. The
+// ${KEY}.history directory holds a history.json listing the revisions
+// and the object's JSON source for each revision as ${REV}.json.
+//
+
+const (
+	// historyDir holds the revisions of objects in a collection
+	historyDir = "_history"
+)
+
+// Revision describes one saved version of an object
+type Revision struct {
+	// Revision number, starting with 1
+	Revision int `json:"revision"`
+	// Modified is when the revision was written in RFC3339 format
+	Modified string `json:"modified,omitempty"`
+	// Who made the change
+	Who string `json:"who,omitempty"`
+	// Action is create, update or restore
+	Action string `json:"action,omitempty"`
+}
+
+// whoAmI returns the name of the user running the process
+func whoAmI() string {
+	if userinfo, err := user.Current(); err == nil {
+		if userinfo.Name != "" {
+			return userinfo.Name
+		}
+		return userinfo.Username
+	}
+	return ""
+}
+
+// historyPath returns the directory holding the revisions of an object.
+// NOTE: the directory is named for the key since the object's pairtree
+// directory can also hold the pairs of longer keys.
+func (c *Collection) historyPath(keyName string, pairPath string) string {
+	_, fName := keyAndFName(keyName)
+	return path.Join(c.workPath, historyDir, strings.TrimPrefix(pairPath, "pairtree"), strings.TrimSuffix(fName, ".json")+".history")
+}
+
+// readHistory returns the revision list for an object
+func (c *Collection) readHistory(keyName string, pairPath string) ([]*Revision, error) {
+	revisions := []*Revision{}
+	fName := path.Join(c.historyPath(keyName, pairPath), "history.json")
+	if c.Store.IsFile(fName) == false {
+		return revisions, nil
+	}
+	src, err := c.Store.ReadFile(fName)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(src, &revisions); err != nil {
+		return nil, fmt.Errorf("Can't read history %s, %s", fName, err)
+	}
+	return revisions, nil
+}
+
+// saveRevision records src as the next revision of an object. If
+// the object predates its history, prior is saved as revision 1 first.
+func (c *Collection) saveRevision(keyName, pairPath, action string, src []byte, prior []byte, priorModified string) error {
+	revisions, err := c.readHistory(keyName, pairPath)
+	if err != nil {
+		return err
+	}
+	p := c.historyPath(keyName, pairPath)
+	if err := c.Store.MkdirAll(p, 0775); err != nil {
+		return err
+	}
+	if len(revisions) == 0 && prior != nil {
+		if err := c.Store.WriteFile(path.Join(p, "1.json"), prior, 0664); err != nil {
+			return err
+		}
+		revisions = append(revisions, &Revision{
+			Revision: 1,
+			Modified: priorModified,
+		})
+	}
+	rev := &Revision{
+		Revision: len(revisions) + 1,
+		Modified: time.Now().Format(time.RFC3339),
+		Who:      whoAmI(),
+		Action:   action,
+	}
+	if err := c.Store.WriteFile(path.Join(p, fmt.Sprintf("%d.json", rev.Revision)), src, 0664); err != nil {
+		return err
+	}
+	revisions = append(revisions, rev)
+	hSrc, err := json.MarshalIndent(revisions, "", "    ")
+	if err != nil {
+		return err
+	}
+	return c.Store.WriteFile(path.Join(p, "history.json"), hSrc, 0664)
+}
+
+// truncateHistory drops the revisions of an object after the first n
+func (c *Collection) truncateHistory(keyName string, pairPath string, n int) error {
+	revisions, err := c.readHistory(keyName, pairPath)
+	if err != nil || len(revisions) <= n {
+		return err
+	}
+	if n == 0 {
+		return c.removeHistory(keyName, pairPath)
+	}
+	p := c.historyPath(keyName, pairPath)
+	for _, rev := range revisions[n:] {
+		fName := path.Join(p, fmt.Sprintf("%d.json", rev.Revision))
+		if c.Store.IsFile(fName) {
+			if err := c.Store.Remove(fName); err != nil {
+				return err
+			}
+		}
+	}
+	hSrc, err := json.MarshalIndent(revisions[:n], "", "    ")
+	if err != nil {
+		return err
+	}
+	return c.Store.WriteFile(path.Join(p, "history.json"), hSrc, 0664)
+}
+
+// removeHistory removes the revisions of an object
+func (c *Collection) removeHistory(keyName string, pairPath string) error {
+	p := c.historyPath(keyName, pairPath)
+	if c.Store.IsDir(p) == false {
+		return nil
+	}
+	return c.Store.RemoveAll(p)
+}
+
+// History returns the list of revisions kept for an object. The
+// last revision is the current version of the object. An object
+// written before KeepRevisions was set has no history.
+func (c *Collection) History(key string) ([]*Revision, error) {
+	keyName, _ := keyAndFName(normalizeKeyName(key))
+	pairPath, err := c.keyPath(keyName)
+	if err != nil {
+		return nil, err
+	}
+	return c.readHistory(keyName, pairPath)
+}
+
+// ReadRevision returns the JSON source of an object's revision
+func (c *Collection) ReadRevision(key string, rev int) ([]byte, error) {
+	keyName, _ := keyAndFName(normalizeKeyName(key))
+	pairPath, err := c.keyPath(keyName)
+	if err != nil {
+		return nil, err
+	}
+	fName := path.Join(c.historyPath(keyName, pairPath), fmt.Sprintf("%d.json", rev))
+	if c.Store.IsFile(fName) == false {
+		return nil, fmt.Errorf("%w, %q has no revision %d", ErrRevisionNotFound, keyName, rev)
+	}
+	return c.Store.ReadFile(fName)
+}
+
+// Restore makes a revision the current version of an object. The
+// restored object keeps its current attachments. Restoring is itself
+// recorded as a new revision.
+func (c *Collection) Restore(key string, rev int) error {
+	if c.KeepRevisions == false {
+		return fmt.Errorf("%s does not keep revisions", c.Name)
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	src, err := c.ReadRevision(key, rev)
+	if err != nil {
+		return err
+	}
+	obj := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(src))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return err
+	}
+	// NOTE: UpdateJSON carries over the current _Attachments
+	delete(obj, "_Attachments")
+	src, err = json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.updateJSON(key, src, "restore")
+}
@@ -0,0 +1,133 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	cName := path.Join("testdata", "history_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	// An object written before revisions are turned on
+	if err := c.Create("one", map[string]interface{}{"title": "first"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Restore("one", 1); err == nil {
+		t.Errorf("expected an error restoring without KeepRevisions")
+	}
+	c.KeepRevisions = true
+	if revs, err := c.History("one"); err != nil || len(revs) != 0 {
+		t.Errorf("expected no history, got %+v, %v", revs, err)
+	}
+	if err := c.Update("one", map[string]interface{}{"title": "second"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Update("one", map[string]interface{}{"title": "third"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	revs, err := c.History("one")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(revs) != 3 {
+		t.Errorf("expected 3 revisions, got %d", len(revs))
+		t.FailNow()
+	}
+	for i, rev := range revs {
+		if rev.Revision != i+1 || rev.Modified == "" {
+			t.Errorf("unexpected revision %d, %+v", i, rev)
+		}
+	}
+	if revs[2].Action != "update" {
+		t.Errorf("expected update action, got %q", revs[2].Action)
+	}
+
+	obj := map[string]interface{}{}
+	if src, err := c.ReadRevision("one", 1); err != nil {
+		t.Errorf("%s", err)
+	} else if err := json.Unmarshal(src, &obj); err != nil || obj["title"] != "first" {
+		t.Errorf("expected first title in revision 1, got %s", src)
+	}
+	if _, err := c.ReadRevision("one", 10); err == nil {
+		t.Errorf("expected an error reading a missing revision")
+	}
+
+	// Restore keeps the current attachments
+	if err := c.AttachStream("one", "v0.0.1", "hello.txt", strings.NewReader("Hello World")); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Restore("one", 1); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	obj = map[string]interface{}{}
+	if err := c.Read("one", obj, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if obj["title"] != "first" {
+		t.Errorf("expected restored title, got %+v", obj)
+	}
+	if _, ok := obj["_Attachments"]; ok == false {
+		t.Errorf("expected attachments kept after restore, got %+v", obj)
+	}
+	revs, _ = c.History("one")
+	if len(revs) < 5 || revs[len(revs)-1].Action != "restore" {
+		t.Errorf("expected restore to be recorded, got %+v", revs)
+	}
+
+	// New objects start with a create revision, emptying the trash drops the history
+	if err := c.Create("two", map[string]interface{}{"title": "new"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if revs, _ := c.History("two"); len(revs) != 1 || revs[0].Action != "create" {
+		t.Errorf("expected a create revision, got %+v", revs)
+	}
+	pairPath, _, _ := c.keyIndex.get("two")
+	if err := c.Delete("two"); err != nil {
+		t.Errorf("%s", err)
+	}
+	if _, err := os.Stat(c.historyPath("two", pairPath)); err != nil {
+		t.Errorf("expected history kept while in the trash, %s", err)
+	}
+	if _, err := c.EmptyTrash(0); err != nil {
+		t.Errorf("%s", err)
+	}
+	if _, err := os.Stat(c.historyPath("two", pairPath)); os.IsNotExist(err) == false {
+		t.Errorf("expected history removed with the trash")
+	}
+}
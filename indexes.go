@@ -0,0 +1,912 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: indexes.go holds secondary indexes on dotpaths. Each index
+// is stored as line delimited JSON in the collection's _indexes
+// directory, a line holds a key and the value found at the dotpath.
+// Like the key index, writes append a line and the file is compacted
+// once enough of it is stale. Create, Update and Delete keep the
+// indexes current. KeyFilter and KeySortByExpression use an index
+// when an expression refers to an indexed dotpath rather than
+// reading each object. An index that misses an update is marked out
+// of date and isn't used until it is rebuilt.
+//
+
+const (
+	// indexDir holds the dotpath indexes of a collection
+	indexDir = "_indexes"
+
+	// indexOutdated is the suffix of the file marking an index out
+	// of date
+	indexOutdated = ".outdated"
+)
+
+// indexLine is a single line in a dotpath index file
+type indexLine struct {
+	Key     string      `json:"key"`
+	Value   interface{} `json:"value"`
+	Deleted bool        `json:"deleted,omitempty"`
+}
+
+// indexEntry is a value and key in an index's sorted entries, an
+// array value has an entry for each of its elements.
+type indexEntry struct {
+	value interface{}
+	key   string
+}
+
+// dotpathIndex maps keys to the value found at a dotpath
+type dotpathIndex struct {
+	store   *storage.Store
+	fName   string
+	dotPath string
+
+	// values is populated on first use
+	values map[string]interface{}
+	loaded bool
+
+	// stamp identifies the index file when it was last read or written
+	stamp fileStamp
+
+	// stale is the count of superseded lines in the index file
+	stale int
+
+	// entries is sorted by value, it is nil until needed
+	entries []indexEntry
+
+	mutex *sync.Mutex
+}
+
+// newDotpathIndex returns a dotpathIndex stored in fName
+func newDotpathIndex(store *storage.Store, fName string, dotPath string) *dotpathIndex {
+	idx := new(dotpathIndex)
+	idx.store = store
+	idx.fName = fName
+	idx.dotPath = dotPath
+	idx.values = map[string]interface{}{}
+	idx.mutex = new(sync.Mutex)
+	return idx
+}
+
+// load reads the index file if it hasn't been read yet.
+func (idx *dotpathIndex) load() error {
+	if idx.loaded {
+		return nil
+	}
+	idx.values = map[string]interface{}{}
+	idx.entries = nil
+	idx.stale = 0
+	idx.stamp = fileStamp{}
+	if idx.store.IsFile(idx.fName) == false {
+		idx.loaded = true
+		return nil
+	}
+	stamp := stampFile(idx.store, idx.fName)
+	src, err := idx.store.ReadFile(idx.fName)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entry := indexLine{}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("%s line %d, %s", idx.fName, lineNo, err)
+		}
+		if _, found := idx.values[entry.Key]; found {
+			idx.stale++
+		}
+		if entry.Deleted {
+			delete(idx.values, entry.Key)
+			idx.stale++
+		} else {
+			idx.values[entry.Key] = entry.Value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	idx.stamp = stamp
+	idx.loaded = true
+	return nil
+}
+
+// refresh forgets the values read if another process has changed
+// the index file since, see keyIndex.refresh
+func (idx *dotpathIndex) refresh() {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if idx.loaded && stampFile(idx.store, idx.fName) != idx.stamp {
+		idx.loaded = false
+	}
+}
+
+// get returns the indexed value for a key
+func (idx *dotpathIndex) get(key string) (interface{}, bool) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if err := idx.load(); err != nil {
+		return nil, false
+	}
+	value, ok := idx.values[key]
+	return value, ok
+}
+
+// set records the value for a key
+func (idx *dotpathIndex) set(key string, value interface{}) error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if err := idx.load(); err != nil {
+		return err
+	}
+	if _, found := idx.values[key]; found {
+		idx.stale++
+	}
+	idx.values[key] = value
+	idx.entries = nil
+	return idx.appendLine(indexLine{Key: key, Value: value})
+}
+
+// remove records the removal of a key
+func (idx *dotpathIndex) remove(key string) error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if err := idx.load(); err != nil {
+		return err
+	}
+	if _, found := idx.values[key]; found == false {
+		return nil
+	}
+	delete(idx.values, key)
+	idx.entries = nil
+	// Both the original line and the tombstone are now stale
+	idx.stale += 2
+	return idx.appendLine(indexLine{Key: key, Deleted: true})
+}
+
+// replace swaps in a new set of values and writes the index in full
+func (idx *dotpathIndex) replace(values map[string]interface{}) error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.values = values
+	idx.entries = nil
+	idx.loaded = true
+	if err := idx.compact(); err != nil {
+		return err
+	}
+	if idx.outdated() {
+		return idx.store.Remove(idx.fName + indexOutdated)
+	}
+	return nil
+}
+
+// outdated returns true if the index missed an update
+func (idx *dotpathIndex) outdated() bool {
+	return idx.store.IsFile(idx.fName + indexOutdated)
+}
+
+// markOutdated records that the index missed an update
+func (idx *dotpathIndex) markOutdated() error {
+	return idx.store.WriteFile(idx.fName+indexOutdated, []byte(time.Now().Format(time.RFC3339)+"\n"), 0664)
+}
+
+// appendLine adds a line to the index file. It compacts instead when
+// the store can't append or when enough of the file is stale.
+func (idx *dotpathIndex) appendLine(line indexLine) error {
+	if idx.store.Type != storage.FS ||
+		(idx.stale > minCompactSize && idx.stale > len(idx.values)) {
+		return idx.compact()
+	}
+	src, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(idx.fName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if _, err := fp.Write(append(src, '\n')); err != nil {
+		return err
+	}
+	idx.stamp = stampFile(idx.store, idx.fName)
+	return nil
+}
+
+// compact rewrites the index file with only the current values.
+func (idx *dotpathIndex) compact() error {
+	keys := make([]string, 0, len(idx.values))
+	for k := range idx.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		src, err := json.Marshal(indexLine{Key: k, Value: idx.values[k]})
+		if err != nil {
+			return err
+		}
+		buf.Write(src)
+		buf.WriteByte('\n')
+	}
+	if idx.store.Type == storage.FS {
+		// Write to a temp file and rename so a crash can't truncate the index
+		tmpName := idx.fName + ".tmp"
+		if err := idx.store.WriteFile(tmpName, buf.Bytes(), 0664); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpName, idx.fName); err != nil {
+			return err
+		}
+	} else if err := idx.store.WriteFile(idx.fName, buf.Bytes(), 0664); err != nil {
+		return err
+	}
+	idx.stale = 0
+	idx.stamp = stampFile(idx.store, idx.fName)
+	return nil
+}
+
+// sortedEntries returns the index's entries ordered by value then key
+func (idx *dotpathIndex) sortedEntries() []indexEntry {
+	if idx.entries != nil {
+		return idx.entries
+	}
+	entries := []indexEntry{}
+	for key, value := range idx.values {
+		for _, v := range indexValues(value) {
+			entries = append(entries, indexEntry{value: v, key: key})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if cmp := compareIndexValues(entries[i].value, entries[j].value); cmp != 0 {
+			return cmp < 0
+		}
+		return entries[i].key < entries[j].key
+	})
+	idx.entries = entries
+	return entries
+}
+
+// lookup returns the keys with a value matching op and value. op is
+// one of "eq", "lt", "le", "gt", "ge" or "prefix". Keys are returned
+// in the order of their values.
+func (idx *dotpathIndex) lookup(op string, value interface{}) ([]string, error) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+	if idx.outdated() {
+		return nil, fmt.Errorf("%w, %s", ErrIndexOutOfDate, idx.dotPath)
+	}
+	entries := idx.sortedEntries()
+	n := len(entries)
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, form := range queryForms(value) {
+		rank := indexRank(form)
+		first := sort.Search(n, func(i int) bool { return indexRank(entries[i].value) >= rank })
+		last := sort.Search(n, func(i int) bool { return indexRank(entries[i].value) > rank })
+		lo := sort.Search(n, func(i int) bool { return compareIndexValues(entries[i].value, form) >= 0 })
+		hi := sort.Search(n, func(i int) bool { return compareIndexValues(entries[i].value, form) > 0 })
+		start, end := 0, 0
+		switch op {
+		case "eq":
+			start, end = lo, hi
+		case "lt":
+			start, end = first, lo
+		case "le":
+			start, end = first, hi
+		case "gt":
+			start, end = hi, last
+		case "ge":
+			start, end = lo, last
+		case "prefix":
+			prefix, ok := form.(string)
+			if ok == false {
+				continue
+			}
+			start, end = lo, lo
+			for end < last && strings.HasPrefix(entries[end].value.(string), prefix) {
+				end++
+			}
+		default:
+			return nil, fmt.Errorf("unsupported index operation %q", op)
+		}
+		for _, entry := range entries[start:end] {
+			if seen[entry.key] == false {
+				seen[entry.key] = true
+				keys = append(keys, entry.key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// normalizeIndexValue converts a value to a float64, string or bool
+// so values can be ordered.
+func normalizeIndexValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+		return v.String(), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		return v, true
+	case bool:
+		return v, true
+	}
+	return nil, false
+}
+
+// indexValues returns the normalized values to index, the elements
+// of an array are indexed individually and objects aren't indexed.
+// Like a query (see queryAny) only one level of array is looked into,
+// the elements of nested arrays aren't indexed.
+func indexValues(value interface{}) []interface{} {
+	if a, ok := value.([]interface{}); ok {
+		values := []interface{}{}
+		for _, elem := range a {
+			if v, ok := normalizeIndexValue(elem); ok {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	if v, ok := normalizeIndexValue(value); ok {
+		return []interface{}{v}
+	}
+	return nil
+}
+
+// queryForms returns the normalized forms of a value to look up. A
+// string holding a number also matches numeric values.
+func queryForms(value interface{}) []interface{} {
+	v, ok := normalizeIndexValue(value)
+	if ok == false {
+		return nil
+	}
+	forms := []interface{}{v}
+	if s, ok := v.(string); ok {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
+
+// indexRank orders values of different types, booleans sort before
+// numbers which sort before strings.
+func indexRank(value interface{}) int {
+	switch value.(type) {
+	case bool:
+		return 0
+	case float64:
+		return 1
+	}
+	return 2
+}
+
+// compareIndexValues returns -1, 0 or 1 comparing two normalized values
+func compareIndexValues(a interface{}, b interface{}) int {
+	ra, rb := indexRank(a), indexRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch v := a.(type) {
+	case bool:
+		w := b.(bool)
+		if v == w {
+			return 0
+		}
+		if w {
+			return -1
+		}
+		return 1
+	case float64:
+		w := b.(float64)
+		if v < w {
+			return -1
+		}
+		if v > w {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+//
+// Public interface for indexes
+//
+
+// Indexes returns the sorted list of indexed dotpaths
+func (c *Collection) Indexes() []string {
+	dotPaths := []string{}
+	for dotPath := range c.IndexMap {
+		dotPaths = append(dotPaths, dotPath)
+	}
+	sort.Strings(dotPaths)
+	return dotPaths
+}
+
+// getIndex returns the index for a dotpath
+func (c *Collection) getIndex(dotPath string) (*dotpathIndex, error) {
+	savedPath, ok := c.IndexMap[dotPath]
+	if ok == false {
+		return nil, fmt.Errorf("%w, %s", ErrIndexNotFound, dotPath)
+	}
+	if c.indexes == nil {
+		c.indexes = map[string]*dotpathIndex{}
+	}
+	idx, ok := c.indexes[dotPath]
+	if ok == false {
+		idx = newDotpathIndex(c.Store, path.Join(c.workPath, savedPath), dotPath)
+		c.indexes[dotPath] = idx
+	}
+	return idx, nil
+}
+
+// IndexCreate declares a secondary index on a dotpath and builds it
+// from the objects in the collection.
+func (c *Collection) IndexCreate(dotPath string) error {
+	dotPath = strings.TrimSpace(dotPath)
+	if isPathExpression(dotPath) == false {
+		return fmt.Errorf("%q is not a dotpath", dotPath)
+	}
+	if err := checkPath(dotPath); err != nil {
+		return err
+	}
+	if _, ok := c.IndexMap[dotPath]; ok == true {
+		return fmt.Errorf("%w, %s", ErrIndexExists, dotPath)
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	// Check to see if we have an _indexes directory to store our indexes in
+	if _, err := c.Store.Stat(path.Join(c.workPath, indexDir)); err != nil {
+		if err := c.Store.MkdirAll(path.Join(c.workPath, indexDir), 0775); err != nil {
+			return err
+		}
+	}
+	if c.IndexMap == nil {
+		c.IndexMap = make(map[string]string)
+	}
+	c.IndexMap[dotPath] = path.Join(indexDir, url.QueryEscape(dotPath)+".jsonl")
+	if err := c.IndexRebuild(dotPath); err != nil {
+		delete(c.IndexMap, dotPath)
+		delete(c.indexes, dotPath)
+		return err
+	}
+	return c.saveMetadata()
+}
+
+// IndexDrop removes the secondary index on a dotpath
+func (c *Collection) IndexDrop(dotPath string) error {
+	savedPath, ok := c.IndexMap[dotPath]
+	if ok == false {
+		return fmt.Errorf("%w, %s", ErrIndexNotFound, dotPath)
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	delete(c.IndexMap, dotPath)
+	delete(c.indexes, dotPath)
+	fName := path.Join(c.workPath, savedPath)
+	for _, p := range []string{fName, fName + indexOutdated} {
+		if c.Store.IsFile(p) {
+			if err := c.Store.Remove(p); err != nil {
+				return err
+			}
+		}
+	}
+	return c.saveMetadata()
+}
+
+// IndexRebuild regenerates the index on a dotpath from the objects
+// in the collection.
+func (c *Collection) IndexRebuild(dotPath string) error {
+	idx, err := c.getIndex(dotPath)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	err = c.parallelObjects(context.Background(), c.Keys(), func(key string, obj map[string]interface{}) (interface{}, error) {
+		return evalPath(dotPath, obj)
+	}, func(i int, key string, value interface{}, err error) error {
+		if err == nil {
+			values[key] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return idx.replace(values)
+}
+
+// IndexCompare returns the keys whose value at an indexed dotpath
+// compares to value. op is one of "eq", "lt", "le", "gt" or "ge".
+// Numbers are compared numerically, a string holding a number also
+// matches numbers. When the indexed value is an array a key matches
+// if any of its elements do. Keys are ordered by their values.
+func (c *Collection) IndexCompare(dotPath string, op string, value interface{}) ([]string, error) {
+	switch op {
+	case "eq", "lt", "le", "gt", "ge":
+	default:
+		return nil, fmt.Errorf("unsupported index operation %q", op)
+	}
+	idx, err := c.getIndex(dotPath)
+	if err != nil {
+		return nil, err
+	}
+	return idx.lookup(op, value)
+}
+
+// IndexRange returns the keys whose value at an indexed dotpath is
+// between low and high inclusive.
+func (c *Collection) IndexRange(dotPath string, low interface{}, high interface{}) ([]string, error) {
+	keys, err := c.IndexCompare(dotPath, "ge", low)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := c.IndexCompare(dotPath, "le", high)
+	if err != nil {
+		return nil, err
+	}
+	return intersectKeys(keys, upper), nil
+}
+
+// IndexPrefix returns the keys whose string value at an indexed
+// dotpath starts with prefix.
+func (c *Collection) IndexPrefix(dotPath string, prefix string) ([]string, error) {
+	idx, err := c.getIndex(dotPath)
+	if err != nil {
+		return nil, err
+	}
+	return idx.lookup("prefix", prefix)
+}
+
+// intersectKeys returns the keys in a also found in b, in a's order
+func intersectKeys(a []string, b []string) []string {
+	inB := map[string]bool{}
+	for _, key := range b {
+		inB[key] = true
+	}
+	keys := []string{}
+	for _, key := range a {
+		if inB[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// indexObject updates the indexes and live frames from an object's
+// JSON source. It is called once the object is saved so a failure
+// doesn't fail the write, an index that can't be updated is marked
+// out of date instead.
+func (c *Collection) indexObject(key string, src []byte) {
+	if len(c.IndexMap) == 0 && len(c.LiveFrames) == 0 {
+		return
+	}
+	obj := map[string]interface{}{}
+	if err := DecodeJSON(src, &obj); err != nil {
+		for _, dotPath := range c.Indexes() {
+			c.indexOutOfDate(dotPath, err)
+		}
+		c.liveObjectChanged(key, nil)
+		return
+	}
+	for _, dotPath := range c.Indexes() {
+		c.updateIndex(dotPath, key, obj)
+	}
+	c.liveObjectChanged(key, obj)
+}
+
+// unindexObject removes a key from the indexes and live frames
+func (c *Collection) unindexObject(key string) {
+	for _, dotPath := range c.Indexes() {
+		c.updateIndex(dotPath, key, nil)
+	}
+	c.liveObjectChanged(key, nil)
+}
+
+// updateIndex sets or removes a key's value in a dotpath index, obj
+// is nil when the object was deleted
+func (c *Collection) updateIndex(dotPath string, key string, obj map[string]interface{}) {
+	idx, err := c.getIndex(dotPath)
+	if err != nil {
+		c.indexOutOfDate(dotPath, err)
+		return
+	}
+	err = ErrKeyNotFound
+	var value interface{}
+	if obj != nil {
+		value, err = evalPath(dotPath, obj)
+	}
+	if err == nil {
+		err = idx.set(key, value)
+	} else {
+		err = idx.remove(key)
+	}
+	if err != nil {
+		c.indexOutOfDate(dotPath, err)
+	}
+}
+
+// indexOutOfDate marks an index that missed an update so queries stop
+// using it until it is rebuilt
+func (c *Collection) indexOutOfDate(dotPath string, err error) {
+	log.Printf("WARNING %s, index %s is out of date, %s", c.Name, dotPath, err)
+	idx, e := c.getIndex(dotPath)
+	if e == nil {
+		e = idx.markOutdated()
+	}
+	if e != nil {
+		log.Printf("WARNING %s, can't mark index %s out of date, %s", c.Name, dotPath, e)
+	}
+}
+
+//
+// Filter expressions answered from indexes
+//
+
+// filterWord is an unquoted word in a filter expression
+type filterWord string
+
+// tokenizeFilter splits a filter expression into parentheses, quoted
+// strings and words.
+func tokenizeFilter(expr string) ([]interface{}, error) {
+	tokens := []interface{}{}
+	for i := 0; i < len(expr); {
+		switch ch := expr[i]; {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, filterWord(expr[i:i+1]))
+			i++
+		case ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(expr) && expr[j] != ch {
+				if ch == '"' && expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string in %q", expr)
+			}
+			s, err := strconv.Unquote(expr[i : j+1])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, s)
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && strings.IndexByte(" \t\n\r()", expr[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, filterWord(expr[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// parseFilter turns a filter expression into nested lists of words
+// and strings. The outer parentheses are optional.
+func parseFilter(expr string) ([]interface{}, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	var parseList func(pos int) ([]interface{}, int, error)
+	parseList = func(pos int) ([]interface{}, int, error) {
+		list := []interface{}{}
+		for pos < len(tokens) {
+			switch tokens[pos] {
+			case filterWord("("):
+				l, next, err := parseList(pos + 1)
+				if err != nil {
+					return nil, 0, err
+				}
+				list = append(list, l)
+				pos = next
+			case filterWord(")"):
+				return list, pos + 1, nil
+			case filterWord("|"):
+				return nil, 0, fmt.Errorf("pipelines are not supported")
+			default:
+				list = append(list, tokens[pos])
+				pos++
+			}
+		}
+		return list, pos, nil
+	}
+	list, pos, err := parseList(0)
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(tokens) {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", expr)
+	}
+	if len(list) == 1 {
+		if l, ok := list[0].([]interface{}); ok {
+			return l, nil
+		}
+	}
+	return list, nil
+}
+
+// filterLiteral returns the value of a literal in a filter expression
+func filterLiteral(term interface{}) (interface{}, bool) {
+	switch v := term.(type) {
+	case string:
+		return v, true
+	case filterWord:
+		switch v {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		if _, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return json.Number(v), true
+		}
+	}
+	return nil, false
+}
+
+// isFilterDotpath returns true if term is a dotpath
+func isFilterDotpath(term interface{}) bool {
+	w, ok := term.(filterWord)
+	return ok && len(w) > 1 && strings.HasPrefix(string(w), ".")
+}
+
+// indexTerm answers a comparison of an indexed dotpath with a literal,
+// ok is false if the term can't be answered from an index.
+func (c *Collection) indexTerm(term interface{}) ([]string, bool) {
+	l, ok := term.([]interface{})
+	if ok == false || len(l) != 3 {
+		return nil, false
+	}
+	op, _ := l[0].(filterWord)
+	a, b := l[1], l[2]
+	var (
+		dotPath string
+		value   interface{}
+	)
+	switch op {
+	case "eq", "lt", "le", "gt", "ge":
+		if isFilterDotpath(a) {
+			dotPath = string(a.(filterWord))
+			value, ok = filterLiteral(b)
+		} else if isFilterDotpath(b) {
+			// Swap the operands, (lt 1 .x) is (gt .x 1)
+			dotPath = string(b.(filterWord))
+			value, ok = filterLiteral(a)
+			op = map[filterWord]filterWord{"eq": "eq", "lt": "gt", "le": "ge", "gt": "lt", "ge": "le"}[op]
+		} else {
+			return nil, false
+		}
+	case "hasPrefix":
+		if isFilterDotpath(a) == false {
+			return nil, false
+		}
+		dotPath = string(a.(filterWord))
+		value, ok = b.(string)
+		op = "prefix"
+	default:
+		return nil, false
+	}
+	if ok == false {
+		return nil, false
+	}
+	idx, err := c.getIndex(dotPath)
+	if err != nil {
+		return nil, false
+	}
+	keys, err := idx.lookup(string(op), value)
+	if err != nil {
+		return nil, false
+	}
+	return keys, true
+}
+
+// indexFilter answers the comparisons of indexed dotpaths with
+// literals in a filter expression, either the whole expression or the
+// terms of a top level "and". It returns nil if no index applies.
+//
+// NOTE: the keys returned are only candidates. Indexes match the
+// values of arrays and numbers written as strings where a template
+// comparison doesn't, the filter still needs to be applied.
+func (c *Collection) indexFilter(filterExpr string) map[string]bool {
+	if len(c.IndexMap) == 0 {
+		return nil
+	}
+	expr, err := parseFilter(filterExpr)
+	if err != nil {
+		return nil
+	}
+	terms := []interface{}{expr}
+	if len(expr) > 1 && expr[0] == filterWord("and") {
+		terms = expr[1:]
+	}
+	var matched map[string]bool
+	for _, term := range terms {
+		keys, ok := c.indexTerm(term)
+		if ok == false {
+			continue
+		}
+		found := map[string]bool{}
+		for _, key := range keys {
+			if matched == nil || matched[key] {
+				found[key] = true
+			}
+		}
+		matched = found
+	}
+	return matched
+}
@@ -0,0 +1,237 @@
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package dataset
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIndexes(t *testing.T) {
+	cName := path.Join("testdata", "indexes_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+
+	records := map[string]map[string]interface{}{
+		"a": {"title": "Alpha", "year": 2001, "orcids": []interface{}{"0001", "0002"}},
+		"b": {"title": "Beta", "year": 1999, "orcids": []interface{}{"0002"}},
+		"c": {"title": "Gamma", "year": 2010},
+		"d": {"title": "Alphabet", "year": 2005, "orcids": []interface{}{"0003"}},
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Create(key, records[key]); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	for _, dotPath := range []string{".year", ".title", ".orcids"} {
+		if err := c.IndexCreate(dotPath); err != nil {
+			t.Errorf("IndexCreate(%q), %s", dotPath, err)
+			t.FailNow()
+		}
+	}
+	if err := c.IndexCreate(".year"); errors.Is(err, ErrIndexExists) == false {
+		t.Errorf("expected ErrIndexExists, got %v", err)
+	}
+	if _, err := c.IndexCompare(".missing", "eq", 1); errors.Is(err, ErrIndexNotFound) == false {
+		t.Errorf("expected ErrIndexNotFound, got %v", err)
+	}
+	// Objects created after the index are indexed
+	if err := c.Create("d", records["d"]); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+
+	expectKeys := func(label string, expected string, keys []string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s, %s", label, err)
+			return
+		}
+		if s := strings.Join(keys, ","); s != expected {
+			t.Errorf("%s, expected %q, got %q", label, expected, s)
+		}
+	}
+	keys, err := c.IndexCompare(".year", "eq", 2001)
+	expectKeys("eq 2001", "a", keys, err)
+	keys, err = c.IndexCompare(".year", "eq", "2001")
+	expectKeys("eq \"2001\"", "a", keys, err)
+	keys, err = c.IndexCompare(".year", "lt", 2005)
+	expectKeys("lt 2005", "b,a", keys, err)
+	keys, err = c.IndexCompare(".year", "ge", 2005)
+	expectKeys("ge 2005", "d,c", keys, err)
+	keys, err = c.IndexRange(".year", 2000, 2006)
+	expectKeys("range 2000 2006", "a,d", keys, err)
+	keys, err = c.IndexPrefix(".title", "Alpha")
+	expectKeys("prefix Alpha", "a,d", keys, err)
+	keys, err = c.IndexCompare(".orcids", "eq", "0002")
+	expectKeys("eq 0002", "a,b", keys, err)
+
+	// Updates and deletes keep the index current
+	records["b"]["year"] = 2020
+	if err := c.Update("b", records["b"]); err != nil {
+		t.Errorf("%s", err)
+	}
+	keys, err = c.IndexCompare(".year", "gt", 2010)
+	expectKeys("gt 2010 after update", "b", keys, err)
+	if err := c.Delete("a"); err != nil {
+		t.Errorf("%s", err)
+	}
+	keys, err = c.IndexCompare(".orcids", "eq", "0002")
+	expectKeys("eq 0002 after delete", "b", keys, err)
+	if err := c.Undelete("a"); err != nil {
+		t.Errorf("%s", err)
+	}
+	keys, err = c.IndexCompare(".orcids", "eq", "0002")
+	expectKeys("eq 0002 after undelete", "a,b", keys, err)
+
+	// Template filters on indexed dotpaths narrow the objects read
+	TemplateFilters = true
+	defer func() { TemplateFilters = false }()
+	all := []string{"a", "b", "c", "d"}
+	for expr, expected := range map[string]string{
+		`(eq .title "Gamma")`:                          "c",
+		`eq .title "Gamma"`:                            "c",
+		`(and (ge .title "Alpha") (lt .title "Beta"))`: "a,d",
+		`(and (gt "Beta" .title) (ge .title "Alpha"))`: "a,d",
+	} {
+		if matched := c.indexFilter(expr); matched == nil {
+			t.Errorf("expected %s to be looked up in indexes", expr)
+		}
+		keys, err = c.KeyFilter(all, expr)
+		expectKeys(expr, expected, keys, err)
+	}
+	matched := c.indexFilter(`(and (hasPrefix .title "Alpha") (eq .orcids "0003"))`)
+	if len(matched) != 1 || matched["d"] == false {
+		t.Errorf("expected only d to match, got %v", matched)
+	}
+	// The index matches array values, the template comparison doesn't
+	expr := `(eq .orcids "0002")`
+	if matched := c.indexFilter(expr); len(matched) != 2 {
+		t.Errorf("expected a and b as candidates for %s, got %v", expr, matched)
+	}
+	keys, err = c.KeyFilter(all, expr)
+	expectKeys(expr, "", keys, err)
+	// A term without an index narrows the keys from the indexed terms
+	expr = `(and (ge .title "Beta") (ne .title "Gamma"))`
+	if matched := c.indexFilter(expr); matched == nil {
+		t.Errorf("expected %s to be partly looked up in indexes", expr)
+	}
+	keys, err = c.KeyFilter(all, expr)
+	expectKeys(expr, "b", keys, err)
+
+	// Sorting uses the index
+	keys, err = c.KeySortByExpression(all, "-.year")
+	expectKeys("sort -.year", "b,c,d,a", keys, err)
+
+	// Indexes persist when the collection is reopened
+	c.Close()
+	c, err = openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	if s := strings.Join(c.Indexes(), ","); s != ".orcids,.title,.year" {
+		t.Errorf("expected indexes to persist, got %q", s)
+	}
+	keys, err = c.IndexCompare(".year", "le", 2005)
+	expectKeys("le 2005 after reopen", "a,d", keys, err)
+
+	// Rebuild picks up changes made outside the index
+	idx, _ := c.getIndex(".year")
+	if err := idx.replace(map[string]interface{}{}); err != nil {
+		t.Errorf("%s", err)
+	}
+	if err := c.IndexRebuild(".year"); err != nil {
+		t.Errorf("%s", err)
+	}
+	keys, err = c.IndexCompare(".year", "ge", 0)
+	expectKeys("ge 0 after rebuild", "a,d,c,b", keys, err)
+
+	if err := c.IndexDrop(".year"); err != nil {
+		t.Errorf("%s", err)
+	}
+	if _, err := c.IndexCompare(".year", "eq", 2001); errors.Is(err, ErrIndexNotFound) == false {
+		t.Errorf("expected ErrIndexNotFound after drop, got %v", err)
+	}
+	// Without the index filters read the objects
+	keys, err = c.KeyFilter(all, `(eq .title "Beta")`)
+	expectKeys("filter after drop", "b", keys, err)
+}
+
+func TestIndexOutOfDate(t *testing.T) {
+	cName := path.Join("testdata", "index_outdated_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	c.KeepRevisions = true
+	if err := c.Create("a", map[string]interface{}{"year": 2001}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.IndexCreate(".year"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	// Make appending to the index fail
+	idx, _ := c.getIndex(".year")
+	os.Remove(idx.fName)
+	os.MkdirAll(idx.fName, 0775)
+
+	// The object is saved so the create succeeds
+	if err := c.Create("b", map[string]interface{}{"year": 2005}); err != nil {
+		t.Errorf("expected create to succeed, %s", err)
+	}
+	if revisions, err := c.History("b"); err != nil || len(revisions) != 1 {
+		t.Errorf("expected a revision for b, got %d, %v", len(revisions), err)
+	}
+	if _, err := c.IndexCompare(".year", "ge", 2000); errors.Is(err, ErrIndexOutOfDate) == false {
+		t.Errorf("expected ErrIndexOutOfDate, got %v", err)
+	}
+	// Queries read the objects until the index is rebuilt
+	q, err := ParseQuery(`.year >= 2000`)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	keys, err := c.KeyQuery(c.Keys(), q)
+	sort.Strings(keys)
+	if err != nil || strings.Join(keys, ",") != "a,b" {
+		t.Errorf("expected a,b, got %v, %v", keys, err)
+	}
+	os.Remove(idx.fName)
+	if err := c.IndexRebuild(".year"); err != nil {
+		t.Errorf("%s", err)
+	}
+	keys, err = c.IndexCompare(".year", "ge", 2000)
+	if err != nil || strings.Join(keys, ",") != "a,b" {
+		t.Errorf("expected a,b after rebuild, got %v, %v", keys, err)
+	}
+}
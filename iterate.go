@@ -0,0 +1,144 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"context"
+)
+
+//
+// NOTE: iterate.go streams objects from a collection one at a time so
+// code working over many objects (frames, grids, filters and exports)
+// only holds the current object in memory. Iterate is the push style
+// API, a Cursor is the pull style one.
+//
+
+// IterFunc is called by Iterate for each object. Returning
+// ErrStopIteration ends the iteration without an error, any other
+// error ends it and is returned by Iterate.
+type IterFunc func(key string, obj map[string]interface{}) error
+
+// Cursor steps through the objects of a list of keys. Objects are
+// read when the cursor reaches them.
+//
+//     cur := c.NewCursor(ctx, keys)
+//     defer cur.Close()
+//     for cur.Next() {
+//         obj, err := cur.Object()
+//         ...
+//     }
+//     if err := cur.Err(); err != nil {
+//         ...
+//     }
+type Cursor struct {
+	c    *Collection
+	ctx  context.Context
+	keys []string
+	pos  int
+	key  string
+	obj  map[string]interface{}
+	err  error
+	done error
+}
+
+// NewCursor returns a cursor over the objects for keys, use c.Keys()
+// for every object in the collection. The cursor stops early if ctx
+// is cancelled.
+func (c *Collection) NewCursor(ctx context.Context, keys []string) *Cursor {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Cursor{c: c, ctx: ctx, keys: keys, pos: -1}
+}
+
+// Next advances the cursor, it returns false when there are no more
+// objects or the context is done.
+func (cur *Cursor) Next() bool {
+	cur.key, cur.obj, cur.err = "", nil, nil
+	if cur.done != nil {
+		return false
+	}
+	if err := cur.ctx.Err(); err != nil {
+		cur.done = err
+		return false
+	}
+	cur.pos++
+	if cur.pos >= len(cur.keys) {
+		return false
+	}
+	cur.key = cur.keys[cur.pos]
+	return true
+}
+
+// Key returns the key at the cursor
+func (cur *Cursor) Key() string {
+	return cur.key
+}
+
+// Position returns the index of the cursor's key in the key list
+func (cur *Cursor) Position() int {
+	return cur.pos
+}
+
+// Object reads and returns the object at the cursor. An error
+// reading one object doesn't end the iteration.
+func (cur *Cursor) Object() (map[string]interface{}, error) {
+	if cur.obj == nil && cur.err == nil {
+		src, err := cur.c.ReadJSON(cur.key)
+		if err == nil {
+			obj := map[string]interface{}{}
+			if err = DecodeJSON(src, &obj); err == nil {
+				cur.obj = obj
+			}
+		}
+		cur.err = err
+	}
+	return cur.obj, cur.err
+}
+
+// Err returns the context's error if it ended the iteration
+func (cur *Cursor) Err() error {
+	return cur.done
+}
+
+// Close releases the cursor
+func (cur *Cursor) Close() {
+	cur.keys, cur.key, cur.obj, cur.err = nil, "", nil, nil
+}
+
+// Iterate calls fn for each object of keys in order. It stops at the first
+// error reading an object, the first error returned by fn or when
+// ctx is done.
+func (c *Collection) Iterate(ctx context.Context, keys []string, fn IterFunc) error {
+	cur := c.NewCursor(ctx, keys)
+	defer cur.Close()
+	for cur.Next() {
+		obj, err := cur.Object()
+		if err != nil {
+			return err
+		}
+		if err := fn(cur.Key(), obj); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return cur.Err()
+}
@@ -0,0 +1,150 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestIterate(t *testing.T) {
+	cName := path.Join("testdata", "iterate_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	keys := []string{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if err := c.Create(key, map[string]interface{}{"i": i}); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+		keys = append(keys, key)
+	}
+
+	// Objects are visited in key order
+	seen := []string{}
+	err = c.Iterate(context.Background(), keys, func(key string, obj map[string]interface{}) error {
+		if obj["_Key"] != key {
+			t.Errorf("expected object for %q, got %+v", key, obj)
+		}
+		seen = append(seen, key)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	if fmt.Sprintf("%v", seen) != fmt.Sprintf("%v", keys) {
+		t.Errorf("expected %v, got %v", keys, seen)
+	}
+
+	// ErrStopIteration ends early without an error
+	cnt := 0
+	err = c.Iterate(context.Background(), keys, func(key string, obj map[string]interface{}) error {
+		cnt++
+		if cnt == 3 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil || cnt != 3 {
+		t.Errorf("expected to stop after 3 objects, %d, %v", cnt, err)
+	}
+
+	// Other errors are returned
+	expected := fmt.Errorf("boom")
+	if err := c.Iterate(context.Background(), keys, func(key string, obj map[string]interface{}) error {
+		return expected
+	}); err != expected {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+
+	// A missing key ends Iterate with ErrKeyNotFound
+	err = c.Iterate(context.Background(), []string{"k1", "nope", "k2"}, func(key string, obj map[string]interface{}) error {
+		return nil
+	})
+	if errors.Is(err, ErrKeyNotFound) == false {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	// Cancelling the context stops the iteration
+	ctx, cancel := context.WithCancel(context.Background())
+	cnt = 0
+	err = c.Iterate(ctx, keys, func(key string, obj map[string]interface{}) error {
+		cnt++
+		if cnt == 5 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled || cnt != 5 {
+		t.Errorf("expected cancel after 5 objects, %d, %v", cnt, err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	cName := path.Join("testdata", "cursor_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	for _, key := range []string{"a", "b"} {
+		if err := c.Create(key, map[string]interface{}{"name": key}); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+
+	// A read error is reported for its key only
+	cur := c.NewCursor(context.Background(), []string{"a", "missing", "b"})
+	defer cur.Close()
+	found, missing := []string{}, []string{}
+	for cur.Next() {
+		obj, err := cur.Object()
+		if err != nil {
+			missing = append(missing, cur.Key())
+			continue
+		}
+		if obj["name"] != cur.Key() {
+			t.Errorf("unexpected object at %d, %+v", cur.Position(), obj)
+		}
+		found = append(found, cur.Key())
+	}
+	if cur.Err() != nil {
+		t.Errorf("%s", cur.Err())
+	}
+	if len(found) != 2 || len(missing) != 1 || missing[0] != "missing" {
+		t.Errorf("unexpected cursor results, found %v, missing %v", found, missing)
+	}
+	if cur.Next() {
+		t.Errorf("expected an exhausted cursor to stay exhausted")
+	}
+}
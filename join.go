@@ -0,0 +1,303 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//
+// NOTE: join.go implements a recursive merge of JSON objects. Nested
+// objects are merged attribute by attribute, other values in common
+// are resolved by the conflict strategy and arrays in common by the
+// array strategy.
+//
+
+const (
+	// JoinKeep keeps the existing value when values conflict
+	JoinKeep = "keep"
+	// JoinOverwrite replaces the existing value when values conflict
+	JoinOverwrite = "overwrite"
+	// JoinError fails the join when values conflict
+	JoinError = "error"
+
+	// JoinReplace treats arrays in common like any other conflicting value
+	JoinReplace = "replace"
+	// JoinAppend appends the new array's items to the existing array
+	JoinAppend = "append"
+	// JoinUnion appends only the new items not already in the
+	// existing array, items are matched by UnionKey if set
+	JoinUnion = "union"
+)
+
+// JoinOptions describes how Join merges an object into an existing one
+type JoinOptions struct {
+	// Conflict is the strategy for values in common, JoinKeep (default),
+	// JoinOverwrite or JoinError
+	Conflict string `json:"conflict,omitempty"`
+	// Arrays is the strategy for arrays in common, JoinReplace (default),
+	// JoinAppend or JoinUnion
+	Arrays string `json:"arrays,omitempty"`
+	// UnionKey is a dotpath into array items used to match them
+	// when Arrays is JoinUnion. Matched objects are merged. If empty
+	// items are matched by value.
+	UnionKey string `json:"union_key,omitempty"`
+}
+
+// JoinConflictError is returned when the JoinError strategy
+// encounters a value in common that differs.
+type JoinConflictError struct {
+	// Key of the object being joined
+	Key string
+	// Path is the dotpath of the conflicting value
+	Path string
+}
+
+// Error implements the error interface
+func (e *JoinConflictError) Error() string {
+	return fmt.Sprintf("join conflict for %q at %s", e.Key, e.Path)
+}
+
+// Unwrap returns ErrJoinConflict
+func (e *JoinConflictError) Unwrap() error {
+	return ErrJoinConflict
+}
+
+// joinOptions maps the legacy overwrite flag to JoinOptions
+func joinOptions(overwrite bool) *JoinOptions {
+	if overwrite {
+		return &JoinOptions{Conflict: JoinOverwrite}
+	}
+	return &JoinOptions{Conflict: JoinKeep}
+}
+
+// validate checks the strategy names, empty values take the defaults
+func (opts *JoinOptions) validate() error {
+	switch opts.Conflict {
+	case "", JoinKeep, JoinOverwrite, JoinError:
+	default:
+		return fmt.Errorf("unknown conflict strategy %q", opts.Conflict)
+	}
+	switch opts.Arrays {
+	case "", JoinReplace, JoinAppend, JoinUnion:
+	default:
+		return fmt.Errorf("unknown array strategy %q", opts.Arrays)
+	}
+	if opts.UnionKey != "" && opts.Arrays != JoinUnion {
+		return fmt.Errorf("union key requires the %q array strategy", JoinUnion)
+	}
+	return nil
+}
+
+// MergeObjects recursively merges src into dest using opts. The
+// path of a conflict reported by JoinError is relative to dest.
+func MergeObjects(dest map[string]interface{}, src map[string]interface{}, opts *JoinOptions) error {
+	if opts == nil {
+		opts = &JoinOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	return mergeObject("", dest, src, opts)
+}
+
+// mergeObject merges src into dest, p is the dotpath of dest
+func mergeObject(p string, dest map[string]interface{}, src map[string]interface{}, opts *JoinOptions) error {
+	for k, v := range src {
+		current, ok := dest[k]
+		if ok == false {
+			dest[k] = v
+			continue
+		}
+		merged, err := mergeValue(p+"."+k, current, v, opts)
+		if err != nil {
+			return err
+		}
+		dest[k] = merged
+	}
+	return nil
+}
+
+// mergeValue merges two values found at the same dotpath
+func mergeValue(p string, current interface{}, v interface{}, opts *JoinOptions) (interface{}, error) {
+	switch cur := current.(type) {
+	case map[string]interface{}:
+		if m, ok := v.(map[string]interface{}); ok {
+			if err := mergeObject(p, cur, m, opts); err != nil {
+				return nil, err
+			}
+			return cur, nil
+		}
+	case []interface{}:
+		if a, ok := v.([]interface{}); ok {
+			switch opts.Arrays {
+			case JoinAppend:
+				return append(cur, a...), nil
+			case JoinUnion:
+				return unionArrays(p, cur, a, opts)
+			}
+		}
+	}
+	if jsonEqual(current, v) {
+		return current, nil
+	}
+	switch opts.Conflict {
+	case JoinOverwrite:
+		return v, nil
+	case JoinError:
+		return nil, &JoinConflictError{Path: p}
+	}
+	return current, nil
+}
+
+// unionArrays appends the items of a not already in cur. When
+// opts.UnionKey is set items with the same key value are merged.
+func unionArrays(p string, cur []interface{}, a []interface{}, opts *JoinOptions) ([]interface{}, error) {
+	for _, item := range a {
+		i := findItem(cur, item, opts.UnionKey)
+		if i < 0 {
+			cur = append(cur, item)
+			continue
+		}
+		if opts.UnionKey == "" {
+			continue
+		}
+		merged, err := mergeValue(fmt.Sprintf("%s[%d]", p, i), cur[i], item, opts)
+		if err != nil {
+			return nil, err
+		}
+		cur[i] = merged
+	}
+	return cur, nil
+}
+
+// findItem returns the position of item in list or -1. If unionKey
+// is set items are compared by the value found at that dotpath.
+func findItem(list []interface{}, item interface{}, unionKey string) int {
+	if unionKey == "" {
+		for i, v := range list {
+			if jsonEqual(v, item) {
+				return i
+			}
+		}
+		return -1
+	}
+	target, err := evalPath(unionKey, item)
+	if err != nil || target == nil {
+		return -1
+	}
+	for i, v := range list {
+		if val, err := evalPath(unionKey, v); err == nil && jsonEqual(val, target) {
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonEqual compares two JSON values. Numbers are compared by value
+// (see aggregateNumber) so json.Number("1.0") and float64(1) are equal,
+// objects and arrays are compared element by element.
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := aggregateNumber(a); ok {
+		y, ok := aggregateNumber(b)
+		return ok && x.Cmp(y) == 0
+	}
+	switch v := a.(type) {
+	case map[string]interface{}:
+		w, ok := b.(map[string]interface{})
+		if ok == false || len(v) != len(w) {
+			return false
+		}
+		for k, val := range v {
+			if other, found := w[k]; found == false || jsonEqual(val, other) == false {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		w, ok := b.([]interface{})
+		if ok == false || len(v) != len(w) {
+			return false
+		}
+		for i := range v {
+			if jsonEqual(v[i], w[i]) == false {
+				return false
+			}
+		}
+		return true
+	}
+	src1, err1 := json.Marshal(a)
+	src2, err2 := json.Marshal(b)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return string(src1) == string(src2)
+}
+
+// JoinWithOptions takes a key, a map[string]interface{}{} and
+// *JoinOptions and recursively merges the map with an existing JSON
+// object in the collection. If the object doesn't exist it is created.
+// The "_Key" and "_Attachments" attributes of obj are ignored.
+func (c *Collection) JoinWithOptions(key string, obj map[string]interface{}, opts *JoinOptions) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.join(key, obj, opts)
+}
+
+// join merges obj with an object, see JoinWithOptions. The caller
+// holds the collection's lock.
+func (c *Collection) join(key string, obj map[string]interface{}, opts *JoinOptions) error {
+	if opts == nil {
+		opts = &JoinOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if c.KeyExists(key) == false {
+		src, err := EncodeJSON(obj)
+		if err != nil {
+			return fmt.Errorf("%s, %s", key, err)
+		}
+		return c.createJSON(key, src)
+	}
+	record := map[string]interface{}{}
+	if err := c.Read(key, record, false); err != nil {
+		return err
+	}
+	src := map[string]interface{}{}
+	for k, v := range obj {
+		if k != "_Key" && k != "_Attachments" {
+			src[k] = v
+		}
+	}
+	if err := mergeObject("", record, src, opts); err != nil {
+		if e, ok := err.(*JoinConflictError); ok {
+			e.Key = key
+		}
+		return err
+	}
+	joined, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Update can't marshal into JSON %s, %s", key, err)
+	}
+	return c.updateJSON(key, joined, "update")
+}
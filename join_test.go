@@ -0,0 +1,172 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMergeObjects(t *testing.T) {
+	decode := func(s string) map[string]interface{} {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+		return m
+	}
+	testData := []struct {
+		dest     string
+		src      string
+		opts     *JoinOptions
+		expected string
+		fail     bool
+	}{
+		{`{"a":1,"b":{"c":1}}`, `{"a":2,"b":{"c":2,"d":2}}`, &JoinOptions{Conflict: JoinKeep}, `{"a":1,"b":{"c":1,"d":2}}`, false},
+		{`{"a":1,"b":{"c":1}}`, `{"a":2,"b":{"c":2,"d":2}}`, &JoinOptions{Conflict: JoinOverwrite}, `{"a":2,"b":{"c":2,"d":2}}`, false},
+		{`{"a":1,"b":{"c":1}}`, `{"b":{"c":2}}`, &JoinOptions{Conflict: JoinError}, ``, true},
+		{`{"a":1,"b":{"c":1}}`, `{"a":1,"b":{"d":2}}`, &JoinOptions{Conflict: JoinError}, `{"a":1,"b":{"c":1,"d":2}}`, false},
+		{`{"l":[1,2]}`, `{"l":[2,3]}`, &JoinOptions{}, `{"l":[1,2]}`, false},
+		{`{"l":[1,2]}`, `{"l":[2,3]}`, &JoinOptions{Conflict: JoinOverwrite}, `{"l":[2,3]}`, false},
+		{`{"l":[1,2]}`, `{"l":[2,3]}`, &JoinOptions{Arrays: JoinAppend}, `{"l":[1,2,2,3]}`, false},
+		{`{"l":[1,2]}`, `{"l":[2,3]}`, &JoinOptions{Arrays: JoinUnion}, `{"l":[1,2,3]}`, false},
+		{
+			`{"l":[{"id":"a","x":1},{"id":"b"}]}`,
+			`{"l":[{"id":"a","y":2},{"id":"c"}]}`,
+			&JoinOptions{Arrays: JoinUnion, UnionKey: ".id"},
+			`{"l":[{"id":"a","x":1,"y":2},{"id":"b"},{"id":"c"}]}`,
+			false,
+		},
+		{`{"a":1}`, `{"a":2}`, &JoinOptions{Conflict: "bogus"}, ``, true},
+		{`{"a":1}`, `{"a":2}`, &JoinOptions{UnionKey: ".id"}, ``, true},
+	}
+	for i, test := range testData {
+		dest := decode(test.dest)
+		err := MergeObjects(dest, decode(test.src), test.opts)
+		if test.fail {
+			if err == nil {
+				t.Errorf("(%d) expected an error, got %+v", i, dest)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("(%d) %s", i, err)
+			continue
+		}
+		if jsonEqual(dest, decode(test.expected)) == false {
+			src, _ := json.Marshal(dest)
+			t.Errorf("(%d) expected %s, got %s", i, test.expected, src)
+		}
+	}
+	// Numbers are compared by value whatever they were decoded as
+	dest := map[string]interface{}{"a": json.Number("1.0"), "l": []interface{}{json.Number("2")}}
+	src := map[string]interface{}{"a": float64(1), "l": []interface{}{2}}
+	if err := MergeObjects(dest, src, &JoinOptions{Conflict: JoinError}); err != nil {
+		t.Errorf("expected equal numbers not to conflict, %s", err)
+	}
+}
+
+func TestJoinWithOptions(t *testing.T) {
+	cName := path.Join("testdata", "join_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	if err := c.Create("jane", map[string]interface{}{
+		"name":    map[string]interface{}{"family": "Doe", "given": "Jane"},
+		"email":   "jd@example.org",
+		"tags":    []interface{}{"one"},
+		"_Key":    "jane",
+		"version": 1,
+	}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+
+	// Nested attributes are merged rather than replaced
+	if err := c.Join("jane", map[string]interface{}{
+		"name":  map[string]interface{}{"family": "Dough", "orcid": "0000-0001"},
+		"email": "jane@example.edu",
+		"_Key":  "someone-else",
+	}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	obj := map[string]interface{}{}
+	if err := c.Read("jane", obj, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	name := obj["name"].(map[string]interface{})
+	if name["family"] != "Doe" || name["given"] != "Jane" || name["orcid"] != "0000-0001" {
+		t.Errorf("unexpected name after join, %+v", name)
+	}
+	if obj["email"] != "jd@example.org" || obj["_Key"] != "jane" {
+		t.Errorf("unexpected object after join, %+v", obj)
+	}
+
+	if err := c.Join("jane", map[string]interface{}{
+		"name": map[string]interface{}{"family": "Dough"},
+	}, true); err != nil {
+		t.Errorf("%s", err)
+	}
+	obj = map[string]interface{}{}
+	c.Read("jane", obj, false)
+	name = obj["name"].(map[string]interface{})
+	if name["family"] != "Dough" || name["given"] != "Jane" {
+		t.Errorf("unexpected name after overwrite join, %+v", name)
+	}
+
+	// A number read back from storage is equal to the same number
+	err = c.JoinWithOptions("jane", map[string]interface{}{"version": 1}, &JoinOptions{Conflict: JoinError})
+	if err != nil {
+		t.Errorf("expected equal values to join without conflict, %s", err)
+	}
+	err = c.JoinWithOptions("jane", map[string]interface{}{"version": 2}, &JoinOptions{Conflict: JoinError})
+	if e, ok := err.(*JoinConflictError); ok == false {
+		t.Errorf("expected *JoinConflictError, got %T %v", err, err)
+	} else if e.Key != "jane" || e.Path != ".version" {
+		t.Errorf("unexpected conflict %+v", e)
+	}
+
+	err = c.JoinWithOptions("jane", map[string]interface{}{"tags": []interface{}{"one", "two"}}, &JoinOptions{Arrays: JoinUnion})
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	obj = map[string]interface{}{}
+	c.Read("jane", obj, false)
+	if tags := obj["tags"].([]interface{}); len(tags) != 2 {
+		t.Errorf("expected two tags, got %+v", tags)
+	}
+
+	// Join creates missing objects
+	if err := c.JoinWithOptions("john", map[string]interface{}{"name": "John"}, nil); err != nil {
+		t.Errorf("%s", err)
+	}
+	if c.KeyExists("john") == false {
+		t.Errorf("expected join to create john")
+	}
+}
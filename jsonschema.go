@@ -0,0 +1,632 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//
+// NOTE: jsonschema.go is a small JSON Schema validator covering the
+// commonly used keywords of drafts 4 through 2019-09: type, enum, const,
+// properties, required, additionalProperties, patternProperties,
+// min/maxProperties, items, min/maxItems, uniqueItems, min/maxLength,
+// pattern, format, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, allOf, anyOf, oneOf, not and local $ref.
+//
+
+// FieldError describes a single schema violation
+type FieldError struct {
+	// Path is the dotpath to the failing value, "." for the object itself
+	Path string `json:"path"`
+	// Message describes the problem
+	Message string `json:"message"`
+}
+
+// String returns a human readable version of the FieldError
+func (e *FieldError) String() string {
+	return fmt.Sprintf("%s %s", e.Path, e.Message)
+}
+
+// ValidationError is returned when an object fails its collection's schema
+type ValidationError struct {
+	// Key of the object
+	Key string `json:"key"`
+	// Errors lists each failing field
+	Errors []*FieldError `json:"errors"`
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	msgs := []string{}
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.String())
+	}
+	return fmt.Sprintf("%s failed schema validation, %s", e.Key, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns ErrValidation
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// jsonSchema is a parsed JSON Schema document
+type jsonSchema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// decodeJSON decodes JSON source keeping numbers as json.Number
+func decodeJSON(src []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(src))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// parseSchema reads a JSON Schema document and checks that its
+// patterns and references can be used.
+func parseSchema(src []byte) (*jsonSchema, error) {
+	var root interface{}
+	if err := decodeJSON(src, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema, %s", err)
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, fmt.Errorf("invalid JSON Schema, expected an object")
+	}
+	s := &jsonSchema{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := s.check(root); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema, %s", err)
+	}
+	return s, nil
+}
+
+// check walks the schema compiling patterns and resolving $ref
+func (s *jsonSchema) check(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			switch k {
+			case "pattern":
+				if p, ok := v.(string); ok {
+					if _, err := s.regexp(p); err != nil {
+						return err
+					}
+				}
+			case "patternProperties":
+				if m, ok := v.(map[string]interface{}); ok {
+					for p := range m {
+						if _, err := s.regexp(p); err != nil {
+							return err
+						}
+					}
+				}
+			case "$ref":
+				if ref, ok := v.(string); ok {
+					if _, err := s.resolve(ref); err != nil {
+						return err
+					}
+				}
+			case "enum", "const", "default", "examples":
+				// values, not schemas
+				continue
+			}
+			if err := s.check(v); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, v := range n {
+			if err := s.check(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// regexp returns a compiled pattern
+func (s *jsonSchema) regexp(p string) (*regexp.Regexp, error) {
+	if re, ok := s.patterns[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern %q, %s", p, err)
+	}
+	s.patterns[p] = re
+	return re, nil
+}
+
+// resolve finds a local $ref (e.g. "#/definitions/name")
+func (s *jsonSchema) resolve(ref string) (interface{}, error) {
+	if strings.HasPrefix(ref, "#") == false {
+		return nil, fmt.Errorf("only local $ref supported, %q", ref)
+	}
+	node := s.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return node, nil
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		part, _ = url.PathUnescape(part)
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[part]
+			if ok == false {
+				return nil, fmt.Errorf("can't resolve $ref %q", ref)
+			}
+			node = v
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("can't resolve $ref %q", ref)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("can't resolve $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// Validate checks a value against the schema returning the violations found
+func (s *jsonSchema) Validate(value interface{}) []*FieldError {
+	errs := []*FieldError{}
+	s.validate(s.root, value, ".", &errs)
+	return errs
+}
+
+// childPath appends a property name to a dotpath
+func childPath(p string, name string) string {
+	if p == "." {
+		return "." + name
+	}
+	return p + "." + name
+}
+
+// indexPath appends an array index to a dotpath
+func indexPath(p string, i int) string {
+	if p == "." {
+		return fmt.Sprintf(".[%d]", i)
+	}
+	return fmt.Sprintf("%s[%d]", p, i)
+}
+
+// jsonType returns the JSON Schema type name of a decoded value
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := val.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case int, int64:
+		return "integer"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// typeMatches checks a value's type against a schema type name
+func typeMatches(v interface{}, t string) bool {
+	vt := jsonType(v)
+	return vt == t || (t == "number" && vt == "integer")
+}
+
+// toFloat converts a numeric value to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	}
+	return 0, false
+}
+
+// normalizeValue converts numbers to float64 so values can be compared
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number, int, int64:
+		f, _ := toFloat(val)
+		return f
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, item := range val {
+			l[i] = normalizeValue(item)
+		}
+		return l
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = normalizeValue(item)
+		}
+		return m
+	}
+	return v
+}
+
+// equalValues compares two JSON values
+func equalValues(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(normalizeValue(a), normalizeValue(b))
+}
+
+// formatValue renders a value for an error message
+func formatValue(v interface{}) string {
+	src, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(src)
+}
+
+// validFormat checks the common string formats
+func validFormat(format string, s string) bool {
+	switch format {
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", s)
+		if err != nil {
+			_, err = time.Parse("15:04:05", s)
+		}
+		return err == nil
+	case "email":
+		_, err := mail.ParseAddress(s)
+		return err == nil && strings.Contains(s, "@")
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	}
+	// Unknown formats are annotations only
+	return true
+}
+
+func (s *jsonSchema) validate(node interface{}, v interface{}, p string, errs *[]*FieldError) {
+	addError := func(format string, values ...interface{}) {
+		*errs = append(*errs, &FieldError{Path: p, Message: fmt.Sprintf(format, values...)})
+	}
+	var schema map[string]interface{}
+	switch n := node.(type) {
+	case bool:
+		if n == false {
+			addError("is not allowed")
+		}
+		return
+	case map[string]interface{}:
+		schema = n
+	default:
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			s.validate(target, v, p, errs)
+		} else {
+			addError("%s", err)
+		}
+	}
+
+	// type
+	switch t := schema["type"].(type) {
+	case string:
+		if typeMatches(v, t) == false {
+			addError("expected %s, got %s", t, jsonType(v))
+			return
+		}
+	case []interface{}:
+		names := []string{}
+		matched := false
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+				if typeMatches(v, name) {
+					matched = true
+				}
+			}
+		}
+		if matched == false {
+			addError("expected %s, got %s", strings.Join(names, " or "), jsonType(v))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if equalValues(v, item) {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			addError("must be one of %s", formatValue(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok {
+		if equalValues(v, c) == false {
+			addError("must be %s", formatValue(c))
+		}
+	}
+
+	// Combinators
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub, v, p, errs)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(s.validateQuiet(sub, v, p)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if matched == false {
+			addError("does not match any of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		cnt := 0
+		for _, sub := range oneOf {
+			if len(s.validateQuiet(sub, v, p)) == 0 {
+				cnt++
+			}
+		}
+		if cnt != 1 {
+			addError("must match exactly one schema, matched %d", cnt)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		if len(s.validateQuiet(not, v, p)) == 0 {
+			addError("must not match schema")
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		s.validateString(schema, val, addError)
+	case json.Number, float64, int, int64:
+		f, _ := toFloat(val)
+		validateNumber(schema, f, addError)
+	case []interface{}:
+		s.validateArray(schema, val, p, errs, addError)
+	case map[string]interface{}:
+		s.validateObject(schema, val, p, errs, addError)
+	}
+}
+
+// validateQuiet returns the errors for a sub-schema without recording them
+func (s *jsonSchema) validateQuiet(node interface{}, v interface{}, p string) []*FieldError {
+	errs := []*FieldError{}
+	s.validate(node, v, p, &errs)
+	return errs
+}
+
+// schemaNumber returns a numeric keyword's value
+func schemaNumber(schema map[string]interface{}, name string) (float64, bool) {
+	if v, ok := schema[name]; ok {
+		return toFloat(v)
+	}
+	return 0, false
+}
+
+func (s *jsonSchema) validateString(schema map[string]interface{}, val string, addError func(string, ...interface{})) {
+	l := float64(utf8.RuneCountInString(val))
+	if n, ok := schemaNumber(schema, "minLength"); ok && l < n {
+		addError("must be at least %g characters", n)
+	}
+	if n, ok := schemaNumber(schema, "maxLength"); ok && l > n {
+		addError("must be at most %g characters", n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := s.regexp(pattern); err == nil && re.MatchString(val) == false {
+			addError("must match pattern %q", pattern)
+		}
+	}
+	if format, ok := schema["format"].(string); ok && validFormat(format, val) == false {
+		addError("must be a valid %s", format)
+	}
+}
+
+func validateNumber(schema map[string]interface{}, f float64, addError func(string, ...interface{})) {
+	// NOTE: draft 4 uses booleans for exclusiveMinimum/Maximum, later drafts numbers
+	if n, ok := schemaNumber(schema, "minimum"); ok {
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && f <= n {
+			addError("must be greater than %g", n)
+		} else if f < n {
+			addError("must be at least %g", n)
+		}
+	}
+	if n, ok := schemaNumber(schema, "maximum"); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && f >= n {
+			addError("must be less than %g", n)
+		} else if f > n {
+			addError("must be at most %g", n)
+		}
+	}
+	if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && f <= n {
+		addError("must be greater than %g", n)
+	}
+	if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && f >= n {
+		addError("must be less than %g", n)
+	}
+	if n, ok := schemaNumber(schema, "multipleOf"); ok && n > 0 {
+		q := f / n
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			addError("must be a multiple of %g", n)
+		}
+	}
+}
+
+func (s *jsonSchema) validateArray(schema map[string]interface{}, val []interface{}, p string, errs *[]*FieldError, addError func(string, ...interface{})) {
+	l := float64(len(val))
+	if n, ok := schemaNumber(schema, "minItems"); ok && l < n {
+		addError("must have at least %g items", n)
+	}
+	if n, ok := schemaNumber(schema, "maxItems"); ok && l > n {
+		addError("must have at most %g items", n)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := 0; i < len(val); i++ {
+			for j := i + 1; j < len(val); j++ {
+				if equalValues(val[i], val[j]) {
+					addError("items %d and %d must be unique", i, j)
+				}
+			}
+		}
+	}
+	switch items := schema["items"].(type) {
+	case []interface{}:
+		// Tuple validation
+		for i, item := range val {
+			if i < len(items) {
+				s.validate(items[i], item, indexPath(p, i), errs)
+			} else if additional, ok := schema["additionalItems"]; ok {
+				s.validate(additional, item, indexPath(p, i), errs)
+			}
+		}
+	case map[string]interface{}, bool:
+		for i, item := range val {
+			s.validate(items, item, indexPath(p, i), errs)
+		}
+	}
+	if contains, ok := schema["contains"]; ok {
+		found := false
+		for i, item := range val {
+			if len(s.validateQuiet(contains, item, indexPath(p, i))) == 0 {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			addError("must contain a matching item")
+		}
+	}
+}
+
+func (s *jsonSchema) validateObject(schema map[string]interface{}, val map[string]interface{}, p string, errs *[]*FieldError, addError func(string, ...interface{})) {
+	l := float64(len(val))
+	if n, ok := schemaNumber(schema, "minProperties"); ok && l < n {
+		addError("must have at least %g properties", n)
+	}
+	if n, ok := schemaNumber(schema, "maxProperties"); ok && l > n {
+		addError("must have at most %g properties", n)
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, item := range required {
+			if name, ok := item.(string); ok {
+				if _, found := val[name]; found == false {
+					*errs = append(*errs, &FieldError{Path: childPath(p, name), Message: "is required"})
+				}
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	// Sort names so errors are reported in a stable order
+	names := []string{}
+	for name := range val {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		item := val[name]
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			s.validate(sub, item, childPath(p, name), errs)
+		}
+		for pattern, sub := range patternProperties {
+			if re, err := s.regexp(pattern); err == nil && re.MatchString(name) {
+				matched = true
+				s.validate(sub, item, childPath(p, name), errs)
+			}
+		}
+		if matched == false && hasAdditional {
+			if allowed, ok := additional.(bool); ok && allowed == false {
+				*errs = append(*errs, &FieldError{Path: childPath(p, name), Message: "is not an allowed property"})
+			} else {
+				s.validate(additional, item, childPath(p, name), errs)
+			}
+		}
+	}
+	if deps, ok := schema["dependencies"].(map[string]interface{}); ok {
+		for name, dep := range deps {
+			if _, found := val[name]; found == false {
+				continue
+			}
+			if list, ok := dep.([]interface{}); ok {
+				for _, item := range list {
+					if other, ok := item.(string); ok {
+						if _, found := val[other]; found == false {
+							*errs = append(*errs, &FieldError{Path: childPath(p, other), Message: fmt.Sprintf("is required when %s is present", name)})
+						}
+					}
+				}
+			} else {
+				s.validate(dep, val, p, errs)
+			}
+		}
+	}
+}
@@ -0,0 +1,341 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: keyindex.go holds the mapping of object keys to pairtree paths.
+// The index is stored as line delimited JSON in the collection's root.
+// Creates and deletes append a single line rather than rewriting
+// collection.json. Deletes are recorded as a tombstone. When the
+// superseded lines outnumber the live keys the file is compacted.
+// The index is read lazily, on the first key lookup, so opening a
+// collection doesn't require loading every key. Taking the collection's
+// lock reads it again if another process has changed it since.
+//
+
+const (
+	// keyIndexName is the file holding the key to pairtree path index
+	keyIndexName = "_keys.jsonl"
+
+	// minCompactSize is the number of superseded entries needed
+	// before we'll consider compacting the index
+	minCompactSize = 1000
+)
+
+// keyEntry is a single line in the key index
+type keyEntry struct {
+	Key     string `json:"key"`
+	Path    string `json:"path,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// keyIndex manages the key to pairtree path mapping for a collection
+type keyIndex struct {
+	store *storage.Store
+	fName string
+
+	// keys is populated on first use
+	keys   map[string]string
+	loaded bool
+
+	// stamp identifies the index file when it was last read or written
+	stamp fileStamp
+
+	// stale is the count of superseded lines in the index file
+	stale int
+
+	// migrate is true when keys came from a pre-index collection.json,
+	// the first write will create the index file from scratch.
+	migrate bool
+
+	mutex *sync.Mutex
+}
+
+// newKeyIndex returns a keyIndex for a collection's work path.
+func newKeyIndex(store *storage.Store, workPath string) *keyIndex {
+	ki := new(keyIndex)
+	ki.store = store
+	ki.fName = path.Join(workPath, keyIndexName)
+	ki.keys = map[string]string{}
+	ki.mutex = new(sync.Mutex)
+	return ki
+}
+
+// exists returns true if an index file is present
+func (ki *keyIndex) exists() bool {
+	return ki.store.IsFile(ki.fName)
+}
+
+// useLegacyKeyMap seeds the index from a keymap found in an older
+// collection.json. It is ignored if an index file already exists.
+func (ki *keyIndex) useLegacyKeyMap(keyMap map[string]string) {
+	if len(keyMap) == 0 || ki.exists() {
+		return
+	}
+	ki.keys = keyMap
+	ki.loaded = true
+	ki.migrate = true
+}
+
+// load reads the index file if it hasn't been read yet.
+func (ki *keyIndex) load() error {
+	if ki.loaded {
+		return nil
+	}
+	ki.keys = map[string]string{}
+	ki.stale = 0
+	ki.stamp = fileStamp{}
+	if ki.exists() == false {
+		ki.loaded = true
+		return nil
+	}
+	// NOTE: the stamp is taken first so a change made while reading
+	// is seen by the next refresh
+	stamp := stampFile(ki.store, ki.fName)
+	src, err := ki.store.ReadFile(ki.fName)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entry := keyEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("%s line %d, %s", ki.fName, lineNo, err)
+		}
+		if _, found := ki.keys[entry.Key]; found {
+			ki.stale++
+		}
+		if entry.Deleted {
+			delete(ki.keys, entry.Key)
+			ki.stale++
+		} else {
+			ki.keys[entry.Key] = entry.Path
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	ki.stamp = stamp
+	ki.loaded = true
+	return nil
+}
+
+// refresh forgets the keys read if another process has changed the
+// index file since, they are read again on next use. The caller
+// holds the collection's lock.
+func (ki *keyIndex) refresh() {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if ki.loaded && stampFile(ki.store, ki.fName) != ki.stamp {
+		ki.loaded, ki.migrate = false, false
+	}
+}
+
+// get returns the pairtree path for a key, an error is returned if
+// the index can't be read
+func (ki *keyIndex) get(key string) (string, bool, error) {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if err := ki.load(); err != nil {
+		return "", false, fmt.Errorf("Can't read key index, %s", err)
+	}
+	p, ok := ki.keys[key]
+	return p, ok, nil
+}
+
+// set records the pairtree path for a key, the caller holds the
+// collection's lock
+func (ki *keyIndex) set(key string, p string) error {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if err := ki.load(); err != nil {
+		return err
+	}
+	return ki.appendEntry(keyEntry{Key: key, Path: p})
+}
+
+// remove records the removal of a key, the caller holds the
+// collection's lock
+func (ki *keyIndex) remove(key string) error {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if err := ki.load(); err != nil {
+		return err
+	}
+	if _, found := ki.keys[key]; found == false {
+		return nil
+	}
+	return ki.appendEntry(keyEntry{Key: key, Deleted: true})
+}
+
+// apply updates the keys held in memory with an entry, counting the
+// lines it makes stale the same way load does
+func (ki *keyIndex) apply(entry keyEntry) {
+	if _, found := ki.keys[entry.Key]; found {
+		ki.stale++
+	}
+	if entry.Deleted {
+		// Both the original entry and the tombstone are now stale
+		delete(ki.keys, entry.Key)
+		ki.stale++
+	} else {
+		ki.keys[entry.Key] = entry.Path
+	}
+}
+
+// list returns the keys in the index
+func (ki *keyIndex) list() []string {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	keys := []string{}
+	if err := ki.load(); err != nil {
+		return keys
+	}
+	for k := range ki.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// length returns the number of keys in the index
+func (ki *keyIndex) length() int {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if err := ki.load(); err != nil {
+		return 0
+	}
+	return len(ki.keys)
+}
+
+// appendEntry adds a line to the index file, the caller holds the
+// collection's lock. It compacts instead when migrating, when the
+// store can't append or when enough of the file is stale.
+func (ki *keyIndex) appendEntry(entry keyEntry) error {
+	if ki.migrate || ki.store.Type != storage.FS ||
+		(ki.stale+1 > minCompactSize && ki.stale+1 > len(ki.keys)) {
+		// NOTE: another process may have written keys since the index
+		// was loaded, read it again so compacting doesn't drop them.
+		if ki.exists() {
+			ki.loaded, ki.migrate = false, false
+			if err := ki.load(); err != nil {
+				return err
+			}
+		}
+		ki.apply(entry)
+		return ki.compact()
+	}
+	ki.apply(entry)
+	src, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(ki.fName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if _, err := fp.Write(append(src, '\n')); err != nil {
+		return err
+	}
+	ki.stamp = stampFile(ki.store, ki.fName)
+	return nil
+}
+
+// compact rewrites the index file with only the live keys.
+func (ki *keyIndex) compact() error {
+	buf := new(bytes.Buffer)
+	for k, p := range ki.keys {
+		src, err := json.Marshal(keyEntry{Key: k, Path: p})
+		if err != nil {
+			return err
+		}
+		buf.Write(src)
+		buf.WriteByte('\n')
+	}
+	if ki.store.Type == storage.FS {
+		// Write to a temp file and rename so a crash can't truncate the index
+		tmpName := ki.fName + ".tmp"
+		if err := ki.store.WriteFile(tmpName, buf.Bytes(), 0664); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpName, ki.fName); err != nil {
+			return err
+		}
+	} else if err := ki.store.WriteFile(ki.fName, buf.Bytes(), 0664); err != nil {
+		return err
+	}
+	ki.stale = 0
+	ki.migrate = false
+	ki.stamp = stampFile(ki.store, ki.fName)
+	return nil
+}
+
+// save forces the index to be written in full, it is used by
+// repair and migration which rework the keys held in memory. The
+// caller holds the collection's lock.
+func (ki *keyIndex) save() error {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if err := ki.load(); err != nil {
+		return err
+	}
+	return ki.compact()
+}
+
+// all returns the index's map of keys to pairtree paths. It is used
+// by repair which needs to rework the mapping before calling save().
+func (ki *keyIndex) all() (map[string]string, error) {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	if err := ki.load(); err != nil {
+		return nil, fmt.Errorf("Can't read key index, %s", err)
+	}
+	return ki.keys, nil
+}
+
+// reset starts the index over without any keys, repair uses it to
+// rebuild an index that can't be read.
+func (ki *keyIndex) reset() map[string]string {
+	ki.mutex.Lock()
+	defer ki.mutex.Unlock()
+	ki.keys = map[string]string{}
+	ki.stale = 0
+	ki.loaded = true
+	return ki.keys
+}
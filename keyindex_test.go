@@ -0,0 +1,249 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	cName := path.Join("testdata", "keyindex_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for _, key := range []string{"one", "two", "three"} {
+		if err := c.Create(key, map[string]interface{}{"name": key}); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	if err := c.Delete("two"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c.Close()
+
+	// Keys must not be stored in collection.json
+	src, err := ioutil.ReadFile(path.Join(cName, "collection.json"))
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if strings.Contains(string(src), `"keymap"`) {
+		t.Errorf("expected no keymap in collection.json, %s", src)
+	}
+	// Creates and deletes are appended
+	src, err = ioutil.ReadFile(path.Join(cName, keyIndexName))
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if lines := strings.Count(string(src), "\n"); lines != 4 {
+		t.Errorf("expected 4 lines in %s, got %d", keyIndexName, lines)
+	}
+
+	c, err = openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if c.Length() != 2 || c.KeyExists("two") || c.KeyExists("one") == false {
+		t.Errorf("expected keys one and three, got %+v", c.Keys())
+	}
+	if c.keyIndex.stale != 2 {
+		t.Errorf("expected 2 stale entries, got %d", c.keyIndex.stale)
+	}
+	if err := c.keyIndex.save(); err != nil {
+		t.Errorf("%s", err)
+	}
+	src, _ = ioutil.ReadFile(path.Join(cName, keyIndexName))
+	if lines := strings.Count(string(src), "\n"); lines != 2 {
+		t.Errorf("expected 2 lines after compacting, got %d", lines)
+	}
+	c.Close()
+
+	// Simulate a collection created before the key index
+	os.Remove(path.Join(cName, keyIndexName))
+	src, _ = ioutil.ReadFile(path.Join(cName, "collection.json"))
+	meta := map[string]interface{}{}
+	json.Unmarshal(src, &meta)
+	meta["keymap"] = map[string]string{
+		"one":   "pairtree/on/e",
+		"three": "pairtree/th/re/e",
+	}
+	src, _ = json.Marshal(meta)
+	ioutil.WriteFile(path.Join(cName, "collection.json"), src, 0664)
+
+	if err := analyzer(cName, false); err == nil {
+		t.Errorf("expected analyzer to warn about legacy keymap")
+	}
+	c, err = openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if c.Length() != 2 {
+		t.Errorf("expected 2 keys from legacy keymap, got %d", c.Length())
+	}
+	c.Close()
+	if err := repair(cName, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if _, err := os.Stat(path.Join(cName, keyIndexName)); err != nil {
+		t.Errorf("expected repair to write %s, %s", keyIndexName, err)
+	}
+	src, _ = ioutil.ReadFile(path.Join(cName, "collection.json"))
+	if strings.Contains(string(src), `"keymap"`) {
+		t.Errorf("expected repair to remove keymap from collection.json")
+	}
+	if err := analyzer(cName, false); err != nil {
+		t.Errorf("expected clean analyzer after repair, %s", err)
+	}
+	c, err = openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	if c.Length() != 2 || c.KeyExists("three") == false {
+		t.Errorf("expected keys one and three, got %+v", c.Keys())
+	}
+}
+
+func TestKeyIndexCompactMerges(t *testing.T) {
+	cName := path.Join("testdata", "keyindex_compact.ds")
+	os.RemoveAll(cName)
+	c1, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c1.Close()
+	if err := c1.Create("one", map[string]interface{}{"n": 1}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	// A second process writes a key c1 hasn't seen
+	c2, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c2.Create("two", map[string]interface{}{"n": 2}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c2.Close()
+
+	// Force c1's next write to compact the index
+	c1.keyIndex.stale = 2 * minCompactSize
+	if err := c1.Create("three", map[string]interface{}{"n": 3}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c3, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c3.Close()
+	for _, key := range []string{"one", "two", "three"} {
+		if c3.KeyExists(key) == false {
+			t.Errorf("expected %q to survive compaction", key)
+		}
+	}
+
+	// A key index that can't be read isn't the same as a missing key
+	if err := ioutil.WriteFile(path.Join(cName, keyIndexName), []byte("not json\n"), 0664); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c4, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c4.Close()
+	if _, err := c4.ReadJSON("one"); err == nil || strings.Contains(err.Error(), "key index") == false {
+		t.Errorf("expected a key index error, got %v", err)
+	}
+}
+
+func TestKeyIndexSeesOtherWriters(t *testing.T) {
+	cName := path.Join("testdata", "keyindex_shared.ds")
+	os.RemoveAll(cName)
+	c1, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c1.Close()
+	if err := c1.IndexCreate(".who"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c2, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c2.Close()
+	// Both handles read their indexes before either writes
+	if c1.KeyExists("x") || c2.KeyExists("x") {
+		t.Errorf("expected no key x yet")
+	}
+	if _, err := c2.KeyFilter(c2.Keys(), `.who == "c1"`); err != nil {
+		t.Errorf("%s", err)
+	}
+
+	if err := c1.Create("x", map[string]interface{}{"who": "c1"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c2.Create("x", map[string]interface{}{"who": "c2"}); errors.Is(err, ErrKeyExists) == false {
+		t.Errorf("expected ErrKeyExists creating a key made by another handle, got %v", err)
+	}
+	obj := map[string]interface{}{}
+	if err := c1.Read("x", obj, false); err != nil || obj["who"] != "c1" {
+		t.Errorf("expected x to be kept from c1, got %+v, %v", obj, err)
+	}
+	// c2's write reads the dotpath index again so c1's entry is kept
+	if err := c2.Create("y", map[string]interface{}{"who": "c2"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	idx, err := c2.getIndex(".who")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if value, ok := idx.get("x"); ok == false || value != "c1" {
+		t.Errorf("expected .who of x to be c1 in c2's index, got %v", value)
+	}
+}
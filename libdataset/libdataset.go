@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -41,13 +42,73 @@ var (
 	// NOTE: error state is shared because C doesn't easily pass multiple
 	// return values without resorting to complex structures.
 	errorValue error
+	errorCode  = errNone
 )
 
+// Error codes returned by error_code(). The values are stable so
+// callers can test them rather than match error messages.
+const (
+	errNone               = 0
+	errUnknown            = 1
+	errKeyNotFound        = 2
+	errKeyExists          = 3
+	errFrameNotFound      = 4
+	errFrameExists        = 5
+	errNotAnObject        = 6
+	errCollectionNotFound = 7
+	errCollectionLocked   = 8
+	errRevisionNotFound   = 9
+	errRevisionConflict   = 10
+	errJoinConflict       = 11
+	errValidation         = 12
+	errIndexNotFound      = 13
+	errIndexExists        = 14
+	errQuerySyntax        = 15
+)
+
+// codeForError maps an error to its error code
+func codeForError(err error) int {
+	switch {
+	case err == nil:
+		return errNone
+	case errors.Is(err, dataset.ErrKeyNotFound):
+		return errKeyNotFound
+	case errors.Is(err, dataset.ErrKeyExists):
+		return errKeyExists
+	case errors.Is(err, dataset.ErrFrameNotFound):
+		return errFrameNotFound
+	case errors.Is(err, dataset.ErrFrameExists):
+		return errFrameExists
+	case errors.Is(err, dataset.ErrNotAnObject):
+		return errNotAnObject
+	case errors.Is(err, dataset.ErrCollectionNotFound):
+		return errCollectionNotFound
+	case errors.Is(err, dataset.ErrCollectionLocked):
+		return errCollectionLocked
+	case errors.Is(err, dataset.ErrRevisionNotFound):
+		return errRevisionNotFound
+	case errors.Is(err, dataset.ErrRevisionConflict):
+		return errRevisionConflict
+	case errors.Is(err, dataset.ErrJoinConflict):
+		return errJoinConflict
+	case errors.Is(err, dataset.ErrValidation):
+		return errValidation
+	case errors.Is(err, dataset.ErrIndexNotFound):
+		return errIndexNotFound
+	case errors.Is(err, dataset.ErrIndexExists):
+		return errIndexExists
+	case errors.Is(err, dataset.ErrQuerySyntax):
+		return errQuerySyntax
+	}
+	return errUnknown
+}
+
 // error_clear will set the global error state to nil.
 //
 //export error_clear
 func error_clear() {
 	errorValue = nil
+	errorCode = errNone
 }
 
 // error_dispatch logs error messages to console based on string template
@@ -55,11 +116,20 @@ func error_clear() {
 //
 func error_dispatch(err error, s string, values ...interface{}) {
 	errorValue = err
+	errorCode = codeForError(err)
 	if verbose == true {
 		log.Printf(s, values...)
 	}
 }
 
+// error_code returns the code of the last error recorded, 0 if
+// none. Unlike error_message() it doesn't clear the error state.
+//
+//export error_code
+func error_code() C.int {
+	return C.int(errorCode)
+}
+
 // error_message returns an error message previously recorded or
 // an empty string if no errors recorded
 //
@@ -86,6 +156,31 @@ func use_strict_dotpath(v C.int) C.int {
 	return C.int(0)
 }
 
+// set_workers sets the number of objects read and evaluated at
+// once when building frames and grids or filtering keys. Returns
+// the previous value.
+//
+//export set_workers
+func set_workers(n C.int) C.int {
+	prev := dataset.Workers
+	dataset.Workers = int(n)
+	return C.int(prev)
+}
+
+// use_template_filters sets whether filter expressions are read as
+// Go template expressions (the original syntax) rather than queries.
+// 1 is true, any other value is false. Returns the previous value.
+//
+//export use_template_filters
+func use_template_filters(v C.int) C.int {
+	prev := dataset.TemplateFilters
+	dataset.TemplateFilters = (int(v) == 1)
+	if prev {
+		return C.int(1)
+	}
+	return C.int(0)
+}
+
 // is_verbose returns the library options' verbose value.
 //
 //export is_verbose
@@ -263,6 +358,43 @@ func read_object(cName, cKey *C.char, cCleanObject C.int) *C.char {
 	return C.CString(txt)
 }
 
+// read_object_revision reads a record like read_object and returns
+// it with the revision token of the same read as
+// {"object": OBJECT, "revision": TOKEN}. Pass the token to
+// update_object_if_revision so the update fails if the record changed
+// since.
+//
+//export read_object_revision
+func read_object_revision(cName, cKey *C.char, cCleanObject C.int) *C.char {
+	collectionName := C.GoString(cName)
+	key := C.GoString(cKey)
+	cleanObject := (C.int(1) == cCleanObject)
+
+	error_clear()
+	src, token, err := dataset.ReadJSONWithRevision(collectionName, key)
+	if err != nil {
+		error_dispatch(err, "Can't read %s, %s", key, err)
+		return C.CString("")
+	}
+	object := map[string]interface{}{}
+	if err := dataset.DecodeJSON(src, &object); err != nil {
+		error_dispatch(err, "Can't decode %s, %s", key, err)
+		return C.CString("")
+	}
+	if cleanObject {
+		delete(object, "_Key")
+	}
+	src, err = dataset.EncodeJSON(map[string]interface{}{
+		"object":   object,
+		"revision": token,
+	})
+	if err != nil {
+		error_dispatch(err, "Can't encode %s, %s", key, err)
+		return C.CString("")
+	}
+	return C.CString(fmt.Sprintf("%s", src))
+}
+
 // THIS IS AN UGLY HACK, Python ctypes doesn't **easily** support
 // undemensioned arrays of strings. So we will assume the array of
 // keys has already been transformed into JSON before calling
@@ -340,75 +472,116 @@ func update_object(cName, cKey, cSrc *C.char) C.int {
 	return C.int(1)
 }
 
-// delete_object takes a key and removes a record from the collection
+// update_object_if_revision takes a key, JSON source and a revision
+// token and replaces the record in the collection. If the revision
+// token isn't empty the update fails unless it matches the stored
+// record, get it with read_object_revision.
 //
-//export delete_object
-func delete_object(cName, cKey *C.char) C.int {
+//export update_object_if_revision
+func update_object_if_revision(cName, cKey, cSrc, cRevision *C.char) C.int {
 	collectionName := C.GoString(cName)
 	key := C.GoString(cKey)
+	src := []byte(C.GoString(cSrc))
+	revision := C.GoString(cRevision)
 
 	error_clear()
-	err := dataset.DeleteJSON(collectionName, key)
+	err := dataset.UpdateJSONIfRevision(collectionName, key, src, revision)
 	if err != nil {
-		error_dispatch(err, "Cannot open collection %s, %s", collectionName, err)
+		error_dispatch(err, "Update %s failed, %s", key, err)
 		return C.int(0)
 	}
 	return C.int(1)
 }
 
-// join takes a collection name, a key, and merges JSON source with an
-// existing JSON record. If overwrite is 1 it overwrites and replaces
-// common values, if not 1 it only adds missing attributes.
+// revision_token returns the current revision token of a record.
+// The record may change before you read it, use read_object_revision
+// to get a record and its token together.
 //
-//export join
-func join(cName *C.char, cKey *C.char, cObjSrc *C.char, cOverwrite C.int) C.int {
+//export revision_token
+func revision_token(cName, cKey *C.char) *C.char {
 	collectionName := C.GoString(cName)
 	key := C.GoString(cKey)
-	overwrite := (cOverwrite == 1)
-	objectSrc := C.GoString(cObjSrc)
 
 	error_clear()
-	err := dataset.Open(collectionName)
+	token, err := dataset.RevisionToken(collectionName, key)
 	if err != nil {
-		error_dispatch(err, "%s", err)
-		return C.int(0)
+		error_dispatch(err, "Can't get revision of %s, %s", key, err)
+		return C.CString("")
 	}
+	return C.CString(token)
+}
 
-	newObject := map[string]interface{}{}
-	if err := dataset.DecodeJSON([]byte(objectSrc), &newObject); err != nil {
-		error_dispatch(err, "%s", err)
+// patch_object takes a key and a JSON Patch (RFC 6902) or JSON Merge
+// Patch (RFC 7396) document and applies it to the stored record.
+//
+//export patch_object
+func patch_object(cName, cKey, cPatch *C.char) C.int {
+	collectionName := C.GoString(cName)
+	key := C.GoString(cKey)
+	patchSrc := C.GoString(cPatch)
+
+	error_clear()
+	if err := dataset.PatchJSON(collectionName, key, []byte(patchSrc)); err != nil {
+		error_dispatch(err, "Can't patch %s, %s", key, err)
 		return C.int(0)
 	}
+	return C.int(1)
+}
+
+// delete_object takes a key and removes a record from the collection
+//
+//export delete_object
+func delete_object(cName, cKey *C.char) C.int {
+	collectionName := C.GoString(cName)
+	key := C.GoString(cKey)
 
-	src, err := dataset.ReadJSON(collectionName, key)
+	error_clear()
+	err := dataset.DeleteJSON(collectionName, key)
 	if err != nil {
-		error_dispatch(err, "%s", err)
+		error_dispatch(err, "Cannot open collection %s, %s", collectionName, err)
 		return C.int(0)
 	}
-	outObject := map[string]interface{}{}
-	if err := dataset.DecodeJSON(src, &outObject); err != nil {
+	return C.int(1)
+}
+
+// join takes a collection name, a key, and recursively merges JSON
+// source with an existing JSON record. If overwrite is 1 it overwrites
+// and replaces common values, if not 1 it only adds missing attributes.
+//
+//export join
+func join(cName *C.char, cKey *C.char, cObjSrc *C.char, cOverwrite C.int) C.int {
+	return joinObject(C.GoString(cName), C.GoString(cKey), C.GoString(cObjSrc), (cOverwrite == 1), "")
+}
+
+// join_with_options is join with cOptions, an optional JSON object with
+// "conflict", "arrays" and "union_key" attributes. A "conflict" value
+// there takes precedence over overwrite.
+//
+//export join_with_options
+func join_with_options(cName *C.char, cKey *C.char, cObjSrc *C.char, cOverwrite C.int, cOptions *C.char) C.int {
+	return joinObject(C.GoString(cName), C.GoString(cKey), C.GoString(cObjSrc), (cOverwrite == 1), C.GoString(cOptions))
+}
+
+// joinObject implements join and join_with_options
+func joinObject(collectionName string, key string, objectSrc string, overwrite bool, optionsSrc string) C.int {
+	error_clear()
+	err := dataset.Open(collectionName)
+	if err != nil {
 		error_dispatch(err, "%s", err)
 		return C.int(0)
 	}
-	// Merge out objects
+
+	opts := &dataset.JoinOptions{Conflict: dataset.JoinKeep}
 	if overwrite {
-		for k, v := range newObject {
-			outObject[k] = v
-		}
-	} else {
-		for k, v := range newObject {
-			if _, ok := outObject[k]; ok != true {
-				outObject[k] = v
-			}
-		}
+		opts.Conflict = dataset.JoinOverwrite
 	}
-	src, err = dataset.EncodeJSON(outObject)
-	if err != nil {
-		error_dispatch(err, "%s", err)
-		return C.int(0)
+	if optionsSrc != "" {
+		if err := json.Unmarshal([]byte(optionsSrc), opts); err != nil {
+			error_dispatch(err, "%s", err)
+			return C.int(0)
+		}
 	}
-
-	if err := dataset.UpdateJSON(collectionName, key, src); err != nil {
+	if err := dataset.JoinJSON(collectionName, key, []byte(objectSrc), opts); err != nil {
 		error_dispatch(err, "%s", err)
 		return C.int(0)
 	}
@@ -503,6 +676,44 @@ func key_sort(cName, cKeyListExpr, cSortExpr *C.char) *C.char {
 	return C.CString(txt)
 }
 
+// key_sort_options is key_sort with sort options. cOptions is a JSON
+// object (e.g. locale, fold_case, nulls_first), it may be an empty string.
+//
+//export key_sort_options
+func key_sort_options(cName, cKeyListExpr, cSortExpr, cOptions *C.char) *C.char {
+	collectionName := C.GoString(cName)
+	keyListExpr := C.GoString(cKeyListExpr)
+	sortExpr := C.GoString(cSortExpr)
+	optionsSrc := C.GoString(cOptions)
+
+	error_clear()
+	keyList := []string{}
+	if err := json.Unmarshal([]byte(keyListExpr), &keyList); err != nil {
+		error_dispatch(err, "Unable to unmarshal keys, %s", err)
+		return C.CString("")
+	}
+	opts := new(dataset.SortOptions)
+	if strings.TrimSpace(optionsSrc) != "" {
+		if err := json.Unmarshal([]byte(optionsSrc), opts); err != nil {
+			error_dispatch(err, "failed to decode sort options, %s", err)
+			return C.CString("")
+		}
+	}
+
+	keys, err := dataset.KeySortByExpressionWithOptions(collectionName, keyList, sortExpr, opts)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	src, err := json.Marshal(keys)
+	if err != nil {
+		error_dispatch(err, "Can't marshal sorted keys, %s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
 // count returns the number of objects (records) in a collection.
 // if an error is encounter a -1 is returned.
 //export count
@@ -1223,6 +1434,44 @@ func frame_create(cName *C.char, cFName *C.char, cKeysSrc *C.char, cDotPathsSrc
 	return C.int(1)
 }
 
+// frame_define defines a new frame from the keys selected by a
+// definition (a JSON object with all_keys, keys, filter, sort and
+// sample_size) and populates it. The definition is saved with the
+// frame so frame_regenerate can apply it again.
+//
+//export frame_define
+func frame_define(cName *C.char, cFName *C.char, cDefinitionSrc *C.char, cDotPathsSrc *C.char, cLabelsSrc *C.char) C.int {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	definitionSrc := []byte(C.GoString(cDefinitionSrc))
+	dotPathSrc := []byte(C.GoString(cDotPathsSrc))
+	labelsSrc := []byte(C.GoString(cLabelsSrc))
+	def := new(dataset.FrameDefinition)
+	dotPaths := []string{}
+	labels := []string{}
+
+	error_clear()
+	if err := json.Unmarshal(definitionSrc, &def); err != nil {
+		error_dispatch(err, "failed to decode frame definition, %s", err)
+		return C.int(0)
+	}
+	def.TemplateFilter = dataset.TemplateFilters
+	if err := json.Unmarshal(dotPathSrc, &dotPaths); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	if err := json.Unmarshal(labelsSrc, &labels); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	_, err := dataset.FrameDefine(collectionName, frameName, def, dotPaths, labels, verbose)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
 // frame_objects retrieves a JSON source list of objects from a frame.
 //
 //export frame_objects
@@ -1244,6 +1493,31 @@ func frame_objects(cName *C.char, cFName *C.char) *C.char {
 	return C.CString(txt)
 }
 
+// frame_objects_page retrieves a JSON source list of limit objects from
+// a frame starting at offset, a limit of zero returns the rest of the
+// frame.
+//
+//export frame_objects_page
+func frame_objects_page(cName *C.char, cFName *C.char, cOffset C.int, cLimit C.int) *C.char {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	offset := int(cOffset)
+	limit := int(cLimit)
+	error_clear()
+	ol, err := dataset.FrameObjectsPage(collectionName, frameName, offset, limit)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	src, err := json.Marshal(ol)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
 // frame_refresh refresh the contents of a frame given a list of keys.
 //
 //export frame_refresh
@@ -1288,6 +1562,79 @@ func frame_reframe(cName *C.char, cFName *C.char, cKeysSrc *C.char) C.int {
 	return C.int(1)
 }
 
+// frame_regenerate selects a frame's keys again using its definition
+// and reframes it.
+//
+//export frame_regenerate
+func frame_regenerate(cName *C.char, cFName *C.char) C.int {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	error_clear()
+	if err := dataset.FrameRegenerate(collectionName, frameName, verbose); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
+// frame_live sets how a frame is kept up to date as objects change,
+// cMode is "immediate", "deferred" or "" to stop.
+//
+//export frame_live
+func frame_live(cName *C.char, cFName *C.char, cMode *C.char) C.int {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	mode := C.GoString(cMode)
+	error_clear()
+	if err := dataset.FrameLive(collectionName, frameName, mode); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
+// frame_types returns a JSON list of the types of a frame's columns.
+//
+//export frame_types
+func frame_types(cName *C.char, cFName *C.char) *C.char {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	error_clear()
+	types, err := dataset.FrameTypes(collectionName, frameName)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	src, err := json.Marshal(types)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
+// frame_set_types declares the types of a frame's columns, cTypes is
+// a JSON object of labels and types (e.g. {"year": "integer"}).
+//
+//export frame_set_types
+func frame_set_types(cName *C.char, cFName *C.char, cTypes *C.char) C.int {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	typesSrc := C.GoString(cTypes)
+	error_clear()
+	types := map[string]string{}
+	if err := json.Unmarshal([]byte(typesSrc), &types); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	if err := dataset.FrameSetTypes(collectionName, frameName, types, verbose); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
 // frame_clear will clear the object list and keys associated with a frame.
 //
 //export frame_clear
@@ -1343,6 +1690,201 @@ func frames(cName *C.char) *C.char {
 	return C.CString(txt)
 }
 
+// index_create declares a secondary index on a dotpath
+//
+//export index_create
+func index_create(cName *C.char, cDotPath *C.char) C.int {
+	collectionName := C.GoString(cName)
+	dotPath := C.GoString(cDotPath)
+	error_clear()
+	if err := dataset.IndexCreate(collectionName, dotPath); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
+// index_drop removes a secondary index from a collection
+//
+//export index_drop
+func index_drop(cName *C.char, cDotPath *C.char) C.int {
+	collectionName := C.GoString(cName)
+	dotPath := C.GoString(cDotPath)
+	error_clear()
+	if err := dataset.IndexDrop(collectionName, dotPath); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
+// index_rebuild regenerates the index on a dotpath, an empty
+// dotpath rebuilds all the collection's indexes.
+//
+//export index_rebuild
+func index_rebuild(cName *C.char, cDotPath *C.char) C.int {
+	collectionName := C.GoString(cName)
+	dotPath := C.GoString(cDotPath)
+	error_clear()
+	if dataset.IsOpen(collectionName) == false {
+		if err := dataset.Open(collectionName); err != nil {
+			error_dispatch(err, "%s", err)
+			return C.int(0)
+		}
+	}
+	dotPaths := []string{dotPath}
+	if dotPath == "" {
+		dotPaths = dataset.Indexes(collectionName)
+	}
+	for _, dotPath := range dotPaths {
+		if err := dataset.IndexRebuild(collectionName, dotPath); err != nil {
+			error_dispatch(err, "%s", err)
+			return C.int(0)
+		}
+	}
+	return C.int(1)
+}
+
+// indexes returns a JSON array of the indexed dotpaths in the collection.
+//
+//export indexes
+func indexes(cName *C.char) *C.char {
+	collectionName := C.GoString(cName)
+
+	error_clear()
+	if dataset.IsOpen(collectionName) == false {
+		if err := dataset.Open(collectionName); err != nil {
+			error_dispatch(err, "%s", err)
+			return C.CString("")
+		}
+	}
+
+	src, err := json.Marshal(dataset.Indexes(collectionName))
+	if err != nil {
+		error_dispatch(err, "failed to marshal indexes, %s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
+// index_frame builds a full text index of a frame in index_path
+//
+//export index_frame
+func index_frame(cName *C.char, cFName *C.char, cIndexPath *C.char) C.int {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	indexPath := C.GoString(cIndexPath)
+	error_clear()
+	if err := dataset.IndexFrame(collectionName, frameName, indexPath); err != nil {
+		error_dispatch(err, "%s", err)
+		return C.int(0)
+	}
+	return C.int(1)
+}
+
+// search runs a query against a full text index returning the
+// results as JSON. cOptions is a JSON object holding the search
+// options (e.g. fields, from, size, highlight, facets, facet_size),
+// it may be an empty string.
+//
+//export search
+func search(cName *C.char, cIndexPath *C.char, cQuery *C.char, cOptions *C.char) *C.char {
+	collectionName := C.GoString(cName)
+	indexPath := C.GoString(cIndexPath)
+	query := C.GoString(cQuery)
+	optionsSrc := C.GoString(cOptions)
+	error_clear()
+	opts := new(dataset.SearchOptions)
+	if strings.TrimSpace(optionsSrc) != "" {
+		if err := json.Unmarshal([]byte(optionsSrc), opts); err != nil {
+			error_dispatch(err, "failed to decode search options, %s", err)
+			return C.CString("")
+		}
+	}
+	result, err := dataset.Search(collectionName, indexPath, query, opts)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	src, err := json.Marshal(result)
+	if err != nil {
+		error_dispatch(err, "failed to marshal search results, %s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
+// lunr_index builds a Lunr.js index and document store of a frame
+// returning them as JSON. cOptions is a JSON object holding the
+// options (e.g. fields, store, boosts), it may be an empty string.
+//
+//export lunr_index
+func lunr_index(cName *C.char, cFName *C.char, cOptions *C.char) *C.char {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	optionsSrc := C.GoString(cOptions)
+	error_clear()
+	opts := new(dataset.LunrOptions)
+	if strings.TrimSpace(optionsSrc) != "" {
+		if err := json.Unmarshal([]byte(optionsSrc), opts); err != nil {
+			error_dispatch(err, "failed to decode lunr index options, %s", err)
+			return C.CString("")
+		}
+	}
+	idx, err := dataset.LunrIndex(collectionName, frameName, opts)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	src, err := json.Marshal(idx)
+	if err != nil {
+		error_dispatch(err, "failed to marshal lunr index, %s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
+// aggregate groups a frame's objects by the dotpaths in cGroupBy
+// (a JSON array) and calculates the aggregations in cAggregations
+// (e.g. "count,sum(.amount)") for each group. Returns the groups
+// as a JSON array of objects.
+//
+//export aggregate
+func aggregate(cName *C.char, cFName *C.char, cGroupBy *C.char, cAggregations *C.char) *C.char {
+	collectionName := C.GoString(cName)
+	frameName := C.GoString(cFName)
+	groupBySrc := C.GoString(cGroupBy)
+	aggregationExpr := C.GoString(cAggregations)
+	error_clear()
+	groupBy := []string{}
+	if strings.TrimSpace(groupBySrc) != "" {
+		if err := json.Unmarshal([]byte(groupBySrc), &groupBy); err != nil {
+			error_dispatch(err, "failed to decode group by dotpaths, %s", err)
+			return C.CString("")
+		}
+	}
+	aggregations, err := dataset.ParseAggregations(aggregationExpr)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	f, err := dataset.FrameGroupBy(collectionName, frameName, groupBy, aggregations)
+	if err != nil {
+		error_dispatch(err, "%s", err)
+		return C.CString("")
+	}
+	src, err := json.Marshal(f.Objects())
+	if err != nil {
+		error_dispatch(err, "failed to marshal groups, %s", err)
+		return C.CString("")
+	}
+	txt := fmt.Sprintf("%s", src)
+	return C.CString(txt)
+}
+
 // sync_send_csv - synchronize a frame sending data to a CSV file
 //
 //export sync_send_csv
@@ -45,11 +45,25 @@ go_error_clear = lib.error_clear
 go_error_message = lib.error_message
 go_error_message.restype = ctypes.c_char_p
 
+go_error_code = lib.error_code
+# Returns: error code of the last error (int), 0 if none
+go_error_code.restype = ctypes.c_int
+
 go_use_strict_dotpath = lib.use_strict_dotpath
 # Args: is 1 (true) or 0 (false)
 go_use_strict_dotpath.argtypes = [ctypes.c_int]
 go_use_strict_dotpath.restype = ctypes.c_int
 
+go_set_workers = lib.set_workers
+# Args: number of workers
+go_set_workers.argtypes = [ctypes.c_int]
+go_set_workers.restype = ctypes.c_int
+
+go_use_template_filters = lib.use_template_filters
+# Args: is 1 (true) or 0 (false)
+go_use_template_filters.argtypes = [ctypes.c_int]
+go_use_template_filters.restype = ctypes.c_int
+
 go_dataset_version = lib.dataset_version
 go_dataset_version.restype = ctypes.c_char_p
 
@@ -80,6 +94,12 @@ go_read_object.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_int]
 # Returns: value (JSON source)
 go_read_object.restype = ctypes.c_char_p
 
+go_read_object_revision = lib.read_object_revision
+# Args: collection_name (string), key (string), clean_object (int)
+go_read_object_revision.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_int]
+# Returns: {"object": value, "revision": token} (JSON source)
+go_read_object_revision.restype = ctypes.c_char_p
+
 # THIS IS A HACK, ctypes doesn't **easily** support undemensioned arrays
 # of strings. So we will assume the array of keys has already been
 # transformed into JSON before calling go_read_list.
@@ -95,6 +115,24 @@ go_update_object.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
 # Returns: true (1), false (0)
 go_update_object.restype = ctypes.c_int
 
+go_update_object_if_revision = lib.update_object_if_revision
+# Args: collection_name (string), key (string), value (JSON sourc), revision (string)
+go_update_object_if_revision.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_update_object_if_revision.restype = ctypes.c_int
+
+go_revision_token = lib.revision_token
+# Args: collection_name (string), key (string)
+go_revision_token.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+# Returns: revision token (string)
+go_revision_token.restype = ctypes.c_char_p
+
+go_patch_object = lib.patch_object
+# Args: collection_name (string), key (string), patch (JSON source)
+go_patch_object.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_patch_object.restype = ctypes.c_int
+
 go_delete_object = lib.delete_object
 # Args: collection_name (string), key (string)
 go_delete_object.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
@@ -125,6 +163,12 @@ go_key_sort.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
 # Returns: value (JSON source)
 go_key_sort.restype = ctypes.c_char_p
 
+go_key_sort_options = lib.key_sort_options
+# Args: collection_name (string), key_list (JSON array source), sort order (string), options (JSON source)
+go_key_sort_options.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: value (JSON source)
+go_key_sort_options.restype = ctypes.c_char_p
+
 go_count = lib.count
 # Args: collection_name (string)
 go_count.argtypes = [ctypes.c_char_p]
@@ -261,6 +305,12 @@ go_join.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_
 # Returns: true (1), false (0)
 go_join.restype = ctypes.c_int
 
+go_join_with_options = lib.join_with_options
+# Args: collection_name (string), key (string), value (JSON source), overwrite (1: true, 0: false), options (JSON source)
+go_join_with_options.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_join_with_options.restype = ctypes.c_int
+
 go_clone = lib.clone
 # Args: collection_name (string), new_collection_name (string), ????
 go_clone.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
@@ -285,6 +335,12 @@ go_frame_create.argtypes = [ctypes.c_char_p, ctypes.c_char_p,  ctypes.c_char_p,
 # Returns: value (JSON object source)
 go_frame_create.restype = ctypes.c_int
 
+go_frame_define = lib.frame_define
+# Args: collection_name (string), frame_name (string), definition (JSON source), dotpaths (JSON source), labels (JSON source)
+go_frame_define.argtypes = [ctypes.c_char_p, ctypes.c_char_p,  ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_frame_define.restype = ctypes.c_int
+
 go_frame_exists = lib.frame_exists
 # Args: collection_name (string), fame_name (string)
 go_frame_exists.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
@@ -303,6 +359,12 @@ go_frame_objects.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
 # Returns: value (JSON object source)
 go_frame_objects.restype = ctypes.c_char_p
 
+go_frame_objects_page = lib.frame_objects_page
+# Args: collection_name (string), fame_name (string), offset (int), limit (int)
+go_frame_objects_page.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_int, ctypes.c_int]
+# Returns: value (JSON object source)
+go_frame_objects_page.restype = ctypes.c_char_p
+
 
 go_frames = lib.frames
 # Args: collection_name)
@@ -310,6 +372,54 @@ go_frames.argtypes = [ctypes.c_char_p]
 # Returns: frame names (JSON Array Source)
 go_frames.restype = ctypes.c_char_p
 
+go_index_create = lib.index_create
+# Args: collection_name (string), dotpath (string)
+go_index_create.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_index_create.restype = ctypes.c_int
+
+go_index_drop = lib.index_drop
+# Args: collection_name (string), dotpath (string)
+go_index_drop.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_index_drop.restype = ctypes.c_int
+
+go_index_rebuild = lib.index_rebuild
+# Args: collection_name (string), dotpath (string, empty for all)
+go_index_rebuild.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_index_rebuild.restype = ctypes.c_int
+
+go_indexes = lib.indexes
+# Args: collection_name (string)
+go_indexes.argtypes = [ctypes.c_char_p]
+# Returns: indexed dotpaths (JSON Array Source)
+go_indexes.restype = ctypes.c_char_p
+
+go_index_frame = lib.index_frame
+# Args: collection_name (string), frame_name (string), index_path (string)
+go_index_frame.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_index_frame.restype = ctypes.c_int
+
+go_search = lib.search
+# Args: collection_name (string), index_path (string), query (string), options (JSON source)
+go_search.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: search results (JSON Object Source)
+go_search.restype = ctypes.c_char_p
+
+go_lunr_index = lib.lunr_index
+# Args: collection_name (string), frame_name (string), options (JSON source)
+go_lunr_index.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: lunr index and document store (JSON Object Source)
+go_lunr_index.restype = ctypes.c_char_p
+
+go_aggregate = lib.aggregate
+# Args: collection_name (string), frame_name (string), group_by (JSON source), aggregations (string)
+go_aggregate.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: groups (JSON array source)
+go_aggregate.restype = ctypes.c_char_p
+
 go_frame_refresh = lib.frame_refresh
 # Args: collection_name (string), frame_name (string), keys??? (JSON source)
 go_frame_refresh.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
@@ -322,6 +432,30 @@ go_frame_reframe.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
 # Returns: value (JSON object source)
 go_frame_reframe.restype = ctypes.c_int
 
+go_frame_regenerate = lib.frame_regenerate
+# Args: collection_name (string), frame_name (string)
+go_frame_regenerate.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_frame_regenerate.restype = ctypes.c_int
+
+go_frame_live = lib.frame_live
+# Args: collection_name (string), frame_name (string), mode (string)
+go_frame_live.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_frame_live.restype = ctypes.c_int
+
+go_frame_types = lib.frame_types
+# Args: collection_name (string), frame_name (string)
+go_frame_types.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+# Returns: value (JSON list source)
+go_frame_types.restype = ctypes.c_char_p
+
+go_frame_set_types = lib.frame_set_types
+# Args: collection_name (string), frame_name (string), types (JSON object source)
+go_frame_set_types.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+# Returns: true (1), false (0)
+go_frame_set_types.restype = ctypes.c_int
+
 go_frame_delete = lib.frame_delete
 # Args: collection_name (string), frame_name (string)
 go_frame_delete.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
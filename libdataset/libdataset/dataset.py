@@ -21,7 +21,7 @@
 import json
 import ctypes
 
-from libdataset.cwrapper import go_basename , go_error_clear, go_error_message , go_use_strict_dotpath , go_dataset_version , go_is_verbose , go_verbose_on , go_verbose_off , go_init , go_create_object , go_read_object , go_read_object_list , go_update_object , go_delete_object , go_key_exists , go_keys , go_key_filter , go_key_sort , go_count , go_import_csv , go_export_csv , go_import_gsheet , go_export_gsheet , go_sync_recieve_csv , go_sync_send_csv , go_sync_recieve_gsheet , go_sync_send_gsheet , go_status , go_list , go_path , go_check , go_repair , go_attach , go_attachments , go_detach , go_prune , go_join , go_clone , go_clone_sample , go_grid , go_frame_create, go_frame_keys, go_frame_objects, go_frame_exists , go_frames , go_frame_reframe , go_frame_delete , go_frame_grid , go_update_objects, go_set_who, go_get_who, go_set_what, go_get_what, go_set_where, go_get_where, go_set_when, go_get_when, go_set_version, go_get_version, go_set_contact, go_get_contact
+from libdataset.cwrapper import go_basename , go_error_clear, go_error_message , go_error_code , go_use_strict_dotpath , go_set_workers , go_use_template_filters , go_dataset_version , go_is_verbose , go_verbose_on , go_verbose_off , go_init , go_create_object , go_read_object , go_read_object_revision , go_read_object_list , go_update_object , go_update_object_if_revision , go_revision_token , go_patch_object , go_delete_object , go_key_exists , go_keys , go_key_filter , go_key_sort , go_key_sort_options , go_count , go_import_csv , go_export_csv , go_import_gsheet , go_export_gsheet , go_sync_recieve_csv , go_sync_send_csv , go_sync_recieve_gsheet , go_sync_send_gsheet , go_status , go_list , go_path , go_check , go_repair , go_attach , go_attachments , go_detach , go_prune , go_join , go_join_with_options , go_clone , go_clone_sample , go_grid , go_frame_create, go_frame_define, go_frame_keys, go_frame_objects, go_frame_objects_page, go_frame_exists , go_frames , go_index_create , go_index_drop , go_index_rebuild , go_indexes , go_index_frame , go_search , go_lunr_index , go_aggregate , go_frame_reframe , go_frame_regenerate , go_frame_live , go_frame_types , go_frame_set_types , go_frame_delete , go_frame_grid , go_update_objects, go_set_who, go_get_who, go_set_what, go_get_what, go_set_where, go_get_where, go_set_when, go_get_when, go_set_version, go_get_version, go_set_contact, go_get_contact
 
 #
 # These are our Python idiomatic functions
@@ -36,6 +36,29 @@ def error_message():
         value = value.encode('utf-8')
     return value.decode() 
 
+# Error codes returned by error_code()
+ERR_NONE = 0
+ERR_UNKNOWN = 1
+ERR_KEY_NOT_FOUND = 2
+ERR_KEY_EXISTS = 3
+ERR_FRAME_NOT_FOUND = 4
+ERR_FRAME_EXISTS = 5
+ERR_NOT_AN_OBJECT = 6
+ERR_COLLECTION_NOT_FOUND = 7
+ERR_COLLECTION_LOCKED = 8
+ERR_REVISION_NOT_FOUND = 9
+ERR_REVISION_CONFLICT = 10
+ERR_JOIN_CONFLICT = 11
+ERR_VALIDATION = 12
+ERR_INDEX_NOT_FOUND = 13
+ERR_INDEX_EXISTS = 14
+ERR_QUERY_SYNTAX = 15
+
+# error_code returns the code of the last error, call it before
+# the next libdataset function
+def error_code():
+    return go_error_code()
+
 
 def use_strict_dotpath(on_off = True):
     if on_off == True:
@@ -44,6 +67,20 @@ def use_strict_dotpath(on_off = True):
     go_use_strict_dotpath(0)
     return False
 
+# set_workers sets how many objects are read and evaluated at once
+# when building frames and grids or filtering keys, returns the
+# previous value.
+def set_workers(n = 1):
+    return go_set_workers(ctypes.c_int(n))
+
+# use_template_filters reads filter expressions as Go template
+# expressions (e.g. '(eq .year 2019)') instead of queries, returns
+# the previous setting.
+def use_template_filters(on_off = True):
+    if on_off == True:
+        return go_use_template_filters(1) == 1
+    return go_use_template_filters(0) == 1
+
 # is_verbose returns true is verbose is enabled, false otherwise
 def is_verbose():
     ok = go_is_verbose()
@@ -150,6 +187,24 @@ def read(collection_name, key, clean_object = False):
         return json.loads(rval), ''
     return {}, f"Can't read {key} from {collection_name}, {error_message()}"
     
+# Read a JSON record and its revision token from a Dataset collection
+def read_with_revision(collection_name, key, clean_object = False):
+    '''read a JSON record from a collection with the given name and record key, returns a dict, the record's revision token for use with update and an error string'''
+    clean_object_int = ctypes.c_int(0)
+    if clean_object == True:
+        clean_object_int = ctypes.c_int(1)
+    if not isinstance(key, str) == True:
+        key = f"{key}"
+    value = go_read_object_revision(ctypes.c_char_p(collection_name.encode('utf8')),
+            ctypes.c_char_p(key.encode('utf8')), clean_object_int)
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    rval = value.decode()
+    if rval == "":
+        return {}, '', error_message()
+    result = json.loads(rval)
+    return result['object'], result['revision'], ''
+
 # Read a list of JSON records from a Dataset collection
 # NOTE: this provides dataset cli behavior for reading back a list
 # of records effeciently ...
@@ -178,11 +233,37 @@ def read_list(collection_name, keys, clean_object = False):
 
 
 # Update a JSON record from a Dataset collection
-def update(collection_name, key, value):
-    '''update a JSON record from a collection with the given name, record key, JSON string returning True/False'''
+def update(collection_name, key, value, revision = ''):
+    '''update a JSON record from a collection with the given name, record key, JSON string returning True/False. If revision is provided the update fails when the record's revision token no longer matches'''
+    if not isinstance(key, str) == True:
+        key = f"{key}"
+    if revision == '':
+        ok = go_update_object(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(json.dumps(value).encode('utf8')))
+    else:
+        ok = go_update_object_if_revision(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(json.dumps(value).encode('utf8')), ctypes.c_char_p(revision.encode('utf8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+# Revision token of a JSON record in a Dataset collection
+def revision_token(collection_name, key):
+    '''return the current revision token of a JSON record, use read_with_revision to get a record and its token together'''
+    if not isinstance(key, str) == True:
+        key = f"{key}"
+    value = go_revision_token(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    rval = value.decode()
+    if rval == "":
+        return '', error_message()
+    return rval, ''
+
+# Patch a JSON record in a Dataset collection
+def patch(collection_name, key, patch):
+    '''apply a JSON Patch (a list of operations) or JSON Merge Patch (a dict) to a JSON record in a collection, returning an error message or empty string'''
     if not isinstance(key, str) == True:
         key = f"{key}"
-    ok = go_update_object(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(json.dumps(value).encode('utf8')))
+    ok = go_patch_object(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(json.dumps(patch).encode('utf8')))
     if ok == 1:
         return ''
     return error_message()
@@ -221,10 +302,11 @@ def key_filter(collection_name, keys, filter_expr):
     return json.loads(rval)
     
 # Key sort takes sort expression and an optional list of keys and returns a sorted list of keys
-def key_sort(collection_name, keys, sort_expr):
-    '''key_filter takes a list of keys (if empty or * then it uses all keys in collection) and a filter expression returning a filtered list'''
+def key_sort(collection_name, keys, sort_expr, locale = '', fold_case = False, nulls_first = False):
+    '''key_sort takes a list of keys and a sort expression (e.g. "-.year,+.title") returning a sorted list'''
     key_list = json.dumps(keys)
-    value = go_key_sort(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key_list.encode('utf8')), ctypes.c_char_p(sort_expr.encode('utf8')))
+    options = json.dumps({ "locale": locale, "fold_case": fold_case, "nulls_first": nulls_first })
+    value = go_key_sort_options(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key_list.encode('utf8')), ctypes.c_char_p(sort_expr.encode('utf8')), ctypes.c_char_p(options.encode('utf8')))
     if not isinstance(value, bytes):
         value = value.encode('utf8')
     rval = value.decode()
@@ -394,12 +476,23 @@ def prune(collection_name, key, filenames = [], semver = ''):
         return ''
     return error_message()
 
-def join(collection_name, key, obj = {}, overwrite = False):
+def join(collection_name, key, obj = {}, overwrite = False, conflict = '', arrays = '', union_key = ''):
     src = json.dumps(obj).encode('utf8')
     cOverwrite = ctypes.c_int(0)
     if overwrite == True:
         cOverwrite = ctypes.c_int(1)
-    ok = go_join(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(src), cOverwrite)
+    options = {}
+    if conflict != '':
+        options['conflict'] = conflict
+    if arrays != '':
+        options['arrays'] = arrays
+    if union_key != '':
+        options['union_key'] = union_key
+    if len(options) > 0:
+        src_options = json.dumps(options)
+        ok = go_join_with_options(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(src), cOverwrite, ctypes.c_char_p(src_options.encode('utf8')))
+    else:
+        ok = go_join(ctypes.c_char_p(collection_name.encode('utf8')), ctypes.c_char_p(key.encode('utf8')), ctypes.c_char_p(src), cOverwrite)
     if ok == 1:
         return ''
     return error_message()
@@ -445,6 +538,33 @@ def frame_create(collection_name, frame_name, keys, dot_paths, labels):
         return ''
     return error_message()
 
+# frame_define creates a frame from the keys selected by filter_expr,
+# sample_size and sort_expr. Keys are selected from all the collection's
+# keys unless a list of keys is given. The selection is saved with
+# the frame so frame_regenerate can apply it again.
+def frame_define(collection_name, frame_name, dot_paths, labels, keys = None, filter_expr = '', sort_expr = '', sample_size = 0, types = None):
+    definition = { "all_keys": keys == None, "filter": filter_expr, "sort": sort_expr, "sample_size": sample_size }
+    if keys != None:
+        definition["keys"] = keys
+    if types != None:
+        definition["types"] = types
+    src_definition = json.dumps(definition)
+    src_dot_paths = json.dumps(dot_paths)
+    if len(labels) == 0 and len(dot_paths) > 0:
+        for item in dot_paths:
+            if item.startswith("."):
+                item = item[1:]
+            labels.append(item)
+    src_labels = json.dumps(labels)
+    ok = go_frame_define(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')),
+        ctypes.c_char_p(src_definition.encode('utf-8')),
+        ctypes.c_char_p(src_dot_paths.encode('utf-8')),
+        ctypes.c_char_p(src_labels.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
 
 def frame_exists(collection_name, frame_name):
     ok = go_frame_exists(ctypes.c_char_p(collection_name.encode('utf-8')),
@@ -469,6 +589,16 @@ def frame_objects(collection_name, frame_name):
         return {}, error_message()
     return json.loads(value), ''
 
+def frame_objects_page(collection_name, frame_name, offset = 0, limit = 0):
+    value = go_frame_objects_page(ctypes.c_char_p(collection_name.encode('utf-8')),
+            ctypes.c_char_p(frame_name.encode('utf-8')),
+            ctypes.c_int(offset), ctypes.c_int(limit))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    if value == None or value.strip() == '' or len(value) == 0:
+        return {}, error_message()
+    return json.loads(value), ''
+
 def frames(collection_name):
     value = go_frames(ctypes.c_char_p(collection_name.encode('utf-8')))
     if not isinstance(value, bytes):
@@ -477,6 +607,87 @@ def frames(collection_name):
         return [] 
     return json.loads(value)
 
+def index_create(collection_name, dotpath):
+    ok = go_index_create(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(dotpath.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+def index_drop(collection_name, dotpath):
+    ok = go_index_drop(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(dotpath.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+def index_rebuild(collection_name, dotpath = ''):
+    ok = go_index_rebuild(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(dotpath.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+def indexes(collection_name):
+    value = go_indexes(ctypes.c_char_p(collection_name.encode('utf-8')))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    if value == None or value.strip() == '' or len(value) == 0: 
+        return [] 
+    return json.loads(value)
+
+def index_frame(collection_name, frame_name, index_path):
+    ok = go_index_frame(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')),
+        ctypes.c_char_p(index_path.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+# search returns a tuple of the search results (a dict with total,
+# hits and facets) and an error message
+def search(collection_name, index_path, query, fields = [], size = 0, 
+        start = 0, highlight = False, facets = [], facet_size = 0):
+    options = json.dumps({ "fields": fields, "size": size, "from": start,
+        "highlight": highlight, "facets": facets, "facet_size": facet_size })
+    value = go_search(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(index_path.encode('utf-8')),
+        ctypes.c_char_p(query.encode('utf-8')),
+        ctypes.c_char_p(options.encode('utf-8')))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    if value == None or value.strip() == b'' or len(value) == 0:
+        return {}, error_message()
+    return json.loads(value), ''
+
+# lunr_index returns a tuple of a dict holding a Lunr.js index and
+# document store and an error message
+def lunr_index(collection_name, frame_name, fields = [], store = [], boosts = {}):
+    options = json.dumps({ "fields": fields, "store": store, "boosts": boosts })
+    value = go_lunr_index(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')),
+        ctypes.c_char_p(options.encode('utf-8')))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    if value == None or value.strip() == b'' or len(value) == 0:
+        return {}, error_message()
+    return json.loads(value), ''
+
+# aggregate groups a frame's objects by the dotpaths in group_by and
+# summarizes each group, e.g. aggregations = 'count,sum(.amount)'.
+# Returns a tuple of a list of dicts (one per group) and an error message
+def aggregate(collection_name, frame_name, group_by = [], aggregations = 'count'):
+    src_group_by = json.dumps(group_by)
+    value = go_aggregate(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')),
+        ctypes.c_char_p(src_group_by.encode('utf-8')),
+        ctypes.c_char_p(aggregations.encode('utf-8')))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    if value == None or value.strip() == b'' or len(value) == 0:
+        return [], error_message()
+    return json.loads(value), ''
+
 def frame_reframe(collection_name, frame_name, keys = []):
     src_keys = json.dumps(keys)
     ok = go_frame_reframe(ctypes.c_char_p(collection_name.encode('utf-8')),
@@ -486,6 +697,46 @@ def frame_reframe(collection_name, frame_name, keys = []):
         return ''
     return error_message()
 
+# frame_regenerate selects a frame's keys again using the definition
+# saved by frame_define and reframes it
+def frame_regenerate(collection_name, frame_name):
+    ok = go_frame_regenerate(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+# frame_live keeps a frame up to date as objects change, mode is
+# 'immediate', 'deferred' (applied when the frame is next read) or
+# '' to stop
+def frame_live(collection_name, frame_name, mode = 'immediate'):
+    ok = go_frame_live(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')),
+        ctypes.c_char_p(mode.encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
+# frame_types returns the types of a frame's columns
+def frame_types(collection_name, frame_name):
+    value = go_frame_types(ctypes.c_char_p(collection_name.encode('utf-8')),
+            ctypes.c_char_p(frame_name.encode('utf-8')))
+    if not isinstance(value, bytes):
+        value = value.encode('utf-8')
+    if value == None or value.strip() == '' or len(value) == 0:
+        return [], error_message()
+    return json.loads(value), ''
+
+# frame_set_types declares the types of a frame's columns, types is
+# a dict of labels and types (e.g. {'year': 'integer'})
+def frame_set_types(collection_name, frame_name, types):
+    ok = go_frame_set_types(ctypes.c_char_p(collection_name.encode('utf-8')),
+        ctypes.c_char_p(frame_name.encode('utf-8')),
+        ctypes.c_char_p(json.dumps(types).encode('utf-8')))
+    if ok == 1:
+        return ''
+    return error_message()
+
 def frame_refresh(collection_name, frame_name, keys = []):
     src_keys = json.dumps(keys)
     ok = go_frame_refresh(ctypes.c_char_p(collection_name.encode('utf-8')),
@@ -0,0 +1,285 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: live.go keeps frames registered as live views up to date as
+// objects are created, updated and deleted. Immediate frames are
+// updated as each object changes, deferred frames collect the changed
+// keys and are updated when the frame is next read. Immediate frames
+// on local disc are kept in memory between writes so a write only
+// costs the rows it changes, they are reread if the frame's files
+// are changed by someone else.
+//
+
+const (
+	// LiveImmediate updates a live frame as each object changes
+	LiveImmediate = "immediate"
+	// LiveDeferred updates a live frame when it is next read
+	LiveDeferred = "deferred"
+)
+
+// FrameLive registers a frame as a live view of the collection. mode
+// is LiveImmediate or LiveDeferred, an empty mode stops the frame
+// being live. Pending changes of a deferred frame are applied first.
+// Objects enter and leave the frame as they match its definition's
+// filter, frames without a definition only update the objects they
+// already hold.
+func (c *Collection) FrameLive(name string, mode string) error {
+	switch mode {
+	case "", LiveImmediate, LiveDeferred:
+	default:
+		return fmt.Errorf("unknown live frame mode %q", mode)
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	// NOTE: loadFrame applies any pending changes
+	if _, err := c.loadFrame(name, true); err != nil {
+		return err
+	}
+	if mode == "" {
+		delete(c.LiveFrames, name)
+		if c.notLive == nil {
+			c.notLive = make(map[string]bool)
+		}
+		c.notLive[name] = true
+	} else {
+		if c.LiveFrames == nil {
+			c.LiveFrames = make(map[string]string)
+		}
+		c.LiveFrames[name] = mode
+		delete(c.notLive, name)
+	}
+	return c.saveMetadata()
+}
+
+// pendingPath returns the path of the list of keys changed since a
+// deferred frame was last read
+func (c *Collection) pendingPath(name string) string {
+	return path.Join(c.workPath, "_frames", strings.TrimSuffix(name, ".json")+".pending")
+}
+
+// liveFrame is an immediate live frame kept between writes along
+// with the stamps of its files when last written
+type liveFrame struct {
+	frame   *DataFrame
+	header  fileStamp
+	offsets fileStamp
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// stampFile returns the stamp of a file, the zero stamp if it
+// can't be read
+func stampFile(store *storage.Store, fName string) fileStamp {
+	info, err := store.Stat(fName)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}
+}
+
+// getLiveFrame returns an immediate live frame without its rows,
+// the frame kept from the last write is used if its files haven't
+// changed since.
+func (c *Collection) getLiveFrame(name string) (*DataFrame, error) {
+	if c.Store.Type != storage.FS {
+		return c.loadFrame(name, false)
+	}
+	header, _, offsets := c.frameFiles(c.FrameMap[name])
+	if lf, ok := c.liveCache[name]; ok && c.Store.IsFile(c.pendingPath(name)) == false &&
+		lf.header == stampFile(c.Store, header) && lf.offsets == stampFile(c.Store, offsets) {
+		return lf.frame, nil
+	}
+	delete(c.liveCache, name)
+	return c.loadFrame(name, false)
+}
+
+// keepLiveFrame keeps an immediate live frame after it is written
+func (c *Collection) keepLiveFrame(name string, f *DataFrame) {
+	if c.Store.Type != storage.FS {
+		return
+	}
+	if c.liveCache == nil {
+		c.liveCache = map[string]*liveFrame{}
+	}
+	header, _, offsets := c.frameFiles(c.FrameMap[name])
+	// NOTE: only the changed rows are needed for the next write
+	f.ObjectMap = map[string]interface{}{}
+	c.liveCache[name] = &liveFrame{
+		frame:   f,
+		header:  stampFile(c.Store, header),
+		offsets: stampFile(c.Store, offsets),
+	}
+}
+
+// liveMember decides if a changed object belongs in a live frame
+func (c *Collection) liveMember(f *DataFrame, key string, obj map[string]interface{}) (bool, error) {
+	def := f.Definition
+	if def == nil {
+		return f.keyPosition(key) >= 0, nil
+	}
+	if def.AllKeys == false && def.hasKey(key) == false {
+		return false, nil
+	}
+	if def.Filter == "" || def.Filter == "true" {
+		return true, nil
+	}
+	if def.TemplateFilter {
+		keys, err := c.keyFilter([]string{key}, def.Filter, true)
+		return len(keys) == 1, err
+	}
+	q, err := ParseQuery(def.Filter)
+	if err != nil {
+		return false, err
+	}
+	return q.Match(obj), nil
+}
+
+// liveUpdate updates a frame's row for a changed object, obj is nil
+// when the object was deleted. New rows are added to the end of the
+// frame. The frame's rows needn't have been read.
+func (c *Collection) liveUpdate(f *DataFrame, key string, obj map[string]interface{}) error {
+	member := false
+	if obj != nil {
+		ok, err := c.liveMember(f, key, obj)
+		if err != nil {
+			return err
+		}
+		member = ok
+	}
+	switch {
+	case member:
+		// NOTE: like FrameCreate missing dotpaths are left out of the row
+		row, _ := frameObject(key, obj, f.DotPaths, f.Labels)
+		f.coerceRow(key, row, false)
+		f.widenTypes(row)
+		f.ObjectMap[key] = row
+		f.appendKey(key)
+	case f.keyPosition(key) >= 0:
+		delete(f.ObjectMap, key)
+		f.removeKey(key)
+	}
+	return nil
+}
+
+// liveObjectChanged updates the live frames for a changed object,
+// obj is nil when the object was deleted. The caller holds the
+// collection's lock. The object is already saved so an immediate
+// frame that can't be updated gets the key in its pending list
+// instead, it is applied the next time the frame is read.
+func (c *Collection) liveObjectChanged(key string, obj map[string]interface{}) {
+	for name, mode := range c.LiveFrames {
+		if c.hasFrame(name) == false {
+			continue
+		}
+		var err error
+		if mode == LiveDeferred {
+			err = c.addPending(name, key)
+		} else if err = c.liveImmediate(name, key, obj); err != nil {
+			delete(c.liveCache, name)
+			log.Printf("WARNING %s, can't update live frame %s, %s", c.Name, name, err)
+			err = c.addPending(name, key)
+		}
+		if err != nil {
+			log.Printf("WARNING %s, live frame %s is out of date, %s", c.Name, name, err)
+		}
+	}
+}
+
+// liveImmediate updates an immediate live frame's row for a key
+func (c *Collection) liveImmediate(name string, key string, obj map[string]interface{}) error {
+	f, err := c.getLiveFrame(name)
+	if err != nil {
+		return err
+	}
+	if err := c.liveUpdate(f, key, obj); err != nil {
+		return err
+	}
+	f.Updated = time.Now()
+	if err := c.setFrameRows(name, f, []string{key}); err != nil {
+		return err
+	}
+	c.keepLiveFrame(name, f)
+	return c.queueSearchIndexes(f, []string{key})
+}
+
+// addPending adds a key to a deferred frame's pending list
+func (c *Collection) addPending(name string, key string) error {
+	return c.appendToFile(c.pendingPath(name), []byte(key+"\n"))
+}
+
+// applyPending brings a deferred frame up to date with the objects
+// changed since it was last read, the caller holds the collection's
+// lock
+func (c *Collection) applyPending(name string, f *DataFrame) error {
+	pending := c.pendingPath(name)
+	if c.Store.IsFile(pending) == false {
+		return nil
+	}
+	src, err := c.Store.ReadFile(pending)
+	if err != nil {
+		return err
+	}
+	keys, seen := []string{}, map[string]bool{}
+	for _, key := range strings.Split(string(src), "\n") {
+		if key = strings.TrimSpace(key); key != "" && seen[key] == false {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	for _, key := range keys {
+		var obj map[string]interface{}
+		if c.KeyExists(key) {
+			obj = map[string]interface{}{}
+			if err := c.Read(key, obj, false); err != nil {
+				return err
+			}
+		}
+		if err := c.liveUpdate(f, key, obj); err != nil {
+			return err
+		}
+	}
+	f.compactKeys()
+	f.Updated = time.Now()
+	if err := c.setFrameRows(name, f, keys); err != nil {
+		return err
+	}
+	if err := c.Store.Remove(pending); err != nil {
+		return err
+	}
+	return c.updateSearchIndexes(f, keys)
+}
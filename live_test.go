@@ -0,0 +1,224 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLiveFrames(t *testing.T) {
+	cName := path.Join("testdata", "live_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	for key, src := range map[string]string{
+		"a": `{"title": "Alpha", "status": "published"}`,
+		"b": `{"title": "Beta", "status": "draft"}`,
+	} {
+		if err := c.CreateJSON(key, []byte(src)); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	def := &FrameDefinition{AllKeys: true, Filter: `.status == "published"`, Sort: ".title"}
+	for _, name := range []string{"now", "later"} {
+		if _, err := c.FrameDefine(name, def, []string{".title"}, []string{"title"}, false); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	if err := c.FrameLive("now", LiveImmediate); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameLive("later", LiveDeferred); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.FrameLive("now", "sometimes"); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+
+	// frameTitles returns the frame's titles in order, reading the
+	// frame file directly doesn't apply pending changes
+	frameTitles := func(name string) string {
+		f, err := c.FrameRead(name)
+		if err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+		titles := []string{}
+		for _, obj := range f.Objects() {
+			titles = append(titles, obj["title"].(string))
+		}
+		return strings.Join(titles, ",")
+	}
+	pendingExists := func(name string) bool {
+		return c.Store.IsFile(c.pendingPath(name))
+	}
+
+	// Objects enter, change and leave the frame by its filter
+	if err := c.CreateJSON("c", []byte(`{"title": "Gamma", "status": "published"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.UpdateJSON("b", []byte(`{"title": "Beta", "status": "published"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Join("a", map[string]interface{}{"title": "Alpha 2"}, true); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.UpdateJSON("c", []byte(`{"title": "Gamma", "status": "withdrawn"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if pendingExists("later") == false {
+		t.Errorf("expected pending changes for the deferred frame")
+	}
+	if s := frameTitles("now"); s != "Alpha 2,Beta" {
+		t.Errorf("expected Alpha 2,Beta, got %s", s)
+	}
+	if s := frameTitles("later"); s != "Alpha 2,Beta" {
+		t.Errorf("expected Alpha 2,Beta, got %s", s)
+	}
+	if pendingExists("later") {
+		t.Errorf("expected pending changes to be applied on read")
+	}
+
+	// Deleted objects leave the frame, undeleted ones return
+	if err := c.Delete("a"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if s := frameTitles("now"); s != "Beta" {
+		t.Errorf("expected Beta, got %s", s)
+	}
+	if s := frameTitles("later"); s != "Beta" {
+		t.Errorf("expected Beta, got %s", s)
+	}
+	if err := c.Undelete("a"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if s := frameTitles("now"); s != "Beta,Alpha 2" {
+		t.Errorf("expected Beta,Alpha 2, got %s", s)
+	}
+
+	// Changes made by another handle aren't lost by the frame kept
+	// in memory between writes
+	c2, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c2.CreateJSON("e", []byte(`{"title": "Epsilon", "status": "published"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c2.Close()
+	if err := c.UpdateJSON("b", []byte(`{"title": "Beta 2", "status": "published"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if s := frameTitles("now"); s != "Beta 2,Alpha 2,Epsilon" {
+		t.Errorf("expected Beta 2,Alpha 2,Epsilon, got %s", s)
+	}
+
+	// Search indexes queue live changes until the next search
+	indexPath := path.Join("testdata", "live_test.idx")
+	os.RemoveAll(indexPath)
+	if err := c.IndexFrame("now", indexPath); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.CreateJSON("f", []byte(`{"title": "Zeta", "status": "published"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Delete("a"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if _, err := os.Stat(path.Join(indexPath, searchIndexPending)); err != nil {
+		t.Errorf("expected queued search index changes, %s", err)
+	}
+	for query, expected := range map[string]string{"zeta": "f", "alpha": ""} {
+		result, err := c.Search(indexPath, query, nil)
+		if err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+		keys := []string{}
+		for _, hit := range result.Hits {
+			keys = append(keys, hit.Key)
+		}
+		if s := strings.Join(keys, ","); s != expected {
+			t.Errorf("expected %q for %s, got %q", expected, query, s)
+		}
+	}
+	if _, err := os.Stat(path.Join(indexPath, searchIndexPending)); err == nil {
+		t.Errorf("expected queued search index changes to be applied")
+	}
+	if s := frameTitles("now"); s != "Beta 2,Epsilon,Zeta" {
+		t.Errorf("expected Beta 2,Epsilon,Zeta, got %s", s)
+	}
+
+	// A frame that stops being live is left alone, even after the
+	// collection is reopened
+	if err := c.FrameLive("now", ""); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c.Close()
+	c, err = openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	if c.LiveFrames["later"] != LiveDeferred || c.LiveFrames["now"] != "" {
+		t.Errorf("unexpected live frames %+v", c.LiveFrames)
+	}
+	if err := c.CreateJSON("d", []byte(`{"title": "Delta", "status": "published"}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if s := frameTitles("now"); s != "Beta 2,Epsilon,Zeta" {
+		t.Errorf("expected Beta 2,Epsilon,Zeta, got %s", s)
+	}
+	if s := frameTitles("later"); s != "Beta 2,Epsilon,Zeta,Delta" {
+		t.Errorf("expected Beta 2,Epsilon,Zeta,Delta, got %s", s)
+	}
+	if err := c.FrameDelete("later"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if _, ok := c.LiveFrames["later"]; ok {
+		t.Errorf("expected a deleted frame to stop being live")
+	}
+}
@@ -0,0 +1,198 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: lock.go provides advisory locking between processes sharing
+// a collection on local disc. The mutexes in Collection only protect
+// goroutines in the same process. Readers take a shared lock,
+// writers an exclusive one. The holder's pid is written to the lock
+// file so a waiting process can report who holds it.
+//
+// Collection.lock() isn't reentrant. Exported methods that write take
+// it once and call unexported helpers (e.g. createJSON, updateJSON,
+// setFrame, saveMetadata) which expect the caller to hold it.
+//
+
+const (
+	// lockName is the lock file in the collection's root
+	lockName = "_lock"
+
+	// lockRetryInterval is how long we sleep between attempts
+	// to take a lock
+	lockRetryInterval = 25 * time.Millisecond
+)
+
+// LockTimeout is how long to wait for another process to release
+// a collection before giving up with an error.
+var LockTimeout = 10 * time.Second
+
+// fileLock is an advisory lock held on a collection's lock file
+type fileLock struct {
+	fName     string
+	fp        *os.File
+	exclusive bool
+}
+
+// acquireLock takes a shared or exclusive lock on the collection
+// at workPath waiting up to LockTimeout. Only local disc is locked,
+// for other stores a nil lock is returned.
+func acquireLock(store *storage.Store, workPath string, exclusive bool) (*fileLock, error) {
+	if store == nil || store.Type != storage.FS {
+		return nil, nil
+	}
+	l := new(fileLock)
+	l.fName = path.Join(workPath, lockName)
+	l.exclusive = exclusive
+	if store.IsDir(workPath) == false {
+		// Nothing to lock yet
+		return nil, nil
+	}
+	fp, err := os.OpenFile(l.fName, os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil && exclusive == false {
+		// NOTE: readers may not be able to write in the collection,
+		// a read only lock file still works for a shared lock.
+		fp, err = os.Open(l.fName)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Can't open lock file, %s", err)
+	}
+	l.fp = fp
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		ok, err := tryLockFile(fp, exclusive)
+		if err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("Can't lock %s, %s", workPath, err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			fp.Close()
+			return nil, &LockError{Collection: path.Base(workPath), PID: lockHolder(l.fName)}
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	// Record who holds the lock, it is informational only
+	if err := fp.Truncate(0); err == nil {
+		fp.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	return l, nil
+}
+
+// release gives up the lock
+func (l *fileLock) release() error {
+	if l == nil || l.fp == nil {
+		return nil
+	}
+	err := unlockFile(l.fp)
+	if cErr := l.fp.Close(); err == nil {
+		err = cErr
+	}
+	l.fp = nil
+	return err
+}
+
+// lockHolder returns the pid recorded in a lock file or zero
+func lockHolder(fName string) int {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(src)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// collectionLock serializes the writers of a collection, the mutex
+// orders goroutines in this process and the file lock other processes.
+type collectionLock struct {
+	mutex sync.Mutex
+	lock  *fileLock
+}
+
+// lock takes an exclusive lock on the collection's lock file
+func (c *Collection) lock() error {
+	if c.fileLock == nil {
+		c.fileLock = new(collectionLock)
+	}
+	cl := c.fileLock
+	cl.mutex.Lock()
+	l, err := acquireLock(c.Store, c.workPath, true)
+	if err != nil {
+		cl.mutex.Unlock()
+		return err
+	}
+	cl.lock = l
+	c.refreshIndexes()
+	return nil
+}
+
+// refreshIndexes has the key index and dotpath indexes read again if
+// another process changed them before we took the lock
+func (c *Collection) refreshIndexes() {
+	if c.keyIndex != nil {
+		c.keyIndex.refresh()
+	}
+	for _, idx := range c.indexes {
+		idx.refresh()
+	}
+}
+
+// unlock releases a lock taken with lock()
+func (c *Collection) unlock() error {
+	cl := c.fileLock
+	if cl == nil {
+		return nil
+	}
+	l := cl.lock
+	cl.lock = nil
+	err := l.release()
+	cl.mutex.Unlock()
+	return err
+}
+
+// withLock calls fn holding the collection's lock
+func (c *Collection) withLock(fn func() error) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return fn()
+}
@@ -0,0 +1,130 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	cName := path.Join("testdata", "lock_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	saveTimeout := LockTimeout
+	LockTimeout = 100 * time.Millisecond
+	defer func() {
+		LockTimeout = saveTimeout
+	}()
+
+	// NOTE: flock is held per open file so a second lock in the same
+	// process behaves like another process holding it.
+	l, err := acquireLock(c.Store, c.workPath, true)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	expected := fmt.Sprintf("locked by pid %d", os.Getpid())
+	if _, err := openCollection(cName); err == nil || strings.Contains(err.Error(), expected) == false {
+		t.Errorf("expected %q error opening a locked collection, got %v", expected, err)
+	}
+	var lockErr *LockError
+	if err := c.withLock(c.saveMetadata); errors.Is(err, ErrCollectionLocked) == false {
+		t.Errorf("expected ErrCollectionLocked saving metadata for a locked collection, got %v", err)
+	} else if errors.As(err, &lockErr) == false || lockErr.PID != os.Getpid() {
+		t.Errorf("expected *LockError held by pid %d, got %v", os.Getpid(), err)
+	}
+	l.release()
+
+	// Shared locks don't block each other
+	l, err = acquireLock(c.Store, c.workPath, false)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c2, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("expected to open with a shared lock held, %s", err)
+		t.FailNow()
+	}
+	defer c2.Close()
+	if err := c.withLock(c.saveMetadata); err == nil {
+		t.Errorf("expected an error saving metadata while a shared lock is held")
+	}
+	l.release()
+
+	// Frames saved by one handle survive metadata saved by another
+	if err := c.Create("one", map[string]interface{}{"name": "one"}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if _, err := c.FrameCreate("f1", []string{"one"}, []string{".name"}, []string{"name"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if _, err := c2.FrameCreate("f2", []string{"one"}, []string{".name"}, []string{"name"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	c3, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c3.Close()
+	if c3.FrameExists("f1") == false || c3.FrameExists("f2") == false {
+		t.Errorf("expected frames f1 and f2, got %+v", c3.Frames())
+	}
+
+	// Another goroutine waits for the lock
+	if err := c.lock(); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	locked := make(chan bool)
+	go func() {
+		if err := c.lock(); err != nil {
+			t.Errorf("%s", err)
+		}
+		c.unlock()
+		locked <- true
+	}()
+	select {
+	case <-locked:
+		t.Errorf("expected goroutine to wait while the lock is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Errorf("expected goroutine to take the lock once released")
+	}
+}
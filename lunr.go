@@ -0,0 +1,243 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+//
+// NOTE: lunr.go renders a frame as a Lunr.js (version 2) serialized
+// index and a document store so a collection published on static
+// hosting can be searched in the browser. The index is loaded with
+// lunr.Index.load(). Scores are computed with BM25 as lunr's Builder
+// does, field boosts are applied when the index is built. The
+// serialized search pipeline is empty so query terms are matched as
+// typed (lower cased) rather than stemmed.
+//
+
+const (
+	// lunrVersion is the Lunr.js version the index is compatible with
+	lunrVersion = "2.3.9"
+
+	// BM25 tuning parameters, the Lunr.js defaults
+	lunrK1 = 1.2
+	lunrB  = 0.75
+)
+
+// LunrOptions controls the index and store built by LunrIndex
+type LunrOptions struct {
+	// Fields are the frame labels to index, all labels if empty
+	Fields []string `json:"fields,omitempty"`
+	// Store are the frame labels kept in the document store,
+	// the indexed fields if empty
+	Store []string `json:"store,omitempty"`
+	// Boosts maps a field to a multiplier of its scores
+	Boosts map[string]float64 `json:"boosts,omitempty"`
+}
+
+// LunrBundle holds a Lunr.js serialized index and a document store
+type LunrBundle struct {
+	// Index is passed to lunr.Index.load()
+	Index *LunrSerializedIndex `json:"index"`
+	// Store maps a key to the stored fields of its frame object
+	Store map[string]map[string]interface{} `json:"store"`
+}
+
+// LunrSerializedIndex is the JSON form of a lunr.Index
+type LunrSerializedIndex struct {
+	Version       string          `json:"version"`
+	Fields        []string        `json:"fields"`
+	FieldVectors  [][]interface{} `json:"fieldVectors"`
+	InvertedIndex [][]interface{} `json:"invertedIndex"`
+	Pipeline      []string        `json:"pipeline"`
+}
+
+// lunrTokenize splits text into terms the way Lunr.js does, on spaces
+// and hyphens, then lower cases them and trims leading and trailing
+// punctuation.
+func lunrTokenize(text string) []string {
+	terms := []string{}
+	for _, s := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-'
+	}) {
+		s = strings.TrimFunc(s, func(r rune) bool {
+			return unicode.IsLetter(r) == false && unicode.IsDigit(r) == false
+		})
+		if s != "" {
+			terms = append(terms, s)
+		}
+	}
+	return terms
+}
+
+// lessUTF16 compares strings as JavaScript does, by UTF-16 code units.
+// Lunr.js requires the inverted index to be in this order.
+func lessUTF16(a string, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// LunrIndex builds a Lunr.js index and document store from a frame's
+// objects. opts may be nil.
+func (c *Collection) LunrIndex(frameName string, opts *LunrOptions) (*LunrBundle, error) {
+	f, err := c.getFrame(frameName)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = new(LunrOptions)
+	}
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = f.Labels
+	}
+	stored := opts.Store
+	if len(stored) == 0 {
+		stored = fields
+	}
+	for _, label := range append(append([]string{}, fields...), stored...) {
+		found := false
+		for _, l := range f.Labels {
+			if l == label {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			return nil, fmt.Errorf("%q is not a label in frame %s", label, frameName)
+		}
+	}
+
+	// Tokenize each field of each object counting terms
+	type fieldDoc struct {
+		ref    string
+		field  string
+		length int
+		counts map[string]int
+	}
+	fieldDocs := []*fieldDoc{}
+	postings := map[string]map[string]map[string]bool{}
+	totalLength := map[string]int{}
+	store := map[string]map[string]interface{}{}
+	for _, key := range f.Keys {
+		obj, ok := f.ObjectMap[key].(map[string]interface{})
+		if ok == false {
+			continue
+		}
+		for _, field := range fields {
+			fd := &fieldDoc{ref: key, field: field, counts: map[string]int{}}
+			for _, term := range lunrTokenize(searchText(obj[field])) {
+				fd.counts[term]++
+				fd.length++
+				if postings[term] == nil {
+					postings[term] = map[string]map[string]bool{}
+				}
+				if postings[term][field] == nil {
+					postings[term][field] = map[string]bool{}
+				}
+				postings[term][field][key] = true
+			}
+			totalLength[field] += fd.length
+			fieldDocs = append(fieldDocs, fd)
+		}
+		doc := map[string]interface{}{}
+		for _, label := range stored {
+			if value, ok := obj[label]; ok {
+				doc[label] = value
+			}
+		}
+		store[key] = doc
+	}
+	docCount := len(store)
+
+	// The inverted index is sorted by term, a term's position is its index
+	terms := make([]string, 0, len(postings))
+	for term := range postings {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool { return lessUTF16(terms[i], terms[j]) })
+	termIndex := map[string]int{}
+	idf := map[string]float64{}
+	invertedIndex := make([][]interface{}, 0, len(terms))
+	for i, term := range terms {
+		termIndex[term] = i
+		posting := map[string]interface{}{"_index": i}
+		withTerm := 0
+		for _, field := range fields {
+			refs := map[string]interface{}{}
+			for ref := range postings[term][field] {
+				refs[ref] = map[string]interface{}{}
+			}
+			withTerm += len(refs)
+			posting[field] = refs
+		}
+		x := (float64(docCount-withTerm) + 0.5) / (float64(withTerm) + 0.5)
+		idf[term] = math.Log(1 + math.Abs(x))
+		invertedIndex = append(invertedIndex, []interface{}{term, posting})
+	}
+
+	// Score each term of each field with BM25
+	fieldVectors := make([][]interface{}, 0, len(fieldDocs))
+	for _, fd := range fieldDocs {
+		boost, ok := opts.Boosts[fd.field]
+		if ok == false {
+			boost = 1
+		}
+		avgLength := 1.0
+		if docCount > 0 && totalLength[fd.field] > 0 {
+			avgLength = float64(totalLength[fd.field]) / float64(docCount)
+		}
+		indexes := []int{}
+		for term := range fd.counts {
+			indexes = append(indexes, termIndex[term])
+		}
+		sort.Ints(indexes)
+		vector := make([]float64, 0, 2*len(indexes))
+		for _, i := range indexes {
+			tf := float64(fd.counts[terms[i]])
+			score := idf[terms[i]] * ((lunrK1 + 1) * tf) /
+				(lunrK1*(1-lunrB+lunrB*(float64(fd.length)/avgLength)) + tf)
+			score = math.Round(score*boost*1000) / 1000
+			vector = append(vector, float64(i), score)
+		}
+		fieldVectors = append(fieldVectors, []interface{}{fd.field + "/" + fd.ref, vector})
+	}
+
+	return &LunrBundle{
+		Index: &LunrSerializedIndex{
+			Version:       lunrVersion,
+			Fields:        append([]string{}, fields...),
+			FieldVectors:  fieldVectors,
+			InvertedIndex: invertedIndex,
+			Pipeline:      []string{},
+		},
+		Store: store,
+	}, nil
+}
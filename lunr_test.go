@@ -0,0 +1,159 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLunrTokenize(t *testing.T) {
+	expected := []string{"climate", "and", "coasts", "o'brien", "sea", "level", "2019"}
+	result := lunrTokenize(`Climate and "Coasts", O'Brien sea-level (2019)`)
+	if len(result) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+	for i, term := range expected {
+		if result[i] != term {
+			t.Errorf("expected %q, got %q", expected, result)
+			break
+		}
+	}
+	// Go orders strings by UTF-8 bytes, JavaScript by UTF-16 code units
+	if lessUTF16("\U0001F600", "\uffff") == false {
+		t.Errorf("expected U+1F600 to sort before U+FFFF by UTF-16 code units")
+	}
+}
+
+func TestLunrIndex(t *testing.T) {
+	cName := path.Join("testdata", "lunr_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	records := map[string]map[string]interface{}{
+		"p1": {"title": "Climate and Coasts", "authors": []interface{}{"Doe", "Smith"}, "link": "p1.html"},
+		"p2": {"title": "Changes in the climate", "authors": []interface{}{"Roe"}, "link": "p2.html"},
+		"p3": {"title": "Coastal birds", "authors": []interface{}{"Smith"}, "link": "p3.html"},
+	}
+	keys := []string{"p1", "p2", "p3"}
+	for _, key := range keys {
+		if err := c.Create(key, records[key]); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	if _, err := c.FrameCreate("pubs", keys, []string{".title", ".authors", ".link"}, []string{"title", "author", "link"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+
+	if _, err := c.LunrIndex("pubs", &LunrOptions{Fields: []string{"abstract"}}); err == nil {
+		t.Errorf("expected an error for a label not in the frame")
+	}
+
+	idx, err := c.LunrIndex("pubs", &LunrOptions{
+		Fields: []string{"title", "author"},
+		Store:  []string{"title", "link"},
+		Boosts: map[string]float64{"title": 10},
+	})
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	si := idx.Index
+	if si.Version != lunrVersion || len(si.Fields) != 2 || len(si.Pipeline) != 0 {
+		t.Errorf("unexpected index header %+v", si)
+	}
+	// Lunr.js requires the inverted index in term order
+	terms := map[string]int{}
+	for i, entry := range si.InvertedIndex {
+		term := entry[0].(string)
+		if i > 0 && lessUTF16(term, si.InvertedIndex[i-1][0].(string)) {
+			t.Errorf("inverted index out of order at %q", term)
+		}
+		posting := entry[1].(map[string]interface{})
+		if posting["_index"] != i {
+			t.Errorf("expected _index %d for %q, got %v", i, term, posting["_index"])
+		}
+		terms[term] = i
+	}
+	climate := si.InvertedIndex[terms["climate"]][1].(map[string]interface{})
+	if refs := climate["title"].(map[string]interface{}); len(refs) != 2 || refs["p1"] == nil || refs["p2"] == nil {
+		t.Errorf("expected climate in titles of p1 and p2, got %+v", refs)
+	}
+	if refs := climate["author"].(map[string]interface{}); len(refs) != 0 {
+		t.Errorf("expected climate in no authors, got %+v", refs)
+	}
+	if _, ok := terms["p1.html"]; ok {
+		t.Errorf("expected link not to be indexed")
+	}
+
+	// One vector per field per document, title scores are boosted
+	vectors := map[string][]float64{}
+	for _, fv := range si.FieldVectors {
+		vectors[fv[0].(string)] = fv[1].([]float64)
+	}
+	if len(vectors) != 6 {
+		t.Errorf("expected 6 field vectors, got %d", len(vectors))
+	}
+	score := func(ref string, term string) float64 {
+		v := vectors[ref]
+		for i := 0; i+1 < len(v); i += 2 {
+			if int(v[i]) == terms[term] {
+				return v[i+1]
+			}
+		}
+		return 0
+	}
+	if title, author := score("title/p3", "smith"), score("author/p3", "smith"); title != 0 || author <= 0 {
+		t.Errorf("expected smith only in p3's author, got %f, %f", title, author)
+	}
+	if title, author := score("title/p3", "birds"), score("author/p1", "smith"); title <= author {
+		t.Errorf("expected boosted title score %f > author score %f", title, author)
+	}
+
+	if len(idx.Store) != 3 {
+		t.Errorf("expected 3 stored documents, got %d", len(idx.Store))
+	}
+	if doc := idx.Store["p2"]; doc["title"] != "Changes in the climate" || doc["link"] != "p2.html" || doc["author"] != nil {
+		t.Errorf("unexpected stored document %+v", doc)
+	}
+
+	// The package level function opens the collection and the
+	// result must encode as JSON
+	c.Close()
+	idx, err = LunrIndex(cName, "pubs", nil)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(idx.Index.Fields) != 3 {
+		t.Errorf("expected all the frame's labels indexed, got %q", idx.Index.Fields)
+	}
+	if _, err := json.Marshal(idx); err != nil {
+		t.Errorf("%s", err)
+	}
+}
@@ -0,0 +1,352 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// NOTE: patch.go applies RFC 6902 JSON Patch and RFC 7396 JSON Merge
+// Patch documents to stored objects. A JSON array is treated as a
+// JSON Patch, a JSON object as a Merge Patch. The object's "_Key" and
+// "_Attachments" are restored after patching so a patch can't change
+// them.
+//
+
+// patchOperation is a single RFC 6902 operation
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into reference tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return []string{}, nil
+	}
+	if strings.HasPrefix(p, "/") == false {
+		return nil, fmt.Errorf("invalid JSON pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, tok := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(tok, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex converts a reference token to an array position, size
+// is the array's length and the largest position allowed.
+func arrayIndex(tok string, size int) (int, error) {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return -1, fmt.Errorf("invalid array index %q", tok)
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || i > size {
+		return -1, fmt.Errorf("array index %q out of range", tok)
+	}
+	return i, nil
+}
+
+// pointerGet returns the value at the location of tokens in doc
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, tok := range tokens {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			val, ok := v[tok]
+			if ok == false {
+				return nil, fmt.Errorf("%q not found", tok)
+			}
+			doc = val
+		case []interface{}:
+			i, err := arrayIndex(tok, len(v)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("%q not found", tok)
+		}
+	}
+	return doc, nil
+}
+
+// pointerSet applies fn to the parent container of the last token
+// and returns the updated document. Arrays are replaced by the
+// updated slice in their own parent.
+func pointerSet(doc interface{}, tokens []string, fn func(parent interface{}, tok string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	child, err := pointerGet(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerSet(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		v[tokens[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(tokens[0], len(v)-1)
+		v[i] = child
+	}
+	return doc, nil
+}
+
+// patchAdd implements the "add" operation
+func patchAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerSet(doc, tokens, func(parent interface{}, tok string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			v[tok] = value
+			return v, nil
+		case []interface{}:
+			i := len(v)
+			if tok != "-" {
+				var err error
+				if i, err = arrayIndex(tok, len(v)); err != nil {
+					return nil, err
+				}
+			}
+			v = append(v, nil)
+			copy(v[i+1:], v[i:])
+			v[i] = value
+			return v, nil
+		}
+		return nil, fmt.Errorf("can't add %q to a %T", tok, parent)
+	})
+}
+
+// patchRemove implements the "remove" operation
+func patchRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("can't remove the whole document")
+	}
+	return pointerSet(doc, tokens, func(parent interface{}, tok string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := v[tok]; ok == false {
+				return nil, fmt.Errorf("%q not found", tok)
+			}
+			delete(v, tok)
+			return v, nil
+		case []interface{}:
+			i, err := arrayIndex(tok, len(v)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(v[:i], v[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%q not found", tok)
+	})
+}
+
+// patchReplace implements the "replace" operation
+func patchReplace(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if _, err := pointerGet(doc, tokens); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerSet(doc, tokens, func(parent interface{}, tok string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			v[tok] = value
+			return v, nil
+		case []interface{}:
+			i, _ := arrayIndex(tok, len(v)-1)
+			v[i] = value
+			return v, nil
+		}
+		return nil, fmt.Errorf("%q not found", tok)
+	})
+}
+
+// copyValue returns a deep copy of a decoded JSON value
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = copyValue(val)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, val := range v {
+			a[i] = copyValue(val)
+		}
+		return a
+	}
+	return value
+}
+
+// applyJSONPatch applies an RFC 6902 JSON Patch document to doc
+func applyJSONPatch(doc interface{}, patchSrc []byte) (interface{}, error) {
+	ops := []*patchOperation{}
+	if err := json.Unmarshal(patchSrc, &ops); err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, fmt.Errorf("operation %d, missing path", i)
+		}
+		tokens, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d, %s", i, err)
+		}
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d, missing value", i)
+			}
+			if err := decodeJSON(*op.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d, %s", i, err)
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, fmt.Errorf("operation %d, missing from", i)
+			}
+			from, err := parsePointer(*op.From)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d, %s", i, err)
+			}
+			if value, err = pointerGet(doc, from); err != nil {
+				return nil, fmt.Errorf("operation %d, %s", i, err)
+			}
+			if op.Op == "move" {
+				if strings.HasPrefix(*op.Path+"/", *op.From+"/") && *op.Path != *op.From {
+					return nil, fmt.Errorf("operation %d, can't move a value into itself", i)
+				}
+				if doc, err = patchRemove(doc, from); err != nil {
+					return nil, fmt.Errorf("operation %d, %s", i, err)
+				}
+			} else {
+				value = copyValue(value)
+			}
+		}
+		switch op.Op {
+		case "add", "move", "copy":
+			doc, err = patchAdd(doc, tokens, value)
+		case "remove":
+			doc, err = patchRemove(doc, tokens)
+		case "replace":
+			doc, err = patchReplace(doc, tokens, value)
+		case "test":
+			current, e := pointerGet(doc, tokens)
+			if e != nil {
+				err = e
+			} else if jsonEqual(current, value) == false {
+				err = fmt.Errorf("test failed for %q", *op.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d, %s", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyMergePatch applies an RFC 7396 JSON Merge Patch to doc
+func applyMergePatch(doc interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if ok == false {
+		return patch
+	}
+	target, ok := doc.(map[string]interface{})
+	if ok == false {
+		target = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(target, k)
+		} else {
+			target[k] = applyMergePatch(target[k], v)
+		}
+	}
+	return target
+}
+
+// Patch applies a patch document to the object stored under key.
+// If patchSrc is a JSON array it is applied as an RFC 6902 JSON
+// Patch, if it is a JSON object as an RFC 7396 JSON Merge Patch.
+// The object's "_Key" and "_Attachments" are left unchanged.
+func (c *Collection) Patch(key string, patchSrc []byte) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	src, err := c.ReadJSON(key)
+	if err != nil {
+		return err
+	}
+	var original map[string]interface{}
+	if err := DecodeJSON(src, &original); err != nil {
+		return err
+	}
+	var doc interface{} = copyValue(original)
+	patchSrc = bytes.TrimSpace(patchSrc)
+	switch {
+	case bytes.HasPrefix(patchSrc, []byte("[")):
+		doc, err = applyJSONPatch(doc, patchSrc)
+		if err != nil {
+			return fmt.Errorf("patch %q, %s", key, err)
+		}
+	case bytes.HasPrefix(patchSrc, []byte("{")):
+		var patch interface{}
+		if err := decodeJSON(patchSrc, &patch); err != nil {
+			return err
+		}
+		doc = applyMergePatch(doc, patch)
+	default:
+		return fmt.Errorf("patch must be a JSON Patch array or JSON Merge Patch object")
+	}
+	obj, ok := doc.(map[string]interface{})
+	if ok == false {
+		return fmt.Errorf("patch %q, result is not a JSON object", key)
+	}
+	for _, attr := range []string{"_Key", "_Attachments"} {
+		if val, ok := original[attr]; ok {
+			obj[attr] = val
+		} else {
+			delete(obj, attr)
+		}
+	}
+	src, err = json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.updateJSON(key, src, "patch")
+}
@@ -0,0 +1,164 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	testData := []struct {
+		doc      string
+		patch    string
+		expected string
+		fail     bool
+	}{
+		// Examples from RFC 6902, Appendix A
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, false},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+			false,
+		},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, false},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, false},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, true},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, false},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, false},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"copy","from":"/~1","path":"/a"}]`, `{"/":9,"~1":10,"a":9}`, false},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, true},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/5","value":"qux"}]`, ``, true},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ``, true},
+		{`{"foo":"bar"}`, `[{"op":"bogus","path":"/foo"}]`, ``, true},
+	}
+	for i, test := range testData {
+		var doc, expected interface{}
+		if err := json.Unmarshal([]byte(test.doc), &doc); err != nil {
+			t.Errorf("(%d) %s", i, err)
+			continue
+		}
+		result, err := applyJSONPatch(doc, []byte(test.patch))
+		if test.fail {
+			if err == nil {
+				t.Errorf("(%d) expected an error, got %+v", i, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("(%d) %s", i, err)
+			continue
+		}
+		json.Unmarshal([]byte(test.expected), &expected)
+		if jsonEqual(result, expected) == false {
+			src, _ := json.Marshal(result)
+			t.Errorf("(%d) expected %s, got %s", i, test.expected, src)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// Examples from RFC 7396, Appendix A
+	testData := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for i, test := range testData {
+		var doc, patch, expected interface{}
+		json.Unmarshal([]byte(test.doc), &doc)
+		json.Unmarshal([]byte(test.patch), &patch)
+		json.Unmarshal([]byte(test.expected), &expected)
+		result := applyMergePatch(doc, patch)
+		if jsonEqual(result, expected) == false {
+			src, _ := json.Marshal(result)
+			t.Errorf("(%d) expected %s, got %s", i, test.expected, src)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	cName := path.Join("testdata", "patch_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	if err := c.Create("jane", map[string]interface{}{"name": "Jane", "age": 42}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.Patch("jane", []byte(`{"age":null,"email":"jane@example.org","_Key":"john"}`)); err != nil {
+		t.Errorf("%s", err)
+	}
+	obj := map[string]interface{}{}
+	c.Read("jane", obj, false)
+	if _, ok := obj["age"]; ok || obj["email"] != "jane@example.org" || obj["_Key"] != "jane" {
+		t.Errorf("unexpected object after merge patch, %+v", obj)
+	}
+
+	patch := `[{"op":"replace","path":"/name","value":"Janet"},{"op":"remove","path":"/_Key"}]`
+	if err := c.Patch("jane", []byte(patch)); err != nil {
+		t.Errorf("%s", err)
+	}
+	obj = map[string]interface{}{}
+	c.Read("jane", obj, false)
+	if obj["name"] != "Janet" || obj["_Key"] != "jane" {
+		t.Errorf("unexpected object after JSON patch, %+v", obj)
+	}
+
+	// A failed test leaves the object unchanged
+	patch = `[{"op":"replace","path":"/name","value":"Jan"},{"op":"test","path":"/name","value":"Janet"}]`
+	if err := c.Patch("jane", []byte(patch)); err == nil {
+		t.Errorf("expected failed test to return an error")
+	}
+	obj = map[string]interface{}{}
+	c.Read("jane", obj, false)
+	if obj["name"] != "Janet" {
+		t.Errorf("expected object unchanged, %+v", obj)
+	}
+
+	if err := c.Patch("jane", []byte(`[{"op":"replace","path":"","value":[1,2]}]`)); err == nil {
+		t.Errorf("expected an error replacing the object with an array")
+	}
+	if err := c.Patch("nobody", []byte(`{"a":1}`)); err == nil {
+		t.Errorf("expected an error patching a missing object")
+	}
+}
@@ -0,0 +1,137 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestContextOperations(t *testing.T) {
+	cName := path.Join("testdata", "progress_test.ds")
+	cloneName := path.Join("testdata", "progress_clone_test.ds")
+	os.RemoveAll(cName)
+	os.RemoveAll(cloneName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	keys := []string{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if err := c.Create(key, map[string]interface{}{"i": i}); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+		keys = append(keys, key)
+	}
+
+	// Progress is reported for each key
+	calls := 0
+	progress := func(op string, done int, total int) {
+		calls++
+		if op != "frame" || done != calls || total != len(keys) {
+			t.Errorf("unexpected progress %q %d of %d", op, done, total)
+		}
+	}
+	if _, err := c.FrameCreateContext(context.Background(), "f1", keys, []string{".i"}, []string{"i"}, false, progress); err != nil {
+		t.Errorf("%s", err)
+	}
+	if calls != len(keys) {
+		t.Errorf("expected %d progress calls, got %d", len(keys), calls)
+	}
+
+	// A cancelled frame isn't saved
+	ctx, cancel := context.WithCancel(context.Background())
+	stopAt := func(n int) ProgressFunc {
+		return func(op string, done int, total int) {
+			if done == n {
+				cancel()
+			}
+		}
+	}
+	if _, err := c.FrameCreateContext(ctx, "f2", keys, []string{".i"}, []string{"i"}, false, stopAt(3)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if c.FrameExists("f2") {
+		t.Errorf("expected cancelled frame not to be saved")
+	}
+
+	// A cancelled refresh leaves the frame unchanged
+	c.Update("k0", map[string]interface{}{"i": 100})
+	ctx, cancel = context.WithCancel(context.Background())
+	if err := c.FrameRefreshContext(ctx, "f1", keys, false, stopAt(1)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	f, _ := c.FrameRead("f1")
+	if o, ok := f.ObjectMap["k0"].(map[string]interface{}); ok == false || fmt.Sprintf("%v", o["i"]) != "0" {
+		t.Errorf("expected k0 unchanged in frame, got %+v", f.ObjectMap["k0"])
+	}
+
+	// A cancelled clone keeps the objects copied so far
+	ctx, cancel = context.WithCancel(context.Background())
+	if err := c.CloneContext(ctx, cloneName, keys, false, stopAt(4)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	clone, err := openCollection(cloneName)
+	if err != nil {
+		t.Errorf("%s", err)
+	} else if clone.Length() != 4 {
+		t.Errorf("expected 4 objects in cancelled clone, got %d", clone.Length())
+	}
+
+	// A cancelled import stops before the next row
+	ctx, cancel = context.WithCancel(context.Background())
+	csvSrc := "id,name\na,one\nb,two\nc,three\n"
+	rows := 0
+	_, err = c.ImportCSVContext(ctx, strings.NewReader(csvSrc), 0, true, false, false, func(op string, done int, total int) {
+		rows++
+		if rows == 1 {
+			cancel()
+		}
+	})
+	if err != context.Canceled || c.KeyExists("a") == false || c.KeyExists("b") {
+		t.Errorf("expected import to stop after one row, %v", err)
+	}
+
+	// A cancelled check or repair stops early
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := analyzerContext(ctx, cName, false, nil); err != context.Canceled {
+		t.Errorf("expected context.Canceled from analyzer, got %v", err)
+	}
+	if err := repairContext(ctx, cName, false, nil); err != context.Canceled {
+		t.Errorf("expected context.Canceled from repair, got %v", err)
+	}
+	checked := 0
+	if err := analyzerContext(context.Background(), cName, false, func(op string, done int, total int) {
+		checked = done
+	}); err != nil {
+		t.Errorf("%s", err)
+	}
+	if checked != c.Length() {
+		t.Errorf("expected %d keys checked, got %d", c.Length(), checked)
+	}
+}
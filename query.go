@@ -0,0 +1,924 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//
+// NOTE: query.go implements the query language KeyFilter uses to
+// select objects, e.g.
+//
+//     .year between 2005 and 2019 and any .authors (.family == "Doe")
+//
+// A query is compiled once by ParseQuery then matched against each
+// object. The grammar is
+//
+//     query   = and { "or" and }
+//     and     = unary { "and" unary }
+//     unary   = "not" unary | primary
+//     primary = "(" query ")"
+//             | "exists" DOTPATH
+//             | ("any" | "all") DOTPATH "(" query ")"
+//             | operand [ ("==" | "!=" | "<" | "<=" | ">" | ">=") operand
+//                       | ("=~" | "!~") STRING
+//                       | [ "not" ] "in" "[" [ literal { "," literal } ] "]"
+//                       | "contains" operand
+//                       | "between" operand "and" operand ]
+//     operand = DOTPATH | literal
+//     literal = STRING | NUMBER | "true" | "false" | "null"
+//
+// Inside "any" and "all" dotpaths are relative to each element of
+// the array, "." is the element itself. When a dotpath holds an array
+// a comparison is true if the array or any of its elements match.
+//
+
+// TemplateFilters makes KeyFilter read filter expressions as Go
+// template expressions (e.g. `(eq .year 2019)`), the syntax used
+// before the query language.
+var TemplateFilters = false
+
+// Query is a compiled query expression
+type Query struct {
+	src  string
+	root queryNode
+}
+
+// queryNode is a compiled part of a query
+type queryNode interface {
+	eval(root interface{}) bool
+}
+
+// queryOperand is a dotpath or a literal value
+type queryOperand struct {
+	dotPath string
+	literal interface{}
+}
+
+type queryAnd []queryNode
+
+type queryOr []queryNode
+
+type queryNot struct {
+	term queryNode
+}
+
+type queryExists struct {
+	dotPath string
+}
+
+type queryQuantifier struct {
+	all     bool
+	dotPath string
+	cond    queryNode
+}
+
+type queryCompare struct {
+	op    string
+	left  queryOperand
+	right queryOperand
+}
+
+type queryMatch struct {
+	negate bool
+	left   queryOperand
+	re     *regexp.Regexp
+}
+
+type queryIn struct {
+	negate bool
+	left   queryOperand
+	values []interface{}
+}
+
+type queryContains struct {
+	left  queryOperand
+	right queryOperand
+}
+
+type queryBetween struct {
+	left queryOperand
+	low  queryOperand
+	high queryOperand
+}
+
+type queryTruth struct {
+	operand queryOperand
+}
+
+// value returns the operand's normalized value, nil if a dotpath
+// isn't found
+func (o queryOperand) value(root interface{}) interface{} {
+	switch o.dotPath {
+	case "":
+		return o.literal
+	case ".":
+		return normalizeQueryValue(root)
+	}
+	v, err := evalPath(o.dotPath, root)
+	if err != nil {
+		return nil
+	}
+	return normalizeQueryValue(v)
+}
+
+// normalizeQueryValue converts the numbers in a value to float64 so
+// values compare by number not representation
+func normalizeQueryValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, elem := range v {
+			a[i] = normalizeQueryValue(elem)
+		}
+		return a
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[key] = normalizeQueryValue(elem)
+		}
+		return m
+	case nil:
+		return nil
+	}
+	if v, ok := normalizeIndexValue(value); ok {
+		return v
+	}
+	return value
+}
+
+// queryEqual compares normalized values
+func queryEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// queryOrder orders normalized values of the same type, strings
+// holding dates are compared as dates. ok is false if the values
+// can't be ordered.
+func queryOrder(a interface{}, b interface{}) (int, bool) {
+	switch v := a.(type) {
+	case float64:
+		if w, ok := b.(float64); ok {
+			return compareIndexValues(v, w), true
+		}
+	case bool:
+		if w, ok := b.(bool); ok {
+			return compareIndexValues(v, w), true
+		}
+	case string:
+		if w, ok := b.(string); ok {
+			sa, sb := newSortValue(v), newSortValue(w)
+			if sa.kind == sortDate && sb.kind == sortDate {
+				return compareSortValues(sa, sb, nil), true
+			}
+			return strings.Compare(v, w), true
+		}
+	}
+	return 0, false
+}
+
+// queryAny returns true if fn is true for a and b or, when either is
+// an array, for any of their elements
+func queryAny(a interface{}, b interface{}, fn func(x interface{}, y interface{}) bool) bool {
+	if fn(a, b) {
+		return true
+	}
+	if l, ok := a.([]interface{}); ok {
+		for _, x := range l {
+			if fn(x, b) {
+				return true
+			}
+		}
+	}
+	if l, ok := b.([]interface{}); ok {
+		for _, y := range l {
+			if fn(a, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// elements returns a value followed by its elements if it is an array
+func elements(value interface{}) []interface{} {
+	values := []interface{}{value}
+	if l, ok := value.([]interface{}); ok {
+		values = append(values, l...)
+	}
+	return values
+}
+
+func (n queryAnd) eval(root interface{}) bool {
+	for _, term := range n {
+		if term.eval(root) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func (n queryOr) eval(root interface{}) bool {
+	for _, term := range n {
+		if term.eval(root) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *queryNot) eval(root interface{}) bool {
+	return n.term.eval(root) == false
+}
+
+func (n *queryExists) eval(root interface{}) bool {
+	if n.dotPath == "." {
+		return true
+	}
+	_, err := evalPath(n.dotPath, root)
+	return err == nil
+}
+
+func (n *queryQuantifier) eval(root interface{}) bool {
+	var value interface{} = root
+	if n.dotPath != "." {
+		v, err := evalPath(n.dotPath, root)
+		if err != nil {
+			return false
+		}
+		value = v
+	}
+	l, ok := value.([]interface{})
+	if ok == false {
+		return false
+	}
+	for _, elem := range l {
+		if n.cond.eval(elem) != n.all {
+			return n.all == false
+		}
+	}
+	return n.all
+}
+
+func (n *queryCompare) eval(root interface{}) bool {
+	a, b := n.left.value(root), n.right.value(root)
+	switch n.op {
+	case "==":
+		return queryAny(a, b, queryEqual)
+	case "!=":
+		return queryAny(a, b, queryEqual) == false
+	}
+	return queryAny(a, b, func(x interface{}, y interface{}) bool {
+		cmp, ok := queryOrder(x, y)
+		if ok == false {
+			return false
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		}
+		return cmp >= 0
+	})
+}
+
+func (n *queryMatch) eval(root interface{}) bool {
+	for _, v := range elements(n.left.value(root)) {
+		if s, ok := v.(string); ok && n.re.MatchString(s) {
+			return n.negate == false
+		}
+	}
+	return n.negate
+}
+
+func (n *queryIn) eval(root interface{}) bool {
+	a := n.left.value(root)
+	for _, v := range n.values {
+		if queryAny(a, v, queryEqual) {
+			return n.negate == false
+		}
+	}
+	return n.negate
+}
+
+func (n *queryContains) eval(root interface{}) bool {
+	a, b := n.left.value(root), n.right.value(root)
+	switch v := a.(type) {
+	case string:
+		s, ok := b.(string)
+		return ok && strings.Contains(v, s)
+	case []interface{}:
+		for _, elem := range v {
+			if queryEqual(elem, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n *queryBetween) eval(root interface{}) bool {
+	low, high := n.low.value(root), n.high.value(root)
+	for _, v := range elements(n.left.value(root)) {
+		lc, lok := queryOrder(v, low)
+		hc, hok := queryOrder(v, high)
+		if lok && hok && lc >= 0 && hc <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *queryTruth) eval(root interface{}) bool {
+	b, ok := n.operand.value(root).(bool)
+	return ok && b
+}
+
+//
+// Parsing
+//
+
+// query token kinds
+const (
+	tokEOF = iota
+	tokWord
+	tokDotpath
+	tokString
+	tokNumber
+	tokOp
+	tokPunct
+)
+
+// queryToken is a token of a query with its position
+type queryToken struct {
+	kind  int
+	text  string
+	value interface{}
+	pos   int
+}
+
+// queryParser holds the state of parsing a query
+type queryParser struct {
+	src    string
+	tokens []queryToken
+	i      int
+}
+
+// isQueryDelim returns true if r ends a word, a dotpath may hold
+// brackets and quotes (e.g. .authors[0], .a["b c"])
+func isQueryDelim(r rune, inDotpath bool) bool {
+	if inDotpath {
+		return unicode.IsSpace(r) || strings.ContainsRune("(),=!<>~", r)
+	}
+	return unicode.IsSpace(r) || strings.ContainsRune("()[],=!<>~\"", r)
+}
+
+// tokenizeQuery splits a query into tokens
+func tokenizeQuery(src string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case strings.ContainsRune("()[],", r):
+			tokens = append(tokens, queryToken{kind: tokPunct, text: string(r), pos: start})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || runes[i+1] == '~') {
+				op += string(runes[i+1])
+			}
+			switch op {
+			case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+			default:
+				return nil, &QueryError{Query: src, Pos: start, Msg: fmt.Sprintf("unknown operator %q", op)}
+			}
+			tokens = append(tokens, queryToken{kind: tokOp, text: op, pos: start})
+			i += len(op)
+		case r == '"':
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, &QueryError{Query: src, Pos: start, Msg: "unterminated string"}
+			}
+			i++
+			text := string(runes[start:i])
+			s := ""
+			if err := json.Unmarshal([]byte(text), &s); err != nil {
+				return nil, &QueryError{Query: src, Pos: start, Msg: fmt.Sprintf("invalid string %s", text)}
+			}
+			tokens = append(tokens, queryToken{kind: tokString, text: text, value: s, pos: start})
+		case strings.HasPrefix(string(runes[i:]), JMESPrefix):
+			// A JMESPath expression runs to a space, comma, closing
+			// parenthesis or operator outside of brackets and quotes
+			depth, quote := 0, rune(0)
+			for i < len(runes) {
+				c := runes[i]
+				if quote != 0 {
+					if c == quote {
+						quote = 0
+					}
+				} else if c == '\'' || c == '"' || c == '`' {
+					quote = c
+				} else if c == '[' || c == '{' || c == '(' {
+					depth++
+				} else if depth > 0 && (c == ']' || c == '}' || c == ')') {
+					depth--
+				} else if depth == 0 && isQueryDelim(c, true) {
+					break
+				}
+				i++
+			}
+			text := string(runes[start:i])
+			if err := checkPath(text); err != nil {
+				return nil, &QueryError{Query: src, Pos: start, Msg: err.Error()}
+			}
+			tokens = append(tokens, queryToken{kind: tokDotpath, text: text, pos: start})
+		default:
+			inDotpath, quoted := r == '.', false
+			for i < len(runes) && (quoted || isQueryDelim(runes[i], inDotpath) == false) {
+				if inDotpath && runes[i] == '"' {
+					quoted = !quoted
+				}
+				i++
+			}
+			text := string(runes[start:i])
+			switch {
+			case strings.HasPrefix(text, "."):
+				tokens = append(tokens, queryToken{kind: tokDotpath, text: text, pos: start})
+			case r == '-' || unicode.IsDigit(r):
+				f, err := strconv.ParseFloat(text, 64)
+				if err != nil {
+					return nil, &QueryError{Query: src, Pos: start, Msg: fmt.Sprintf("invalid number %q", text)}
+				}
+				tokens = append(tokens, queryToken{kind: tokNumber, text: text, value: f, pos: start})
+			default:
+				tokens = append(tokens, queryToken{kind: tokWord, text: text, pos: start})
+			}
+		}
+	}
+	return append(tokens, queryToken{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// errorf returns a *QueryError at the position of a token
+func (p *queryParser) errorf(tok queryToken, format string, args ...interface{}) error {
+	return &QueryError{Query: p.src, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.i]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the word or punctuation text
+func (p *queryParser) accept(kind int, text string) bool {
+	if tok := p.peek(); tok.kind == kind && tok.text == text {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// expect consumes the next token or returns an error
+func (p *queryParser) expect(kind int, text string) error {
+	if p.accept(kind, text) == false {
+		return p.errorf(p.peek(), "expected %q", text)
+	}
+	return nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	terms := queryOr{}
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.accept(tokWord, "or") == false {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	terms := queryAnd{}
+	for {
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.accept(tokWord, "and") == false {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.accept(tokWord, "not") {
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{term: term}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parseDotpath consumes a dotpath
+func (p *queryParser) parseDotpath() (string, error) {
+	tok := p.next()
+	if tok.kind != tokDotpath {
+		return "", p.errorf(tok, "expected a dotpath")
+	}
+	return tok.text, nil
+}
+
+// parseLiteral consumes a literal value
+func (p *queryParser) parseLiteral() (interface{}, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString, tokNumber:
+		return tok.value, nil
+	case tokWord:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, p.errorf(tok, "expected a value")
+}
+
+// parseOperand consumes a dotpath or literal
+func (p *queryParser) parseOperand() (queryOperand, error) {
+	if p.peek().kind == tokDotpath {
+		return queryOperand{dotPath: p.next().text}, nil
+	}
+	value, err := p.parseLiteral()
+	return queryOperand{literal: value}, err
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokPunct && tok.text == "(":
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(tokPunct, ")")
+	case tok.kind == tokWord && tok.text == "exists":
+		p.next()
+		dotPath, err := p.parseDotpath()
+		return &queryExists{dotPath: dotPath}, err
+	case tok.kind == tokWord && (tok.text == "any" || tok.text == "all"):
+		p.next()
+		dotPath, err := p.parseDotpath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokPunct, "("); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return &queryQuantifier{all: tok.text == "all", dotPath: dotPath, cond: cond}, p.expect(tokPunct, ")")
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	tok = p.peek()
+	switch {
+	case tok.kind == tokOp && (tok.text == "=~" || tok.text == "!~"):
+		p.next()
+		pattern := p.next()
+		if pattern.kind != tokString {
+			return nil, p.errorf(pattern, "expected a regular expression string")
+		}
+		re, err := regexp.Compile(pattern.value.(string))
+		if err != nil {
+			return nil, p.errorf(pattern, "%s", err)
+		}
+		return &queryMatch{negate: tok.text == "!~", left: left, re: re}, nil
+	case tok.kind == tokOp:
+		p.next()
+		right, err := p.parseOperand()
+		return &queryCompare{op: tok.text, left: left, right: right}, err
+	case tok.kind == tokWord && (tok.text == "in" || tok.text == "not"):
+		p.next()
+		negate := tok.text == "not"
+		if negate {
+			if err := p.expect(tokWord, "in"); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect(tokPunct, "["); err != nil {
+			return nil, err
+		}
+		values := []interface{}{}
+		for p.accept(tokPunct, "]") == false {
+			if len(values) > 0 {
+				if err := p.expect(tokPunct, ","); err != nil {
+					return nil, err
+				}
+			}
+			value, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return &queryIn{negate: negate, left: left, values: values}, nil
+	case tok.kind == tokWord && tok.text == "contains":
+		p.next()
+		right, err := p.parseOperand()
+		return &queryContains{left: left, right: right}, err
+	case tok.kind == tokWord && tok.text == "between":
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokWord, "and"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		return &queryBetween{left: left, low: low, high: high}, err
+	}
+	return &queryTruth{operand: left}, nil
+}
+
+// ParseQuery compiles a query expression. Syntax errors are returned
+// as a *QueryError.
+func ParseQuery(src string) (*Query, error) {
+	tokens, err := tokenizeQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{src: src, tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), "empty query")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+// String returns the query's source
+func (q *Query) String() string {
+	return q.src
+}
+
+// Match returns true if an object matches the query
+func (q *Query) Match(obj interface{}) bool {
+	return q.root.eval(obj)
+}
+
+//
+// Queries answered from indexes
+//
+
+// indexOps maps query comparisons to index lookups and the lookup
+// when the operands are swapped
+var indexOps = map[string][2]string{
+	"==": {"eq", "eq"},
+	"<":  {"lt", "gt"},
+	"<=": {"le", "ge"},
+	">":  {"gt", "lt"},
+	">=": {"ge", "le"},
+}
+
+// indexExact returns true if an index lookup of value matches the
+// query exactly. A string holding a number also matches numbers in
+// an index.
+func indexExact(value interface{}) bool {
+	s, ok := value.(string)
+	if ok == false {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err != nil
+}
+
+// indexDate returns true if value is a string holding a date. An
+// index orders strings by code point where a query orders dates as
+// dates so only the equality of dates is answered from an index.
+func indexDate(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && newSortValue(s).kind == sortDate
+}
+
+// indexLookup returns the keys of an indexed dotpath matching op and
+// value, ok is false if no index applies
+func (c *Collection) indexLookup(dotPath string, op string, value interface{}) ([]string, bool) {
+	if dotPath == "." || value == nil {
+		return nil, false
+	}
+	idx, err := c.getIndex(dotPath)
+	if err != nil {
+		return nil, false
+	}
+	keys, err := idx.lookup(op, value)
+	if err != nil {
+		return nil, false
+	}
+	return keys, true
+}
+
+// indexQueryTerm answers a term of a query from an index. ok is false
+// if no index applies, exact is false if the keys may include objects
+// not matching the term.
+func (c *Collection) indexQueryTerm(term queryNode) (keys []string, ok bool, exact bool) {
+	switch n := term.(type) {
+	case *queryCompare:
+		ops, found := indexOps[n.op]
+		if found == false {
+			return nil, false, false
+		}
+		left, right, op := n.left, n.right, ops[0]
+		if left.dotPath == "" {
+			left, right, op = right, left, ops[1]
+		}
+		if left.dotPath == "" || right.dotPath != "" {
+			return nil, false, false
+		}
+		if op != "eq" && indexDate(right.literal) {
+			return nil, false, false
+		}
+		keys, ok = c.indexLookup(left.dotPath, op, right.literal)
+		return keys, ok, indexExact(right.literal)
+	case *queryIn:
+		if n.negate || n.left.dotPath == "" {
+			return nil, false, false
+		}
+		exact, seen := true, map[string]bool{}
+		for _, value := range n.values {
+			found, ok := c.indexLookup(n.left.dotPath, "eq", value)
+			if ok == false {
+				return nil, false, false
+			}
+			for _, key := range found {
+				if seen[key] == false {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			exact = exact && indexExact(value)
+		}
+		return keys, true, exact
+	case *queryBetween:
+		if n.left.dotPath == "" || n.low.dotPath != "" || n.high.dotPath != "" {
+			return nil, false, false
+		}
+		if indexDate(n.low.literal) || indexDate(n.high.literal) {
+			return nil, false, false
+		}
+		low, ok := c.indexLookup(n.left.dotPath, "ge", n.low.literal)
+		if ok == false {
+			return nil, false, false
+		}
+		high, ok := c.indexLookup(n.left.dotPath, "le", n.high.literal)
+		if ok == false {
+			return nil, false, false
+		}
+		// An array may have one element above low and another below
+		// high so the objects are still checked
+		return intersectKeys(low, high), true, false
+	}
+	return nil, false, false
+}
+
+// indexQuery answers the indexed comparisons in a query, either the
+// whole query or the terms of a top level "and". It returns nil if no
+// index applies, complete is true if the whole query was answered.
+func (c *Collection) indexQuery(q *Query) (map[string]bool, bool) {
+	if len(c.IndexMap) == 0 {
+		return nil, false
+	}
+	terms := queryAnd{q.root}
+	if and, ok := q.root.(queryAnd); ok {
+		terms = and
+	}
+	var matched map[string]bool
+	complete := true
+	for _, term := range terms {
+		keys, ok, exact := c.indexQueryTerm(term)
+		if ok == false {
+			complete = false
+			continue
+		}
+		complete = complete && exact
+		found := map[string]bool{}
+		for _, key := range keys {
+			if matched == nil || matched[key] {
+				found[key] = true
+			}
+		}
+		matched = found
+	}
+	return matched, complete && matched != nil
+}
+
+// KeyQuery returns the keys in keyList of the objects matching a
+// compiled query
+func (c *Collection) KeyQuery(keyList []string, q *Query) ([]string, error) {
+	candidates := []string{}
+	for _, key := range keyList {
+		key = strings.TrimSpace(key)
+		if len(key) > 0 {
+			candidates = append(candidates, key)
+		}
+	}
+	// Answer what we can from the indexes before reading objects
+	if matched, complete := c.indexQuery(q); matched != nil {
+		indexed := []string{}
+		for _, key := range candidates {
+			if matched[key] {
+				indexed = append(indexed, key)
+			}
+		}
+		if complete {
+			return indexed, nil
+		}
+		candidates = indexed
+	}
+	keys := []string{}
+	err := c.parallelObjects(context.Background(), candidates, func(key string, m map[string]interface{}) (interface{}, error) {
+		return q.Match(m), nil
+	}, func(i int, key string, value interface{}, err error) error {
+		if ok, _ := value.(bool); err == nil && ok == true {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,259 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseQueryErrors(t *testing.T) {
+	for src, pos := range map[string]int{
+		``:                  0,
+		`.year ==`:          8,
+		`.year = 2019`:      6,
+		`(.year == 2019`:    14,
+		`.title == "Alpha`:  10,
+		`.year in [1, 2`:    14,
+		`.title =~ "("`:     10,
+		`.year 2019`:        6,
+		`any .authors .x`:   13,
+		`.a between 1 or 2`: 13,
+	} {
+		_, err := ParseQuery(src)
+		if errors.Is(err, ErrQuerySyntax) == false {
+			t.Errorf("expected ErrQuerySyntax for %q, got %v", src, err)
+			continue
+		}
+		if qErr, ok := err.(*QueryError); ok == false || qErr.Pos != pos {
+			t.Errorf("expected %q to fail at %d, got %v", src, pos, err)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	obj := map[string]interface{}{}
+	src := []byte(`{
+		"title": "Climate and Coasts",
+		"year": 2019,
+		"published": true,
+		"updated": "2019-07-04T12:00:00-07:00",
+		"keywords": ["climate", "coast"],
+		"scores": [3, 12],
+		"notes": null,
+		"authors": [
+			{"family": "Doe", "given": "Jane", "orcid": "0001"},
+			{"family": "Smith", "given": "Sam"}
+		]
+	}`)
+	if err := DecodeJSON(src, &obj); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for src, expected := range map[string]bool{
+		`.year == 2019`:                        true,
+		`.year == 2019.0`:                      true,
+		`.year == "2019"`:                      false,
+		`.year != 2019`:                        false,
+		`.year > 2000 and .year <= 2019`:       true,
+		`2000 < .year`:                         true,
+		`.title < "D"`:                         true,
+		`.published`:                           true,
+		`.published == false or .year == 2019`: true,
+		`not .published`:                       false,
+		`not (.year == 2019 and .published)`:   false,
+		`.notes == null`:                       true,
+		`.missing == null`:                     true,
+		`.missing != 1`:                        true,
+		`exists .notes`:                        true,
+		`exists .missing`:                      false,
+		`exists .authors[0].orcid`:             true,
+		`.year in [2018, 2019]`:                true,
+		`.year not in [2018, 2019]`:            false,
+		`.year in []`:                          false,
+		`.keywords in ["coast", "sea"]`:        true,
+		`.keywords contains "coast"`:           true,
+		`.title contains "and Coasts"`:         true,
+		`.title contains "sea"`:                false,
+		`.keywords == "climate"`:               true,
+		`.title =~ "^Climate"`:                 true,
+		`.title !~ "^Climate"`:                 false,
+		`.keywords =~ "^coa"`:                  true,
+		`.year between 2010 and 2019`:          true,
+		`.scores between 5 and 10`:             false,
+		`.scores > 5 and .scores < 10`:         true,
+		`.updated > "2019-07-04T15:00:00Z"`:    true,
+		`.updated < "2019-07-05"`:              true,
+		`any .authors (.family == "Smith")`:    true,
+		`any .authors (.family == "Roe")`:      false,
+		`all .authors (exists .given)`:         true,
+		`all .authors (exists .orcid)`:         false,
+		`any .keywords (. == "coast")`:         true,
+		`all .scores (. > 1)`:                  true,
+		`all .missing (. > 1)`:                 false,
+		`any .authors (.family == "Doe" and exists .orcid) and .year >= 2019`: true,
+		`jmes:authors[?family=='Doe'].orcid == "0001"`:                        true,
+		`jmes:length(keywords) > 1`:                                           true,
+		`exists jmes:authors[1].orcid`:                                        false,
+		`any jmes:authors[?given] (.family == "Smith")`:                       true,
+	} {
+		q, err := ParseQuery(src)
+		if err != nil {
+			t.Errorf("%s", err)
+			continue
+		}
+		if result := q.Match(obj); result != expected {
+			t.Errorf("expected %s to be %t, got %t", src, expected, result)
+		}
+		if q.String() != src {
+			t.Errorf("expected String() %q, got %q", src, q.String())
+		}
+	}
+}
+
+func TestKeyQuery(t *testing.T) {
+	cName := path.Join("testdata", "query_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+	for key, src := range map[string]string{
+		"a": `{"title": "Alpha", "year": 2001, "tags": ["x"]}`,
+		"b": `{"title": "Beta", "year": 2020, "tags": ["y", "z"]}`,
+		"c": `{"title": "Gamma", "year": 2010, "tags": []}`,
+		"d": `{"title": "Alpha Two", "year": "2005"}`,
+	} {
+		if err := c.CreateJSON(key, []byte(src)); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	all := []string{"a", "b", "c", "d"}
+	expectKeys := func(label string, expected string, keys []string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s, %s", label, err)
+		} else if s := strings.Join(keys, ","); s != expected {
+			t.Errorf("%s, expected %q, got %q", label, expected, s)
+		}
+	}
+	cases := map[string]string{
+		`.year >= 2005`:                     "b,c",
+		`.year in [2001, 2020]`:             "a,b",
+		`.year between 2000 and 2010`:       "a,c",
+		`.title =~ "^Alpha"`:                "a,d",
+		`.tags contains "z"`:                "b",
+		`.title == "Alpha" or .year > 2015`: "a,b",
+	}
+	for expr, expected := range cases {
+		keys, err := c.KeyFilter(all, expr)
+		expectKeys(expr, expected, keys, err)
+	}
+	if _, err := c.KeyFilter(all, `.year >`); errors.Is(err, ErrQuerySyntax) == false {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+
+	// Indexes answer comparisons with literals
+	if err := c.IndexCreate(".year"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for expr, complete := range map[string]bool{
+		`.year >= 2005`:                  true,
+		`2005 <= .year`:                  true,
+		`.year in [2001, 2020]`:          true,
+		`.year == "2005"`:                false,
+		`.year between 2000 and 2010`:    false,
+		`.year > 2000 and .title != "B"`: false,
+	} {
+		q, err := ParseQuery(expr)
+		if err != nil {
+			t.Errorf("%s", err)
+			continue
+		}
+		matched, ok := c.indexQuery(q)
+		if matched == nil || ok != complete {
+			t.Errorf("expected %s answered from index (complete %t), got %v, %t", expr, complete, matched, ok)
+		}
+	}
+	for expr, expected := range cases {
+		keys, err := c.KeyFilter(all, expr)
+		expectKeys(expr+" with index", expected, keys, err)
+	}
+	keys, err := c.KeyFilter(all, `.year == "2005"`)
+	expectKeys("string year with index", "d", keys, err)
+
+	// Dates are compared as dates with or without an index
+	for key, src := range map[string]string{
+		"e": `{"d": "2019-12-01T00:00:00Z"}`,
+		"f": `{"d": "2019-11-30"}`,
+	} {
+		if err := c.CreateJSON(key, []byte(src)); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	dates := []string{"e", "f"}
+	dateCases := map[string]string{
+		`.d <= "2019-12-01"`:                       "e,f",
+		`.d > "2019-11-30T12:00:00Z"`:              "e",
+		`.d between "2019-11-30" and "2019-12-01"`: "e,f",
+	}
+	for expr, expected := range dateCases {
+		keys, err := c.KeyFilter(dates, expr)
+		expectKeys(expr, expected, keys, err)
+	}
+	if err := c.IndexCreate(".d"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for expr, expected := range dateCases {
+		keys, err := c.KeyFilter(dates, expr)
+		expectKeys(expr+" with index", expected, keys, err)
+	}
+
+	// Only one level of array is matched with or without an index
+	if err := c.CreateJSON("g", []byte(`{"n": [[1, 2], 3]}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	nested := []string{"g"}
+	nestedCases := map[string]string{
+		`.n == 1`: "",
+		`.n == 3`: "g",
+	}
+	for expr, expected := range nestedCases {
+		keys, err := c.KeyFilter(nested, expr)
+		expectKeys(expr, expected, keys, err)
+	}
+	if err := c.IndexCreate(".n"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for expr, expected := range nestedCases {
+		keys, err := c.KeyFilter(nested, expr)
+		expectKeys(expr+" with index", expected, keys, err)
+	}
+}
@@ -1,4 +1,3 @@
-//
 // Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
 //
 // Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
@@ -15,10 +14,10 @@
 // 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
 //
 // THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
-//
 package dataset
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -34,11 +33,14 @@ import (
 	"github.com/caltechlibrary/storage"
 )
 
-//
 // analyzer checks the collection version and either calls
 // bucketAnalyzer or pairtreeAnalyzer as appropriate.
-//
 func analyzer(collectionName string, verbose bool) error {
+	return analyzerContext(context.Background(), collectionName, verbose, nil)
+}
+
+// analyzerContext is analyzer with a context and progress callback
+func analyzerContext(ctx context.Context, collectionName string, verbose bool, progress ProgressFunc) error {
 	var (
 		eCnt int
 		wCnt int
@@ -115,10 +117,30 @@ func analyzer(collectionName string, verbose bool) error {
 		return err
 	}
 
+	// NOTE: An interrupted transaction leaves a journal behind
+	if c.hasJournal() {
+		repairLog(verbose, "WARNING: incomplete transaction journal %s, run repair", c.journalPath())
+		wCnt++
+	}
+
+	// NOTE: Collections from before the key index keep their keys in collection.json
+	if c.keyIndex.migrate {
+		repairLog(verbose, "WARNING: keys stored in collection.json, run repair to migrate to %s", keyIndexName)
+		wCnt++
+	}
+
 	// Set layout to PAIRTREE_LAYOUT
 	// Make sure we have all the known pairs in the pairtree
 	// Check to see if records can be found in their buckets
-	for k, v := range c.KeyMap {
+	keyMap, err := c.keyIndex.all()
+	if err != nil {
+		repairLog(verbose, "ERROR: %s", err)
+		eCnt++
+	}
+	for k, v := range keyMap {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		dirPath := path.Join(collectionPath, v)
 		// NOTE: k needs to be urlencoded before checking for file
 		fname := url.QueryEscape(k) + ".json"
@@ -131,23 +153,24 @@ func analyzer(collectionName string, verbose bool) error {
 			eCnt++
 		}
 		kCnt++
+		progress.report("check", kCnt, len(keyMap))
 		if (kCnt % 5000) == 0 {
-			repairLog(verbose, "%d of %d keys checked", kCnt, len(c.KeyMap))
+			repairLog(verbose, "%d of %d keys checked", kCnt, len(keyMap))
 		}
 	}
-	if len(c.KeyMap) > 0 {
-		repairLog(verbose, "%d of %d keys checked", kCnt, len(c.KeyMap))
+	if len(keyMap) > 0 {
+		repairLog(verbose, "%d of %d keys checked", kCnt, len(keyMap))
 	}
 
-	// Check sub-directories in pairtree find but not in KeyMap
+	// Check sub-directories in pairtree find but not in key index
 	pairs, err := walkPairtree(c.Store, c.Store.Join(collectionName, "pairtree"))
-	if err != nil && len(c.KeyMap) > 0 {
+	if err != nil && len(keyMap) > 0 {
 		repairLog(verbose, "ERROR: unable to walk pairtree, %s", err)
 		eCnt++
 	} else {
 		for _, pair := range pairs {
 			key := pairtree.Decode(pair)
-			if _, exists := c.KeyMap[key]; exists == false {
+			if _, exists := keyMap[key]; exists == false {
 				repairLog(verbose, "WARNING: %s found at %q not in collection", key, path.Join(collectionName, "pairtree", pair, key+".json"))
 				wCnt++
 			}
@@ -161,11 +184,15 @@ func analyzer(collectionName string, verbose bool) error {
 	return nil
 }
 
-//
 // repair takes a collection name and calls
 // walks the pairtree and repairs collections.json as appropriate.
-//
 func repair(collectionName string, verbose bool) error {
+	return repairContext(context.Background(), collectionName, verbose, nil)
+}
+
+// repairContext is repair with a context and progress callback. If
+// ctx is done before the repair finishes nothing is saved.
+func repairContext(ctx context.Context, collectionName string, verbose bool, progress ProgressFunc) error {
 	var (
 		c   *Collection
 		err error
@@ -194,6 +221,12 @@ func repair(collectionName string, verbose bool) error {
 	}
 	defer c.Close()
 
+	// Finish or discard any interrupted transaction before walking the pairtree
+	if err := c.recoverJournal(verbose); err != nil {
+		repairLog(verbose, "ERROR: %s", err)
+		return err
+	}
+
 	if c.DatasetVersion != Version {
 		repairLog(verbose, "Migrating format from %s to %s", c.DatasetVersion, Version)
 	}
@@ -205,20 +238,26 @@ func repair(collectionName string, verbose bool) error {
 		return err
 	}
 	repairLog(verbose, "Adding missing pairs")
-	if c.KeyMap == nil {
-		c.KeyMap = map[string]string{}
+	keyMap, err := c.keyIndex.all()
+	if err != nil {
+		repairLog(verbose, "WARNING: %s, rebuilding it from the pairtree", err)
+		keyMap = c.keyIndex.reset()
 	}
 	for _, pair := range pairs {
 		key := pairtree.Decode(pair)
-		if _, exists := c.KeyMap[key]; exists == false {
-			c.KeyMap[key] = path.Join("pairtree", pair)
+		if _, exists := keyMap[key]; exists == false {
+			keyMap[key] = path.Join("pairtree", pair)
 		}
 	}
-	repairLog(verbose, "%d keys in pairtree", len(c.KeyMap))
+	repairLog(verbose, "%d keys in pairtree", len(keyMap))
 	keyList := c.Keys()
 	repairLog(verbose, "checking that each key resolves to a value on disc")
 	missingList := []string{}
-	for _, key := range keyList {
+	for i, key := range keyList {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress.report("repair", i+1, len(keyList))
 		p, err := c.DocPath(key)
 		if err != nil {
 			break
@@ -230,13 +269,16 @@ func repair(collectionName string, verbose bool) error {
 			repairLog(verbose, "Missing %s from %s, %s does not exist", key, collectionName, p)
 			// We save the key to re-attach later...
 			missingList = append(missingList, key)
-			delete(c.KeyMap, key)
+			delete(keyMap, key)
 		}
 	}
 	if len(missingList) > 0 {
 		sort.Strings(missingList)
 		repairLog(verbose, "Trying to locate %d un-associated keys", len(missingList))
 		err = filepath.Walk(c.Store.Join(collectionName, "pairtree"), func(fPath string, info os.FileInfo, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if info.IsDir() == false {
 				if key, err := url.QueryUnescape(strings.TrimSuffix(info.Name(), ".json")); err == nil {
 					// Search our list of keys to see if we can fix path issue...
@@ -247,7 +289,7 @@ func repair(collectionName string, verbose bool) error {
 							// trim leading separator ...
 							kPath = kPath[1:]
 							repairLog(verbose, "Fixing path for key %q", key)
-							c.KeyMap[key] = kPath
+							keyMap[key] = kPath
 							// Now remove key from missingList
 							missingList = append(missingList[:i], missingList[i+1:]...)
 							continue
@@ -264,6 +306,25 @@ func repair(collectionName string, verbose bool) error {
 			repairLog(verbose, "Unable to find the following keys - %s", strings.Join(missingList, ", "))
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	repairLog(verbose, "Saving key index for %s", collectionName)
+	if err := c.keyIndex.save(); err != nil {
+		repairLog(verbose, "ERROR: %s", err)
+		return err
+	}
+	for _, dotPath := range c.Indexes() {
+		repairLog(verbose, "Rebuilding index %s", dotPath)
+		if err := c.IndexRebuild(dotPath); err != nil {
+			repairLog(verbose, "ERROR: %s", err)
+			return err
+		}
+	}
 	repairLog(verbose, "Saving metadata for %s", collectionName)
 	if c.When == "" {
 		c.When = time.Now().Format("2006-01-02")
@@ -0,0 +1,160 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+//
+// NOTE: schema.go attaches an optional JSON Schema to a collection.
+// The schema is kept in schema.json next to collection.json. When
+// present every object written by CreateJSON and UpdateJSON (and so
+// Create, Update, Join, ImportCSV, ImportTable and MergeFromTable)
+// must validate. The _Key and _Attachments attributes are managed
+// by dataset and are not validated.
+//
+
+const (
+	// schemaName is the file holding a collection's JSON Schema
+	schemaName = "schema.json"
+)
+
+// schemaPath returns the path to the collection's schema
+func (c *Collection) schemaPath() string {
+	return path.Join(c.workPath, schemaName)
+}
+
+// loadSchema reads the collection's schema if it hasn't been read
+func (c *Collection) loadSchema() (*jsonSchema, error) {
+	if c.schemaLoaded {
+		return c.schema, nil
+	}
+	c.schema = nil
+	if c.Store.IsFile(c.schemaPath()) {
+		src, err := c.Store.ReadFile(c.schemaPath())
+		if err != nil {
+			return nil, err
+		}
+		s, err := parseSchema(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %s", c.schemaPath(), err)
+		}
+		c.schema = s
+	}
+	c.schemaLoaded = true
+	return c.schema, nil
+}
+
+// HasSchema returns true if the collection has a JSON Schema
+func (c *Collection) HasSchema() bool {
+	return c.Store.IsFile(c.schemaPath())
+}
+
+// Schema returns the collection's JSON Schema source
+func (c *Collection) Schema() ([]byte, error) {
+	if c.HasSchema() == false {
+		return nil, fmt.Errorf("no schema defined for %s", c.Name)
+	}
+	return c.Store.ReadFile(c.schemaPath())
+}
+
+// SetSchema sets the JSON Schema objects in the collection must
+// validate against. Existing objects are not checked, use Validate().
+func (c *Collection) SetSchema(src []byte) error {
+	s, err := parseSchema(src)
+	if err != nil {
+		return err
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if err := c.Store.WriteFile(c.schemaPath(), src, 0664); err != nil {
+		return err
+	}
+	c.schema = s
+	c.schemaLoaded = true
+	return nil
+}
+
+// RemoveSchema removes the collection's JSON Schema
+func (c *Collection) RemoveSchema() error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if c.HasSchema() {
+		if err := c.Store.Remove(c.schemaPath()); err != nil {
+			return err
+		}
+	}
+	c.schema = nil
+	c.schemaLoaded = true
+	return nil
+}
+
+// validateJSON checks JSON source against the collection's schema
+// returning a *ValidationError listing each failing field.
+func (c *Collection) validateJSON(key string, src []byte) error {
+	s, err := c.loadSchema()
+	if err != nil || s == nil {
+		return err
+	}
+	obj := map[string]interface{}{}
+	if err := decodeJSON(src, &obj); err != nil {
+		return err
+	}
+	delete(obj, "_Key")
+	delete(obj, "_Attachments")
+	if errs := s.Validate(obj); len(errs) > 0 {
+		return &ValidationError{Key: key, Errors: errs}
+	}
+	return nil
+}
+
+// Validate checks the objects for keys against the collection's
+// schema. If no keys are provided all objects are checked. The
+// objects that fail are returned sorted by key.
+func (c *Collection) Validate(keys []string) ([]*ValidationError, error) {
+	if c.HasSchema() == false {
+		return nil, fmt.Errorf("no schema defined for %s", c.Name)
+	}
+	if len(keys) == 0 {
+		keys = c.Keys()
+	}
+	sort.Strings(keys)
+	failed := []*ValidationError{}
+	for _, key := range keys {
+		src, err := c.ReadJSON(key)
+		if err != nil {
+			return failed, fmt.Errorf("%s, %s", key, err)
+		}
+		if err := c.validateJSON(key, src); err != nil {
+			if vErr, ok := err.(*ValidationError); ok {
+				failed = append(failed, vErr)
+				continue
+			}
+			return failed, fmt.Errorf("%s, %s", key, err)
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,174 @@
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package dataset
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s, err := parseSchema([]byte(`{
+	"definitions": {
+		"name": { "type": "string", "minLength": 1 }
+	},
+	"type": "object",
+	"required": [ "title", "year" ],
+	"properties": {
+		"title": { "$ref": "#/definitions/name" },
+		"year": { "type": "integer", "minimum": 1900, "maximum": 2100 },
+		"doi": { "type": "string", "pattern": "^10\\." },
+		"status": { "enum": [ "draft", "published" ] },
+		"updated": { "type": "string", "format": "date" },
+		"authors": {
+			"type": "array",
+			"minItems": 1,
+			"uniqueItems": true,
+			"items": { "type": "object", "required": [ "family" ] }
+		},
+		"price": { "type": [ "number", "null" ], "exclusiveMinimum": 0 }
+	},
+	"additionalProperties": false
+}`))
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	obj := map[string]interface{}{}
+	if err := decodeJSON([]byte(`{"title":"Hello","year":2019,"doi":"10.1/x","status":"draft","updated":"2019-10-02","authors":[{"family":"Doe"}],"price":null}`), &obj); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if errs := s.Validate(obj); len(errs) != 0 {
+		t.Errorf("expected valid object, got %+v", errs)
+	}
+
+	obj = map[string]interface{}{}
+	decodeJSON([]byte(`{"title":"","year":1850.5,"doi":"11.1/x","status":"lost","updated":"Oct 2","authors":[{"given":"Jane"},{"given":"Jane"}],"price":0,"extra":true}`), &obj)
+	expected := map[string]bool{
+		".title":             false,
+		".year":              false,
+		".doi":               false,
+		".status":            false,
+		".updated":           false,
+		".authors":           false,
+		".authors[0].family": false,
+		".authors[1].family": false,
+		".price":             false,
+		".extra":             false,
+	}
+	for _, fe := range s.Validate(obj) {
+		if _, ok := expected[fe.Path]; ok == false {
+			t.Errorf("unexpected error %s", fe)
+		}
+		expected[fe.Path] = true
+	}
+	for p, found := range expected {
+		if found == false {
+			t.Errorf("expected an error for %s", p)
+		}
+	}
+
+	obj = map[string]interface{}{}
+	decodeJSON([]byte(`{"title":"Hello"}`), &obj)
+	errs := s.Validate(obj)
+	if len(errs) != 1 || errs[0].Path != ".year" || errs[0].Message != "is required" {
+		t.Errorf("expected .year is required, got %+v", errs)
+	}
+
+	if _, err := parseSchema([]byte(`{"properties":{"a":{"$ref":"#/definitions/missing"}}}`)); err == nil {
+		t.Errorf("expected an error for an unresolved $ref")
+	}
+	if _, err := parseSchema([]byte(`{"pattern":"("}`)); err == nil {
+		t.Errorf("expected an error for a bad pattern")
+	}
+}
+
+func TestCollectionSchema(t *testing.T) {
+	cName := path.Join("testdata", "schema_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	// Objects written before the schema
+	if err := c.Create("old", map[string]interface{}{"name": 1}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.SetSchema([]byte(`{"type":"object"`)); err == nil {
+		t.Errorf("expected an error setting invalid schema")
+	}
+	schema := `{"type":"object","required":["name"],"properties":{"name":{"type":"string"},"age":{"type":"integer"}},"additionalProperties":false}`
+	if err := c.SetSchema([]byte(schema)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if src, err := c.Schema(); err != nil || string(src) != schema {
+		t.Errorf("expected schema back, got %s, %v", src, err)
+	}
+
+	if err := c.Create("one", map[string]interface{}{"name": "one", "age": 1}); err != nil {
+		t.Errorf("expected valid object, %s", err)
+	}
+	err = c.Create("two", map[string]interface{}{"age": "two"})
+	if err == nil {
+		t.Errorf("expected a validation error")
+	} else if vErr, ok := err.(*ValidationError); ok == false {
+		t.Errorf("expected *ValidationError, got %T %s", err, err)
+	} else if len(vErr.Errors) != 2 {
+		t.Errorf("expected 2 field errors, got %s", err)
+	}
+	if c.KeyExists("two") {
+		t.Errorf("invalid object should not be created")
+	}
+	if err := c.Update("one", map[string]interface{}{"name": 1}); err == nil {
+		t.Errorf("expected update to be validated")
+	}
+	if err := c.Join("one", map[string]interface{}{"color": "red"}, false); err == nil {
+		t.Errorf("expected join to be validated")
+	}
+	// Attachments are managed by dataset and not validated
+	if err := c.AttachStream("one", "", "a.txt", strings.NewReader("Hello")); err != nil {
+		t.Errorf("expected attach to work with a schema, %s", err)
+	}
+	csvSrc := "id,name\n3,three\n4,\n"
+	if _, err := c.ImportCSV(strings.NewReader(csvSrc), 0, true, false, false); err == nil {
+		t.Errorf("expected import to fail validation")
+	}
+
+	failed, err := c.Validate(nil)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(failed) != 1 || failed[0].Key != "old" {
+		t.Errorf("expected old to fail validation, got %+v", failed)
+	}
+
+	if err := c.RemoveSchema(); err != nil {
+		t.Errorf("%s", err)
+	}
+	if err := c.Create("two", map[string]interface{}{"age": "two"}); err != nil {
+		t.Errorf("expected no validation without a schema, %s", err)
+	}
+}
@@ -0,0 +1,856 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: search.go provides full text search over a frame. IndexFrame
+// writes a local index directory holding the frame's labeled values
+// and an inverted index of their terms. The index is registered with
+// the frame so FrameRefresh and FrameReframe keep it current. Search
+// takes a query string in the spirit of Bleve's query string syntax,
+//
+//     term          matches term in any indexed label
+//     label:term    matches term in a label
+//     "a phrase"    matches the terms next to each other
+//     term*         matches terms starting with term
+//     +term -term   the term must (or must not) match
+//
+// and returns ranked keys with highlights and facets. Changes made by
+// live frames are queued and indexed together before the next search.
+//
+
+const (
+	// searchIndexMeta holds the search index's definition
+	searchIndexMeta = "index.json"
+	// searchIndexDocs holds the indexed values of each key
+	searchIndexDocs = "docs.json"
+	// searchIndexTerms holds the inverted index of terms
+	searchIndexTerms = "terms.json"
+	// searchIndexPending lists the keys changed by live frames since
+	// the index was written, they are indexed before the next search
+	searchIndexPending = "pending.keys"
+
+	// highlightSize is the number of characters kept either side
+	// of the first match in a highlight
+	highlightSize = 80
+)
+
+// SearchIndex is a full text index of a frame's labeled values
+type SearchIndex struct {
+	// Collection is the name of the indexed collection
+	Collection string `json:"collection"`
+	// Frame is the name of the indexed frame
+	Frame string `json:"frame"`
+	// Labels are the frame's labels that are indexed
+	Labels []string `json:"labels"`
+	// Created is when the index was first built
+	Created time.Time `json:"created"`
+	// Updated is when the index was last changed
+	Updated time.Time `json:"updated"`
+
+	// docs holds the indexed values of each key
+	docs map[string]*searchDoc
+	// terms maps a term to the keys and labels holding it and
+	// the number of times it occurs
+	terms map[string]map[string]map[string]int
+}
+
+// searchDoc holds a key's labeled values and their term counts
+type searchDoc struct {
+	Fields  map[string]interface{} `json:"fields"`
+	Lengths map[string]int         `json:"lengths"`
+}
+
+// SearchOptions controls the results of a Search
+type SearchOptions struct {
+	// Fields limits unqualified terms to these labels, all labels if empty
+	Fields []string `json:"fields,omitempty"`
+	// From is the offset of the first hit returned
+	From int `json:"from,omitempty"`
+	// Size is the maximum number of hits returned, all if zero
+	Size int `json:"size,omitempty"`
+	// Highlight adds the matching text of each label to the hits
+	Highlight bool `json:"highlight,omitempty"`
+	// Facets lists the labels to count values for over all hits
+	Facets []string `json:"facets,omitempty"`
+	// FacetSize is the maximum number of values per facet, all if zero
+	FacetSize int `json:"facet_size,omitempty"`
+}
+
+// SearchResult holds the outcome of a Search
+type SearchResult struct {
+	// Total is the number of keys matching the query
+	Total int `json:"total"`
+	// Hits are the matching keys ordered by score
+	Hits []*SearchHit `json:"hits"`
+	// Facets holds the value counts for each facet label
+	Facets map[string][]*FacetCount `json:"facets,omitempty"`
+}
+
+// SearchHit is a key matching a query
+type SearchHit struct {
+	Key        string            `json:"key"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// FacetCount is a value and the number of hits holding it
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// searchToken is a term and its position in the text
+type searchToken struct {
+	term  string
+	start int
+	end   int
+}
+
+// tokenize splits text into lower case terms of letters and digits
+func tokenize(text string) []searchToken {
+	tokens := []searchToken{}
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, searchToken{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// searchText renders a frame value as text to index
+func searchText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		parts := []string{}
+		for _, elem := range v {
+			if s := searchText(elem); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, " ")
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := []string{}
+		for _, k := range keys {
+			if s := searchText(v[k]); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// newSearchIndex returns an empty index for a frame
+func newSearchIndex(collectionName string, f *DataFrame) *SearchIndex {
+	idx := new(SearchIndex)
+	idx.Collection = collectionName
+	idx.Frame = f.Name
+	idx.Labels = append([]string{}, f.Labels...)
+	idx.Created = time.Now()
+	idx.Updated = idx.Created
+	idx.docs = map[string]*searchDoc{}
+	idx.terms = map[string]map[string]map[string]int{}
+	return idx
+}
+
+// readSearchIndex loads the index stored in indexPath
+func (c *Collection) readSearchIndex(indexPath string) (*SearchIndex, error) {
+	idx := new(SearchIndex)
+	for fName, data := range map[string]interface{}{
+		searchIndexMeta:  idx,
+		searchIndexDocs:  &idx.docs,
+		searchIndexTerms: &idx.terms,
+	} {
+		src, err := c.Store.ReadFile(path.Join(indexPath, fName))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(src, data); err != nil {
+			return nil, fmt.Errorf("%s, %s", path.Join(indexPath, fName), err)
+		}
+	}
+	if idx.docs == nil {
+		idx.docs = map[string]*searchDoc{}
+	}
+	if idx.terms == nil {
+		idx.terms = map[string]map[string]map[string]int{}
+	}
+	return idx, nil
+}
+
+// writeSearchIndex saves the index in indexPath, each file is
+// replaced whole and the index's definition is written last.
+func (c *Collection) writeSearchIndex(indexPath string, idx *SearchIndex) error {
+	if c.Store.Type == storage.FS {
+		if err := c.Store.MkdirAll(indexPath, 0775); err != nil {
+			return err
+		}
+	}
+	idx.Updated = time.Now()
+	for _, file := range []struct {
+		name string
+		data interface{}
+	}{
+		{searchIndexDocs, idx.docs},
+		{searchIndexTerms, idx.terms},
+		{searchIndexMeta, idx},
+	} {
+		src, err := json.Marshal(file.data)
+		if err != nil {
+			return err
+		}
+		if err := c.replaceFile(path.Join(indexPath, file.name), src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchIndexPath returns the path of a search index registered
+// with a frame, they are saved relative to the collection
+func (c *Collection) searchIndexPath(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return path.Join(c.workPath, p)
+}
+
+// relativeSearchIndexPath returns indexPath relative to the collection
+func (c *Collection) relativeSearchIndexPath(indexPath string) (string, error) {
+	base := c.workPath
+	if c.Store.Type == storage.FS {
+		var err error
+		if base, err = filepath.Abs(base); err != nil {
+			return "", err
+		}
+		if indexPath, err = filepath.Abs(indexPath); err != nil {
+			return "", err
+		}
+	}
+	p, err := filepath.Rel(base, indexPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(p), nil
+}
+
+// addDoc indexes the labeled values of a frame object
+func (idx *SearchIndex) addDoc(key string, obj map[string]interface{}) {
+	idx.removeDoc(key)
+	doc := &searchDoc{
+		Fields:  map[string]interface{}{},
+		Lengths: map[string]int{},
+	}
+	for _, label := range idx.Labels {
+		value, ok := obj[label]
+		if ok == false {
+			continue
+		}
+		doc.Fields[label] = value
+		tokens := tokenize(searchText(value))
+		doc.Lengths[label] = len(tokens)
+		for _, token := range tokens {
+			postings, ok := idx.terms[token.term]
+			if ok == false {
+				postings = map[string]map[string]int{}
+				idx.terms[token.term] = postings
+			}
+			if postings[key] == nil {
+				postings[key] = map[string]int{}
+			}
+			postings[key][label]++
+		}
+	}
+	idx.docs[key] = doc
+}
+
+// removeDoc drops a key from the index
+func (idx *SearchIndex) removeDoc(key string) {
+	doc, ok := idx.docs[key]
+	if ok == false {
+		return
+	}
+	for _, value := range doc.Fields {
+		for _, token := range tokenize(searchText(value)) {
+			if postings, ok := idx.terms[token.term]; ok {
+				delete(postings, key)
+				if len(postings) == 0 {
+					delete(idx.terms, token.term)
+				}
+			}
+		}
+	}
+	delete(idx.docs, key)
+}
+
+// searchClause is a single term, prefix or phrase of a query
+type searchClause struct {
+	label   string
+	terms   []string
+	prefix  bool
+	must    bool
+	mustNot bool
+}
+
+// parseSearchQuery splits a query string into clauses
+func parseSearchQuery(query string) []*searchClause {
+	clauses := []*searchClause{}
+	for i := 0; i < len(query); {
+		if query[i] == ' ' || query[i] == '\t' || query[i] == '\n' {
+			i++
+			continue
+		}
+		// Find the end of the clause, quotes may hold spaces
+		j, quoted := i, false
+		for j < len(query) && (quoted || strings.IndexByte(" \t\n", query[j]) < 0) {
+			if query[j] == '"' {
+				quoted = !quoted
+			}
+			j++
+		}
+		s := query[i:j]
+		i = j
+		clause := new(searchClause)
+		switch {
+		case strings.HasPrefix(s, "+"):
+			clause.must, s = true, s[1:]
+		case strings.HasPrefix(s, "-"):
+			clause.mustNot, s = true, s[1:]
+		}
+		if k := strings.Index(s, ":"); k > 0 && strings.HasPrefix(s, `"`) == false {
+			clause.label, s = s[:k], s[k+1:]
+		}
+		if strings.HasPrefix(s, `"`) == false && strings.HasSuffix(s, "*") {
+			clause.prefix, s = true, strings.TrimSuffix(s, "*")
+		}
+		for _, token := range tokenize(strings.Trim(s, `"`)) {
+			clause.terms = append(clause.terms, token.term)
+		}
+		if len(clause.terms) > 0 {
+			clauses = append(clauses, clause)
+		}
+	}
+	return clauses
+}
+
+// matchesTerm returns true if term matches the clause's term at position i
+func (clause *searchClause) matchesTerm(i int, term string) bool {
+	if clause.prefix && i == len(clause.terms)-1 {
+		return strings.HasPrefix(term, clause.terms[i])
+	}
+	return term == clause.terms[i]
+}
+
+// clauseLabels returns the labels a clause applies to
+func (idx *SearchIndex) clauseLabels(clause *searchClause, fields []string) map[string]bool {
+	labels := map[string]bool{}
+	switch {
+	case clause.label != "":
+		labels[clause.label] = true
+	case len(fields) > 0:
+		for _, label := range fields {
+			labels[label] = true
+		}
+	default:
+		for _, label := range idx.Labels {
+			labels[label] = true
+		}
+	}
+	return labels
+}
+
+// termPostings returns the postings of the terms matching the
+// clause's term at position i
+func (idx *SearchIndex) termPostings(clause *searchClause, i int) []map[string]map[string]int {
+	matches := []map[string]map[string]int{}
+	if clause.prefix == false || i < len(clause.terms)-1 {
+		if postings, ok := idx.terms[clause.terms[i]]; ok {
+			matches = append(matches, postings)
+		}
+		return matches
+	}
+	for term, postings := range idx.terms {
+		if clause.matchesTerm(i, term) {
+			matches = append(matches, postings)
+		}
+	}
+	return matches
+}
+
+// termScore is the tf-idf score of a term's postings in a key's label
+func (idx *SearchIndex) termScore(postings map[string]map[string]int, key string, label string) float64 {
+	tf := postings[key][label]
+	if tf == 0 {
+		return 0
+	}
+	idf := math.Log(1 + float64(len(idx.docs))/float64(len(postings)))
+	length := idx.docs[key].Lengths[label]
+	if length < 1 {
+		length = 1
+	}
+	return float64(tf) / math.Sqrt(float64(length)) * idf
+}
+
+// matchClause returns the keys matching a clause with their scores
+func (idx *SearchIndex) matchClause(clause *searchClause, fields []string) map[string]float64 {
+	labels := idx.clauseLabels(clause, fields)
+	// Score each term of the clause, a prefix scores each term it matches
+	scores := make([]map[string]float64, len(clause.terms))
+	for i := range clause.terms {
+		scores[i] = map[string]float64{}
+		for _, postings := range idx.termPostings(clause, i) {
+			for key, counts := range postings {
+				for label := range counts {
+					if labels[label] {
+						scores[i][key] += idx.termScore(postings, key, label)
+					}
+				}
+			}
+		}
+	}
+	matched := scores[0]
+	for i := 1; i < len(scores); i++ {
+		both := map[string]float64{}
+		for key, score := range matched {
+			if s, ok := scores[i][key]; ok {
+				both[key] = score + s
+			}
+		}
+		matched = both
+	}
+	if len(clause.terms) > 1 {
+		// A phrase needs its terms next to each other in a label
+		for key := range matched {
+			if idx.hasPhrase(key, clause, labels) == false {
+				delete(matched, key)
+			}
+		}
+	}
+	return matched
+}
+
+// hasPhrase checks if a key's labels hold a clause's terms in order
+func (idx *SearchIndex) hasPhrase(key string, clause *searchClause, labels map[string]bool) bool {
+	for label, value := range idx.docs[key].Fields {
+		if labels[label] == false {
+			continue
+		}
+		tokens := tokenize(searchText(value))
+		for i := 0; i+len(clause.terms) <= len(tokens); i++ {
+			found := true
+			for j := range clause.terms {
+				if clause.matchesTerm(j, tokens[i+j].term) == false {
+					found = false
+					break
+				}
+			}
+			if found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// highlight marks the query's terms in a label's text, the text is
+// trimmed to the neighborhood of the first match.
+func highlight(text string, clauses []*searchClause, label string) string {
+	tokens := tokenize(text)
+	marked := make([]bool, len(tokens))
+	first := -1
+	for i, token := range tokens {
+		for _, clause := range clauses {
+			if clause.mustNot || (clause.label != "" && clause.label != label) {
+				continue
+			}
+			for j := range clause.terms {
+				if clause.matchesTerm(j, token.term) {
+					marked[i] = true
+				}
+			}
+		}
+		if marked[i] && first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+	start, end := 0, len(text)
+	if utf8.RuneCountInString(text) > 2*highlightSize {
+		for _, token := range tokens {
+			if token.start >= tokens[first].start-highlightSize {
+				start = token.start
+				break
+			}
+		}
+		for _, token := range tokens {
+			if token.end <= tokens[first].end+highlightSize {
+				end = token.end
+			}
+		}
+	}
+	var buf strings.Builder
+	if start > 0 {
+		buf.WriteString("…")
+	}
+	pos := start
+	for i, token := range tokens {
+		if marked[i] == false || token.start < start || token.end > end {
+			continue
+		}
+		buf.WriteString(text[pos:token.start])
+		buf.WriteString("<mark>")
+		buf.WriteString(text[token.start:token.end])
+		buf.WriteString("</mark>")
+		pos = token.end
+	}
+	buf.WriteString(text[pos:end])
+	if end < len(text) {
+		buf.WriteString("…")
+	}
+	return buf.String()
+}
+
+// search runs a query against the index
+func (idx *SearchIndex) search(query string, options *SearchOptions) *SearchResult {
+	// Work on a copy so paging doesn't change the caller's options
+	opts := new(SearchOptions)
+	if options != nil {
+		*opts = *options
+	}
+	clauses := parseSearchQuery(query)
+	var (
+		required map[string]bool
+		excluded = map[string]bool{}
+		scores   = map[string]float64{}
+	)
+	for _, clause := range clauses {
+		matched := idx.matchClause(clause, opts.Fields)
+		switch {
+		case clause.mustNot:
+			for key := range matched {
+				excluded[key] = true
+			}
+			continue
+		case clause.must:
+			found := map[string]bool{}
+			for key := range matched {
+				if required == nil || required[key] {
+					found[key] = true
+				}
+			}
+			required = found
+		}
+		for key, score := range matched {
+			scores[key] += score
+		}
+	}
+	hits := []*SearchHit{}
+	for key, score := range scores {
+		if excluded[key] || (required != nil && required[key] == false) {
+			continue
+		}
+		hits = append(hits, &SearchHit{Key: key, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Key < hits[j].Key
+	})
+	result := &SearchResult{Total: len(hits)}
+	if len(opts.Facets) > 0 {
+		result.Facets = idx.facets(hits, opts.Facets, opts.FacetSize)
+	}
+	if opts.From > 0 {
+		if opts.From > len(hits) {
+			opts.From = len(hits)
+		}
+		hits = hits[opts.From:]
+	}
+	if opts.Size > 0 && opts.Size < len(hits) {
+		hits = hits[:opts.Size]
+	}
+	if opts.Highlight {
+		for _, hit := range hits {
+			hit.Highlights = map[string]string{}
+			for label, value := range idx.docs[hit.Key].Fields {
+				if s := highlight(searchText(value), clauses, label); s != "" {
+					hit.Highlights[label] = s
+				}
+			}
+		}
+	}
+	result.Hits = hits
+	return result
+}
+
+// facets counts the values of labels over the hits
+func (idx *SearchIndex) facets(hits []*SearchHit, labels []string, size int) map[string][]*FacetCount {
+	facets := map[string][]*FacetCount{}
+	for _, label := range labels {
+		counts := map[string]int{}
+		for _, hit := range hits {
+			values := []interface{}{idx.docs[hit.Key].Fields[label]}
+			if a, ok := values[0].([]interface{}); ok {
+				values = a
+			}
+			for _, value := range values {
+				if s := searchText(value); s != "" {
+					counts[s]++
+				}
+			}
+		}
+		facet := []*FacetCount{}
+		for value, count := range counts {
+			facet = append(facet, &FacetCount{Value: value, Count: count})
+		}
+		sort.Slice(facet, func(i, j int) bool {
+			if facet[i].Count != facet[j].Count {
+				return facet[i].Count > facet[j].Count
+			}
+			return facet[i].Value < facet[j].Value
+		})
+		if size > 0 && size < len(facet) {
+			facet = facet[:size]
+		}
+		facets[label] = facet
+	}
+	return facets
+}
+
+//
+// Public interface for search
+//
+
+// IndexFrame builds a full text index of a frame's labeled values
+// in the directory indexPath. The index is kept current when the
+// frame is refreshed or reframed.
+func (c *Collection) IndexFrame(frameName string, indexPath string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	f, err := c.loadFrame(frameName, true)
+	if err != nil {
+		return err
+	}
+	idx := newSearchIndex(c.Name, f)
+	for _, key := range f.Keys {
+		if obj, ok := f.ObjectMap[key].(map[string]interface{}); ok {
+			idx.addDoc(key, obj)
+		}
+	}
+	if err := c.writeSearchIndex(indexPath, idx); err != nil {
+		return err
+	}
+	if pending := path.Join(indexPath, searchIndexPending); c.Store.IsFile(pending) {
+		if err := c.Store.Remove(pending); err != nil {
+			return err
+		}
+	}
+	// Register the index relative to the collection so it is found
+	// from another directory or after the collection is moved
+	rel, err := c.relativeSearchIndexPath(indexPath)
+	if err != nil {
+		return err
+	}
+	for _, p := range f.SearchIndexes {
+		if p == rel {
+			return nil
+		}
+	}
+	f.SearchIndexes = append(f.SearchIndexes, rel)
+	return c.setFrame(frameName, f)
+}
+
+// Search runs a query against the index in indexPath returning the
+// matching keys ranked by score. opts may be nil.
+func (c *Collection) Search(indexPath string, query string, opts *SearchOptions) (*SearchResult, error) {
+	idx, err := c.readSearchIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if idx.Collection != c.Name {
+		return nil, fmt.Errorf("%s is an index of %s not %s", indexPath, idx.Collection, c.Name)
+	}
+	if c.Store.IsFile(path.Join(indexPath, searchIndexPending)) {
+		applied := false
+		err := c.withLock(func() (err error) {
+			applied, err = c.applySearchPending(indexPath, idx.Frame)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			if idx, err = c.readSearchIndex(indexPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return idx.search(query, opts), nil
+}
+
+// queueSearchIndexes adds keys to the pending keys of the frame's
+// search indexes, see applySearchPending
+func (c *Collection) queueSearchIndexes(f *DataFrame, keys []string) error {
+	src := []byte(strings.Join(keys, "\n") + "\n")
+	for _, p := range f.SearchIndexes {
+		indexPath := c.searchIndexPath(p)
+		if c.Store.IsFile(path.Join(indexPath, searchIndexMeta)) == false {
+			continue
+		}
+		if err := c.appendToFile(path.Join(indexPath, searchIndexPending), src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySearchPending indexes the keys queued for a search index of
+// a frame reading only their rows. It returns true if the index was
+// changed. The caller holds the collection's lock.
+func (c *Collection) applySearchPending(indexPath string, frameName string) (bool, error) {
+	pending := path.Join(indexPath, searchIndexPending)
+	if c.Store.IsFile(pending) == false {
+		return false, nil
+	}
+	if c.hasFrame(frameName) == false {
+		return false, c.Store.Remove(pending)
+	}
+	// NOTE: reading a deferred live frame may index the pending
+	// keys itself so they are read after the frame.
+	f, err := c.loadFrame(frameName, false)
+	if err != nil {
+		return false, err
+	}
+	if c.Store.IsFile(pending) == false {
+		return true, nil
+	}
+	src, err := c.Store.ReadFile(pending)
+	if err != nil {
+		return false, err
+	}
+	keys, seen := []string{}, map[string]bool{}
+	for _, key := range strings.Split(string(src), "\n") {
+		if key = strings.TrimSpace(key); key != "" && seen[key] == false {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	_, rowsName, _ := c.frameFiles(c.FrameMap[frameName])
+	if err := c.readFrameRows(f, rowsName, keys); err != nil {
+		return false, err
+	}
+	idx, err := c.readSearchIndex(indexPath)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if obj, ok := f.ObjectMap[key].(map[string]interface{}); ok {
+			idx.addDoc(key, obj)
+		} else {
+			idx.removeDoc(key)
+		}
+	}
+	if err := c.writeSearchIndex(indexPath, idx); err != nil {
+		return false, err
+	}
+	return true, c.Store.Remove(pending)
+}
+
+// updateSearchIndexes re-indexes keys in the frame's search indexes,
+// keys no longer in the frame are removed. If keys is nil the whole
+// frame is re-indexed. Indexes that have been removed are skipped.
+// The caller holds the collection's lock.
+func (c *Collection) updateSearchIndexes(f *DataFrame, keys []string) error {
+	for _, p := range f.SearchIndexes {
+		indexPath := c.searchIndexPath(p)
+		if c.Store.IsFile(path.Join(indexPath, searchIndexMeta)) == false {
+			continue
+		}
+		if _, err := c.applySearchPending(indexPath, f.Name); err != nil {
+			return err
+		}
+		idx, err := c.readSearchIndex(indexPath)
+		if err != nil {
+			return err
+		}
+		update := keys
+		if keys == nil || strings.Join(idx.Labels, "\n") != strings.Join(f.Labels, "\n") {
+			idx.Labels = append([]string{}, f.Labels...)
+			update = append([]string{}, f.Keys...)
+			for key := range idx.docs {
+				if _, ok := f.ObjectMap[key]; ok == false {
+					update = append(update, key)
+				}
+			}
+		}
+		for _, key := range update {
+			if obj, ok := f.ObjectMap[key].(map[string]interface{}); ok {
+				idx.addDoc(key, obj)
+			} else {
+				idx.removeDoc(key)
+			}
+		}
+		if err := c.writeSearchIndex(indexPath, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package dataset
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	cName := path.Join("testdata", "search_test.ds")
+	indexPath := path.Join("testdata", "search_test.idx")
+	os.RemoveAll(cName)
+	os.RemoveAll(indexPath)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	records := map[string]map[string]interface{}{
+		"p1": {"title": "Climate and Coasts", "authors": []interface{}{"Doe", "Smith"}, "year": 2019},
+		"p2": {"title": "Changes in the climate of the Sierra, climate models", "authors": []interface{}{"Roe"}, "year": 2020},
+		"p3": {"title": "Coastal birds", "authors": []interface{}{"Smith"}, "year": 2019},
+		"p4": {"title": "Mountain climbing", "authors": []interface{}{"Doe"}, "year": 2021},
+	}
+	keys := []string{"p1", "p2", "p3", "p4"}
+	for _, key := range keys {
+		if err := c.Create(key, records[key]); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	if _, err := c.FrameCreate("pubs", keys, []string{".title", ".authors", ".year"}, []string{"title", "author", "year"}, false); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if err := c.IndexFrame("pubs", indexPath); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	// The index is registered relative to the collection
+	if f, err := c.getFrameWithoutRows("pubs"); err != nil {
+		t.Errorf("%s", err)
+	} else if len(f.SearchIndexes) != 1 || f.SearchIndexes[0] != "../search_test.idx" {
+		t.Errorf("expected ../search_test.idx, got %+v", f.SearchIndexes)
+	}
+	if matches, _ := filepath.Glob(path.Join(indexPath, "*.tmp")); len(matches) > 0 {
+		t.Errorf("expected no temp files left in the index, got %+v", matches)
+	}
+
+	hitKeys := func(result *SearchResult) string {
+		keys := []string{}
+		for _, hit := range result.Hits {
+			keys = append(keys, hit.Key)
+		}
+		return strings.Join(keys, ",")
+	}
+	for query, expected := range map[string]string{
+		"climate":               "p2,p1",
+		"CLIMATE":               "p2,p1",
+		"climate -author:smith": "p2",
+		"+author:smith":         "p3,p1",
+		"+author:smith +coast*": "p3,p1",
+		`"climate models"`:      "p2",
+		`"models climate"`:      "",
+		"title:doe":             "",
+		"clim*":                 "p4,p2,p1",
+		"year:2021":             "p4",
+		"-climate":              "",
+		"author:doe mountain":   "p4,p1",
+		"nothing":               "",
+	} {
+		result, err := c.Search(indexPath, query, nil)
+		if err != nil {
+			t.Errorf("%q, %s", query, err)
+			continue
+		}
+		if s := hitKeys(result); s != expected {
+			t.Errorf("%q, expected %q, got %q", query, expected, s)
+		}
+	}
+
+	// Paging, highlights and facets
+	result, err := c.Search(indexPath, "climate coast*", &SearchOptions{
+		Size:      1,
+		Highlight: true,
+		Facets:    []string{"year", "author"},
+	})
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if result.Total != 3 || len(result.Hits) != 1 {
+		t.Errorf("expected 3 hits returning 1, got %d returning %d", result.Total, len(result.Hits))
+	}
+	if len(result.Hits) > 0 && result.Hits[0].Highlights["title"] != "<mark>Climate</mark> and <mark>Coasts</mark>" {
+		t.Errorf("unexpected highlight %+v", result.Hits[0].Highlights)
+	}
+	if f := result.Facets["year"]; len(f) != 2 || f[0].Value != "2019" || f[0].Count != 2 {
+		t.Errorf("unexpected year facet %+v", f)
+	}
+	if f := result.Facets["author"]; len(f) != 3 || f[0].Value != "Smith" || f[0].Count != 2 {
+		t.Errorf("unexpected author facet %+v", f)
+	}
+
+	// Refreshing the frame updates the index
+	records["p4"]["title"] = "Climate of mountains"
+	if err := c.Update("p4", records["p4"]); err != nil {
+		t.Errorf("%s", err)
+	}
+	if err := c.FrameRefresh("pubs", []string{"p4"}, false); err != nil {
+		t.Errorf("%s", err)
+	}
+	result, err = c.Search(indexPath, "mountains", nil)
+	if err != nil || hitKeys(result) != "p4" {
+		t.Errorf("expected refresh to index p4, %v", err)
+	}
+	result, err = c.Search(indexPath, "climbing", nil)
+	if err != nil || hitKeys(result) != "" {
+		t.Errorf("expected refresh to drop old terms of p4, %v", err)
+	}
+	// Reframing drops keys no longer in the frame
+	if err := c.FrameReframe("pubs", []string{"p1", "p2"}, false); err != nil {
+		t.Errorf("%s", err)
+	}
+	result, err = c.Search(indexPath, "climate", nil)
+	if err != nil || hitKeys(result) != "p2,p1" {
+		t.Errorf("expected reframe to drop p4 from index, got %q, %v", hitKeys(result), err)
+	}
+	// Paging doesn't change the caller's options
+	opts := &SearchOptions{From: 5}
+	if _, err := c.Search(indexPath, "climate", opts); err != nil || opts.From != 5 {
+		t.Errorf("expected From to stay 5, got %d, %v", opts.From, err)
+	}
+}
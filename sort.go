@@ -19,15 +19,168 @@
 package dataset
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"sort"
 	"strings"
+	"time"
 
-	// Caltech Library Packages
-	"github.com/caltechlibrary/dotpath"
+	// Unicode collation
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
 )
 
+//
+// NOTE: A sort expression is a comma separated list of dotpaths each
+// optionally prefixed with "+" (ascending, the default) or "-"
+// (descending), e.g. "-.year,+.title". Objects are ordered by the
+// first dotpath, ties by the second and so on. Values of different
+// types are ordered booleans, numbers, dates, strings then arrays and
+// objects. Objects missing a value (or holding null) are placed first
+// or last as set by SortOptions.
+//
+
+// dateLayouts are the layouts a string is tried against to compare
+// it as a date
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006-01",
+}
+
+// SortOptions controls how KeySortByExpressionWithOptions compares values
+type SortOptions struct {
+	// Locale is the language tag (e.g. "en", "sv") strings are
+	// collated by, if empty and FoldCase is false strings are
+	// compared by code point.
+	Locale string `json:"locale,omitempty"`
+	// FoldCase compares strings ignoring case
+	FoldCase bool `json:"fold_case,omitempty"`
+	// NullsFirst places objects missing a value before the others,
+	// otherwise they are placed after them.
+	NullsFirst bool `json:"nulls_first,omitempty"`
+}
+
+// sortKey is one dotpath of a sort expression
+type sortKey struct {
+	dotPath   string
+	ascending bool
+}
+
+// the kinds of sort values in the order they sort
+const (
+	sortNull = iota
+	sortBool
+	sortNumber
+	sortDate
+	sortString
+	sortOther
+)
+
+// sortValue is a value prepared for comparison
+type sortValue struct {
+	kind int
+	b    bool
+	n    *big.Float
+	t    time.Time
+	s    string
+}
+
+// parseSortExpression splits a sort expression into its sort keys
+func parseSortExpression(expr string) ([]sortKey, error) {
+	keys := []sortKey{}
+	if strings.TrimSpace(expr) == "" {
+		return keys, nil
+	}
+	for _, part := range splitFields(expr) {
+		sk := sortKey{dotPath: part, ascending: true}
+		if strings.HasPrefix(sk.dotPath, "-") {
+			sk.ascending = false
+			sk.dotPath = sk.dotPath[1:]
+		} else if strings.HasPrefix(sk.dotPath, "+") {
+			sk.dotPath = sk.dotPath[1:]
+		}
+		if sk.dotPath == "" {
+			return nil, fmt.Errorf("missing dotpath in sort expression %q", expr)
+		}
+		keys = append(keys, sk)
+	}
+	return keys, nil
+}
+
+// newSortValue prepares a value for comparison
+func newSortValue(value interface{}) sortValue {
+	switch v := value.(type) {
+	case nil:
+		return sortValue{kind: sortNull}
+	case bool:
+		return sortValue{kind: sortBool, b: v}
+	case json.Number:
+		if n, ok := new(big.Float).SetPrec(128).SetString(v.String()); ok {
+			return sortValue{kind: sortNumber, n: n}
+		}
+		return sortValue{kind: sortString, s: v.String()}
+	case float64:
+		return sortValue{kind: sortNumber, n: big.NewFloat(v)}
+	case float32:
+		return sortValue{kind: sortNumber, n: big.NewFloat(float64(v))}
+	case int:
+		return sortValue{kind: sortNumber, n: new(big.Float).SetInt64(int64(v))}
+	case int64:
+		return sortValue{kind: sortNumber, n: new(big.Float).SetInt64(v)}
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return sortValue{kind: sortDate, t: t, s: v}
+			}
+		}
+		return sortValue{kind: sortString, s: v}
+	}
+	return sortValue{kind: sortOther, s: fmt.Sprintf("%+v", value)}
+}
+
+// compareSortValues returns -1, 0 or 1 as a sorts before, with or
+// after b. Strings are collated when collator isn't nil. Nulls
+// sort before other values.
+func compareSortValues(a sortValue, b sortValue, collator *collate.Collator) int {
+	if a.kind != b.kind {
+		if a.kind < b.kind {
+			return -1
+		}
+		return 1
+	}
+	switch a.kind {
+	case sortNull:
+		return 0
+	case sortBool:
+		switch {
+		case a.b == b.b:
+			return 0
+		case b.b:
+			return -1
+		}
+		return 1
+	case sortNumber:
+		return a.n.Cmp(b.n)
+	case sortDate:
+		switch {
+		case a.t.Before(b.t):
+			return -1
+		case a.t.After(b.t):
+			return 1
+		}
+		return 0
+	}
+	if collator != nil {
+		return collator.CompareString(a.s, b.s)
+	}
+	return strings.Compare(a.s, b.s)
+}
+
 //KeyValue holds an ID string and value interface, this lets us work with numeric keys and to sort them.
 type KeyValue struct {
 	// JSON Record ID in collection
@@ -48,85 +201,125 @@ func (a KeyValues) Swap(i, j int) {
 }
 
 func (a KeyValues) Less(i, j int) bool {
-	switch a[i].Value.(type) {
-	case string:
-		return a[i].Value.(string) < a[j].Value.(string)
-	case float64:
-		return a[i].Value.(float64) < a[j].Value.(float64)
-	case int64:
-		return a[i].Value.(int64) < a[j].Value.(int64)
-	case int:
-		return a[i].Value.(int) < a[j].Value.(int)
-	case json.Number:
-		return a[i].Value.(json.Number) < a[j].Value.(json.Number)
-	default:
-		s1 := fmt.Sprintf("%+v", a[i].Value)
-		s2 := fmt.Sprintf("%+v", a[j].Value)
-		return s1 < s2
-	}
+	return compareSortValues(newSortValue(a[i].Value), newSortValue(a[j].Value), nil) < 0
 }
 
-// sortBy takes a listof record ids in a collection, performs a single field sort for a given
-// dotpath (dpath) returning a sorted list of ids.
-func (c *Collection) sortBy(ids []string, dpath string, ascending bool) ([]string, error) {
-	var (
-		t1 string
-		t2 string
-	)
-	if len(ids) == 0 || len(dpath) == 0 {
+// sortBy takes a list of record ids in a collection and sorts them by
+// the values found at each sort key's dotpath returning the sorted
+// ids. Ids of objects that can't be read are dropped.
+func (c *Collection) sortBy(ids []string, sortKeys []sortKey, opts *SortOptions) ([]string, error) {
+	if len(ids) == 0 || len(sortKeys) == 0 {
 		return ids, nil
 	}
-	// FIXME: loop through ids, collect the values from based on dotpath
-	// sort the values
-	list := []KeyValue{}
-	for _, id := range ids {
-		// Get the record for given id
-		rec := map[string]interface{}{}
-		if err := c.Read(id, rec, false); err == nil {
-			// if exist extract the value
-			if value, err := dotpath.Eval(dpath, rec); err == nil {
-				// Verify we have same type on data or return error
-				sv := KeyValue{
-					ID:    id,
-					Value: value,
-				}
-				if len(list) == 0 {
-					t1 = fmt.Sprintf("%T", sv.Value)
-				} else {
-					t2 = fmt.Sprintf("%T", sv.Value)
-					if t1 != t2 {
-						return ids, fmt.Errorf("value for %s (%s) does not match type %s", id, t2, t1)
-					}
-				} // add it to list of SortableValue
-				list = append(list, sv)
+	if opts == nil {
+		opts = new(SortOptions)
+	}
+	var collator *collate.Collator
+	if opts.Locale != "" || opts.FoldCase {
+		tag := language.Und
+		if opts.Locale != "" {
+			t, err := language.Parse(opts.Locale)
+			if err != nil {
+				return ids, fmt.Errorf("unknown locale %q, %s", opts.Locale, err)
 			}
+			tag = t
+		}
+		if opts.FoldCase {
+			collator = collate.New(tag, collate.IgnoreCase)
+		} else {
+			collator = collate.New(tag)
 		}
 	}
-	// Sort the values in list of SortableValues
-	sort.Sort(KeyValues(list))
-	// Return the id list with sorted values in either ascending or decending order
-	ids = []string{}
-	if ascending == true {
-		for _, sv := range list {
-			ids = append(ids, sv.ID)
+
+	// An index on a dotpath saves reading each record
+	indexes := make([]*dotpathIndex, len(sortKeys))
+	readObjects := false
+	for i, sk := range sortKeys {
+		if idx, err := c.getIndex(sk.dotPath); err == nil && idx.outdated() == false {
+			indexes[i] = idx
+		} else {
+			readObjects = true
+		}
+	}
+	valuesOf := func(id string, rec map[string]interface{}) []sortValue {
+		values := make([]sortValue, len(sortKeys))
+		for i, sk := range sortKeys {
+			var value interface{}
+			if indexes[i] != nil {
+				value, _ = indexes[i].get(id)
+			} else if v, err := evalPath(sk.dotPath, rec); err == nil {
+				value = v
+			}
+			values[i] = newSortValue(value)
+		}
+		return values
+	}
+
+	type sortRow struct {
+		id     string
+		values []sortValue
+	}
+	rows := []sortRow{}
+	if readObjects {
+		err := c.parallelObjects(context.Background(), ids, func(key string, obj map[string]interface{}) (interface{}, error) {
+			return valuesOf(key, obj), nil
+		}, func(i int, key string, value interface{}, err error) error {
+			if err == nil {
+				rows = append(rows, sortRow{id: key, values: value.([]sortValue)})
+			}
+			return nil
+		})
+		if err != nil {
+			return ids, err
 		}
 	} else {
-		for i := len(list) - 1; i >= 0; i-- {
-			ids = append(ids, list[i].ID)
+		for _, id := range ids {
+			if c.KeyExists(id) {
+				rows = append(rows, sortRow{id: id, values: valuesOf(id, nil)})
+			}
+		}
+	}
+
+	// Sort the rows by each key in turn, nulls are placed by policy
+	// whatever the direction
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, sk := range sortKeys {
+			a, b := rows[i].values[k], rows[j].values[k]
+			if a.kind == sortNull || b.kind == sortNull {
+				if a.kind == b.kind {
+					continue
+				}
+				return (a.kind == sortNull) == opts.NullsFirst
+			}
+			cmp := compareSortValues(a, b, collator)
+			if cmp == 0 {
+				continue
+			}
+			if sk.ascending {
+				return cmp < 0
+			}
+			return cmp > 0
 		}
+		return false
+	})
+	ids = make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.id)
 	}
 	return ids, nil
 }
 
 // KeySortByExpression takes a array of keys and a sort expression and turns a sorted list of keys.
 func (c *Collection) KeySortByExpression(keys []string, expr string) ([]string, error) {
-	ascending := true
-	if strings.HasPrefix(expr, "-") {
-		ascending = false
-		expr = expr[1:]
-	}
-	if strings.HasPrefix(expr, "+") {
-		expr = expr[1:]
+	return c.KeySortByExpressionWithOptions(keys, expr, nil)
+}
+
+// KeySortByExpressionWithOptions is KeySortByExpression using opts to
+// compare strings and place missing values. opts may be nil.
+func (c *Collection) KeySortByExpressionWithOptions(keys []string, expr string, opts *SortOptions) ([]string, error) {
+	sortKeys, err := parseSortExpression(expr)
+	if err != nil {
+		return keys, err
 	}
-	return c.sortBy(keys, expr, ascending)
+	return c.sortBy(keys, sortKeys, opts)
 }
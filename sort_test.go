@@ -0,0 +1,134 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestKeyValuesLess(t *testing.T) {
+	list := KeyValues{
+		{ID: "a", Value: json.Number("10")},
+		{ID: "b", Value: json.Number("9")},
+		{ID: "c", Value: json.Number("2.5")},
+	}
+	sort.Sort(list)
+	result := []string{}
+	for _, kv := range list {
+		result = append(result, kv.ID)
+	}
+	if strings.Join(result, ",") != "c,b,a" {
+		t.Errorf("expected numeric order c,b,a, got %s", strings.Join(result, ","))
+	}
+}
+
+func TestParseSortExpression(t *testing.T) {
+	sortKeys, err := parseSortExpression("-.year, +.title,.id")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	expected := []sortKey{{".year", false}, {".title", true}, {".id", true}}
+	if len(sortKeys) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, sortKeys)
+	}
+	for i, sk := range expected {
+		if sortKeys[i] != sk {
+			t.Errorf("expected %+v, got %+v", sk, sortKeys[i])
+		}
+	}
+	sortKeys, err = parseSortExpression("-jmes:join(',', keywords),.id")
+	if err != nil || len(sortKeys) != 2 || sortKeys[0].dotPath != "jmes:join(',', keywords)" {
+		t.Errorf("expected a JMESPath sort key holding a comma, got %+v, %v", sortKeys, err)
+	}
+	if _, err := parseSortExpression("-.year,,.title"); err == nil {
+		t.Errorf("expected an error for an empty dotpath")
+	}
+}
+
+func TestKeySortByExpression(t *testing.T) {
+	cName := path.Join("testdata", "sort_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	records := map[string]string{
+		"k1": `{"title": "zebra", "year": 9, "updated": "2019-07-04T12:00:00-07:00"}`,
+		"k2": `{"title": "apple", "year": 10, "updated": "2019-07-04T15:00:00Z"}`,
+		"k3": `{"title": "Banana", "year": 10, "updated": "2019-06"}`,
+		"k4": `{"title": "école", "year": "unknown"}`,
+		"k5": `{"title": "eclair", "year": null}`,
+		"k6": `{"title": "öl", "year": true}`,
+	}
+	keys := []string{"k1", "k2", "k3", "k4", "k5", "k6"}
+	for _, key := range keys {
+		if err := c.CreateJSON(key, []byte(records[key])); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+
+	check := func(expr string, opts *SortOptions, expected string) {
+		t.Helper()
+		result, err := c.KeySortByExpressionWithOptions(keys, expr, opts)
+		if err != nil {
+			t.Errorf("%s, %s", expr, err)
+			return
+		}
+		if strings.Join(result, ",") != expected {
+			t.Errorf("%s %+v, expected %s, got %s", expr, opts, expected, strings.Join(result, ","))
+		}
+	}
+
+	// Mixed types sort by type, numbers numerically, nulls last
+	// whatever the direction
+	check(".year", nil, "k6,k1,k2,k3,k4,k5")
+	check("-.year", nil, "k4,k2,k3,k1,k6,k5")
+	check(".year", &SortOptions{NullsFirst: true}, "k5,k6,k1,k2,k3,k4")
+
+	// Ties are broken by the next sort key
+	check("-.year,+.title", nil, "k4,k3,k2,k1,k6,k5")
+	check("-.year,-.title", nil, "k4,k2,k3,k1,k6,k5")
+
+	// Dates compare as times, a missing dotpath is a null
+	check(".updated", nil, "k3,k2,k1,k4,k5,k6")
+
+	// Strings by code point, case folded and collated
+	check(".title", nil, "k3,k2,k5,k1,k4,k6")
+	check(".title", &SortOptions{FoldCase: true}, "k2,k3,k5,k4,k6,k1")
+	check(".title", &SortOptions{Locale: "de"}, "k2,k3,k5,k4,k6,k1")
+	check(".title", &SortOptions{Locale: "sv"}, "k2,k3,k5,k4,k1,k6")
+
+	// The package level function and the original signature still work
+	result, err := KeySortByExpression(cName, keys, "+.title")
+	if err != nil {
+		t.Errorf("%s", err)
+	} else if strings.Join(result, ",") != "k3,k2,k5,k1,k4,k6" {
+		t.Errorf("unexpected sort %s", strings.Join(result, ","))
+	}
+}
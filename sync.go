@@ -7,7 +7,6 @@ import (
 
 	// Caltech Library Packages
 	"github.com/caltechlibrary/dataset/tbl"
-	"github.com/caltechlibrary/dotpath"
 )
 
 // findLabel looks through an array of string for a specific label
@@ -110,14 +109,33 @@ func dotPathToColumnMap(f *DataFrame, table [][]interface{}) (map[string]int, er
 	return colMap, nil
 }
 
-// rowToObj assembles a new JSON object from map into row and row values
-// BUG: This is a naive map assumes all root level object properties
+// rowToObj assembles a new JSON object from map into row and row values.
+// Dotpaths like ".a.b" become nested objects, paths with array
+// indexes are kept as root level property names. Computed columns and
+// JMESPath expressions have no attribute to set and are skipped.
 func rowToObj(key string, dotPathToCols map[string]int, row []interface{}) map[string]interface{} {
 	obj := map[string]interface{}{}
 	for p, i := range dotPathToCols {
+		if strings.HasPrefix(p, ".") == false || isComputedColumn(p) {
+			continue
+		}
 		if i < len(row) {
 			attrName := strings.TrimPrefix(p, ".")
-			obj[attrName] = row[i]
+			if strings.ContainsAny(attrName, "[]") {
+				obj[attrName] = row[i]
+				continue
+			}
+			parts := strings.Split(attrName, ".")
+			m := obj
+			for _, part := range parts[:len(parts)-1] {
+				child, ok := m[part].(map[string]interface{})
+				if ok == false {
+					child = map[string]interface{}{}
+					m[part] = child
+				}
+				m = child
+			}
+			m[parts[len(parts)-1]] = row[i]
 		}
 	}
 	obj["_Key"] = key
@@ -208,7 +226,7 @@ func (c *Collection) MergeIntoTable(frameName string, table [][]interface{}, ove
 				if ok == false {
 					continue
 				}
-				val, err := dotpath.Eval(p, obj)
+				val, err := evalColumn(p, obj)
 				if err == nil {
 					row[j] = val
 				}
@@ -232,7 +250,7 @@ func (c *Collection) MergeIntoTable(frameName string, table [][]interface{}, ove
 			}
 			// For each row replace cells in dotPath map to column number
 			for p, j := range colMap {
-				val, err := dotpath.Eval(p, obj)
+				val, err := evalColumn(p, obj)
 				if err == nil {
 					// Pad cells in row if necessary
 					for j >= len(row) {
@@ -247,11 +265,30 @@ func (c *Collection) MergeIntoTable(frameName string, table [][]interface{}, ove
 	return table, nil
 }
 
+// typedRow parses a table row's cells by the declared types of the
+// frame's columns, cells that can't be parsed and cells of columns
+// whose types were only inferred are left as they are
+func typedRow(f *DataFrame, dotPathToCols map[string]int, row []interface{}) []interface{} {
+	types := f.declaredColumnTypes()
+	typed := append([]interface{}{}, row...)
+	for pos, p := range f.DotPaths {
+		i, ok := dotPathToCols[p]
+		if ok == false || i >= len(typed) || types[pos] == "" {
+			continue
+		}
+		if v, err := coerceValue(typed[i], types[pos]); err == nil {
+			typed[i] = v
+		}
+	}
+	return typed
+}
+
 // MergeFromTable - uses a DataFrame associated in the collection
 // to map columns from a table into JSON object attributes saving the
 // JSON object in the collection.  If overwrite is true then JSON objects
 // for matching keys will be updated, if false only new objects will be
-// added to collection. Returns an error value
+// added to collection. Cells are parsed by the declared types of the
+// frame's columns. Returns an error value
 func (c *Collection) MergeFromTable(frameName string, table [][]interface{}, overwrite bool, verbose bool) error {
 	// Build Map dotpath to column position
 	//
@@ -261,7 +298,11 @@ func (c *Collection) MergeFromTable(frameName string, table [][]interface{}, ove
 	//    else if has ID then join (append)
 	//    else add object to collection
 	// Regenerate the frame
-	f, err := c.getFrame(frameName)
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	f, err := c.loadFrame(frameName, true)
 	if err != nil {
 		return err
 	}
@@ -285,26 +326,29 @@ func (c *Collection) MergeFromTable(frameName string, table [][]interface{}, ove
 				}
 				continue
 			}
-			obj := rowToObj(key, colMap, row)
+			obj := rowToObj(key, colMap, typedRow(f, colMap, row))
 			if c.KeyExists(key) {
 				// Update collection, and get merged object.
-				if err := c.Join(key, obj, overwrite); err != nil {
+				if err := c.join(key, obj, joinOptions(overwrite)); err != nil {
 					return err
 				}
 				err = c.Read(key, obj, false)
 			} else {
-				err = c.Create(key, obj)
+				err = c.join(key, obj, nil)
 			}
 			if err != nil {
 				return err
 			}
-			// Update f.ObjectMap
-			f.ObjectMap[key] = obj
+			// Update f.ObjectMap with the object's row
+			frameRow, _ := frameObject(key, obj, f.DotPaths, f.Labels)
+			f.coerceRow(key, frameRow, verbose)
+			f.ObjectMap[key] = frameRow
 			keys = append(keys, key)
 		}
 	}
 	// Update the frame's keys
 	f.Keys = mergeKeys(f.Keys, keys)
+	f.inferTypes()
 	// Save Frame so it can be regenerated later
 	err = c.setFrame(frameName, f)
 	return err
@@ -81,7 +81,7 @@ function test_dataset() {
 	RESULT=$(bin/dataset keys "${DATASET}" | sort | tr "\n" " ")
 	assert_equal "keys:" "$EXPECTED" "$RESULT"
 	EXPECTED="1 "
-	RESULT=$(bin/dataset keys "${DATASET}" '(eq .one 1)' | sort | tr "\n" " ")
+	RESULT=$(bin/dataset keys "${DATASET}" '.one == 1' | sort | tr "\n" " ")
 
 	if [ -f "testdata/test1.ds/collection.json" ]; then
 		rm -fR testdata/test1.ds
@@ -273,7 +273,7 @@ function test_readme () {
     fi
 
     # Get keys filtered for the name "freda"
-    bin/dataset -nl=false -quiet keys testdata/mystuff.ds '(eq .name "freda")' > /dev/null
+    bin/dataset -nl=false -quiet keys testdata/mystuff.ds '.name == "freda"' > /dev/null
     if [[ "$?" != "0" ]]; then
         echo 'test_readme (260): could not keys'
         exit 1
@@ -556,9 +556,9 @@ EOT
         echo 'test_count: (failed) testdata/count.ds count'
         exit 1
     fi
-    bin/dataset -quiet -nl=false count testdata/count.ds '(eq .published true)' > /dev/null
+    bin/dataset -quiet -nl=false count testdata/count.ds '.published == true' > /dev/null
     if [[ "$?" != "0" ]]; then
-        echo 'test_count: (failed) count testdata/count.ds "(eq .published true)"'
+        echo 'test_count: (failed) count testdata/count.ds ".published == true"'
         exit 1
     fi
 
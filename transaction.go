@@ -0,0 +1,382 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/pairtree"
+)
+
+//
+// NOTE: transaction.go provides a simple write-ahead journal so a batch of
+// creates, updates and deletes either lands completely in a collection or
+// not at all. The journal is written to the collection's root before any
+// object is touched and removed once collection.json has been saved.
+// If the process dies in between Repair() will replay the journal.
+// The collection's lock is held from checking for a journal until it
+// is removed so commits of different processes can't interleave.
+//
+
+const (
+	// journalName is the file holding an in-flight transaction
+	journalName = "_journal.json"
+)
+
+// txOp describes a single staged operation in a transaction. Prior holds
+// the object's JSON source before the operation so a failed commit can be
+// undone.
+type txOp struct {
+	Op    string          `json:"op"`
+	Key   string          `json:"key"`
+	Src   json.RawMessage `json:"src,omitempty"`
+	Prior json.RawMessage `json:"prior,omitempty"`
+
+	// revisions is the length of the object's history before the
+	// commit, undo drops the revisions added since
+	revisions int
+}
+
+// journal is the structure persisted to _journal.json
+type journal struct {
+	Created string  `json:"created"`
+	Ops     []*txOp `json:"ops"`
+}
+
+// Tx holds a list of staged object operations for a collection.
+// Nothing is written to the collection until Commit() is called.
+type Tx struct {
+	c      *Collection
+	ops    []*txOp
+	exists map[string]bool
+	closed bool
+}
+
+// Begin starts a new transaction for the collection.
+func (c *Collection) Begin() (*Tx, error) {
+	if c.hasJournal() {
+		return nil, fmt.Errorf("incomplete transaction found in %s, run repair", c.Name)
+	}
+	tx := new(Tx)
+	tx.c = c
+	tx.ops = []*txOp{}
+	tx.exists = make(map[string]bool)
+	return tx, nil
+}
+
+// keyExists checks the staged operations before falling back to
+// the collection.
+func (tx *Tx) keyExists(key string) bool {
+	key = normalizeKeyName(key)
+	if exists, staged := tx.exists[key]; staged {
+		return exists
+	}
+	return tx.c.KeyExists(key)
+}
+
+// stage validates and appends an operation to the transaction
+func (tx *Tx) stage(op string, key string, src []byte) error {
+	if tx.closed {
+		return fmt.Errorf("transaction is closed")
+	}
+	key = normalizeKeyName(key)
+	if key == "" || key == ".json" {
+		return fmt.Errorf("must not be empty")
+	}
+	switch op {
+	case "create":
+		if tx.keyExists(key) {
+			return tx.c.errKeyExists(key)
+		}
+	case "update", "delete":
+		if tx.keyExists(key) == false {
+			return tx.c.errKeyNotFound(key)
+		}
+	}
+	if op != "delete" {
+		if strings.HasPrefix(string(src), "{") == false || json.Valid(src) == false {
+			return ErrNotAnObject
+		}
+	}
+	tx.ops = append(tx.ops, &txOp{
+		Op:  op,
+		Key: key,
+		Src: src,
+	})
+	tx.exists[key] = (op != "delete")
+	return nil
+}
+
+// CreateJSON stages the creation of a JSON object
+func (tx *Tx) CreateJSON(key string, src []byte) error {
+	return tx.stage("create", key, src)
+}
+
+// Create stages the creation of an object from a map[string]interface{}
+func (tx *Tx) Create(key string, data map[string]interface{}) error {
+	src, err := EncodeJSON(data)
+	if err != nil {
+		return fmt.Errorf("%s, %s", key, err)
+	}
+	return tx.CreateJSON(key, src)
+}
+
+// UpdateJSON stages the replacement of a JSON object
+func (tx *Tx) UpdateJSON(key string, src []byte) error {
+	return tx.stage("update", key, src)
+}
+
+// Update stages the replacement of an object from a map[string]interface{}
+func (tx *Tx) Update(key string, data map[string]interface{}) error {
+	src, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Update can't marshal into JSON %s, %s", key, err)
+	}
+	return tx.UpdateJSON(key, src)
+}
+
+// Delete stages the removal of an object
+func (tx *Tx) Delete(key string) error {
+	return tx.stage("delete", key, nil)
+}
+
+// Len returns the number of staged operations
+func (tx *Tx) Len() int {
+	return len(tx.ops)
+}
+
+// Rollback discards the staged operations. The collection is untouched.
+func (tx *Tx) Rollback() error {
+	if tx.closed {
+		return fmt.Errorf("transaction is closed")
+	}
+	tx.ops = nil
+	tx.exists = nil
+	tx.closed = true
+	return nil
+}
+
+// Commit writes the journal, applies the staged operations, saves
+// collection.json and removes the journal. If an operation fails the
+// operations already applied are undone and an error is returned.
+func (tx *Tx) Commit() error {
+	if tx.closed {
+		return fmt.Errorf("transaction is closed")
+	}
+	tx.closed = true
+	c := tx.c
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if c.hasJournal() {
+		return fmt.Errorf("incomplete transaction found in %s, run repair", c.Name)
+	}
+	// Capture the prior state of each object so we can undo
+	for _, op := range tx.ops {
+		if c.KeyExists(op.Key) {
+			src, err := c.ReadJSON(op.Key)
+			if err != nil {
+				return err
+			}
+			op.Prior = src
+		}
+		if c.KeepRevisions {
+			revisions, err := c.readHistory(op.Key, c.txPairPath(op.Key))
+			if err != nil {
+				return err
+			}
+			op.revisions = len(revisions)
+		}
+	}
+	j := &journal{
+		Created: time.Now().Format(time.RFC3339),
+		Ops:     tx.ops,
+	}
+	if err := c.writeJournal(j); err != nil {
+		return err
+	}
+
+	c.unsafeSaveMetadata = true
+	for i, op := range tx.ops {
+		if err := op.apply(c); err != nil {
+			// Undo what we've done in reverse order
+			for k := i - 1; k >= 0; k-- {
+				tx.ops[k].undo(c)
+			}
+			c.unsafeSaveMetadata = false
+			if err := c.saveMetadata(); err != nil {
+				return err
+			}
+			c.removeJournal()
+			return fmt.Errorf("transaction aborted, %s %q, %s", op.Op, op.Key, err)
+		}
+	}
+	c.unsafeSaveMetadata = false
+	if err := c.saveMetadata(); err != nil {
+		// NOTE: we leave the journal in place so repair can replay it.
+		return err
+	}
+	return c.removeJournal()
+}
+
+// apply performs an operation against the collection. Operations are
+// idempotent so a journal can be replayed safely. The caller holds
+// the collection's lock.
+func (op *txOp) apply(c *Collection) error {
+	switch op.Op {
+	case "create", "update":
+		if c.KeyExists(op.Key) {
+			return c.updateJSON(op.Key, op.Src, "update")
+		}
+		return c.createJSON(op.Key, op.Src)
+	case "delete":
+		if c.KeyExists(op.Key) {
+			return c.deleteObject(op.Key)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// undo restores the object to its prior state. An object created by
+// the transaction is removed without going to the trash and the
+// revisions added by the transaction are dropped.
+func (op *txOp) undo(c *Collection) error {
+	pairPath := c.txPairPath(op.Key)
+	var err error
+	switch {
+	case op.Prior == nil:
+		if c.KeyExists(op.Key) {
+			err = c.purgeObject(op.Key)
+		}
+	case c.KeyExists(op.Key):
+		err = c.updateJSON(op.Key, op.Prior, "update")
+	case op.Op == "delete" && c.undelete(op.Key) == nil:
+		// A deleted object and its attachments are still in the trash
+	default:
+		err = c.createJSON(op.Key, op.Prior)
+	}
+	if err != nil || c.KeepRevisions == false {
+		return err
+	}
+	return c.truncateHistory(op.Key, pairPath, op.revisions)
+}
+
+// txPairPath returns the pairtree path of a key whether or not the
+// key is in the collection
+func (c *Collection) txPairPath(key string) string {
+	keyName, _ := keyAndFName(key)
+	if p, ok, err := c.keyIndex.get(keyName); err == nil && ok {
+		return p
+	}
+	return path.Join("pairtree", pairtree.Encode(key))
+}
+
+// purgeObject removes an object and its attachments for good, the
+// caller holds the collection's lock
+func (c *Collection) purgeObject(name string) error {
+	keyName, fName := keyAndFName(normalizeKeyName(name))
+	pairPath, err := c.keyPath(keyName)
+	if err != nil {
+		return err
+	}
+	docDir := path.Join(c.workPath, pairPath)
+	for _, f := range c.objectFiles(keyName, fName, pairPath) {
+		p := path.Join(docDir, f)
+		if c.Store.IsFile(p) {
+			if err := c.Store.Remove(p); err != nil {
+				return err
+			}
+		}
+		c.removeEmptyDirs(docDir, path.Dir(p))
+	}
+	if err := c.keyIndex.remove(keyName); err != nil {
+		return err
+	}
+	c.unindexObject(keyName)
+	return nil
+}
+
+// journalPath returns the path to the collection's journal
+func (c *Collection) journalPath() string {
+	return path.Join(c.workPath, journalName)
+}
+
+// hasJournal returns true if an uncommitted journal is present
+func (c *Collection) hasJournal() bool {
+	return c.Store.IsFile(c.journalPath())
+}
+
+// writeJournal saves the journal to the collection's root
+func (c *Collection) writeJournal(j *journal) error {
+	src, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("Can't marshal journal, %s", err)
+	}
+	return c.Store.WriteFile(c.journalPath(), src, 0664)
+}
+
+// removeJournal removes the journal from the collection's root
+func (c *Collection) removeJournal() error {
+	return c.Store.Remove(c.journalPath())
+}
+
+// recoverJournal replays a journal left by an interrupted commit.
+// A journal that can't be parsed was never completely written
+// so nothing was applied and it is discarded.
+func (c *Collection) recoverJournal(verbose bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if c.hasJournal() == false {
+		return nil
+	}
+	src, err := c.Store.ReadFile(c.journalPath())
+	if err != nil {
+		return err
+	}
+	j := new(journal)
+	if err := json.Unmarshal(src, &j); err != nil {
+		repairLog(verbose, "Discarding incomplete journal, %s", err)
+		return c.removeJournal()
+	}
+	repairLog(verbose, "Replaying journal from %s, %d operations", j.Created, len(j.Ops))
+	c.unsafeSaveMetadata = true
+	for _, op := range j.Ops {
+		if err := op.apply(c); err != nil {
+			c.unsafeSaveMetadata = false
+			return fmt.Errorf("journal replay failed, %s %q, %s", op.Op, op.Key, err)
+		}
+	}
+	c.unsafeSaveMetadata = false
+	if err := c.saveMetadata(); err != nil {
+		return err
+	}
+	return c.removeJournal()
+}
@@ -0,0 +1,157 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	cName := path.Join("testdata", "transaction_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	// Commit a batch
+	tx, err := c.Begin()
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	for _, key := range []string{"one", "two", "three"} {
+		if err := tx.Create(key, map[string]interface{}{"name": key}); err != nil {
+			t.Errorf("expected to stage %q, %s", key, err)
+			t.FailNow()
+		}
+	}
+	if err := tx.Create("one", map[string]interface{}{}); err == nil {
+		t.Errorf("expected an error staging duplicate key")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("expected commit, %s", err)
+		t.FailNow()
+	}
+	if c.Length() != 3 {
+		t.Errorf("expected 3 objects, got %d", c.Length())
+	}
+	if c.hasJournal() {
+		t.Errorf("expected journal to be removed after commit")
+	}
+	if err := tx.Delete("one"); err == nil {
+		t.Errorf("expected an error using a committed transaction")
+	}
+
+	// Rollback leaves the collection untouched
+	tx, _ = c.Begin()
+	tx.Create("four", map[string]interface{}{"name": "four"})
+	tx.Delete("one")
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("expected rollback, %s", err)
+	}
+	if c.KeyExists("four") || c.KeyExists("one") == false {
+		t.Errorf("expected rollback to leave collection unchanged, %+v", c.Keys())
+	}
+
+	// A failed commit removes what it created for good and drops
+	// the revisions it added
+	c.KeepRevisions = true
+	if err := c.SetSchema([]byte(`{"type": "object", "required": ["name"]}`)); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	history, _ := c.History("one")
+	tx, _ = c.Begin()
+	tx.Create("six", map[string]interface{}{"name": "six"})
+	tx.Update("one", map[string]interface{}{"name": "ONE"})
+	tx.Update("two", map[string]interface{}{"title": "no name"})
+	if err := tx.Commit(); err == nil {
+		t.Errorf("expected commit to fail validating two")
+	}
+	if c.KeyExists("six") {
+		t.Errorf("expected six to be removed by the failed commit")
+	}
+	if trash, _ := c.Trash(); len(trash) != 0 {
+		t.Errorf("expected nothing in the trash after a failed commit, got %+v", trash)
+	}
+	if c.Store.IsDir(c.historyPath("six", c.txPairPath("six"))) {
+		t.Errorf("expected no history for six")
+	}
+	if revisions, _ := c.History("one"); len(revisions) != len(history) {
+		t.Errorf("expected %d revisions for one, got %d", len(history), len(revisions))
+	}
+	obj := map[string]interface{}{}
+	if err := c.Read("one", obj, false); err != nil || obj["name"] != "one" {
+		t.Errorf("expected one to be unchanged, got %+v, %v", obj, err)
+	}
+	c.KeepRevisions = false
+	c.RemoveSchema()
+
+	// Simulate an interrupted commit, then repair replays the journal
+	tx, _ = c.Begin()
+	tx.Create("five", map[string]interface{}{"name": "five"})
+	tx.Update("two", map[string]interface{}{"name": "TWO"})
+	tx.Delete("three")
+	if err := c.writeJournal(&journal{Ops: tx.ops}); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if _, err := c.Begin(); err == nil {
+		t.Errorf("expected Begin to fail with an outstanding journal")
+	}
+	if err := analyzer(cName, false); err == nil {
+		t.Errorf("expected check to warn about journal")
+	}
+	if err := Repair(cName, false); err != nil {
+		t.Errorf("expected repair to replay journal, %s", err)
+		t.FailNow()
+	}
+	c2, err := openCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c2.Close()
+	if c2.hasJournal() {
+		t.Errorf("expected journal to be removed by repair")
+	}
+	if c2.KeyExists("five") == false || c2.KeyExists("three") {
+		t.Errorf("expected journal to be replayed, %+v", c2.Keys())
+	}
+	obj = map[string]interface{}{}
+	if err := c2.Read("two", obj, false); err != nil {
+		t.Errorf("%s", err)
+	} else if obj["name"] != "TWO" {
+		t.Errorf("expected TWO, got %+v", obj)
+	}
+
+	// A truncated journal is discarded
+	c2.Store.WriteFile(c2.journalPath(), []byte(`{"ops":[{"op":"delete","key":"one"`), 0664)
+	if err := c2.recoverJournal(false); err != nil {
+		t.Errorf("expected truncated journal to be discarded, %s", err)
+	}
+	if c2.KeyExists("one") == false || c2.hasJournal() {
+		t.Errorf("expected one to remain and journal removed")
+	}
+}
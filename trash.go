@@ -0,0 +1,299 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/storage"
+)
+
+//
+// NOTE: trash.go implements soft deletes. Delete moves an object's
+// JSON document and attachments into _trash keeping their pairtree
+// path. _trash/trash.json records what was moved and when so the
+// object can be brought back with Undelete() or removed for good
+// with EmptyTrash().
+//
+
+const (
+	// trashDir holds deleted objects
+	trashDir = "_trash"
+)
+
+// TrashEntry describes a deleted object held in the trash
+type TrashEntry struct {
+	// Key of the deleted object
+	Key string `json:"key"`
+	// Path is the object's pairtree path
+	Path string `json:"path"`
+	// Files are the moved files relative to Path
+	Files []string `json:"files"`
+	// Deleted is when the object was deleted in RFC3339 format
+	Deleted string `json:"deleted"`
+}
+
+// trashIndexPath returns the path to trash.json
+func (c *Collection) trashIndexPath() string {
+	return path.Join(c.workPath, trashDir, "trash.json")
+}
+
+// readTrash returns the trash index
+func (c *Collection) readTrash() (map[string]*TrashEntry, error) {
+	trash := map[string]*TrashEntry{}
+	fName := c.trashIndexPath()
+	if c.Store.IsFile(fName) == false {
+		return trash, nil
+	}
+	src, err := c.Store.ReadFile(fName)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(src, &trash); err != nil {
+		return nil, fmt.Errorf("Can't read %s, %s", fName, err)
+	}
+	return trash, nil
+}
+
+// writeTrash saves the trash index
+func (c *Collection) writeTrash(trash map[string]*TrashEntry) error {
+	src, err := json.MarshalIndent(trash, "", "    ")
+	if err != nil {
+		return err
+	}
+	if c.Store.Type == storage.FS {
+		if err := c.Store.MkdirAll(path.Join(c.workPath, trashDir), 0775); err != nil {
+			return err
+		}
+	}
+	return c.Store.WriteFile(c.trashIndexPath(), src, 0664)
+}
+
+// moveFile moves a file within the collection's store
+func (c *Collection) moveFile(src string, dest string) error {
+	if c.Store.Type == storage.FS {
+		if err := c.Store.MkdirAll(path.Dir(dest), 0775); err != nil {
+			return err
+		}
+		return os.Rename(src, dest)
+	}
+	buf, err := c.Store.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := c.Store.WriteFile(dest, buf, 0664); err != nil {
+		return err
+	}
+	return c.Store.Delete(src)
+}
+
+// objectFiles lists the files belonging to an object relative
+// to its pairtree path, the JSON document, a legacy tarball and
+// any attachment versions.
+func (c *Collection) objectFiles(keyName string, fName string, pairPath string) []string {
+	files := []string{fName}
+	docDir := path.Join(c.workPath, pairPath)
+	tarball := strings.TrimSuffix(fName, ".json") + ".tar"
+	if c.Store.IsFile(path.Join(docDir, tarball)) {
+		files = append(files, tarball)
+	}
+	obj := map[string]interface{}{}
+	if err := c.Read(keyName, obj, false); err != nil {
+		return files
+	}
+	attachmentList, _ := getAttachmentList(obj)
+	for _, a := range attachmentList {
+		for _, href := range a.VersionHRefs {
+			if strings.HasPrefix(href, docDir+"/") {
+				files = append(files, strings.TrimPrefix(href, docDir+"/"))
+			}
+		}
+	}
+	return files
+}
+
+// trashObject moves an object's files into the trash. If the key
+// is already in the trash the older copy is removed. The caller
+// holds the collection's lock.
+func (c *Collection) trashObject(keyName string, fName string, pairPath string) error {
+	trash, err := c.readTrash()
+	if err != nil {
+		return err
+	}
+	if old, ok := trash[keyName]; ok {
+		c.purgeTrashEntry(old)
+	}
+	entry := &TrashEntry{
+		Key:     keyName,
+		Path:    pairPath,
+		Files:   c.objectFiles(keyName, fName, pairPath),
+		Deleted: time.Now().Format(time.RFC3339),
+	}
+	docDir := path.Join(c.workPath, pairPath)
+	trashedDir := path.Join(c.workPath, trashDir, pairPath)
+	for _, f := range entry.Files {
+		if err := c.moveFile(path.Join(docDir, f), path.Join(trashedDir, f)); err != nil {
+			return fmt.Errorf("Can't move %q to trash, %s", f, err)
+		}
+		c.removeEmptyDirs(docDir, path.Dir(path.Join(docDir, f)))
+	}
+	trash[keyName] = entry
+	return c.writeTrash(trash)
+}
+
+// removeEmptyDirs removes the attachment version directories left
+// empty after moving files, stopping at docDir.
+func (c *Collection) removeEmptyDirs(docDir string, p string) {
+	if c.Store.Type != storage.FS {
+		return
+	}
+	for strings.HasPrefix(p, docDir+"/") {
+		// NOTE: os.Remove fails on a non-empty directory
+		if err := os.Remove(p); err != nil {
+			return
+		}
+		p = path.Dir(p)
+	}
+}
+
+// purgeTrashEntry removes a trashed object's files
+func (c *Collection) purgeTrashEntry(entry *TrashEntry) error {
+	trashedDir := path.Join(c.workPath, trashDir, entry.Path)
+	for _, f := range entry.Files {
+		p := path.Join(trashedDir, f)
+		if c.Store.IsFile(p) {
+			if err := c.Store.Remove(p); err != nil {
+				return err
+			}
+		}
+		c.removeEmptyDirs(trashedDir, path.Dir(p))
+	}
+	return nil
+}
+
+// Trash returns the objects in the trash sorted by key
+func (c *Collection) Trash() ([]*TrashEntry, error) {
+	trash, err := c.readTrash()
+	if err != nil {
+		return nil, err
+	}
+	entries := []*TrashEntry{}
+	for _, entry := range trash {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// Undelete brings a deleted object back from the trash. It is an
+// error if an object with the same key has been created since.
+func (c *Collection) Undelete(key string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.undelete(key)
+}
+
+// undelete brings a deleted object back from the trash, the caller
+// holds the collection's lock
+func (c *Collection) undelete(key string) error {
+	keyName, _ := keyAndFName(normalizeKeyName(key))
+	if c.KeyExists(keyName) {
+		return c.errKeyExists(keyName)
+	}
+	trash, err := c.readTrash()
+	if err != nil {
+		return err
+	}
+	entry, ok := trash[keyName]
+	if ok == false {
+		return fmt.Errorf("%w in trash, %q", ErrKeyNotFound, keyName)
+	}
+	docDir := path.Join(c.workPath, entry.Path)
+	trashedDir := path.Join(c.workPath, trashDir, entry.Path)
+	for _, f := range entry.Files {
+		if err := c.moveFile(path.Join(trashedDir, f), path.Join(docDir, f)); err != nil {
+			return fmt.Errorf("Can't restore %q from trash, %s", f, err)
+		}
+		c.removeEmptyDirs(trashedDir, path.Dir(path.Join(trashedDir, f)))
+	}
+	delete(trash, keyName)
+	if err := c.writeTrash(trash); err != nil {
+		return err
+	}
+	if err := c.keyIndex.set(keyName, entry.Path); err != nil {
+		return err
+	}
+	src, err := c.ReadJSON(keyName)
+	if err != nil {
+		return err
+	}
+	c.indexObject(keyName, src)
+	return nil
+}
+
+// EmptyTrash permanently removes objects deleted more than olderThan
+// ago, zero removes everything. The revisions of the removed objects
+// are removed as well. It returns the keys removed.
+func (c *Collection) EmptyTrash(olderThan time.Duration) ([]string, error) {
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	trash, err := c.readTrash()
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	cutoff := time.Now().Add(-olderThan)
+	for key, entry := range trash {
+		if olderThan > 0 {
+			deleted, err := time.Parse(time.RFC3339, entry.Deleted)
+			if err == nil && deleted.After(cutoff) {
+				continue
+			}
+		}
+		if err := c.purgeTrashEntry(entry); err != nil {
+			return removed, fmt.Errorf("Can't empty %q from trash, %s", key, err)
+		}
+		// NOTE: the key may have been created again since it was deleted
+		if c.KeyExists(key) == false {
+			if err := c.removeHistory(entry.Key, entry.Path); err != nil {
+				return removed, fmt.Errorf("Can't remove history for %q, %s", key, err)
+			}
+		}
+		delete(trash, key)
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+	if len(removed) == 0 {
+		return removed, nil
+	}
+	return removed, c.writeTrash(trash)
+}
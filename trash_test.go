@@ -0,0 +1,113 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	cName := path.Join("testdata", "trash_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	for _, key := range []string{"on", "one", "two"} {
+		if err := c.Create(key, map[string]interface{}{"name": key}); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	if err := c.AttachStream("on", "v0.0.1", "hello.txt", strings.NewReader("Hello World")); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	docPath, _ := c.DocPath("on")
+	attachmentPath := path.Join(path.Dir(docPath), "v0.0.1", "hello.txt")
+
+	if err := c.Delete("on"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if c.KeyExists("on") || c.Length() != 2 {
+		t.Errorf("expected on to be removed from keys, got %+v", c.Keys())
+	}
+	if _, err := os.Stat(docPath); os.IsNotExist(err) == false {
+		t.Errorf("expected %s to be moved to the trash", docPath)
+	}
+	if _, err := os.Stat(attachmentPath); os.IsNotExist(err) == false {
+		t.Errorf("expected %s to be moved to the trash", attachmentPath)
+	}
+	// Deleting "on" must leave "one" alone, they share a pairtree directory
+	if c.KeyExists("one") == false {
+		t.Errorf("expected one to still exist")
+	}
+	entries, err := c.Trash()
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(entries) != 1 || entries[0].Key != "on" || entries[0].Deleted == "" {
+		t.Errorf("expected on in trash, got %+v", entries)
+	}
+
+	if err := c.Undelete("on"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if c.KeyExists("on") == false {
+		t.Errorf("expected on after undelete")
+	}
+	if _, err := os.Stat(attachmentPath); err != nil {
+		t.Errorf("expected attachment restored, %s", err)
+	}
+	if err := c.Undelete("on"); err == nil {
+		t.Errorf("expected an error undeleting an existing key")
+	}
+	if err := c.Undelete("missing"); err == nil {
+		t.Errorf("expected an error undeleting a key not in the trash")
+	}
+
+	// EmptyTrash honors olderThan
+	if err := c.Delete("two"); err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if keys, err := c.EmptyTrash(time.Hour); err != nil || len(keys) != 0 {
+		t.Errorf("expected nothing older than an hour, got %+v, %v", keys, err)
+	}
+	keys, err := c.EmptyTrash(0)
+	if err != nil || len(keys) != 1 || keys[0] != "two" {
+		t.Errorf("expected two removed from trash, got %+v, %v", keys, err)
+	}
+	if err := c.Undelete("two"); err == nil {
+		t.Errorf("expected an error undeleting after emptying trash")
+	}
+	if entries, _ := c.Trash(); len(entries) != 0 {
+		t.Errorf("expected empty trash, got %+v", entries)
+	}
+}
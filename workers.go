@@ -0,0 +1,112 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"context"
+	"sync"
+)
+
+// Workers sets how many objects are read and evaluated at once when
+// building frames and grids or filtering keys. Values less than two
+// process one object at a time. Results are always in the order of
+// the keys requested.
+var Workers = 1
+
+// workResult holds the outcome of processing one object
+type workResult struct {
+	value interface{}
+	err   error
+}
+
+// workBatchSize is the number of objects per worker processed
+// before results are collected, it bounds the memory used.
+const workBatchSize = 16
+
+// parallelObjects reads the object for each key and passes it to
+// work, using Workers goroutines. collect is then called with each
+// result in the order of keys, a read error is passed to collect in
+// place of work's result. work may run concurrently, collect doesn't.
+// An error returned by collect or ctx being done stops processing.
+func (c *Collection) parallelObjects(ctx context.Context, keys []string, work func(key string, obj map[string]interface{}) (interface{}, error), collect func(i int, key string, value interface{}, err error) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	workers := Workers
+	if workers < 2 {
+		cur := c.NewCursor(ctx, keys)
+		defer cur.Close()
+		for cur.Next() {
+			var value interface{}
+			obj, err := cur.Object()
+			if err == nil {
+				value, err = work(cur.Key(), obj)
+			}
+			if err := collect(cur.Position(), cur.Key(), value, err); err != nil {
+				return err
+			}
+		}
+		return cur.Err()
+	}
+
+	batchSize := workers * workBatchSize
+	results := make([]workResult, batchSize)
+	for start := 0; start < len(keys); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					r := workResult{}
+					src, err := c.ReadJSON(keys[i])
+					if err == nil {
+						obj := map[string]interface{}{}
+						if err = DecodeJSON(src, &obj); err == nil {
+							r.value, err = work(keys[i], obj)
+						}
+					}
+					r.err = err
+					results[i-start] = r
+				}
+			}()
+		}
+		for i := start; i < end; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		for i := start; i < end; i++ {
+			r := results[i-start]
+			results[i-start] = workResult{}
+			if err := collect(i, keys[i], r.value, r.err); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,113 @@
+//
+// Package dataset includes the operations needed for processing collections of JSON documents and their attachments.
+//
+// Authors R. S. Doiel, <rsdoiel@library.caltech.edu> and Tom Morrel, <tmorrell@library.caltech.edu>
+//
+// Copyright (c) 2019, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package dataset
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWorkers(t *testing.T) {
+	cName := path.Join("testdata", "workers_test.ds")
+	os.RemoveAll(cName)
+	c, err := InitCollection(cName)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	defer c.Close()
+
+	keys := []string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("k%03d", i)
+		if err := c.Create(key, map[string]interface{}{"i": i, "even": (i%2 == 0)}); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+		keys = append(keys, key)
+	}
+	// Reverse the keys so order isn't the order of creation
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+
+	defer func(n int) { Workers = n }(Workers)
+	Workers = 1
+	expectedGrid, err := c.Grid(keys, []string{"._Key", ".i"}, false)
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	expectedKeys, err := c.KeyFilter(keys, ".even")
+	if err != nil {
+		t.Errorf("%s", err)
+		t.FailNow()
+	}
+	if len(expectedKeys) != 50 {
+		t.Errorf("expected 50 keys, got %d", len(expectedKeys))
+	}
+
+	for _, n := range []int{2, 4, 7} {
+		Workers = n
+		grid, err := c.Grid(keys, []string{"._Key", ".i"}, false)
+		if err != nil {
+			t.Errorf("workers %d, %s", n, err)
+			continue
+		}
+		if fmt.Sprintf("%v", grid) != fmt.Sprintf("%v", expectedGrid) {
+			t.Errorf("workers %d, grid out of order %v", n, grid)
+		}
+		filtered, err := c.KeyFilter(keys, ".even")
+		if err != nil {
+			t.Errorf("workers %d, %s", n, err)
+			continue
+		}
+		if fmt.Sprintf("%v", filtered) != fmt.Sprintf("%v", expectedKeys) {
+			t.Errorf("workers %d, expected %v, got %v", n, expectedKeys, filtered)
+		}
+		frameName := fmt.Sprintf("f%d", n)
+		f, err := c.FrameCreate(frameName, keys, []string{".i"}, []string{"i"}, false)
+		if err != nil {
+			t.Errorf("workers %d, %s", n, err)
+			continue
+		}
+		if len(f.ObjectMap) != len(keys) {
+			t.Errorf("workers %d, expected %d objects, got %d", n, len(keys), len(f.ObjectMap))
+		}
+		objs, err := c.ObjectList(keys, []string{"._Key"}, []string{"key"}, false)
+		if err != nil {
+			t.Errorf("workers %d, %s", n, err)
+			continue
+		}
+		for i, obj := range objs {
+			if obj["key"] != keys[i] {
+				t.Errorf("workers %d, expected %q at %d, got %v", n, keys[i], i, obj["key"])
+				break
+			}
+		}
+	}
+
+	// A missing key is reported by Grid
+	Workers = 4
+	if _, err := c.Grid(append(keys, "missing"), []string{".i"}, false); err == nil {
+		t.Errorf("expected an error for a missing key")
+	}
+}